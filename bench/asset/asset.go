@@ -47,7 +47,8 @@ func Initialize(ctx context.Context, dataDir, fixtureDir string) {
 				}
 				return err
 			}
-			StoreChair(chair)
+			chair.markStored()
+			storeChair(chair)
 		}
 		return nil
 	})
@@ -73,7 +74,8 @@ func Initialize(ctx context.Context, dataDir, fixtureDir string) {
 				}
 				return err
 			}
-			StoreEstate(estate)
+			estate.markStored()
+			storeEstate(estate)
 		}
 
 		return nil
@@ -112,8 +114,8 @@ func Initialize(ctx context.Context, dataDir, fixtureDir string) {
 	})
 
 	if err := eg.Wait(); err != nil {
-		err = failure.Translate(err, fails.ErrBenchmarker, failure.Message("assetの初期化に失敗しました"))
-		fails.Add(err)
+		err = failure.Translate(err, fails.ErrBenchmarker, fails.Message("ASSET_INITIALIZE", "assetの初期化に失敗しました"))
+		fails.Add(ctx, err)
 	}
 }
 
@@ -127,21 +129,66 @@ func GetChairFromID(id int64) (*Chair, error) {
 	return c, nil
 }
 
+// StoreChair 入稿するイスを保存する。CommitChair を呼ぶまでは、検索結果に含まれるかどうか決まらないものとして扱う
+// 入稿が失敗しても、アプリケーション側に保存されているかもしれないため削除しない
 func StoreChair(chair Chair) {
+	storeChair(chair)
+	notify(Change{Kind: ChangeChairStored, ID: chair.ID, Chair: &chair})
+}
+
+func storeChair(chair Chair) {
 	chairMu.Lock()
 	defer chairMu.Unlock()
 	chairMap[chair.ID] = &chair
 }
 
-func DecrementChairStock(id int64) {
+// CommitChair イスの入稿が成功したときに呼ぶ
+func CommitChair(id int64) {
+	withChair(id, (*Chair).markStored)
+	notify(Change{Kind: ChangeChairCommitted, ID: id})
+}
+
+// GetChairs 保存されているすべてのイスを返す
+func GetChairs() []*Chair {
+	chairMu.RLock()
+	defer chairMu.RUnlock()
+	chairs := make([]*Chair, 0, len(chairMap))
+	for _, c := range chairMap {
+		chairs = append(chairs, c)
+	}
+	return chairs
+}
+
+func withChair(id int64, f func(c *Chair)) {
 	chairMu.RLock()
 	defer chairMu.RUnlock()
 	c, ok := chairMap[id]
 	if ok {
-		c.DecrementStock()
+		f(c)
 	}
 }
 
+func DecrementChairStock(id int64) {
+	withChair(id, (*Chair).DecrementStock)
+	notify(Change{Kind: ChangeChairStockDecremented, ID: id})
+}
+
+func BeginChairPurchase(id int64) {
+	withChair(id, (*Chair).BeginPurchase)
+	notify(Change{Kind: ChangeChairPurchaseBegan, ID: id})
+}
+
+func EndChairPurchase(id int64) {
+	withChair(id, (*Chair).EndPurchase)
+	notify(Change{Kind: ChangeChairPurchaseEnded, ID: id})
+}
+
+// LoseChairStock 購入リクエストのレスポンスを受け取れず、アプリケーション側の在庫がわからなくなったときに呼ぶ
+func LoseChairStock(id int64) {
+	withChair(id, (*Chair).LoseStock)
+	notify(Change{Kind: ChangeChairStockLost, ID: id})
+}
+
 func GetEstateFromID(id int64) (*Estate, error) {
 	estateMu.RLock()
 	defer estateMu.RUnlock()
@@ -152,8 +199,41 @@ func GetEstateFromID(id int64) (*Estate, error) {
 	return e, nil
 }
 
+// StoreEstate 入稿する物件を保存する。CommitEstate を呼ぶまでは、検索結果に含まれるかどうか決まらないものとして扱う
+// 入稿が失敗しても、アプリケーション側に保存されているかもしれないため削除しない
 func StoreEstate(estate Estate) {
+	storeEstate(estate)
+	notify(Change{Kind: ChangeEstateStored, ID: estate.ID, Estate: &estate})
+}
+
+func storeEstate(estate Estate) {
 	estateMu.Lock()
 	defer estateMu.Unlock()
 	estateMap[estate.ID] = &estate
 }
+
+// CommitEstate 物件の入稿が成功したときに呼ぶ
+func CommitEstate(id int64) {
+	withEstate(id, (*Estate).markStored)
+	notify(Change{Kind: ChangeEstateCommitted, ID: id})
+}
+
+func withEstate(id int64, f func(e *Estate)) {
+	estateMu.RLock()
+	defer estateMu.RUnlock()
+	e, ok := estateMap[id]
+	if ok {
+		f(e)
+	}
+}
+
+// GetEstates 保存されているすべての物件を返す
+func GetEstates() []*Estate {
+	estateMu.RLock()
+	defer estateMu.RUnlock()
+	estates := make([]*Estate, 0, len(estateMap))
+	for _, e := range estateMap {
+		estates = append(estates, e)
+	}
+	return estates
+}
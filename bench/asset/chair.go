@@ -41,6 +41,12 @@ type Chair struct {
 	popularity  int64
 	stock       int64
 	soldOutTime atomic.Value
+	// purchasing 結果が確定していない購入リクエストの数
+	purchasing int64
+	// stockUnknown レスポンスを受け取れなかった購入リクエストがあり、アプリケーション側の在庫がわからない
+	stockUnknown int32
+	// storedAt 入稿が確定した時刻。入稿のレスポンスを受け取るまでは空
+	storedAt atomic.Value
 }
 
 func (c Chair) MarshalJSON() ([]byte, error) {
@@ -119,6 +125,31 @@ func (c *Chair) DecrementStock() {
 	}
 }
 
+// BeginPurchase 購入リクエストを送る前に呼ぶ。結果にかかわらず EndPurchase と対にすること
+func (c *Chair) BeginPurchase() {
+	atomic.AddInt64(&(c.purchasing), 1)
+}
+
+// EndPurchase 購入リクエストの結果が確定したときに呼ぶ
+func (c *Chair) EndPurchase() {
+	atomic.AddInt64(&(c.purchasing), -1)
+}
+
+// LoseStock 購入リクエストのレスポンスを受け取れなかったときに呼ぶ
+// アプリケーション側で在庫が減っているかわからないため、以降は売り切れている可能性があるものとして扱う
+func (c *Chair) LoseStock() {
+	atomic.StoreInt32(&(c.stockUnknown), 1)
+}
+
+// MaybeSoldOut 結果が確定していない購入によって、アプリケーション側では売り切れている可能性があるか
+// 分散実行では、他のプロセスから伝わった結果が確定していない購入も数える
+func (c *Chair) MaybeSoldOut() bool {
+	if atomic.LoadInt32(&(c.stockUnknown)) != 0 {
+		return true
+	}
+	return c.GetStock()-atomic.LoadInt64(&(c.purchasing)) <= 0
+}
+
 func (c *Chair) GetSoldOutTime() *time.Time {
 	value := c.soldOutTime.Load()
 	if value == nil {
@@ -132,6 +163,16 @@ func (c *Chair) GetSoldOutTime() *time.Time {
 	return &t
 }
 
+// StoredBefore t より前にイスの入稿が確定していたか。確定後に始まったリクエストではイスが存在しているはず
+func (c *Chair) StoredBefore(t time.Time) bool {
+	storedAt, ok := c.storedAt.Load().(time.Time)
+	return ok && storedAt.Before(t)
+}
+
+func (c *Chair) markStored() {
+	c.storedAt.Store(time.Now())
+}
+
 func (c *Chair) ToCSV() string {
 	var buf bytes.Buffer
 	w := csv.NewWriter(&buf)
@@ -61,3 +61,51 @@ func TestChair_MarshalJSON(t *testing.T) {
 		t.Errorf("unexpected chair. expected: %+v, but got: %+v", chair, got)
 	}
 }
+
+func TestChair_MaybeSoldOut(t *testing.T) {
+	c := Chair{
+		stock: 2,
+	}
+	c.BeginPurchase()
+	if c.MaybeSoldOut() {
+		t.Error("MaybeSoldOut() = true with 2 stocks and 1 purchase")
+	}
+	c.BeginPurchase()
+	if !c.MaybeSoldOut() {
+		t.Error("MaybeSoldOut() = false with 2 stocks and 2 purchases")
+	}
+	c.EndPurchase()
+	c.EndPurchase()
+
+	// レスポンスを受け取れなかった購入があれば、購入が終わっても売り切れている可能性がある
+	c.BeginPurchase()
+	c.LoseStock()
+	c.EndPurchase()
+	if !c.MaybeSoldOut() {
+		t.Error("MaybeSoldOut() = false after the stock is lost")
+	}
+}
+
+// 他のプロセスから伝わった購入は、結果が伝わるまで売り切れている可能性がある
+func Test_ApplyRemotePurchase(t *testing.T) {
+	chairMap = map[int64]*Chair{}
+	defer func() { chairMap = nil }()
+	storeChair(Chair{ID: 1, stock: 1})
+	storeChair(Chair{ID: 2, stock: 1})
+
+	Apply(Change{Kind: ChangeChairPurchaseBegan, ID: 1})
+	c1, _ := GetChairFromID(1)
+	c2, _ := GetChairFromID(2)
+	if !c1.MaybeSoldOut() {
+		t.Error("MaybeSoldOut() = false during a remote purchase")
+	}
+	if c2.MaybeSoldOut() {
+		t.Error("MaybeSoldOut() = true for a chair without purchases")
+	}
+
+	Apply(Change{Kind: ChangeChairStockDecremented, ID: 1})
+	Apply(Change{Kind: ChangeChairPurchaseEnded, ID: 1})
+	if c1.GetStock() != 0 || c1.GetSoldOutTime() == nil {
+		t.Errorf("remote purchase is not applied: stock %d", c1.GetStock())
+	}
+}
@@ -0,0 +1,71 @@
+package asset
+
+import "sync"
+
+// 分散実行で、プロセス間でベンチマーカーのメモリ上のデータを揃えるために伝える変更の種類
+const (
+	ChangeChairStored           = "chair_stored"
+	ChangeChairCommitted        = "chair_committed"
+	ChangeEstateStored          = "estate_stored"
+	ChangeEstateCommitted       = "estate_committed"
+	ChangeChairPurchaseBegan    = "chair_purchase_began"
+	ChangeChairPurchaseEnded    = "chair_purchase_ended"
+	ChangeChairStockDecremented = "chair_stock_decremented"
+	ChangeChairStockLost        = "chair_stock_lost"
+)
+
+// Change イスや物件の保存、イスの購入による変更
+type Change struct {
+	Kind   string  `json:"kind"`
+	ID     int64   `json:"id"`
+	Chair  *Chair  `json:"chair,omitempty"`
+	Estate *Estate `json:"estate,omitempty"`
+}
+
+var (
+	watcher   func(Change)
+	watcherMu sync.RWMutex
+)
+
+// Watch 以降の変更を f に渡す。nil を渡すと渡すのをやめる
+// Initialize での初期データの読み込みは、どのプロセスでも同じなので渡さない
+func Watch(f func(Change)) {
+	watcherMu.Lock()
+	defer watcherMu.Unlock()
+	watcher = f
+}
+
+func notify(c Change) {
+	watcherMu.RLock()
+	f := watcher
+	watcherMu.RUnlock()
+	if f != nil {
+		f(c)
+	}
+}
+
+// Apply 他のプロセスで起きた変更を反映する。反映した変更は Watch には渡さない
+func Apply(c Change) {
+	switch c.Kind {
+	case ChangeChairStored:
+		if c.Chair != nil {
+			storeChair(*c.Chair)
+		}
+	case ChangeChairCommitted:
+		withChair(c.ID, (*Chair).markStored)
+	case ChangeEstateStored:
+		if c.Estate != nil {
+			storeEstate(*c.Estate)
+		}
+	case ChangeEstateCommitted:
+		withEstate(c.ID, (*Estate).markStored)
+	case ChangeChairPurchaseBegan:
+		withChair(c.ID, (*Chair).BeginPurchase)
+	case ChangeChairPurchaseEnded:
+		withChair(c.ID, (*Chair).EndPurchase)
+	case ChangeChairStockDecremented:
+		withChair(c.ID, (*Chair).DecrementStock)
+	case ChangeChairStockLost:
+		withChair(c.ID, (*Chair).LoseStock)
+	}
+}
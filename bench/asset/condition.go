@@ -70,14 +70,14 @@ func loadEstateSearchCondition(fixtureDir string) error {
 
 func GetChairSearchCondition() (*ChairSearchCondition, error) {
 	if chairSearchCondition == nil {
-		return nil, failure.New(fails.ErrBenchmarker, failure.Message("イスの検索条件が読み込まれていません"))
+		return nil, failure.New(fails.ErrBenchmarker, fails.Message("CHAIR_CONDITION_NOT_LOADED", "イスの検索条件が読み込まれていません"))
 	}
 	return chairSearchCondition, nil
 }
 
 func GetEstateSearchCondition() (*EstateSearchCondition, error) {
 	if estateSearchCondition == nil {
-		return nil, failure.New(fails.ErrBenchmarker, failure.Message("物件の検索条件が読み込まれていません"))
+		return nil, failure.New(fails.ErrBenchmarker, fails.Message("ESTATE_CONDITION_NOT_LOADED", "物件の検索条件が読み込まれていません"))
 	}
 	return estateSearchCondition, nil
 }
@@ -5,6 +5,8 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 type JSONEstate struct {
@@ -36,6 +38,8 @@ type Estate struct {
 	Features    string
 
 	popularity int64
+	// storedAt 入稿が確定した時刻。入稿のレスポンスを受け取るまでは空
+	storedAt atomic.Value
 }
 
 func (e Estate) MarshalJSON() ([]byte, error) {
@@ -98,6 +102,16 @@ func (e *Estate) GetPopularity() int64 {
 	return e.popularity
 }
 
+// StoredBefore t より前に物件の入稿が確定していたか。確定後に始まったリクエストでは物件が存在しているはず
+func (e *Estate) StoredBefore(t time.Time) bool {
+	storedAt, ok := e.storedAt.Load().(time.Time)
+	return ok && storedAt.Before(t)
+}
+
+func (e *Estate) markStored() {
+	e.storedAt.Store(time.Now())
+}
+
 func (e *Estate) ToCSV() string {
 	var buf bytes.Buffer
 	w := csv.NewWriter(&buf)
@@ -76,13 +76,37 @@ func (c *Client) AccessChairDetailPage(ctx context.Context, id int64) (*asset.Ch
 	return chair, estates, nil
 }
 
-func (c *Client) AccessEstateDetailPage(ctx context.Context, id int64) (*asset.Estate, error) {
-	estate, err := c.GetEstateDetailFromID(ctx, strconv.FormatInt(id, 10))
-	if err != nil {
-		return nil, err
+func (c *Client) AccessEstateDetailPage(ctx context.Context, id int64) (*asset.Estate, *ChairsResponse, error) {
+	eg, childCtx := errgroup.WithContext(ctx)
+
+	var (
+		estate *asset.Estate
+		chairs *ChairsResponse
+	)
+
+	eg.Go(func() (err error) {
+		estate, err = c.GetEstateDetailFromID(childCtx, strconv.FormatInt(id, 10))
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	eg.Go(func() (err error) {
+		chairs, err = c.GetRecommendedChairsFromEstate(childCtx, id)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if err := eg.Wait(); err != nil {
+		return nil, nil, err
 	}
 
-	return estate, nil
+	return estate, chairs, nil
 }
 
 func (c *Client) AccessChairSearchPage(ctx context.Context) error {
@@ -1,15 +1,26 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/morikuni/failure"
 	// "github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/evidence"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
 )
 
 type Client struct {
@@ -23,6 +34,8 @@ type TargetURLs struct {
 	TargetHost string
 }
 
+const maxErrorResponseSize = 4096
+
 var (
 	ShareTargetURLs *TargetURLs
 )
@@ -118,6 +131,25 @@ func (c *Client) newPostRequest(u url.URL, spath string, body io.Reader) (*http.
 	return req, nil
 }
 
+// ErrorResponse アプリケーションがエラー時に返すレスポンスの形式
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field"`
+}
+
+type statusCodeError struct {
+	statusCode int
+	response   *ErrorResponse
+}
+
+func (e *statusCodeError) Error() string {
+	if e.response == nil {
+		return fmt.Sprintf("unexpected status code: %d", e.statusCode)
+	}
+	return fmt.Sprintf("unexpected status code: %d, code: %s, message: %s", e.statusCode, e.response.Code, e.response.Message)
+}
+
 func checkStatusCode(res *http.Response, expectedStatusCodes []int) error {
 	for _, expectedStatusCode := range expectedStatusCodes {
 		if res.StatusCode == expectedStatusCode {
@@ -125,12 +157,80 @@ func checkStatusCode(res *http.Response, expectedStatusCodes []int) error {
 		}
 	}
 
-	return failure.New(fails.ErrApplication)
+	err := &statusCodeError{statusCode: res.StatusCode}
+	var errRes ErrorResponse
+	if json.NewDecoder(io.LimitReader(res.Body, maxErrorResponseSize)).Decode(&errRes) == nil && errRes.Code != "" {
+		err.response = &errRes
+	}
+
+	return failure.Translate(err, fails.ErrApplication)
+}
+
+// withErrorCode code を付けたメッセージを付ける。アプリケーションがエラーコードを返していれば補足のメッセージとして付与する
+func withErrorCode(code, msg string, err error) failure.Wrapper {
+	var scErr *statusCodeError
+	if errors.As(err, &scErr) && scErr.response != nil {
+		return failure.WrapperFunc(func(err error) error {
+			return failure.Custom(err, fails.Message(code, msg), failure.Messagef("status: %d, code: %s", scErr.statusCode, scErr.response.Code))
+		})
+	}
+	return fails.Message(code, msg)
+}
+
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited: retry after %s", e.retryAfter)
+}
+
+// parseRetryAfter Retry-After ヘッダの値を解釈する。秒数と HTTP-date の両方に対応する
+func parseRetryAfter(v string) time.Duration {
+	if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// RetryAfterOf 429 が返ってきたことによるエラーであれば、アプリケーションが指定した待ち時間を返す
+func RetryAfterOf(err error) (time.Duration, bool) {
+	var rlErr *rateLimitedError
+	if !errors.As(err, &rlErr) {
+		return 0, false
+	}
+	return rlErr.retryAfter, true
 }
 
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	startedAt := time.Now()
+	route := metrics.RouteOf(req.Method, req.URL.Path)
+	level := score.FromContext(req.Context()).GetLevel()
+	m := metrics.FromContext(req.Context())
+	ev := evidence.FromContext(req.Context())
+	entry := evidence.Entry{Route: route, StartedAt: startedAt}
+	if ev != nil {
+		entry.Request = recordedRequest(req)
+	}
+
+	m.Begin()
 	res, err := c.httpClient.Do(req)
 	if err != nil {
+		m.End()
+		m.Record(metrics.Request{
+			Route:     route,
+			Latency:   time.Since(startedAt),
+			Level:     level,
+			StartedAt: startedAt,
+		})
+		entry.Duration = time.Since(startedAt)
+		entry.Error = err.Error()
+		ev.Record(req.Context(), entry)
 		if nerr, ok := err.(net.Error); ok {
 			if nerr.Timeout() {
 				return nil, failure.Translate(err, fails.ErrTimeout)
@@ -142,13 +242,101 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
+	statusCode, contentLength := res.StatusCode, res.ContentLength
+	var header http.Header
+	if ev != nil {
+		header = res.Header.Clone()
+	}
+	body := &measuredBody{ReadCloser: res.Body, capture: ev != nil}
+	body.onClose = func(n int64) {
+		m.End()
+		if n < contentLength {
+			n = contentLength
+		}
+		latency := time.Since(startedAt)
+		m.Record(metrics.Request{
+			Route:      route,
+			StatusCode: statusCode,
+			Latency:    latency,
+			Bytes:      n,
+			Level:      level,
+			StartedAt:  startedAt,
+		})
+		entry.Duration = latency
+		entry.Response = &evidence.Response{StatusCode: statusCode, Header: header, Body: body.head, Size: n}
+		ev.Record(req.Context(), entry)
+	}
+	res.Body = body
+
 	if !c.isBot && res.StatusCode == http.StatusServiceUnavailable {
+		res.Body.Close()
 		return nil, failure.New(fails.ErrTemporary)
 	}
 
+	if !c.isBot && res.StatusCode == http.StatusTooManyRequests {
+		res.Body.Close()
+		return nil, failure.Translate(&rateLimitedError{retryAfter: parseRetryAfter(res.Header.Get("Retry-After"))}, fails.ErrTemporary)
+	}
+
 	return res, nil
 }
 
+// recordedRequest エラーの調査のために req を複製する。ボディは GetBody で読み直す
+func recordedRequest(req *http.Request) evidence.Request {
+	header := req.Header.Clone()
+	header.Set("Host", req.Host)
+	r := evidence.Request{Method: req.Method, URL: req.URL.String(), Header: header}
+	if req.GetBody == nil {
+		return r
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return r
+	}
+	defer body.Close()
+	b, _ := ioutil.ReadAll(io.LimitReader(body, parameter.MaxEvidenceBodySize))
+	r.Body = b
+	return r
+}
+
+// addScore ボット以外のリクエストが成功したときに、エンドポイントの重みだけ加点する
+func (c *Client) addScore(ctx context.Context, route string) {
+	if c.isBot {
+		return
+	}
+	score.Add(ctx, route)
+}
+
+// measuredBody 読み込んだバイト数を数え、Close 時に計測結果を記録する
+// capture が true なら先頭の parameter.MaxEvidenceBodySize バイトを head に残す
+type measuredBody struct {
+	io.ReadCloser
+	n       int64
+	capture bool
+	head    []byte
+	once    sync.Once
+	onClose func(n int64)
+}
+
+func (b *measuredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.capture && len(b.head) < parameter.MaxEvidenceBodySize {
+		rest := parameter.MaxEvidenceBodySize - len(b.head)
+		if rest > n {
+			rest = n
+		}
+		b.head = append(b.head, p[:rest]...)
+	}
+	return n, err
+}
+
+func (b *measuredBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.onClose(b.n) })
+	return err
+}
+
 func (c *Client) GetEmail() string {
 	return fmt.Sprintf("%s@isucon.com", c.userAgent)
 }
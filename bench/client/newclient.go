@@ -3,17 +3,18 @@ package client
 import (
 	"crypto/tls"
 	"fmt"
+	"math/rand"
 	"net/http"
 
 	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
 )
 
-func NewClient(isBot bool) *Client {
+func NewClient(isBot bool, rnd *rand.Rand) *Client {
 	var userAgent string
 	if isBot {
-		userAgent = GenerateBotUserAgent()
+		userAgent = GenerateBotUserAgent(rnd)
 	} else {
-		userAgent = GenerateUserAgent()
+		userAgent = GenerateUserAgent(rnd)
 	}
 
 	return &Client{
@@ -71,9 +72,9 @@ func NewClientForVerify() *Client {
 	}
 }
 
-func NewClientForDraft() *Client {
+func NewClientForDraft(rnd *rand.Rand) *Client {
 	return &Client{
-		userAgent: GenerateUserAgent(),
+		userAgent: GenerateUserAgent(rnd),
 		isBot:     false,
 		httpClient: &http.Client{
 			Transport: &http.Transport{
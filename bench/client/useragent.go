@@ -23,33 +23,29 @@ var suffixList []string = []string{
 	"",
 }
 
-func GenerateUserAgent() string {
-	browser := browserList[rand.Intn(len(browserList))]
-	suffix := suffixList[rand.Intn(len(suffixList))]
-	var uuidStr string
-	u, err := uuid.NewRandom()
-	if err != nil {
-		uuidStr = "00000000-0000-0000-0000-000000000000"
-	} else {
-		uuidStr = u.String()
-	}
+// newUUID rnd から UUID (version 4) を作る
+func newUUID(rnd *rand.Rand) string {
+	var u uuid.UUID
+	rnd.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // variant is 10
+	return u.String()
+}
+
+func GenerateUserAgent(rnd *rand.Rand) string {
+	browser := browserList[rnd.Intn(len(browserList))]
+	suffix := suffixList[rnd.Intn(len(suffixList))]
+	uuidStr := newUUID(rnd)
 
 	return fmt.Sprintf("%v%v-%v", browser, suffix, uuidStr)
 }
 
-func GenerateBotUserAgent() string {
-	u, _ := uuid.NewRandom()
-	var uuidStr string
-	u, err := uuid.NewRandom()
-	if err != nil {
-		uuidStr = "00000000-0000-0000-0000-000000000000"
-	} else {
-		uuidStr = u.String()
-	}
+func GenerateBotUserAgent(rnd *rand.Rand) string {
+	uuidStr := newUUID(rnd)
 
-	switch rand.Intn(10) {
+	switch rnd.Intn(10) {
 	case 0:
-		switch rand.Intn(2) {
+		switch rnd.Intn(2) {
 		case 0:
 			return fmt.Sprintf("ISUCONbot-Mobile-%v", uuidStr)
 		default:
@@ -66,7 +62,7 @@ func GenerateBotUserAgent() string {
 		return fmt.Sprintf("%v-ISUCONCoffee", uuidStr)
 
 	case 4:
-		switch rand.Intn(2) {
+		switch rnd.Intn(2) {
 		case 0:
 			return fmt.Sprintf("%v-ISUCONFeedSeekerBeta", uuidStr)
 		default:
@@ -74,7 +70,7 @@ func GenerateBotUserAgent() string {
 		}
 
 	case 5:
-		switch rand.Intn(2) {
+		switch rnd.Intn(2) {
 		case 0:
 			return fmt.Sprintf("crawler (https://isucon.invalid/support/faq/) %v", uuidStr)
 		default:
@@ -88,7 +84,7 @@ func GenerateBotUserAgent() string {
 		return fmt.Sprintf("Isupider-%v", uuidStr)
 
 	case 8:
-		switch rand.Intn(2) {
+		switch rnd.Intn(2) {
 		case 0:
 			return fmt.Sprintf("Isupider-image+%v", uuidStr)
 		default:
@@ -97,7 +93,7 @@ func GenerateBotUserAgent() string {
 
 	default:
 		var main, suffix string
-		switch rand.Intn(9) {
+		switch rnd.Intn(9) {
 		case 0:
 			main = "bot"
 		case 1:
@@ -117,7 +113,7 @@ func GenerateBotUserAgent() string {
 		case 8:
 			main = "SPIDER"
 		}
-		switch rand.Intn(10) {
+		switch rnd.Intn(10) {
 		case 0:
 			suffix = fmt.Sprintf("-%v", uuidStr)
 		case 1:
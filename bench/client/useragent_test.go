@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
 )
 
 var botUserAgentRegExpList []*regexp.Regexp = []*regexp.Regexp{
@@ -34,13 +35,13 @@ func Test_UserAgent(t *testing.T) {
 	var wg sync.WaitGroup
 	for i := 0; i < 10000; i++ {
 		wg.Add(1)
-		go func() {
+		go func(i int64) {
 			defer wg.Done()
-			ua := client.GenerateUserAgent()
+			ua := client.GenerateUserAgent(random.NewSource(1).New("user_agent", i))
 			if isBotUserAgent(ua) {
 				t.Errorf("Bot User Agent was generated by GenerateUserAgent func: %v", ua)
 			}
-		}()
+		}(int64(i))
 	}
 
 	wg.Wait()
@@ -50,14 +51,23 @@ func Test_BotUserAgent(t *testing.T) {
 	var wg sync.WaitGroup
 	for i := 0; i < 10000; i++ {
 		wg.Add(1)
-		go func() {
+		go func(i int64) {
 			defer wg.Done()
-			ua := client.GenerateBotUserAgent()
+			ua := client.GenerateBotUserAgent(random.NewSource(1).New("bot_user_agent", i))
 			if !isBotUserAgent(ua) {
 				t.Errorf("User Agent was generated by GenerateBotUserAgent func: %v", ua)
 			}
-		}()
+		}(int64(i))
 	}
 
 	wg.Wait()
 }
+
+func Test_UserAgentWithSameSeed(t *testing.T) {
+	src := random.NewSource(1)
+	a := client.GenerateUserAgent(src.New("user_agent", 0))
+	b := client.GenerateUserAgent(src.New("user_agent", 0))
+	if a != b {
+		t.Errorf("User Agents generated with the same seed are different: %v, %v", a, b)
+	}
+}
@@ -16,7 +16,6 @@ import (
 
 	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
-	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
 )
 
 type Coordinates struct {
@@ -43,7 +42,7 @@ func (c *Client) Initialize(ctx context.Context) (*InitializeResponse, error) {
 
 	res, err := c.Do(req)
 	if err != nil {
-		return nil, failure.Wrap(err, failure.Message("POST /initialize: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("INITIALIZE_REQUEST_FAILED", "POST /initialize: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -51,7 +50,7 @@ func (c *Client) Initialize(ctx context.Context) (*InitializeResponse, error) {
 	// MEMO: /initializeの成功ステータスによって第二引数が変わる可能性がある
 	err = checkStatusCode(res, []int{http.StatusOK})
 	if err != nil {
-		return nil, failure.Wrap(err, failure.Message("POST /initialize: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("INITIALIZE_INVALID_STATUS", "POST /initialize: レスポンスコードが不正です", err))
 	}
 
 	var initRes InitializeResponse
@@ -61,11 +60,11 @@ func (c *Client) Initialize(ctx context.Context) (*InitializeResponse, error) {
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("POST /initialize: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("INITIALIZE_INVALID_JSON", "POST /initialize: JSONデコードに失敗しました"))
 	}
 
 	if initRes.Language == "" {
-		return nil, failure.New(fails.ErrApplication, failure.Message("POST /initialize: 実装言語が設定されていません"))
+		return nil, failure.New(fails.ErrApplication, fails.Message("INITIALIZE_LANGUAGE_NOT_SET", "POST /initialize: 実装言語が設定されていません"))
 	}
 
 	return &initRes, nil
@@ -94,7 +93,7 @@ func (c *Client) GetChairDetailFromID(ctx context.Context, id string) (*asset.Ch
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/:id: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("CHAIR_DETAIL_REQUEST_FAILED", "GET /api/chair/:id: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -104,7 +103,7 @@ func (c *Client) GetChairDetailFromID(ctx context.Context, id string) (*asset.Ch
 		if c.isBot {
 			return nil, failure.Translate(err, fails.ErrBot)
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/:id: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("CHAIR_DETAIL_INVALID_STATUS", "GET /api/chair/:id: レスポンスコードが不正です", err))
 	}
 
 	if res.StatusCode == http.StatusNotFound {
@@ -123,11 +122,13 @@ func (c *Client) GetChairDetailFromID(ctx context.Context, id string) (*asset.Ch
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("GET /api/chair/:id: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("CHAIR_DETAIL_REQUEST_FAILED", "GET /api/chair/:id: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/:id: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("CHAIR_DETAIL_INVALID_JSON", "GET /api/chair/:id: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "GET /api/chair/:id")
+
 	return &chair, nil
 }
 
@@ -168,7 +169,7 @@ func (c *Client) PostChairs(ctx context.Context, chairs []asset.Chair) error {
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return ctxErr
 		}
-		return failure.Wrap(err, failure.Message("POST /api/chair: リクエストに失敗しました"))
+		return failure.Wrap(err, fails.Message("CHAIR_POST_REQUEST_FAILED", "POST /api/chair: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -178,9 +179,14 @@ func (c *Client) PostChairs(ctx context.Context, chairs []asset.Chair) error {
 		if c.isBot {
 			return failure.Translate(err, fails.ErrBot)
 		}
-		return failure.Wrap(err, failure.Message("POST /api/chair: リクエストに失敗しました"))
+		return failure.Wrap(err, withErrorCode("CHAIR_POST_REQUEST_FAILED", "POST /api/chair: リクエストに失敗しました", err))
 	}
 
+	for _, chair := range chairs {
+		asset.CommitChair(chair.ID)
+	}
+	c.addScore(ctx, "POST /api/chair")
+
 	return nil
 }
 
@@ -196,17 +202,16 @@ func (c *Client) GetChairSearchCondition(ctx context.Context) (*asset.ChairSearc
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/search/condition: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("CHAIR_SEARCH_CONDITION_REQUEST_FAILED", "GET /api/chair/search/condition: リクエストに失敗しました"))
 	}
+	defer res.Body.Close()
+	defer io.Copy(ioutil.Discard, res.Body)
 
 	err = checkStatusCode(res, []int{http.StatusOK})
 	if err != nil {
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/search/condition: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("CHAIR_SEARCH_CONDITION_INVALID_STATUS", "GET /api/chair/search/condition: レスポンスコードが不正です", err))
 	}
 
-	defer res.Body.Close()
-	defer io.Copy(ioutil.Discard, res.Body)
-
 	var condition asset.ChairSearchCondition
 
 	err = json.NewDecoder(res.Body).Decode(&condition)
@@ -215,11 +220,13 @@ func (c *Client) GetChairSearchCondition(ctx context.Context) (*asset.ChairSearc
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("GET /api/chair/search/condition: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("CHAIR_SEARCH_CONDITION_REQUEST_FAILED", "GET /api/chair/search/condition: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/search/condition: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("CHAIR_SEARCH_CONDITION_INVALID_JSON", "GET /api/chair/search/condition: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "GET /api/chair/search/condition")
+
 	return &condition, nil
 }
 
@@ -236,7 +243,7 @@ func (c *Client) SearchChairsWithQuery(ctx context.Context, q url.Values) (*Chai
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/search: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("CHAIR_SEARCH_REQUEST_FAILED", "GET /api/chair/search: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -246,7 +253,7 @@ func (c *Client) SearchChairsWithQuery(ctx context.Context, q url.Values) (*Chai
 		if c.isBot {
 			return nil, failure.Translate(err, fails.ErrBot)
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/search: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("CHAIR_SEARCH_INVALID_STATUS", "GET /api/chair/search: レスポンスコードが不正です", err))
 	}
 
 	var chairs ChairsResponse
@@ -257,11 +264,13 @@ func (c *Client) SearchChairsWithQuery(ctx context.Context, q url.Values) (*Chai
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("GET /api/chair/search: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("CHAIR_SEARCH_REQUEST_FAILED", "GET /api/chair/search: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/search: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("CHAIR_SEARCH_INVALID_JSON", "GET /api/chair/search: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "GET /api/chair/search")
+
 	return &chairs, nil
 }
 
@@ -277,17 +286,16 @@ func (c *Client) GetEstateSearchCondition(ctx context.Context) (*asset.EstateSea
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/search/condition: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_SEARCH_CONDITION_REQUEST_FAILED", "GET /api/estate/search/condition: リクエストに失敗しました"))
 	}
+	defer res.Body.Close()
+	defer io.Copy(ioutil.Discard, res.Body)
 
 	err = checkStatusCode(res, []int{http.StatusOK})
 	if err != nil {
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/search/condition: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("ESTATE_SEARCH_CONDITION_INVALID_STATUS", "GET /api/estate/search/condition: レスポンスコードが不正です", err))
 	}
 
-	defer res.Body.Close()
-	defer io.Copy(ioutil.Discard, res.Body)
-
 	var condition asset.EstateSearchCondition
 
 	err = json.NewDecoder(res.Body).Decode(&condition)
@@ -296,11 +304,13 @@ func (c *Client) GetEstateSearchCondition(ctx context.Context) (*asset.EstateSea
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("GET /api/estate/search/condition: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("ESTATE_SEARCH_CONDITION_REQUEST_FAILED", "GET /api/estate/search/condition: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/search/condition: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_SEARCH_CONDITION_INVALID_JSON", "GET /api/estate/search/condition: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "GET /api/estate/search/condition")
+
 	return &condition, nil
 }
 
@@ -317,7 +327,7 @@ func (c *Client) SearchEstatesWithQuery(ctx context.Context, q url.Values) (*Est
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/search: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_SEARCH_REQUEST_FAILED", "GET /api/estate/search: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -327,7 +337,7 @@ func (c *Client) SearchEstatesWithQuery(ctx context.Context, q url.Values) (*Est
 		if c.isBot {
 			return nil, failure.Translate(err, fails.ErrBot)
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/search: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("ESTATE_SEARCH_INVALID_STATUS", "GET /api/estate/search: レスポンスコードが不正です", err))
 	}
 
 	var estates EstatesResponse
@@ -338,11 +348,13 @@ func (c *Client) SearchEstatesWithQuery(ctx context.Context, q url.Values) (*Est
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("GET /api/estate/search: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("ESTATE_SEARCH_REQUEST_FAILED", "GET /api/estate/search: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/search: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_SEARCH_INVALID_JSON", "GET /api/estate/search: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "GET /api/estate/search")
+
 	return &estates, nil
 }
 
@@ -364,7 +376,7 @@ func (c *Client) SearchEstatesNazotte(ctx context.Context, polygon *Coordinates)
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("POST /api/estate/nazotte: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_NAZOTTE_REQUEST_FAILED", "POST /api/estate/nazotte: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -374,7 +386,7 @@ func (c *Client) SearchEstatesNazotte(ctx context.Context, polygon *Coordinates)
 		if c.isBot {
 			return nil, failure.Translate(err, fails.ErrBot)
 		}
-		return nil, failure.Wrap(err, failure.Message("POST /api/estate/nazotte: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("ESTATE_NAZOTTE_INVALID_STATUS", "POST /api/estate/nazotte: レスポンスコードが不正です", err))
 	}
 
 	var estates EstatesResponse
@@ -385,11 +397,13 @@ func (c *Client) SearchEstatesNazotte(ctx context.Context, polygon *Coordinates)
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("POST /api/estate/nazotte: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("ESTATE_NAZOTTE_REQUEST_FAILED", "POST /api/estate/nazotte: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("POST /api/estate/nazotte: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_NAZOTTE_INVALID_JSON", "POST /api/estate/nazotte: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "POST /api/estate/nazotte")
+
 	return &estates, nil
 }
 
@@ -406,7 +420,7 @@ func (c *Client) GetEstateDetailFromID(ctx context.Context, id string) (*asset.E
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/:id: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_DETAIL_REQUEST_FAILED", "GET /api/estate/:id: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -416,7 +430,7 @@ func (c *Client) GetEstateDetailFromID(ctx context.Context, id string) (*asset.E
 		if c.isBot {
 			return nil, failure.Translate(err, fails.ErrBot)
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/:id: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("ESTATE_DETAIL_INVALID_STATUS", "GET /api/estate/:id: レスポンスコードが不正です", err))
 	}
 
 	var estate asset.Estate
@@ -427,11 +441,13 @@ func (c *Client) GetEstateDetailFromID(ctx context.Context, id string) (*asset.E
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("GET /api/estate/:id: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("ESTATE_DETAIL_REQUEST_FAILED", "GET /api/estate/:id: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/:id: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_DETAIL_INVALID_JSON", "GET /api/estate/:id: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "GET /api/estate/:id")
+
 	return &estate, nil
 }
 
@@ -472,7 +488,7 @@ func (c *Client) PostEstates(ctx context.Context, estates []asset.Estate) error
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return ctxErr
 		}
-		return failure.Wrap(err, failure.Message("POST /api/estate: リクエストに失敗しました"))
+		return failure.Wrap(err, fails.Message("ESTATE_POST_REQUEST_FAILED", "POST /api/estate: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -482,9 +498,14 @@ func (c *Client) PostEstates(ctx context.Context, estates []asset.Estate) error
 		if c.isBot {
 			return failure.Translate(err, fails.ErrBot)
 		}
-		return failure.Wrap(err, failure.Message("POST /api/estate: リクエストに失敗しました"))
+		return failure.Wrap(err, withErrorCode("ESTATE_POST_REQUEST_FAILED", "POST /api/estate: リクエストに失敗しました", err))
 	}
 
+	for _, estate := range estates {
+		asset.CommitEstate(estate.ID)
+	}
+	c.addScore(ctx, "POST /api/estate")
+
 	return nil
 }
 
@@ -501,7 +522,7 @@ func (c *Client) GetLowPricedChair(ctx context.Context) (*ChairsResponse, error)
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/low_priced: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("CHAIR_LOW_PRICED_REQUEST_FAILED", "GET /api/chair/low_priced: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -511,7 +532,7 @@ func (c *Client) GetLowPricedChair(ctx context.Context) (*ChairsResponse, error)
 		if c.isBot {
 			return nil, failure.Translate(err, fails.ErrBot)
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/low_priced: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("CHAIR_LOW_PRICED_INVALID_STATUS", "GET /api/chair/low_priced: レスポンスコードが不正です", err))
 	}
 
 	var chairs ChairsResponse
@@ -522,11 +543,13 @@ func (c *Client) GetLowPricedChair(ctx context.Context) (*ChairsResponse, error)
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("GET /api/chair/low_priced: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("CHAIR_LOW_PRICED_REQUEST_FAILED", "GET /api/chair/low_priced: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/chair/low_priced: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("CHAIR_LOW_PRICED_INVALID_JSON", "GET /api/chair/low_priced: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "GET /api/chair/low_priced")
+
 	return &chairs, nil
 }
 
@@ -543,7 +566,7 @@ func (c *Client) GetLowPricedEstate(ctx context.Context) (*EstatesResponse, erro
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/low_priced: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_LOW_PRICED_REQUEST_FAILED", "GET /api/estate/low_priced: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -553,7 +576,7 @@ func (c *Client) GetLowPricedEstate(ctx context.Context) (*EstatesResponse, erro
 		if c.isBot {
 			return nil, failure.Translate(err, fails.ErrBot)
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/low_priced: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("ESTATE_LOW_PRICED_INVALID_STATUS", "GET /api/estate/low_priced: レスポンスコードが不正です", err))
 	}
 
 	var estate EstatesResponse
@@ -564,11 +587,13 @@ func (c *Client) GetLowPricedEstate(ctx context.Context) (*EstatesResponse, erro
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("GET /api/estate/low_priced: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("ESTATE_LOW_PRICED_REQUEST_FAILED", "GET /api/estate/low_priced: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/estate/low_priced: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("ESTATE_LOW_PRICED_INVALID_JSON", "GET /api/estate/low_priced: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "GET /api/estate/low_priced")
+
 	return &estate, nil
 }
 
@@ -585,7 +610,7 @@ func (c *Client) GetRecommendedEstatesFromChair(ctx context.Context, id int64) (
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/recommended_estate/:id: リクエストに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("RECOMMENDED_ESTATE_REQUEST_FAILED", "GET /api/recommended_estate/:id: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -595,7 +620,7 @@ func (c *Client) GetRecommendedEstatesFromChair(ctx context.Context, id int64) (
 		if c.isBot {
 			return nil, failure.Translate(err, fails.ErrBot)
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/recommended_estate/:id: レスポンスコードが不正です"))
+		return nil, failure.Wrap(err, withErrorCode("RECOMMENDED_ESTATE_INVALID_STATUS", "GET /api/recommended_estate/:id: レスポンスコードが不正です", err))
 	}
 
 	var estate EstatesResponse
@@ -606,14 +631,60 @@ func (c *Client) GetRecommendedEstatesFromChair(ctx context.Context, id int64) (
 			return nil, ctxErr
 		}
 		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
-			return nil, failure.Translate(err, fails.ErrTimeout, failure.Message("GET /api/recommended_estate/:id: リクエストに失敗しました"))
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("RECOMMENDED_ESTATE_REQUEST_FAILED", "GET /api/recommended_estate/:id: リクエストに失敗しました"))
 		}
-		return nil, failure.Wrap(err, failure.Message("GET /api/recommended_estate/:id: JSONデコードに失敗しました"))
+		return nil, failure.Wrap(err, fails.Message("RECOMMENDED_ESTATE_INVALID_JSON", "GET /api/recommended_estate/:id: JSONデコードに失敗しました"))
 	}
 
+	c.addScore(ctx, "GET /api/recommended_estate/:id")
+
 	return &estate, nil
 }
 
+func (c *Client) GetRecommendedChairsFromEstate(ctx context.Context, id int64) (*ChairsResponse, error) {
+	req, err := c.newGetRequest(ShareTargetURLs.AppURL, "/api/recommended_chair/"+strconv.FormatInt(id, 10))
+	if err != nil {
+		return nil, failure.Translate(err, fails.ErrBenchmarker)
+	}
+
+	req = req.WithContext(ctx)
+	res, err := c.Do(req)
+
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, failure.Wrap(err, fails.Message("RECOMMENDED_CHAIR_REQUEST_FAILED", "GET /api/recommended_chair/:id: リクエストに失敗しました"))
+	}
+	defer res.Body.Close()
+	defer io.Copy(ioutil.Discard, res.Body)
+
+	err = checkStatusCode(res, []int{http.StatusOK})
+	if err != nil {
+		if c.isBot {
+			return nil, failure.Translate(err, fails.ErrBot)
+		}
+		return nil, failure.Wrap(err, withErrorCode("RECOMMENDED_CHAIR_INVALID_STATUS", "GET /api/recommended_chair/:id: レスポンスコードが不正です", err))
+	}
+
+	var chairs ChairsResponse
+
+	err = json.NewDecoder(res.Body).Decode(&chairs)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if nerr, ok := err.(interface{ Timeout() bool }); ok && nerr.Timeout() {
+			return nil, failure.Translate(err, fails.ErrTimeout, fails.Message("RECOMMENDED_CHAIR_REQUEST_FAILED", "GET /api/recommended_chair/:id: リクエストに失敗しました"))
+		}
+		return nil, failure.Wrap(err, fails.Message("RECOMMENDED_CHAIR_INVALID_JSON", "GET /api/recommended_chair/:id: JSONデコードに失敗しました"))
+	}
+
+	c.addScore(ctx, "GET /api/recommended_chair/:id")
+
+	return &chairs, nil
+}
+
 type EmailRequest struct {
 	Email string `json:"email"`
 }
@@ -629,14 +700,20 @@ func (c *Client) BuyChair(ctx context.Context, id string) error {
 		return failure.Translate(err, fails.ErrBenchmarker)
 	}
 
+	intid, _ := strconv.ParseInt(id, 10, 64)
+	asset.BeginChairPurchase(intid)
+	defer asset.EndChairPurchase(intid)
+
 	req = req.WithContext(ctx)
 	res, err := c.Do(req)
 
 	if err != nil {
+		// アプリケーション側で在庫が減っているかわからない
+		asset.LoseChairStock(intid)
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return ctxErr
 		}
-		return failure.Wrap(err, failure.Message("POST /api/chair/buy/:id: リクエストに失敗しました"))
+		return failure.Wrap(err, fails.Message("CHAIR_BUY_REQUEST_FAILED", "POST /api/chair/buy/:id: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -646,14 +723,11 @@ func (c *Client) BuyChair(ctx context.Context, id string) error {
 		if c.isBot {
 			return failure.Translate(err, fails.ErrBot)
 		}
-		return failure.Wrap(err, failure.Message("POST /api/chair/buy/:id: リクエストに失敗しました"))
+		return failure.Wrap(err, withErrorCode("CHAIR_BUY_REQUEST_FAILED", "POST /api/chair/buy/:id: リクエストに失敗しました", err))
 	}
 
-	intid, _ := strconv.ParseInt(id, 10, 64)
 	asset.DecrementChairStock(intid)
-	if !c.isBot {
-		score.IncrementScore()
-	}
+	c.addScore(ctx, "POST /api/chair/buy/:id")
 
 	return nil
 }
@@ -676,7 +750,7 @@ func (c *Client) RequestEstateDocument(ctx context.Context, id string) error {
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return ctxErr
 		}
-		return failure.Wrap(err, failure.Message("POST /api/estate/req_doc/:id: リクエストに失敗しました"))
+		return failure.Wrap(err, fails.Message("ESTATE_REQ_DOC_REQUEST_FAILED", "POST /api/estate/req_doc/:id: リクエストに失敗しました"))
 	}
 	defer res.Body.Close()
 	defer io.Copy(ioutil.Discard, res.Body)
@@ -686,12 +760,10 @@ func (c *Client) RequestEstateDocument(ctx context.Context, id string) error {
 		if c.isBot {
 			return failure.Translate(err, fails.ErrBot)
 		}
-		return failure.Wrap(err, failure.Message("POST /api/estate/req_doc/:id: リクエストに失敗しました"))
+		return failure.Wrap(err, withErrorCode("ESTATE_REQ_DOC_REQUEST_FAILED", "POST /api/estate/req_doc/:id: リクエストに失敗しました", err))
 	}
 
-	if !c.isBot {
-		score.IncrementScore()
-	}
+	c.addScore(ctx, "POST /api/estate/req_doc/:id")
 
 	return nil
 }
@@ -0,0 +1,46 @@
+package client_test
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+)
+
+// レスポンスコードが不正でも、リクエストの計測結果を記録してボディを閉じる
+func Test_SearchConditionWithInvalidStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	if err := client.SetShareTargetURLs(srv.URL, ""); err != nil {
+		t.Fatal(err)
+	}
+	m := metrics.New()
+	ctx := metrics.WithRecorder(context.Background(), m)
+
+	c := client.NewClient(false, rand.New(rand.NewSource(1)))
+	if _, err := c.GetChairSearchCondition(ctx); err == nil {
+		t.Error("GetChairSearchCondition() returns no error for status 500")
+	}
+	if _, err := c.GetEstateSearchCondition(ctx); err == nil {
+		t.Error("GetEstateSearchCondition() returns no error for status 500")
+	}
+
+	if n := m.InFlight(); n != 0 {
+		t.Errorf("InFlight() = %d, want 0", n)
+	}
+	rs := m.RequestsSince(0)
+	if len(rs) != 2 {
+		t.Fatalf("%d requests are recorded, want 2", len(rs))
+	}
+	for _, r := range rs {
+		if r.StatusCode != http.StatusInternalServerError {
+			t.Errorf("%s: status = %d, want 500", r.Route, r.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/distributed"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/scenario"
+)
+
+const agentUsage = `usage: bench agent [flags]
+
+-agents を指定して起動したベンチマーカー (coordinator) に接続し、割り当てられたシナリオのWorkerを動かす。
+対象の URL、負荷プロファイル、シードは coordinator から受け取る。初期データとジャーニーは coordinator と同じものを指定すること。
+
+`
+
+// runAgent bench agent サブコマンド。終了コードを返す
+func runAgent(args []string) int {
+	flags := flag.NewFlagSet("agent", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, agentUsage)
+		flags.PrintDefaults()
+	}
+	coordinatorAddr := ""
+	name := ""
+	dataDir := ""
+	fixtureDir := ""
+	journeyPath := ""
+	flags.StringVar(&coordinatorAddr, "coordinator", "127.0.0.1:7000", "address of the coordinator")
+	flags.StringVar(&name, "name", "", "name of this agent in logs (hostname-pid if empty)")
+	flags.StringVar(&dataDir, "data-dir", "../initial-data", "data directory")
+	flags.StringVar(&fixtureDir, "fixture-dir", "../webapp/fixture", "fixture directory")
+	flags.StringVar(&journeyPath, "journey", "", "user journey file (YAML) or directory of them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if name == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "agent"
+		}
+		name = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if journeyPath != "" {
+		if _, err := scenario.RegisterJourneys(journeyPath); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Println("shutting down")
+		cancel()
+	}()
+
+	e := fails.New()
+	asset.Initialize(fails.WithErrors(ctx, e), dataDir, fixtureDir)
+	if msgs := e.GetMsgs(); len(msgs) > 0 {
+		log.Printf("asset initialize failed: %v", msgs)
+		return 1
+	}
+
+	if err := distributed.RunAgent(ctx, coordinatorAddr, name); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
@@ -4,20 +4,31 @@ import (
 	"context"
 	"flag"
 	"log"
-	"math/rand"
 	"net"
 	"os"
 	"time"
 
 	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/distributed"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/reporter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/run"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/scenario"
-	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/timeline"
 	"github.com/morikuni/failure"
 )
 
+const (
+	// ModeFull 互換性チェックの後に負荷走行を行う
+	ModeFull = "full"
+	// ModeVerify すべてのSnapshotで互換性チェックだけを行う
+	ModeVerify = "verify"
+	// ModeLoad 互換性チェックを行わずに負荷走行だけを行う
+	ModeLoad = "load"
+)
+
 type Config struct {
 	TargetURLStr string
 	TargetHost   string
@@ -26,20 +37,32 @@ type Config struct {
 }
 
 func init() {
-	rand.Seed(time.Now().UnixNano())
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		os.Exit(runCompare(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		os.Exit(runServe(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		os.Exit(runAgent(os.Args[2:]))
+	}
+
+	r := run.New()
+	ctx := r.Context(context.Background())
+
 	defer func() {
-		reporter.Report(fails.Get())
+		r.Reporter.Report(r.Errors)
 	}()
 
 	defer func() {
 		err := recover()
 		if err, ok := err.(error); ok {
 			err = failure.Translate(err, fails.ErrBenchmarker)
-			fails.Add(err)
+			r.Errors.Add(err)
 		}
 	}()
 
@@ -49,79 +72,267 @@ func main() {
 	conf := Config{}
 	dataDir := ""
 	fixtureDir := ""
+	profilePath := ""
+	journeyPath := ""
+	timelinePath := ""
+	var seed int64
+	mode := ""
+	diffOutPath := ""
+	evidencePath := ""
+	lang := ""
+	numAgents := 0
+	agentListen := ""
 
 	flags.StringVar(&conf.TargetURLStr, "target-url", "http://localhost:1323", "target url")
 	flags.StringVar(&dataDir, "data-dir", "../initial-data", "data directory")
 	flags.StringVar(&fixtureDir, "fixture-dir", "../webapp/fixture", "fixture directory")
+	flags.StringVar(&mode, "mode", ModeFull, "benchmark mode (full, verify or load)")
+	flags.StringVar(&lang, "lang", fails.LocaleJa, "language of messages in the report (ja or en)")
+	flags.StringVar(&evidencePath, "evidence", "", "write requests and responses that caused errors to the file in HAR format (for post-mortem, not shown in the report)")
+	flags.StringVar(&diffOutPath, "diff-out", "", "write response diffs of failed verification to the file (for operators, not shown in the report)")
+	flags.Int64Var(&seed, "seed", 0, "random seed. the same seed reproduces the same requests for the same level progression (random if 0)")
+	flags.StringVar(&timelinePath, "timeline", "", "write a timeline sampled every second to the file (.csv or .jsonl)")
+	flags.StringVar(&profilePath, "profile", "", "load profile (YAML or JSON). built-in profile is used if empty")
+	flags.StringVar(&journeyPath, "journey", "", "user journey file (YAML) or directory of them. journeys are registered as scenarios by name")
+	flags.IntVar(&numAgents, "agents", 0, "number of agents to run scenario workers on. workers run in this process if 0")
+	flags.StringVar(&agentListen, "agent-listen", ":7000", "address to accept agents on")
 
 	err := flags.Parse(os.Args[1:])
 	if err != nil {
-		err = failure.Translate(err, fails.ErrBenchmarker, failure.Message("コマンドライン引数のパースに失敗しました"))
-		fails.Add(err)
-		reporter.SetPassed(false)
-		reporter.SetReason("コマンドライン引数のパースに失敗しました")
+		err = failure.Translate(err, fails.ErrBenchmarker, fails.Message("INVALID_ARGUMENTS", "コマンドライン引数のパースに失敗しました"))
+		r.Errors.Add(err)
+		r.Reporter.SetPassed(false)
+		r.Reporter.SetReason("コマンドライン引数のパースに失敗しました")
+		return
+	}
+
+	if evidencePath != "" {
+		defer func() {
+			if err := writeEvidence(evidencePath, r); err != nil {
+				log.Printf("failed to write evidence: %v", err)
+			}
+		}()
+	}
+
+	if lang != fails.LocaleJa && lang != fails.LocaleEn {
+		r.Errors.Add(failure.New(fails.ErrBenchmarker, fails.Message("INVALID_LANG", "不正な言語です"), failure.Messagef("lang: %s", lang)))
+		r.Reporter.SetPassed(false)
+		r.Reporter.SetReason("コマンドライン引数のパースに失敗しました")
+		return
+	}
+	r.Reporter.SetLocale(lang)
+
+	if mode != ModeFull && mode != ModeVerify && mode != ModeLoad {
+		r.Errors.Add(failure.New(fails.ErrBenchmarker, fails.Message("INVALID_MODE", "不正なモードです"), failure.Messagef("mode: %s", mode)))
+		r.Reporter.SetPassed(false)
+		r.Reporter.SetReason("コマンドライン引数のパースに失敗しました")
 		return
 	}
+	r.Reporter.SetMode(mode)
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r.Random.SetSeed(seed)
+	r.Reporter.SetSeed(seed)
+	log.Printf("seed: %d", seed)
+
+	if journeyPath != "" {
+		names, err := scenario.RegisterJourneys(journeyPath)
+		if err != nil {
+			r.Errors.Add(failure.Translate(err, fails.ErrBenchmarker))
+			r.Reporter.SetPassed(false)
+			r.Reporter.SetReason("ジャーニーの読み込みに失敗しました")
+			return
+		}
+		log.Printf("journeys: %v", names)
+	}
+
+	if profilePath != "" {
+		profile, err := loadProfile(profilePath)
+		if err != nil {
+			r.Errors.Add(failure.Translate(err, fails.ErrBenchmarker))
+			r.Reporter.SetPassed(false)
+			r.Reporter.SetReason("負荷プロファイルの読み込みに失敗しました")
+			return
+		}
+		parameter.Apply(profile)
+		r.Reporter.SetProfile(profile)
+	}
+
+	var timelineFile *os.File
+	timelineFormat := ""
+	if timelinePath != "" {
+		timelineFormat, err = timeline.FormatOf(timelinePath)
+		if err == nil {
+			timelineFile, err = os.Create(timelinePath)
+		}
+		if err != nil {
+			r.Errors.Add(failure.Translate(err, fails.ErrBenchmarker))
+			r.Reporter.SetPassed(false)
+			r.Reporter.SetReason("タイムラインの出力先が不正です")
+			return
+		}
+		defer timelineFile.Close()
+	}
 
 	err = client.SetShareTargetURLs(
 		conf.TargetURLStr,
 		conf.TargetHost,
 	)
 	if err != nil {
-		fails.Add(failure.Translate(err, fails.ErrBenchmarker))
-		reporter.SetPassed(false)
-		reporter.SetReason("ベンチ対象サーバーのURLが不正です")
+		r.Errors.Add(failure.Translate(err, fails.ErrBenchmarker))
+		r.Reporter.SetPassed(false)
+		r.Reporter.SetReason("ベンチ対象サーバーのURLが不正です")
 		return
 	}
 
-	asset.Initialize(context.Background(), dataDir, fixtureDir)
-	msgs := fails.GetMsgs()
+	asset.Initialize(ctx, dataDir, fixtureDir)
+	msgs := r.Errors.GetMsgs()
 	if len(msgs) > 0 {
 		log.Println("asset initialize failed")
-		reporter.SetPassed(false)
-		reporter.SetReason("ベンチマーカーの初期化に失敗しました")
+		r.Reporter.SetPassed(false)
+		r.Reporter.SetReason("ベンチマーカーの初期化に失敗しました")
 		return
 	}
 
 	log.Println("=== initialize ===")
-	initRes := scenario.Initialize(context.Background())
-	msgs = fails.GetMsgs()
+	initRes := scenario.Initialize(ctx)
+	msgs = r.Errors.GetMsgs()
 	if len(msgs) > 0 {
 		log.Println("initialize failed")
-		reporter.SetPassed(false)
-		reporter.SetReason("POST /initializeに失敗しました")
+		r.Reporter.SetPassed(false)
+		r.Reporter.SetReason("POST /initializeに失敗しました")
 		return
 	}
 
-	reporter.SetLanguage(initRes.Language)
+	r.Reporter.SetLanguage(initRes.Language)
+
+	var coordinator *distributed.Coordinator
+	if numAgents > 0 && mode != ModeVerify {
+		// 互換性チェック中の asset の変更も agent に伝えるため、互換性チェックの前に待ち受ける
+		coordinator, err = distributed.Listen(agentListen)
+		if err != nil {
+			r.Errors.Add(failure.Translate(err, fails.ErrBenchmarker))
+			r.Reporter.SetPassed(false)
+			r.Reporter.SetReason("agentの待ち受けに失敗しました")
+			return
+		}
+		defer coordinator.Close()
+	}
 
-	log.Println("=== verify ===")
-	scenario.Verify(context.Background(), dataDir, fixtureDir)
-	msgs = fails.GetMsgs()
+	switch mode {
+	case ModeFull:
+		log.Println("=== verify ===")
+		scenario.Verify(ctx, dataDir, fixtureDir)
+	case ModeVerify:
+		log.Println("=== verify (conformance) ===")
+		scenario.VerifyConformance(ctx, dataDir, fixtureDir)
+	}
+	if mode == ModeVerify {
+		r.Reporter.SetConformance(r.Conformance.Report())
+	}
+	if diffOutPath != "" {
+		if err := writeDiffArtifact(diffOutPath, r); err != nil {
+			log.Printf("failed to write diff artifact: %v", err)
+		}
+	}
+	msgs = r.Errors.GetMsgs()
 	if len(msgs) > 0 {
 		log.Println("verify failed")
-		reporter.SetPassed(false)
-		reporter.SetReason("アプリケーション互換性チェックに失敗しました")
+		r.Reporter.SetPassed(false)
+		r.Reporter.SetReason("アプリケーション互換性チェックに失敗しました")
 		return
 	}
 
+	if mode == ModeVerify {
+		r.Reporter.SetPassed(true)
+		r.Reporter.SetReason("OK")
+		return
+	}
+
+	if coordinator != nil {
+		log.Println("=== agents ===")
+		err := coordinator.Start(ctx, numAgents, conf.TargetURLStr, seed, parameter.CurrentProfile())
+		if err != nil {
+			r.Errors.Add(failure.Translate(err, fails.ErrBenchmarker, fails.Message("AGENT_SETUP", "agentの準備に失敗しました")))
+			r.Reporter.SetPassed(false)
+			r.Reporter.SetReason("agentの準備に失敗しました")
+			return
+		}
+		ctx = scenario.WithDispatcher(ctx, coordinator)
+	}
+
 	log.Println("=== validation ===")
-	scenario.Validation(context.Background())
-	log.Printf("最終的な負荷レベル: %d", score.GetLevel())
+	// レポートのメトリクスには負荷走行中のリクエストのみを載せる
+	r.Metrics.Reset()
+	timelineCtx, stopTimeline := context.WithCancel(ctx)
+	timelineDone := make(chan struct{})
+	go func() {
+		defer close(timelineDone)
+		if timelineFile == nil {
+			return
+		}
+		if err := timeline.Run(timelineCtx, timelineFile, timelineFormat); err != nil {
+			log.Printf("failed to write timeline: %v", err)
+		}
+	}()
+	scenario.Validation(ctx)
+	if coordinator != nil {
+		coordinator.Finish()
+	}
+	stopTimeline()
+	<-timelineDone
+	log.Printf("最終的な負荷レベル: %d", r.Score.GetLevel())
 
 	// ベンチマーク終了時にcritical errorが1つ以上、もしくはapplication errorが10回以上で失格
-	msgs, critical, application, _ := fails.Get()
+	msgs, critical, application, _ := r.Errors.Get()
 	isPassed := true
 
 	if critical > 0 {
 		isPassed = false
-		reporter.SetReason("致命的なエラーが発生しました")
+		r.Reporter.SetReason("致命的なエラーが発生しました")
 	} else if application >= 10 {
 		isPassed = false
-		reporter.SetReason("アプリケーションエラーが10回以上発生しました")
+		r.Reporter.SetReason("アプリケーションエラーが10回以上発生しました")
 	} else {
-		reporter.SetReason("OK")
+		r.Reporter.SetReason("OK")
+	}
+
+	r.Reporter.SetPassed(isPassed)
+}
+
+// loadProfile 負荷プロファイルを読み込み、登録されたシナリオとエラーの種類で検証する
+func loadProfile(path string) (parameter.Profile, error) {
+	profile, err := parameter.LoadProfile(path)
+	if err != nil {
+		return parameter.Profile{}, err
+	}
+	if err := scenario.ValidateProfile(profile); err != nil {
+		return parameter.Profile{}, err
+	}
+	if err := reporter.ValidateProfile(profile); err != nil {
+		return parameter.Profile{}, err
+	}
+	return profile, nil
+}
+
+func writeDiffArtifact(path string, r *run.Run) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.Conformance.WriteArtifact(f)
+}
+
+func writeEvidence(path string, r *run.Run) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	reporter.SetPassed(isPassed)
+	return r.Evidence.WriteHAR(f)
 }
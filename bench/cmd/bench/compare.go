@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/compare"
+)
+
+const compareUsage = `usage: bench compare [flags] BASE... [-- CANDIDATE...]
+
+BASE と CANDIDATE は結果の JSON (.json) かタイムライン (.csv / .jsonl)。
+-- がなければ最初のファイルを基準にし、残りのファイルをまとめて比べる。
+回帰が見つかると終了コード 1 で終了する。
+
+`
+
+// runCompare bench compare サブコマンド。終了コードを返す
+func runCompare(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, compareUsage)
+		flags.PrintDefaults()
+	}
+	opt := compare.Options{}
+	flags.Float64Var(&opt.Threshold, "threshold", 5, "regression threshold in percent")
+	flags.Float64Var(&opt.Alpha, "alpha", 0.05, "significance level of Welch's t-test")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	basePaths, candidatePaths := splitRuns(flags.Args())
+	if len(basePaths) == 0 || len(candidatePaths) == 0 {
+		flags.Usage()
+		return 2
+	}
+	base, err := loadRuns(basePaths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	candidate, err := loadRuns(candidatePaths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	rows := compare.Compare(base, candidate, opt)
+	if err := compare.Write(os.Stdout, base, candidate, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for _, row := range rows {
+		if row.Regression {
+			return 1
+		}
+	}
+	return 0
+}
+
+// splitRuns "--" の前を基準、後ろを比べる対象にする。"--" がなければ最初のファイルを基準にする
+func splitRuns(paths []string) ([]string, []string) {
+	for i, p := range paths {
+		if p == "--" {
+			return paths[:i], paths[i+1:]
+		}
+	}
+	if len(paths) < 2 {
+		return paths, nil
+	}
+	return paths[:1], paths[1:]
+}
+
+func loadRuns(paths []string) ([]compare.Run, error) {
+	runs := make([]compare.Run, 0, len(paths))
+	for _, path := range paths {
+		r, err := compare.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, nil
+}
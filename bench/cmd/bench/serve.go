@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/scenario"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/server"
+)
+
+const serveUsage = `usage: bench serve [flags]
+
+HTTP API でジョブ (対象の URL、負荷プロファイル、シード) を受け付け、投入された順に1つずつベンチマークを実行する。
+ジョブと結果は -dir に保存され、再起動しても実行待ちのジョブから続ける。
+
+`
+
+// shutdownTimeout サーバーを止めるときに、処理中のリクエストを待つ時間
+const shutdownTimeout = 5 * time.Second
+
+// runServe bench serve サブコマンド。終了コードを返す
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, serveUsage)
+		flags.PrintDefaults()
+	}
+	listen := ""
+	dir := ""
+	benchPath := ""
+	dataDir := ""
+	fixtureDir := ""
+	journeyPath := ""
+	lang := ""
+	flags.StringVar(&listen, "listen", "127.0.0.1:5000", "address of the HTTP API")
+	flags.StringVar(&dir, "dir", "jobs", "directory to store jobs and reports")
+	flags.StringVar(&benchPath, "bench", "", "benchmarker executable to run jobs (this executable if empty)")
+	flags.StringVar(&dataDir, "data-dir", "../initial-data", "data directory")
+	flags.StringVar(&fixtureDir, "fixture-dir", "../webapp/fixture", "fixture directory")
+	flags.StringVar(&journeyPath, "journey", "", "user journey file (YAML) or directory of them")
+	flags.StringVar(&lang, "lang", fails.LocaleJa, "language of messages in reports (ja or en)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if benchPath == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		benchPath = exe
+	}
+	benchArgs := []string{"-data-dir", dataDir, "-fixture-dir", fixtureDir, "-lang", lang}
+	if journeyPath != "" {
+		// 負荷プロファイルの検証でジャーニーの名前を使うので、サーバーでも登録する
+		if _, err := scenario.RegisterJourneys(journeyPath); err != nil {
+			log.Print(err)
+			return 1
+		}
+		benchArgs = append(benchArgs, "-journey", journeyPath)
+	}
+
+	q, err := server.Open(dir, func(path string) error {
+		_, err := loadProfile(path)
+		return err
+	})
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Println("shutting down")
+		cancel()
+	}()
+
+	srv := &http.Server{
+		Addr:    listen,
+		Handler: server.Handler(q),
+		// 進捗を流している接続も止められるように ctx を渡す
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	queueDone := make(chan error, 1)
+	go func() {
+		queueDone <- q.Run(ctx, server.Command(benchPath, benchArgs...))
+	}()
+	serveDone := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", listen)
+		serveDone <- srv.ListenAndServe()
+	}()
+
+	status := 0
+	queueStopped := false
+	select {
+	case err := <-serveDone:
+		log.Print(err)
+		status = 1
+		cancel()
+	case err := <-queueDone:
+		if ctx.Err() == nil {
+			log.Printf("failed to run jobs: %v", err)
+			status = 1
+			cancel()
+		}
+		queueStopped = true
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down: %v", err)
+	}
+	if !queueStopped {
+		// 実行中のジョブは待ち行列に戻してから終わる
+		<-queueDone
+	}
+	return status
+}
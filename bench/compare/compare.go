@@ -0,0 +1,278 @@
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/timeline"
+)
+
+// Run 1回分のベンチマークの結果。結果の JSON かタイムラインから読み込む
+type Run struct {
+	Path     string
+	Score    float64
+	MaxLevel float64
+	// Latencies "GET /api/chair/search.p99" のようなエンドポイントとパーセンタイルごとのレイテンシ (ms)。結果の JSON にのみある
+	Latencies map[string]float64
+	// Errors 結果の JSON ではエラーのコード、タイムラインではエラーの種類ごとのエラー数
+	Errors map[string]float64
+	// ScoreRates 1秒ごとのスコアの増分。タイムラインにのみある
+	ScoreRates []float64
+}
+
+// report 結果の JSON のうち比較に使う項目。古い結果も読めるように reporter.Stdout は使わない
+type report struct {
+	Score    int64 `json:"score"`
+	Messages []struct {
+		Code  string `json:"code"`
+		Text  string `json:"text"`
+		Count int    `json:"count"`
+	} `json:"messages"`
+	Metrics      metrics.Summary     `json:"metrics"`
+	LevelHistory []score.LevelChange `json:"level_history"`
+}
+
+// Load 拡張子が .json なら結果の JSON、.csv か .jsonl ならタイムラインとして読み込む
+func Load(path string) (Run, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Run{}, err
+	}
+	defer f.Close()
+
+	if filepath.Ext(path) == ".json" {
+		return loadReport(path, f)
+	}
+	format, err := timeline.FormatOf(path)
+	if err != nil {
+		return Run{}, err
+	}
+	samples, err := timeline.Read(f, format)
+	if err != nil {
+		return Run{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return fromTimeline(path, samples), nil
+}
+
+func loadReport(path string, r io.Reader) (Run, error) {
+	var rep report
+	if err := json.NewDecoder(r).Decode(&rep); err != nil {
+		return Run{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	run := Run{Path: path, Score: float64(rep.Score), Latencies: make(map[string]float64), Errors: make(map[string]float64)}
+	for _, lc := range rep.LevelHistory {
+		run.MaxLevel = math.Max(run.MaxLevel, float64(lc.Level))
+	}
+	for _, ep := range rep.Metrics.Endpoints {
+		run.Latencies[ep.Route+".p50"] = ep.P50
+		run.Latencies[ep.Route+".p90"] = ep.P90
+		run.Latencies[ep.Route+".p99"] = ep.P99
+	}
+	for _, m := range rep.Messages {
+		// コードのない古い結果はメッセージでまとめる
+		key := m.Code
+		if key == "" {
+			key = m.Text
+		}
+		run.Errors[key] += float64(m.Count)
+	}
+	return run, nil
+}
+
+func fromTimeline(path string, samples []timeline.Sample) Run {
+	run := Run{Path: path, Errors: make(map[string]float64), ScoreRates: make([]float64, 0, len(samples))}
+	for i, s := range samples {
+		run.MaxLevel = math.Max(run.MaxLevel, float64(s.Level))
+		if i > 0 {
+			dt := s.Elapsed - samples[i-1].Elapsed
+			if dt > 0 {
+				run.ScoreRates = append(run.ScoreRates, float64(s.Score-samples[i-1].Score)/dt)
+			}
+		}
+	}
+	if len(samples) > 0 {
+		last := samples[len(samples)-1]
+		run.Score = float64(last.Score)
+		for class, n := range last.Errors {
+			run.Errors[class] = float64(n)
+		}
+	}
+	return run
+}
+
+// Options 回帰とみなす条件。悪化した割合 (%) が Threshold を超え、かつ Welch の t 検定の p 値が Alpha を下回ると回帰とみなす
+// 標本が2つ未満で検定できない指標は、Threshold だけで判定する
+type Options struct {
+	Threshold float64
+	Alpha     float64
+}
+
+// Row 1つの指標の比較結果
+type Row struct {
+	Metric string
+	// HigherIsBetter 値が大きいほど良い指標か
+	HigherIsBetter bool
+	Base           float64
+	Candidate      float64
+	Delta          float64
+	// DeltaPercent 基準が0で値が変わった場合は ±Inf になる
+	DeltaPercent float64
+	// P 検定できない場合は NaN になる
+	P float64
+	// Tested 検定したか。false なら Regression は Threshold だけで判定している
+	Tested     bool
+	Regression bool
+}
+
+type metric struct {
+	name           string
+	higherIsBetter bool
+	// values 1回分の結果から比較する値を取り出す。値がなければ ok が false になる
+	values func(r Run) ([]float64, bool)
+}
+
+func single(v float64) []float64 {
+	return []float64{v}
+}
+
+// metricsOf runs に含まれる指標を、スコア、負荷レベル、レイテンシ、エラー数の順に並べる
+func metricsOf(runs []Run) []metric {
+	ms := []metric{
+		{"score", true, func(r Run) ([]float64, bool) { return single(r.Score), true }},
+		{"max_level", true, func(r Run) ([]float64, bool) { return single(r.MaxLevel), true }},
+		{"score_per_second", true, func(r Run) ([]float64, bool) { return r.ScoreRates, len(r.ScoreRates) > 0 }},
+	}
+
+	latencies, errors := make(map[string]bool), make(map[string]bool)
+	for _, r := range runs {
+		for key := range r.Latencies {
+			latencies[key] = true
+		}
+		for key := range r.Errors {
+			errors[key] = true
+		}
+	}
+	for _, key := range sortedKeys(latencies) {
+		key := key
+		ms = append(ms, metric{"latency." + key, false, func(r Run) ([]float64, bool) {
+			v, ok := r.Latencies[key]
+			return single(v), ok
+		}})
+	}
+	for _, key := range sortedKeys(errors) {
+		key := key
+		ms = append(ms, metric{"errors." + key, false, func(r Run) ([]float64, bool) {
+			// エラーが1件もなければ結果に出てこないため0件とみなす
+			return single(r.Errors[key]), true
+		}})
+	}
+	return ms
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func collect(runs []Run, values func(r Run) ([]float64, bool)) []float64 {
+	xs := make([]float64, 0, len(runs))
+	for _, r := range runs {
+		if v, ok := values(r); ok {
+			xs = append(xs, v...)
+		}
+	}
+	return xs
+}
+
+// Compare base を基準に candidate の指標を比べる。片方にしかない指標は比べない
+// 結果の JSON 1つからは1つの値しか得られないため、検定するにはそれぞれ2回以上の結果が必要になる
+// score_per_second はタイムラインの1秒ごとの値を標本にするので、1回ずつでも検定できる
+func Compare(base, candidate []Run, opt Options) []Row {
+	rows := make([]Row, 0)
+	for _, m := range metricsOf(append(append([]Run{}, base...), candidate...)) {
+		a, b := collect(base, m.values), collect(candidate, m.values)
+		if len(a) == 0 || len(b) == 0 {
+			continue
+		}
+
+		row := Row{Metric: m.name, HigherIsBetter: m.higherIsBetter, Base: mean(a), Candidate: mean(b), P: welch(a, b), Tested: len(a) >= 2 && len(b) >= 2}
+		row.Delta = row.Candidate - row.Base
+		switch {
+		case row.Base != 0:
+			row.DeltaPercent = row.Delta / math.Abs(row.Base) * 100
+		case row.Delta == 0:
+			row.DeltaPercent = 0
+		default:
+			row.DeltaPercent = math.Inf(int(math.Copysign(1, row.Delta)))
+		}
+		worse := row.DeltaPercent
+		if m.higherIsBetter {
+			worse = -worse
+		}
+		row.Regression = worse > opt.Threshold && (!row.Tested || row.P < opt.Alpha)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func formatFloat(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func formatP(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+func formatPercent(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "-"
+	case math.IsInf(v, 0):
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", v)
+}
+
+// Write 比較結果を表にして書き出す
+func Write(w io.Writer, base, candidate []Run, rows []Row) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "base: %d runs, candidate: %d runs\n\n", len(base), len(candidate))
+	fmt.Fprintln(tw, "METRIC\tBASE\tCANDIDATE\tDELTA\tDELTA%\tP\tFLAG")
+	untested := false
+	for _, row := range rows {
+		flag := ""
+		if row.Regression {
+			flag = "REGRESSION"
+		}
+		if !row.Tested {
+			untested = true
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			row.Metric, formatFloat(row.Base), formatFloat(row.Candidate), formatFloat(row.Delta),
+			formatPercent(row.DeltaPercent), formatP(row.P), flag)
+	}
+	if untested {
+		fmt.Fprintln(tw, "\nP が - の指標は標本が2つ未満のため有意性を検定しておらず、-threshold だけで判定しています")
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,179 @@
+package compare
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_welch(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		// 自由度2の t 分布の両側 p 値は 1 - |t|/sqrt(t^2+2) になる
+		{name: "df=2", a: []float64{0, 2}, b: []float64{1, 3}, want: 1 - math.Sqrt(0.2)},
+		{name: "identical", a: []float64{1, 2, 3}, b: []float64{1, 2, 3}, want: 1},
+		{name: "constant", a: []float64{5, 5}, b: []float64{6, 6}, want: 0},
+		{name: "too few", a: []float64{1}, b: []float64{1, 2}, want: math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := welch(tt.a, tt.b)
+			if math.IsNaN(tt.want) {
+				if !math.IsNaN(got) {
+					t.Errorf("welch() = %v, want NaN", got)
+				}
+				return
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("welch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if p := welch([]float64{1000, 1010, 990}, []float64{800, 810, 790}); p > 0.001 {
+		t.Errorf("welch() of separated samples = %v, want < 0.001", p)
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("report", func(t *testing.T) {
+		path := writeFile(t, dir, "result.json", `{
+			"score": 1200,
+			"messages": [
+				{"code": "CHAIR_SEARCH_INVALID_CONTENT", "text": "GET /api/chair/search: レスポンスの内容が不正です", "count": 2},
+				{"text": "古いメッセージ", "count": 1}
+			],
+			"metrics": {"endpoints": [{"route": "GET /api/chair/search", "p50_ms": 10, "p90_ms": 20, "p99_ms": 30}]},
+			"level_history": [{"level": 1}, {"level": 3}, {"level": 2}]
+		}`)
+		run, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Score != 1200 || run.MaxLevel != 3 {
+			t.Errorf("score = %v, max level = %v", run.Score, run.MaxLevel)
+		}
+		if run.Latencies["GET /api/chair/search.p99"] != 30 {
+			t.Errorf("latencies = %v", run.Latencies)
+		}
+		if run.Errors["CHAIR_SEARCH_INVALID_CONTENT"] != 2 || run.Errors["古いメッセージ"] != 1 {
+			t.Errorf("errors = %v", run.Errors)
+		}
+	})
+
+	t.Run("timeline", func(t *testing.T) {
+		csv := writeFile(t, dir, "timeline.csv", strings.Join([]string{
+			"time,elapsed,score,level,workers.chair,in_flight,errors.application",
+			"2020-09-12T10:00:01Z,1.000,100,0,2,3,0",
+			"2020-09-12T10:00:02Z,2.000,300,1,2,3,1",
+			"2020-09-12T10:00:03Z,3.000,400,1,2,3,2",
+		}, "\n")+"\n")
+		jsonl := writeFile(t, dir, "timeline.jsonl", strings.Join([]string{
+			`{"elapsed":1,"score":100,"level":0,"errors":{"application":0}}`,
+			`{"elapsed":2,"score":300,"level":1,"errors":{"application":1}}`,
+			`{"elapsed":3,"score":400,"level":1,"errors":{"application":2}}`,
+		}, "\n")+"\n")
+		for _, path := range []string{csv, jsonl} {
+			run, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.Score != 400 || run.MaxLevel != 1 || run.Errors["application"] != 2 {
+				t.Errorf("%s: %+v", path, run)
+			}
+			if len(run.ScoreRates) != 2 || run.ScoreRates[0] != 200 || run.ScoreRates[1] != 100 {
+				t.Errorf("%s: score rates = %v", path, run.ScoreRates)
+			}
+		}
+	})
+}
+
+func Test_Compare(t *testing.T) {
+	run := func(score, p99, errors float64) Run {
+		return Run{
+			Score:     score,
+			MaxLevel:  3,
+			Latencies: map[string]float64{"GET /api/chair/search.p99": p99},
+			Errors:    map[string]float64{"CHAIR_SEARCH_INVALID_CONTENT": errors},
+		}
+	}
+	base := []Run{run(1000, 100, 0), run(1010, 102, 1), run(990, 98, 0)}
+	candidate := []Run{run(800, 101, 0), run(810, 99, 0), run(790, 100, 1)}
+	rows := Compare(base, candidate, Options{Threshold: 5, Alpha: 0.05})
+
+	got := make(map[string]Row)
+	for _, row := range rows {
+		got[row.Metric] = row
+	}
+	if _, ok := got["score_per_second"]; ok {
+		t.Errorf("score_per_second should be skipped without timelines")
+	}
+	if r := got["score"]; !r.Regression || math.Abs(r.DeltaPercent+20) > 1e-9 {
+		t.Errorf("score = %+v, want a 20%% regression", r)
+	}
+	if r := got["max_level"]; r.Regression || r.Delta != 0 {
+		t.Errorf("max_level = %+v", r)
+	}
+	if r := got["latency.GET /api/chair/search.p99"]; r.Regression {
+		t.Errorf("latency = %+v, want no regression", r)
+	}
+	if r := got["errors.CHAIR_SEARCH_INVALID_CONTENT"]; r.Regression {
+		t.Errorf("errors = %+v, want no regression", r)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, base, candidate, rows); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "REGRESSION") {
+		t.Errorf("Write() does not flag the regression:\n%s", buf.String())
+	}
+}
+
+func Test_CompareSingleRuns(t *testing.T) {
+	base := []Run{{Score: 1000, MaxLevel: 3}}
+	candidate := []Run{{Score: 800, MaxLevel: 3}}
+	rows := Compare(base, candidate, Options{Threshold: 5, Alpha: 0.05})
+
+	got := make(map[string]Row)
+	for _, row := range rows {
+		got[row.Metric] = row
+	}
+	// 1回ずつでは検定できないので、threshold だけで判定する
+	if r := got["score"]; !r.Regression || r.Tested || !math.IsNaN(r.P) {
+		t.Errorf("score = %+v, want an untested regression", r)
+	}
+	if r := got["max_level"]; r.Regression || r.Tested {
+		t.Errorf("max_level = %+v, want no regression", r)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, base, candidate, rows); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "REGRESSION") || !strings.Contains(buf.String(), "検定しておらず") {
+		t.Errorf("Write() does not flag the untested regression:\n%s", buf.String())
+	}
+}
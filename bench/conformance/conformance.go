@@ -0,0 +1,175 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/morikuni/failure"
+)
+
+const (
+	// KindSnapshot verification_data のSnapshotとの比較
+	KindSnapshot = "snapshot"
+	// KindScenario 入稿や購入などのシナリオによる確認
+	KindScenario = "scenario"
+)
+
+// Diff 期待したレスポンスと実際のレスポンスの差分
+type Diff struct {
+	Expected interface{} `json:"expected"`
+	Actual   interface{} `json:"actual"`
+	// Text go-cmp による差分の表示
+	Text string `json:"text"`
+	// Lists id を持つ配列ごとの欠落・余分・重複・並び順の差分
+	Lists []ListDiff `json:"lists,omitempty"`
+	// Fields 値が異なるフィールドの一覧
+	Fields []FieldDiff `json:"fields,omitempty"`
+}
+
+// Check 互換性チェック1件分の結果
+type Check struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Snapshot string `json:"snapshot,omitempty"`
+	Passed   bool   `json:"passed"`
+	Message  string `json:"message,omitempty"`
+	Diff     *Diff  `json:"diff,omitempty"`
+}
+
+// Report 互換性チェックの結果一覧
+type Report struct {
+	Passed int     `json:"passed"`
+	Failed int     `json:"failed"`
+	Checks []Check `json:"checks"`
+}
+
+// Results 1回のベンチマークの互換性チェックの結果を集める
+type Results struct {
+	mu     sync.Mutex
+	checks []Check
+}
+
+func NewResults() *Results {
+	return &Results{checks: make([]Check, 0, 100)}
+}
+
+type contextKey struct{}
+
+// WithResults r を持つ context を返す
+func WithResults(ctx context.Context, r *Results) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext ctx が持つ Results を返す。持っていなければ nil を返し、nil の Results は何も記録しない
+func FromContext(ctx context.Context) *Results {
+	r, _ := ctx.Value(contextKey{}).(*Results)
+	return r
+}
+
+// Add チェックの結果を記録する。err が nil なら成功として扱う
+func (r *Results) Add(kind, name, snapshot string, err error) {
+	if r == nil {
+		return
+	}
+	check := Check{
+		Kind:     kind,
+		Name:     name,
+		Snapshot: snapshot,
+		Passed:   err == nil,
+	}
+	if err != nil {
+		if msg, ok := failure.MessageOf(err); ok {
+			check.Message = msg
+		} else {
+			check.Message = err.Error()
+		}
+		check.Diff = DiffOf(err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check)
+}
+
+// Report 記録したチェックの結果を、種類・名前・Snapshot の順に並べて返す
+func (r *Results) Report() Report {
+	if r == nil {
+		return Report{Checks: []Check{}}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep := Report{Checks: make([]Check, len(r.checks))}
+	copy(rep.Checks, r.checks)
+	sort.SliceStable(rep.Checks, func(i, j int) bool {
+		a, b := rep.Checks[i], rep.Checks[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Snapshot < b.Snapshot
+	})
+	for _, c := range rep.Checks {
+		if c.Passed {
+			rep.Passed++
+		} else {
+			rep.Failed++
+		}
+	}
+
+	return rep
+}
+
+// WriteArtifact 失敗したチェックを差分付きで書き出す
+// 競技者には見せない運営向けの出力なので、レポートとは別のファイルに書き出すこと
+func (r *Results) WriteArtifact(w io.Writer) error {
+	failed := make([]Check, 0)
+	for _, c := range r.Report().Checks {
+		if !c.Passed {
+			failed = append(failed, c)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(failed)
+}
+
+// MismatchError レスポンスが期待したものと一致しなかったことを表す
+type MismatchError struct {
+	Diff Diff
+}
+
+// Error 差分は競技者向けのメッセージやログに出さず、Artifact にだけ書き出す
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("response mismatch: %d list(s) and %d field(s) differ", len(e.Diff.Lists), len(e.Diff.Fields))
+}
+
+// Mismatch expected と actual の差分を持つエラーを作る
+func Mismatch(expected, actual interface{}, opts ...cmp.Option) error {
+	d := Diff{
+		Expected: expected,
+		Actual:   actual,
+		Text:     cmp.Diff(expected, actual, opts...),
+	}
+	// JSON にできない値の場合は go-cmp の差分だけを残す
+	d.Lists, d.Fields, _ = structuredDiff(expected, actual)
+	return &MismatchError{Diff: d}
+}
+
+// DiffOf err が MismatchError を含んでいれば、その差分を返す
+func DiffOf(err error) *Diff {
+	var mErr *MismatchError
+	if !errors.As(err, &mErr) {
+		return nil
+	}
+	return &mErr.Diff
+}
@@ -0,0 +1,212 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// floatTolerance 緯度経度など、言語ごとに丸め方が異なる浮動小数点数の比較に使う許容誤差
+const floatTolerance = 1e-6
+
+// FieldDiff 値が異なるフィールド
+type FieldDiff struct {
+	// Path "chairs[id=10].price" のようなフィールドの位置
+	Path     string      `json:"path"`
+	Expected interface{} `json:"expected"`
+	Actual   interface{} `json:"actual"`
+}
+
+// ListDiff id を持つオブジェクトの配列の差分
+type ListDiff struct {
+	Path string `json:"path"`
+	// MissingIDs 期待したレスポンスにはあるが、実際のレスポンスにはない id
+	MissingIDs []int64 `json:"missing_ids,omitempty"`
+	// ExtraIDs 実際のレスポンスにだけある id
+	ExtraIDs []int64 `json:"extra_ids,omitempty"`
+	// DuplicateIDs 期待したレスポンスと現れる回数が異なり、どちらかで重複している id
+	DuplicateIDs []int64 `json:"duplicate_ids,omitempty"`
+	// OrderDiffers 共通する id の並び順が異なる
+	OrderDiffers bool `json:"order_differs"`
+}
+
+// structuredDiff expected と actual を JSON として比較し、リストとフィールドの差分を求める
+func structuredDiff(expected, actual interface{}) ([]ListDiff, []FieldDiff, error) {
+	e, err := toJSONValue(expected)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := toJSONValue(actual)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := &differ{}
+	d.compare("", e, a)
+	return d.lists, d.fields, nil
+}
+
+func toJSONValue(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var r interface{}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type differ struct {
+	lists  []ListDiff
+	fields []FieldDiff
+}
+
+func (d *differ) compare(path string, expected, actual interface{}) {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			d.addField(path, expected, actual)
+			return
+		}
+		keys := make([]string, 0, len(e)+len(a))
+		for k := range e {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := e[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			d.compare(joinPath(path, k), e[k], a[k])
+		}
+
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			d.addField(path, expected, actual)
+			return
+		}
+		if eIDs, ok := idsOf(e); ok {
+			if aIDs, ok := idsOf(a); ok {
+				d.compareByID(path, e, a, eIDs, aIDs)
+				return
+			}
+		}
+		for i := 0; i < len(e) || i < len(a); i++ {
+			var ev, av interface{}
+			if i < len(e) {
+				ev = e[i]
+			}
+			if i < len(a) {
+				av = a[i]
+			}
+			d.compare(fmt.Sprintf("%s[%d]", path, i), ev, av)
+		}
+
+	case float64:
+		a, ok := actual.(float64)
+		if !ok || math.Abs(e-a) > floatTolerance {
+			d.addField(path, expected, actual)
+		}
+
+	default:
+		if expected != actual {
+			d.addField(path, expected, actual)
+		}
+	}
+}
+
+func (d *differ) compareByID(path string, expected, actual []interface{}, eIDs, aIDs []int64) {
+	eIndex, eCount := indexByID(eIDs)
+	aIndex, aCount := indexByID(aIDs)
+
+	list := ListDiff{Path: path}
+	// 同じ id が複数回現れるときは、最初の要素どうしを比べ、並び順も最初に現れた位置で比べる
+	commonExpected := make([]int64, 0, len(eIDs))
+	for i, id := range eIDs {
+		if eIndex[id] != i {
+			continue
+		}
+		if eCount[id] != aCount[id] && (eCount[id] > 1 || aCount[id] > 1) {
+			list.DuplicateIDs = append(list.DuplicateIDs, id)
+		}
+		j, ok := aIndex[id]
+		if !ok {
+			list.MissingIDs = append(list.MissingIDs, id)
+			continue
+		}
+		commonExpected = append(commonExpected, id)
+		d.compare(fmt.Sprintf("%s[id=%d]", path, id), expected[i], actual[j])
+	}
+	commonActual := make([]int64, 0, len(aIDs))
+	for i, id := range aIDs {
+		if aIndex[id] != i {
+			continue
+		}
+		if _, ok := eIndex[id]; !ok {
+			if aCount[id] > 1 {
+				list.DuplicateIDs = append(list.DuplicateIDs, id)
+			}
+			list.ExtraIDs = append(list.ExtraIDs, id)
+			continue
+		}
+		commonActual = append(commonActual, id)
+	}
+	for i := range commonExpected {
+		if commonExpected[i] != commonActual[i] {
+			list.OrderDiffers = true
+			break
+		}
+	}
+
+	if len(list.MissingIDs) > 0 || len(list.ExtraIDs) > 0 || len(list.DuplicateIDs) > 0 || list.OrderDiffers {
+		d.lists = append(d.lists, list)
+	}
+}
+
+// indexByID id ごとに最初に現れた位置と現れた回数を返す
+func indexByID(ids []int64) (map[int64]int, map[int64]int) {
+	index := make(map[int64]int, len(ids))
+	count := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		if _, ok := index[id]; !ok {
+			index[id] = i
+		}
+		count[id]++
+	}
+	return index, count
+}
+
+func (d *differ) addField(path string, expected, actual interface{}) {
+	d.fields = append(d.fields, FieldDiff{Path: path, Expected: expected, Actual: actual})
+}
+
+// idsOf 配列の要素がすべて数値の id を持つオブジェクトであれば、その id を返す
+func idsOf(list []interface{}) ([]int64, bool) {
+	ids := make([]int64, 0, len(list))
+	for _, v := range list {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		id, ok := m["id"].(float64)
+		if !ok {
+			return nil, false
+		}
+		ids = append(ids, int64(id))
+	}
+	return ids, true
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
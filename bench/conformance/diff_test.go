@@ -0,0 +1,91 @@
+package conformance_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/conformance"
+)
+
+type item struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Price int64  `json:"price"`
+}
+
+type itemsResponse struct {
+	Count int64  `json:"count"`
+	Items []item `json:"items"`
+}
+
+func Test_Mismatch(t *testing.T) {
+	expected := itemsResponse{
+		Count: 3,
+		Items: []item{{ID: 1, Name: "a", Price: 100}, {ID: 2, Name: "b", Price: 200}, {ID: 3, Name: "c", Price: 300}},
+	}
+	actual := itemsResponse{
+		Count: 3,
+		Items: []item{{ID: 2, Name: "b", Price: 200}, {ID: 1, Name: "a", Price: 150}, {ID: 4, Name: "d", Price: 400}},
+	}
+
+	diff := conformance.DiffOf(conformance.Mismatch(expected, actual))
+	if diff == nil {
+		t.Fatal("DiffOf() = nil")
+	}
+
+	wantLists := []conformance.ListDiff{
+		{Path: "items", MissingIDs: []int64{3}, ExtraIDs: []int64{4}, OrderDiffers: true},
+	}
+	if !reflect.DeepEqual(diff.Lists, wantLists) {
+		t.Errorf("Lists = %+v, want %+v", diff.Lists, wantLists)
+	}
+
+	wantFields := []conformance.FieldDiff{
+		{Path: "items[id=1].price", Expected: float64(100), Actual: float64(150)},
+	}
+	if !reflect.DeepEqual(diff.Fields, wantFields) {
+		t.Errorf("Fields = %+v, want %+v", diff.Fields, wantFields)
+	}
+
+	if diff.Text == "" {
+		t.Error("Text is empty")
+	}
+}
+
+func Test_MismatchWithDuplicateIDs(t *testing.T) {
+	expected := itemsResponse{
+		Count: 2,
+		Items: []item{{ID: 1, Name: "a", Price: 100}, {ID: 2, Name: "b", Price: 200}},
+	}
+	actual := itemsResponse{
+		Count: 2,
+		Items: []item{{ID: 1, Name: "a", Price: 100}, {ID: 1, Name: "a", Price: 100}, {ID: 2, Name: "b", Price: 200}, {ID: 3, Name: "c", Price: 300}, {ID: 3, Name: "c", Price: 300}},
+	}
+
+	diff := conformance.DiffOf(conformance.Mismatch(expected, actual))
+	if diff == nil {
+		t.Fatal("DiffOf() = nil")
+	}
+
+	wantLists := []conformance.ListDiff{
+		{Path: "items", ExtraIDs: []int64{3}, DuplicateIDs: []int64{1, 3}},
+	}
+	if !reflect.DeepEqual(diff.Lists, wantLists) {
+		t.Errorf("Lists = %+v, want %+v", diff.Lists, wantLists)
+	}
+	if len(diff.Fields) != 0 {
+		t.Errorf("Fields = %+v, want none", diff.Fields)
+	}
+
+	// 期待したレスポンスの側で重複していてもパニックしない
+	diff = conformance.DiffOf(conformance.Mismatch(actual, expected))
+	if diff == nil {
+		t.Fatal("DiffOf() = nil")
+	}
+	wantLists = []conformance.ListDiff{
+		{Path: "items", MissingIDs: []int64{3}, DuplicateIDs: []int64{1, 3}},
+	}
+	if !reflect.DeepEqual(diff.Lists, wantLists) {
+		t.Errorf("Lists = %+v, want %+v", diff.Lists, wantLists)
+	}
+}
@@ -0,0 +1,202 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/scenario"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+)
+
+type gainKey struct {
+	scenario string
+	endpoint string
+}
+
+// agent coordinator に送る結果を貯めておく
+type agent struct {
+	conn    *conn
+	score   *score.Score
+	metrics *metrics.Recorder
+	workers *scenario.Workers
+
+	mu       sync.Mutex
+	failures []remoteFailure
+	// sentGains, sentRequests 前回までに送った加点の数とリクエストの数
+	sentGains    map[gainKey]int64
+	sentRequests int
+}
+
+func dial(ctx context.Context, addr string) (*conn, error) {
+	var d net.Dialer
+	for {
+		nc, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return newConn(nc), nil
+		}
+		log.Printf("failed to connect to the coordinator: %v", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(parameter.AgentDialInterval):
+		}
+	}
+}
+
+// RunAgent addr の coordinator に接続し、終了を指示されるまで割り当てられたWorkerを動かす
+// 呼び出す前に asset.Initialize で coordinator と同じデータを読み込み、同じジャーニーを登録しておくこと
+func RunAgent(ctx context.Context, addr, name string) error {
+	cn, err := dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer cn.Close()
+	if err := cn.send(message{Type: msgHello, Name: name}); err != nil {
+		return err
+	}
+
+	m, err := cn.receive()
+	if err != nil {
+		return err
+	}
+	if m.Type == msgEnd {
+		log.Println("the coordinator finished without load")
+		return nil
+	}
+	if m.Type != msgSetup || m.Setup == nil {
+		return fmt.Errorf("unexpected message: %s", m.Type)
+	}
+	if err := setup(*m.Setup); err != nil {
+		return err
+	}
+	log.Printf("agent %d: target %s, seed %d", m.Setup.Index, m.Setup.TargetURL, m.Setup.Seed)
+
+	a := &agent{
+		conn:      cn,
+		score:     score.NewFollower(),
+		metrics:   metrics.New(),
+		workers:   scenario.NewWorkers(),
+		sentGains: make(map[gainKey]int64),
+	}
+	e := fails.New()
+	e.Forward(a.addFailure)
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	runCtx = fails.WithErrors(score.WithScore(runCtx, a.score), e)
+	runCtx = metrics.WithRecorder(runCtx, a.metrics)
+	runCtx = scenario.WithWorkers(runCtx, a.workers)
+	runCtx = random.WithSource(runCtx, random.NewSource(m.Setup.Seed))
+
+	asset.Watch(func(ch asset.Change) {
+		if err := cn.send(message{Type: msgChange, Change: &ch}); err != nil {
+			log.Printf("failed to send a change: %v", err)
+		}
+	})
+	defer asset.Watch(nil)
+	if err := cn.send(message{Type: msgReady}); err != nil {
+		return err
+	}
+
+	reportDone := make(chan struct{})
+	go func() {
+		defer close(reportDone)
+		a.reportLoop(runCtx)
+	}()
+
+	assignments := make(map[int64]context.CancelFunc)
+	for {
+		m, err := cn.receive()
+		if err != nil {
+			return fmt.Errorf("connection to the coordinator is lost: %v", err)
+		}
+		switch m.Type {
+		case msgStart:
+			levelCtx, cancelLevel := context.WithCancel(runCtx)
+			assignments[m.Assignment] = cancelLevel
+			scenario.Local.Dispatch(levelCtx, m.Workers)
+		case msgStop:
+			if cancelLevel, ok := assignments[m.Assignment]; ok {
+				cancelLevel()
+				delete(assignments, m.Assignment)
+			}
+		case msgSync:
+			a.score.Sync(m.Score, m.Level)
+		case msgChange:
+			if m.Change != nil {
+				asset.Apply(*m.Change)
+			}
+		case msgEnd:
+			cancel()
+			<-reportDone
+			if err := a.report(); err != nil {
+				return err
+			}
+			return cn.send(message{Type: msgDone})
+		}
+	}
+}
+
+// setup coordinator から受け取った設定をこのプロセスに反映する
+func setup(s Setup) error {
+	if err := scenario.ValidateProfile(s.Profile); err != nil {
+		return fmt.Errorf("profile: %v", err)
+	}
+	if err := client.SetShareTargetURLs(s.TargetURL, ""); err != nil {
+		return err
+	}
+	parameter.Apply(s.Profile)
+	for _, ch := range s.Changes {
+		asset.Apply(ch)
+	}
+	return nil
+}
+
+func (a *agent) addFailure(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failures = append(a.failures, newRemoteFailure(err))
+}
+
+func (a *agent) reportLoop(ctx context.Context) {
+	ticker := time.NewTicker(parameter.AgentReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.report(); err != nil {
+				log.Printf("failed to send a report: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// report 前回から増えた加点、エラー、リクエストの計測結果と、稼働中のWorkerの数を送る
+func (a *agent) report() error {
+	a.mu.Lock()
+	rep := report{Failures: a.failures, Workers: a.workers.Active()}
+	a.failures = nil
+	for _, g := range a.score.Gains() {
+		key := gainKey{scenario: g.Scenario, endpoint: g.Endpoint}
+		if d := g.Count - a.sentGains[key]; d > 0 {
+			rep.Gains = append(rep.Gains, score.Gain{Scenario: g.Scenario, Endpoint: g.Endpoint, Count: d})
+			a.sentGains[key] = g.Count
+		}
+	}
+	rep.Requests = a.metrics.RequestsSince(a.sentRequests)
+	a.sentRequests += len(rep.Requests)
+	a.mu.Unlock()
+
+	return a.conn.send(message{Type: msgReport, Report: &rep})
+}
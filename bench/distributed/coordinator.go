@@ -0,0 +1,414 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/scenario"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+	"github.com/morikuni/failure"
+)
+
+// pinned 最初の agent だけで動かすシナリオ
+// 入稿シナリオは初期データのファイルを順に入稿するので、複数の agent で動かすと同じファイルを入稿してしまう
+var pinned = map[string]bool{
+	scenario.WorkerChairDraftPost:  true,
+	scenario.WorkerEstateDraftPost: true,
+}
+
+// remoteAgent coordinator に接続した agent
+type remoteAgent struct {
+	name string
+	conn *conn
+	// ready Setup を反映し終えると close される
+	ready chan struct{}
+	// done 最後の結果を受け取るか、接続が切れると close される
+	done chan struct{}
+}
+
+// Coordinator 負荷走行のWorkerを agent に割り当て、agent から送られた加点、エラー、リクエストの計測結果をまとめる
+// 負荷レベルの制御と失格の判定は、まとめたスコアとエラーで coordinator が行う
+type Coordinator struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	agents []*remoteAgent
+	// joined agent が接続するたびに close して作り直す
+	joined chan struct{}
+	// changes agent に Setup を送るまでに、このプロセスで起きた asset の変更
+	changes []asset.Change
+	started bool
+	ending  bool
+	stop    chan struct{}
+
+	errors  *fails.Errors
+	score   *score.Score
+	metrics *metrics.Recorder
+	workers *scenario.Workers
+
+	// next 次にWorkerを割り当てる agent。余りが同じ agent に偏らないように順に回す
+	next           int
+	nextAssignment int64
+}
+
+// Listen addr で agent の接続を待ち受ける
+// このプロセスで起きた asset の変更を agent に伝えるため、asset.Initialize の後に呼ぶ
+func Listen(addr string) (*Coordinator, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Coordinator{
+		ln:     ln,
+		joined: make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	asset.Watch(c.onLocalChange)
+	go c.accept()
+	return c, nil
+}
+
+// Addr 待ち受けているアドレス
+func (c *Coordinator) Addr() net.Addr {
+	return c.ln.Addr()
+}
+
+func (c *Coordinator) accept() {
+	for {
+		nc, err := c.ln.Accept()
+		if err != nil {
+			return
+		}
+		go c.join(newConn(nc))
+	}
+}
+
+func (c *Coordinator) join(cn *conn) {
+	m, err := cn.receive()
+	if err != nil || m.Type != msgHello {
+		log.Printf("invalid hello from agent: %v", err)
+		cn.Close()
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started || c.ending {
+		log.Printf("agent %s joined too late", m.Name)
+		cn.send(message{Type: msgEnd})
+		// 送信待ちの end を書き込むまで待つので、c.mu を持たずに閉じる
+		go cn.Close()
+		return
+	}
+	a := &remoteAgent{name: m.Name, conn: cn, ready: make(chan struct{}), done: make(chan struct{})}
+	for _, other := range c.agents {
+		if other.name == a.name {
+			a.name = fmt.Sprintf("%s-%d", a.name, len(c.agents))
+		}
+	}
+	c.agents = append(c.agents, a)
+	close(c.joined)
+	c.joined = make(chan struct{})
+	log.Printf("agent %s joined", a.name)
+	go c.read(a)
+}
+
+// read a から送られたメッセージを処理する
+func (c *Coordinator) read(a *remoteAgent) {
+	defer close(a.done)
+	readyClosed := false
+	for {
+		m, err := a.conn.receive()
+		if err != nil {
+			c.lost(a, err)
+			return
+		}
+		switch m.Type {
+		case msgReady:
+			if !readyClosed {
+				close(a.ready)
+				readyClosed = true
+			}
+		case msgReport:
+			if m.Report != nil {
+				c.apply(a, *m.Report)
+			}
+		case msgChange:
+			if m.Change != nil {
+				c.applyChange(a, *m.Change)
+			}
+		case msgDone:
+			return
+		}
+	}
+}
+
+// lost 最後の結果を送らずに接続が切れた agent を扱う
+func (c *Coordinator) lost(a *remoteAgent, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ending {
+		return
+	}
+	if !c.started {
+		// 負荷走行の前であれば、待ち受けを続ける
+		for i, other := range c.agents {
+			if other == a {
+				c.agents = append(c.agents[:i], c.agents[i+1:]...)
+				break
+			}
+		}
+		log.Printf("agent %s left: %v", a.name, err)
+		return
+	}
+	c.errors.Add(failure.New(fails.ErrBenchmarker, fails.Message("AGENT_DISCONNECTED", "agentとの接続が切れました"), failure.Messagef("agent: %s", a.name)))
+}
+
+// apply agent が送った結果を、このプロセスのスコア、エラー、リクエストの計測結果に加える
+func (c *Coordinator) apply(a *remoteAgent, rep report) {
+	c.mu.Lock()
+	sc, e, m, workers := c.score, c.errors, c.metrics, c.workers
+	c.mu.Unlock()
+
+	for _, g := range rep.Gains {
+		for i := int64(0); i < g.Count; i++ {
+			sc.Add(g.Scenario, g.Endpoint)
+		}
+	}
+	for _, f := range rep.Failures {
+		e.Add(f.err())
+	}
+	for _, r := range rep.Requests {
+		m.Record(r)
+	}
+	if rep.Workers != nil {
+		workers.SetRemote(a.name, rep.Workers)
+	}
+}
+
+// connectedAgents 接続している agent の一覧の複製。c.mu を持って呼ぶ
+func (c *Coordinator) connectedAgents() []*remoteAgent {
+	return append([]*remoteAgent{}, c.agents...)
+}
+
+// broadcast agents のうち except 以外に m を送る。c.mu を持たずに呼ぶ
+func broadcast(agents []*remoteAgent, m message, except *remoteAgent) {
+	for _, a := range agents {
+		if a == except {
+			continue
+		}
+		if err := a.conn.send(m); err != nil {
+			log.Printf("failed to send %s to agent %s: %v", m.Type, a.name, err)
+		}
+	}
+}
+
+// onLocalChange このプロセスで起きた asset の変更を agent に伝える。Setup を送る前であれば Setup で送る
+func (c *Coordinator) onLocalChange(ch asset.Change) {
+	c.mu.Lock()
+	if !c.started {
+		c.changes = append(c.changes, ch)
+		c.mu.Unlock()
+		return
+	}
+	agents := c.connectedAgents()
+	c.mu.Unlock()
+	broadcast(agents, message{Type: msgChange, Change: &ch}, nil)
+}
+
+// applyChange agent で起きた asset の変更をこのプロセスに反映し、他の agent に伝える
+func (c *Coordinator) applyChange(from *remoteAgent, ch asset.Change) {
+	asset.Apply(ch)
+	c.mu.Lock()
+	agents := c.connectedAgents()
+	c.mu.Unlock()
+	broadcast(agents, message{Type: msgChange, Change: &ch}, from)
+}
+
+// Start n 台の agent の接続を待ち、負荷走行の設定を送る。すべての agent の準備が終わるまで待つ
+// 以降は ctx が持つ Score、Errors、リクエストの集計と稼働中のWorkerの数に agent の結果を加える
+func (c *Coordinator) Start(ctx context.Context, n int, targetURL string, seed int64, profile parameter.Profile) error {
+	waitCtx, cancel := context.WithTimeout(ctx, parameter.AgentWaitTimeout)
+	defer cancel()
+
+	for {
+		c.mu.Lock()
+		joined, count := c.joined, len(c.agents)
+		c.mu.Unlock()
+		if count >= n {
+			break
+		}
+		log.Printf("waiting for agents (%d/%d)", count, n)
+		select {
+		case <-joined:
+		case <-waitCtx.Done():
+			return fmt.Errorf("%d of %d agents joined", count, n)
+		}
+	}
+
+	c.mu.Lock()
+	c.started = true
+	c.errors = fails.FromContext(ctx)
+	c.score = score.FromContext(ctx)
+	c.metrics = metrics.FromContext(ctx)
+	c.workers = scenario.WorkersFromContext(ctx)
+	for _, extra := range c.agents[n:] {
+		extra.conn.send(message{Type: msgEnd})
+	}
+	c.agents = c.agents[:n]
+	// 接続した順に、元のシードから agent ごとのシードを決める
+	rnd := random.FromContext(ctx).New("agent", 0)
+	for i, a := range c.agents {
+		setup := &Setup{Index: i, TargetURL: targetURL, Seed: rnd.Int63(), Profile: profile, Changes: c.changes}
+		if err := a.conn.send(message{Type: msgSetup, Setup: setup}); err != nil {
+			c.mu.Unlock()
+			return fmt.Errorf("agent %s: %v", a.name, err)
+		}
+	}
+	c.changes = nil
+	agents := c.connectedAgents()
+	c.mu.Unlock()
+
+	for _, a := range agents {
+		select {
+		case <-a.ready:
+		case <-a.done:
+			return fmt.Errorf("agent %s: disconnected before ready", a.name)
+		case <-waitCtx.Done():
+			return fmt.Errorf("agent %s: not ready", a.name)
+		}
+	}
+	log.Printf("%d agents are ready (seed: %d)", n, seed)
+
+	go c.syncLoop()
+	return nil
+}
+
+// syncLoop coordinator のスコアと負荷レベルを agent に送り続ける
+// agent の検索条件やリクエストの計測結果は、負荷レベルによって変わる
+func (c *Coordinator) syncLoop() {
+	ticker := time.NewTicker(parameter.AgentReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			agents := c.connectedAgents()
+			c.mu.Unlock()
+			broadcast(agents, message{Type: msgSync, Score: c.score.GetScore(), Level: c.score.GetLevel()}, nil)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// split incWorkers を agent の数 n に分ける
+func (c *Coordinator) split(incWorkers parameter.IncWorkers, n int) []parameter.IncWorkers {
+	parts := make([]parameter.IncWorkers, n)
+	for i := range parts {
+		parts[i] = parameter.IncWorkers{}
+	}
+	names := make([]string, 0, len(incWorkers))
+	for name := range incWorkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for i := 0; i < incWorkers[name]; i++ {
+			k := 0
+			if !pinned[name] {
+				k = c.next % n
+				c.next++
+			}
+			parts[k][name]++
+		}
+	}
+	return parts
+}
+
+// Dispatch incWorkers のWorkerを agent に分けて起動させ、ctx が終了したら止めさせる
+func (c *Coordinator) Dispatch(ctx context.Context, incWorkers parameter.IncWorkers) {
+	c.mu.Lock()
+	if c.ending || len(c.agents) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	c.nextAssignment++
+	id := c.nextAssignment
+	parts := c.split(incWorkers, len(c.agents))
+	agents := c.connectedAgents()
+	c.mu.Unlock()
+
+	assigned := make([]*remoteAgent, 0, len(agents))
+	for i, a := range agents {
+		if len(parts[i]) == 0 {
+			continue
+		}
+		if err := a.conn.send(message{Type: msgStart, Assignment: id, Workers: parts[i]}); err != nil {
+			log.Printf("failed to start workers on agent %s: %v", a.name, err)
+			continue
+		}
+		assigned = append(assigned, a)
+	}
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		ending := c.ending
+		c.mu.Unlock()
+		if ending {
+			return
+		}
+		for _, a := range assigned {
+			a.conn.send(message{Type: msgStop, Assignment: id})
+		}
+	}()
+}
+
+// Finish agent にWorkerを止めさせ、最後の結果を受け取るまで parameter.AgentFinishTimeout だけ待つ
+func (c *Coordinator) Finish() {
+	c.mu.Lock()
+	if c.ending {
+		c.mu.Unlock()
+		return
+	}
+	c.ending = true
+	close(c.stop)
+	agents := c.connectedAgents()
+	c.mu.Unlock()
+	broadcast(agents, message{Type: msgEnd}, nil)
+
+	timeout := time.After(parameter.AgentFinishTimeout)
+	for _, a := range agents {
+		select {
+		case <-a.done:
+		case <-timeout:
+			log.Printf("agent %s did not finish in time", a.name)
+			return
+		}
+	}
+}
+
+// Close 待ち受けと agent との接続を閉じる。負荷走行をしなかった agent にも終了を伝える
+func (c *Coordinator) Close() error {
+	c.Finish()
+	asset.Watch(nil)
+
+	c.mu.Lock()
+	agents := c.connectedAgents()
+	c.mu.Unlock()
+	for _, a := range agents {
+		a.conn.Close()
+	}
+	return c.ln.Close()
+}
@@ -0,0 +1,257 @@
+package distributed
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/scenario"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+	"github.com/morikuni/failure"
+)
+
+// fakeAgent coordinator とメッセージをやりとりするだけの agent
+type fakeAgent struct {
+	t    *testing.T
+	conn *conn
+	msgs chan message
+}
+
+func dialFake(t *testing.T, addr net.Addr, name string) *fakeAgent {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &fakeAgent{t: t, conn: newConn(nc), msgs: make(chan message, 100)}
+	go func() {
+		defer close(a.msgs)
+		for {
+			m, err := a.conn.receive()
+			if err != nil {
+				return
+			}
+			a.msgs <- m
+		}
+	}()
+	a.send(message{Type: msgHello, Name: name})
+	return a
+}
+
+func (a *fakeAgent) send(m message) {
+	a.t.Helper()
+	if err := a.conn.send(m); err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+// expect typ のメッセージを受け取るまで待つ。sync は読み飛ばす
+func (a *fakeAgent) expect(typ string) message {
+	a.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m, ok := <-a.msgs:
+			if !ok {
+				a.t.Fatalf("connection is closed while waiting for %s", typ)
+			}
+			if m.Type == typ {
+				return m
+			}
+			if m.Type != msgSync {
+				a.t.Fatalf("got %s, want %s", m.Type, typ)
+			}
+		case <-timeout:
+			a.t.Fatalf("timed out waiting for %s", typ)
+		}
+	}
+}
+
+func total(ws ...parameter.IncWorkers) parameter.IncWorkers {
+	sum := parameter.IncWorkers{}
+	for _, w := range ws {
+		for name, n := range w {
+			sum[name] += n
+		}
+	}
+	return sum
+}
+
+func TestCoordinator(t *testing.T) {
+	c, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	agents := []*fakeAgent{dialFake(t, c.Addr(), "a"), dialFake(t, c.Addr(), "a")}
+
+	sc := score.New()
+	e := fails.New()
+	ctx := fails.WithErrors(score.WithScore(context.Background(), sc), e)
+
+	started := make(chan error, 1)
+	go func() {
+		started <- c.Start(ctx, 2, "http://127.0.0.1:1323", 1, parameter.CurrentProfile())
+	}()
+	// 接続を受け付ける順は決まらないので、Setup の番号で並べ直す
+	seeds := map[int64]bool{}
+	byIndex := make([]*fakeAgent, len(agents))
+	for _, a := range agents {
+		m := a.expect(msgSetup)
+		if m.Setup.TargetURL != "http://127.0.0.1:1323" {
+			t.Errorf("target url = %s", m.Setup.TargetURL)
+		}
+		byIndex[m.Setup.Index] = a
+		seeds[m.Setup.Seed] = true
+		a.send(message{Type: msgReady})
+	}
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+	agents = byIndex
+	if len(seeds) != 2 {
+		t.Errorf("seeds of agents are not distinct: %v", seeds)
+	}
+
+	// 入稿シナリオは最初の agent だけに割り当て、それ以外は均等に分ける
+	levelCtx, cancelLevel := context.WithCancel(ctx)
+	inc := parameter.IncWorkers{scenario.WorkerChairSearch: 4, scenario.WorkerChairDraftPost: 2}
+	c.Dispatch(levelCtx, inc)
+	starts := make([]parameter.IncWorkers, len(agents))
+	for i, a := range agents {
+		starts[i] = a.expect(msgStart).Workers
+	}
+	if got := total(starts...); got[scenario.WorkerChairSearch] != 4 || got[scenario.WorkerChairDraftPost] != 2 {
+		t.Errorf("assigned workers = %v, want %v", got, inc)
+	}
+	if starts[1][scenario.WorkerChairDraftPost] != 0 {
+		t.Errorf("draft post workers are assigned to the second agent: %v", starts[1])
+	}
+	if starts[0][scenario.WorkerChairSearch] != 2 || starts[1][scenario.WorkerChairSearch] != 2 {
+		t.Errorf("search workers are not split evenly: %v", starts)
+	}
+	cancelLevel()
+	for _, a := range agents {
+		a.expect(msgStop)
+	}
+
+	// agent の変更は他の agent にだけ伝える
+	change := asset.Change{Kind: asset.ChangeChairStockDecremented, ID: -1}
+	agents[0].send(message{Type: msgChange, Change: &change})
+	if m := agents[1].expect(msgChange); *m.Change != change {
+		t.Errorf("forwarded change = %+v, want %+v", *m.Change, change)
+	}
+
+	endpoint := "POST /api/chair/buy/:id"
+	for _, a := range agents {
+		a.send(message{Type: msgReport, Report: &report{
+			Gains:    []score.Gain{{Scenario: scenario.WorkerChairSearch, Endpoint: endpoint, Count: 3}},
+			Failures: []remoteFailure{newRemoteFailure(failure.New(fails.ErrApplication, fails.Message("CHAIR_BUY_INVALID_STATUS", "POST /api/chair/buy/:id: レスポンスコードが不正です")))},
+		}})
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		c.Finish()
+		close(finished)
+	}()
+	for _, a := range agents {
+		a.expect(msgEnd)
+		a.send(message{Type: msgDone})
+	}
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Finish did not return")
+	}
+
+	want := 6 * parameter.ScoreWeights[endpoint]
+	if got := sc.GetScore(); got != want {
+		t.Errorf("score = %d, want %d", got, want)
+	}
+	if got := e.CountByCode()[fails.ErrApplication]; got != 2 {
+		t.Errorf("application errors = %d, want 2", got)
+	}
+	for _, f := range e.Failures() {
+		if f.Code != "CHAIR_BUY_INVALID_STATUS" {
+			t.Errorf("failure code = %s, want CHAIR_BUY_INVALID_STATUS", f.Code)
+		}
+	}
+}
+
+func TestCoordinatorLostAgent(t *testing.T) {
+	c, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	a := dialFake(t, c.Addr(), "a")
+	e := fails.New()
+	ctx := fails.WithErrors(score.WithScore(context.Background(), score.New()), e)
+	started := make(chan error, 1)
+	go func() {
+		started <- c.Start(ctx, 1, "http://127.0.0.1:1323", 1, parameter.CurrentProfile())
+	}()
+	a.expect(msgSetup)
+	a.send(message{Type: msgReady})
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+
+	a.conn.Close()
+	timeout := time.After(5 * time.Second)
+	for e.CountByCode()[fails.ErrBenchmarker] == 0 {
+		select {
+		case <-timeout:
+			t.Fatal("lost agent is not recorded as an error")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// 相手が読んでいなくても send は書き込みを待たず、Close で送信待ちのメッセージを書き込む
+func TestConnSendDoesNotWait(t *testing.T) {
+	local, remote := net.Pipe()
+	cn, peer := newConn(local), newConn(remote)
+	defer peer.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := cn.send(message{Type: msgSync, Level: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := make(chan int64, 100)
+	go func() {
+		defer close(received)
+		for {
+			m, err := peer.receive()
+			if err != nil {
+				return
+			}
+			received <- m.Level
+		}
+	}()
+	if err := cn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := int64(0)
+	for level := range received {
+		if level != want {
+			t.Fatalf("received level %d, want %d", level, want)
+		}
+		want++
+	}
+	if want != 100 {
+		t.Errorf("received %d messages, want 100", want)
+	}
+	if err := cn.send(message{Type: msgSync}); err == nil {
+		t.Error("send() after Close() returns no error")
+	}
+}
@@ -0,0 +1,221 @@
+package distributed
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+	"github.com/morikuni/failure"
+)
+
+// coordinator と agent の間でやりとりするメッセージの種類。1行に1つの JSON で送る
+const (
+	// agent → coordinator
+	msgHello  = "hello"
+	msgReady  = "ready"
+	msgReport = "report"
+	msgDone   = "done"
+
+	// coordinator → agent
+	msgSetup = "setup"
+	msgStart = "start"
+	msgStop  = "stop"
+	msgSync  = "sync"
+	msgEnd   = "end"
+
+	// 双方向。agent の変更は coordinator が他の agent に伝える
+	msgChange = "change"
+)
+
+// Setup 負荷走行の前に coordinator が agent に送る設定
+type Setup struct {
+	// Index agent の番号。接続した順に0から振る
+	Index     int               `json:"index"`
+	TargetURL string            `json:"target_url"`
+	Seed      int64             `json:"seed"`
+	Profile   parameter.Profile `json:"profile"`
+	// Changes 接続するまでに coordinator で起きた asset の変更
+	Changes []asset.Change `json:"changes"`
+}
+
+// remoteFailure agent で記録したエラー。coordinator で同じコードとメッセージのエラーに作り直す
+type remoteFailure struct {
+	Code     string        `json:"code,omitempty"`
+	Messages []fails.Coded `json:"messages,omitempty"`
+}
+
+// errRemote コードのないエラーを作り直すときの元のエラー
+var errRemote = errors.New("error on agent")
+
+func newRemoteFailure(err error) remoteFailure {
+	f := remoteFailure{Messages: fails.MessagesOf(err)}
+	if code, ok := failure.CodeOf(err); ok {
+		f.Code = code.ErrorCode()
+	}
+	return f
+}
+
+func (f remoteFailure) err() error {
+	wrappers := make([]failure.Wrapper, 0, len(f.Messages))
+	for _, msg := range f.Messages {
+		wrappers = append(wrappers, msg)
+	}
+	if f.Code == "" {
+		return failure.Wrap(errRemote, wrappers...)
+	}
+	return failure.New(failure.StringCode(f.Code), wrappers...)
+}
+
+// report agent が parameter.AgentReportInterval ごとに送る、前回から増えた分の結果
+type report struct {
+	// Gains Count だけが前回からの増分になる
+	Gains    []score.Gain      `json:"gains,omitempty"`
+	Failures []remoteFailure   `json:"failures,omitempty"`
+	Requests []metrics.Request `json:"requests,omitempty"`
+	// Workers 種類ごとの稼働中のWorkerの数
+	Workers map[string]int64 `json:"workers,omitempty"`
+}
+
+type message struct {
+	Type string `json:"type"`
+
+	// Name hello で送る agent の名前
+	Name  string `json:"name,omitempty"`
+	Setup *Setup `json:"setup,omitempty"`
+
+	// Assignment start と stop で、起動するWorkerの組を表す
+	Assignment int64                `json:"assignment,omitempty"`
+	Workers    parameter.IncWorkers `json:"workers,omitempty"`
+
+	// Score, Level sync で送る coordinator のスコアと負荷レベル
+	Score int64 `json:"score,omitempty"`
+	Level int64 `json:"level,omitempty"`
+
+	Report *report       `json:"report,omitempty"`
+	Change *asset.Change `json:"change,omitempty"`
+}
+
+// connQueueSize 1つの接続で書き込みを待てるメッセージの数。これを超えると send は書き込みが進むまで待つ
+const connQueueSize = 4096
+
+// connFlushTimeout Close で、送信待ちのメッセージを書き込み終えるまで待つ時間
+const connFlushTimeout = 1 * time.Second
+
+// errConnClosed 閉じた接続に送ろうとしたときのエラー
+var errConnClosed = errors.New("connection is closed")
+
+// conn メッセージを送受信する接続。送信は複数の goroutine から行える
+// 送信したメッセージは writeLoop が順に書き込むので、send はネットワークへの書き込みを待たない
+type conn struct {
+	c   net.Conn
+	dec *json.Decoder
+
+	out  chan message
+	quit chan struct{}
+	// done writeLoop が終わると close される。err は書き込みに失敗したときのエラー
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+}
+
+func newConn(c net.Conn) *conn {
+	cn := &conn{
+		c:    c,
+		dec:  json.NewDecoder(bufio.NewReader(c)),
+		out:  make(chan message, connQueueSize),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go cn.writeLoop()
+	return cn
+}
+
+// writeLoop 送信待ちのメッセージを書き込む。続けて届いたメッセージはまとめて flush する
+func (c *conn) writeLoop() {
+	defer close(c.done)
+	w := bufio.NewWriter(c.c)
+	enc := json.NewEncoder(w)
+	write := func(m message) bool {
+		if err := enc.Encode(m); err != nil {
+			c.err = err
+			return false
+		}
+		if len(c.out) > 0 {
+			return true
+		}
+		if err := w.Flush(); err != nil {
+			c.err = err
+			return false
+		}
+		return true
+	}
+
+	for {
+		select {
+		case m := <-c.out:
+			if !write(m) {
+				return
+			}
+		case <-c.quit:
+			for {
+				select {
+				case m := <-c.out:
+					if !write(m) {
+						return
+					}
+				default:
+					if err := w.Flush(); err != nil {
+						c.err = err
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *conn) send(m message) error {
+	select {
+	case <-c.done:
+		return c.closedErr()
+	default:
+	}
+	select {
+	case c.out <- m:
+		return nil
+	case <-c.done:
+		return c.closedErr()
+	}
+}
+
+// closedErr done が close された後に呼ぶ
+func (c *conn) closedErr() error {
+	if c.err != nil {
+		return c.err
+	}
+	return errConnClosed
+}
+
+func (c *conn) receive() (message, error) {
+	var m message
+	err := c.dec.Decode(&m)
+	return m, err
+}
+
+// Close 送信待ちのメッセージを connFlushTimeout まで書き込んでから閉じる
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.quit)
+		c.c.SetWriteDeadline(time.Now().Add(connFlushTimeout))
+	})
+	<-c.done
+	return c.c.Close()
+}
@@ -0,0 +1,192 @@
+package evidence
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+)
+
+// Request 記録したリクエスト。Body は parameter.MaxEvidenceBodySize で切り詰める
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Response 記録したレスポンス。Size は切り詰める前のボディの大きさ
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Size       int64
+}
+
+// Entry 1回のリクエストとレスポンスの組
+type Entry struct {
+	// Session リクエストを送ったセッション。セッションの外で送ったリクエストは0になる
+	Session int64
+	// Route metrics.RouteOf の形式のエンドポイント
+	Route     string
+	StartedAt time.Time
+	Duration  time.Duration
+	Request   Request
+	// Response レスポンスを受け取れなかった場合は nil になり、Error に理由が入る
+	Response *Response
+	Error    string
+}
+
+// Failure fails に記録されたエラーと、その原因になったリクエストの記録
+type Failure struct {
+	Time    time.Time
+	Message string
+	// Entries 古い順に並べた、同じセッションの直近のリクエスト。最後がエラーになったリクエスト
+	Entries []Entry
+}
+
+// Recorder 直近のリクエストを固定長のリングに記録し、エラーと結び付ける
+type Recorder struct {
+	ring []Entry
+	// next 次に書き込む ring の位置
+	next int
+	// full ring を一周したか
+	full bool
+
+	failures []Failure
+	// dropped parameter.MaxEvidenceFailures を超えたために記録しなかったエラーの数
+	dropped int
+
+	mu sync.Mutex
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		ring:     make([]Entry, parameter.NumOfEvidenceEntries),
+		failures: make([]Failure, 0, parameter.MaxEvidenceFailures),
+	}
+}
+
+type contextKey struct{}
+
+type sessionKey struct{}
+
+var lastSession int64
+
+// WithRecorder r を持つ context を返す
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext ctx が持つ Recorder を返す。持っていなければ nil を返す
+// nil の Recorder は何も記録しない
+func FromContext(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(contextKey{}).(*Recorder)
+	return r
+}
+
+// WithSession 新しいセッションの context を返す。同じセッションのリクエストはエラーの前後関係として一緒に記録される
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, atomic.AddInt64(&lastSession, 1))
+}
+
+// SessionOf ctx のセッションを返す。セッションの外であれば0を返す
+func SessionOf(ctx context.Context) int64 {
+	s, _ := ctx.Value(sessionKey{}).(int64)
+	return s
+}
+
+// Record ctx のセッションのリクエストとして e を記録する。リングが一杯なら最も古いものを上書きする
+func (r *Recorder) Record(ctx context.Context, e Entry) {
+	if r == nil {
+		return
+	}
+	e.Session = SessionOf(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ring[r.next] = e
+	r.next++
+	if r.next == len(r.ring) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// recent 新しい順に match を満たすものを n 件まで返す
+func (r *Recorder) recent(n int, match func(e *Entry) bool) []Entry {
+	entries := make([]Entry, 0, n)
+	size := r.next
+	if r.full {
+		size = len(r.ring)
+	}
+	for i := 1; i <= size && len(entries) < n; i++ {
+		e := &r.ring[(r.next-i+len(r.ring))%len(r.ring)]
+		if match(e) {
+			entries = append(entries, *e)
+		}
+	}
+	return entries
+}
+
+// routeOf "GET /api/chair/search: レスポンスの内容が不正です" のようなメッセージからエンドポイントを取り出す
+func routeOf(msg string) string {
+	i := strings.Index(msg, ": ")
+	if i < 0 {
+		return ""
+	}
+	return msg[:i]
+}
+
+// Attach msg のエラーの原因になったリクエストを探し、エラーと一緒に記録する
+// メッセージのエンドポイントへの、ctx のセッションの最新のリクエストをエラーになったリクエストとみなし、
+// そこまでの同じセッションのリクエストを parameter.NumOfEvidencePerFailure 件まで含める
+func (r *Recorder) Attach(ctx context.Context, msg string) {
+	if r == nil {
+		return
+	}
+	session, route := SessionOf(ctx), routeOf(msg)
+	if session == 0 && route == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.failures) >= parameter.MaxEvidenceFailures {
+		r.dropped++
+		return
+	}
+
+	// セッションの外では並行するリクエストと区別できないため、エンドポイントが一致するものだけを使う
+	found := false
+	entries := r.recent(parameter.NumOfEvidencePerFailure, func(e *Entry) bool {
+		if !found {
+			found = e.Session == session && (route == "" || e.Route == route)
+			return found
+		}
+		return session != 0 && e.Session == session
+	})
+	if len(entries) == 0 {
+		return
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	r.failures = append(r.failures, Failure{Time: time.Now(), Message: msg, Entries: entries})
+}
+
+// Failures 記録したエラーと、上限を超えて記録しなかったエラーの数
+func (r *Recorder) Failures() ([]Failure, int) {
+	if r == nil {
+		return []Failure{}, 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := make([]Failure, len(r.failures))
+	copy(f, r.failures)
+	return f, r.dropped
+}
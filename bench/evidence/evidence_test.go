@@ -0,0 +1,120 @@
+package evidence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+)
+
+func entry(route string) Entry {
+	return Entry{
+		Route:     route,
+		StartedAt: time.Now(),
+		Request:   Request{Method: "GET", URL: "http://localhost/api?x=1", Header: http.Header{}},
+		Response:  &Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte("{}"), Size: 2},
+	}
+}
+
+func routes(entries []Entry) []string {
+	rs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		rs = append(rs, e.Route)
+	}
+	return rs
+}
+
+func TestAttach(t *testing.T) {
+	r := NewRecorder()
+	a := WithSession(context.Background())
+	b := WithSession(context.Background())
+
+	r.Record(a, entry("GET /api/chair/low_priced"))
+	r.Record(a, entry("GET /api/chair/search"))
+	r.Record(b, entry("GET /api/chair/search"))
+	r.Record(a, entry("GET /api/chair/:id"))
+	r.Record(context.Background(), entry("GET /api/estate/search"))
+
+	// a のセッションのうち、エラーになったエンドポイントへの最新のリクエストまでを結び付ける
+	r.Attach(a, "GET /api/chair/search: レスポンスの内容が不正です")
+	// セッションの外ではエンドポイントが一致するリクエストだけを結び付ける
+	r.Attach(context.Background(), "GET /api/estate/search: レスポンスの内容が不正です")
+	// エンドポイントもセッションもわからなければ結び付けない
+	r.Attach(context.Background(), "運営に連絡してください")
+
+	failures, _ := r.Failures()
+	if len(failures) != 2 {
+		t.Fatalf("failures = %d, want 2", len(failures))
+	}
+	if got := routes(failures[0].Entries); len(got) != 2 || got[0] != "GET /api/chair/low_priced" || got[1] != "GET /api/chair/search" || failures[0].Entries[1].Session != SessionOf(a) {
+		t.Errorf("entries of session a = %v", got)
+	}
+	if got := routes(failures[1].Entries); len(got) != 1 || got[0] != "GET /api/estate/search" {
+		t.Errorf("entries out of session = %v", got)
+	}
+}
+
+func TestRingIsBounded(t *testing.T) {
+	r := NewRecorder()
+	ctx := WithSession(context.Background())
+	r.Record(ctx, entry("GET /api/chair/search"))
+	for i := 0; i < parameter.NumOfEvidenceEntries; i++ {
+		r.Record(ctx, entry("GET /api/chair/:id"))
+	}
+
+	// 最初のリクエストは上書きされている
+	r.Attach(ctx, "GET /api/chair/search: レスポンスの内容が不正です")
+	if failures, _ := r.Failures(); len(failures) != 0 {
+		t.Errorf("failures = %v, want none", failures)
+	}
+
+	for i := 0; i < parameter.MaxEvidenceFailures+3; i++ {
+		r.Attach(ctx, "GET /api/chair/:id: レスポンスの内容が不正です")
+	}
+	if failures, dropped := r.Failures(); len(failures) != parameter.MaxEvidenceFailures || dropped != 3 {
+		t.Errorf("failures = %d, dropped = %d", len(failures), dropped)
+	}
+}
+
+func TestWriteHAR(t *testing.T) {
+	r := NewRecorder()
+	ctx := WithSession(context.Background())
+	e := entry("POST /api/estate/nazotte")
+	e.Request.Method = "POST"
+	e.Request.Body = []byte(`{"coordinates":[]}`)
+	e.Request.Header.Set("Content-Type", "application/json")
+	e.Response = &Response{StatusCode: http.StatusInternalServerError, Header: http.Header{}, Body: []byte("oops"), Size: 10}
+	r.Record(ctx, e)
+	timedOut := entry("GET /api/estate/low_priced")
+	timedOut.Response, timedOut.Error = nil, "timeout"
+	r.Record(ctx, timedOut)
+	r.Attach(ctx, "POST /api/estate/nazotte: レスポンスコードが不正です")
+	r.Attach(ctx, "GET /api/estate/low_priced: リクエストに失敗しました")
+
+	var buf bytes.Buffer
+	if err := r.WriteHAR(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var har harLog
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatalf("invalid HAR: %v", err)
+	}
+	if len(har.Log.Pages) != 2 || har.Log.Pages[0].Title != "POST /api/estate/nazotte: レスポンスコードが不正です" {
+		t.Fatalf("pages = %+v", har.Log.Pages)
+	}
+	// 2件目のエラーには同じセッションの直前のリクエストも含まれる
+	if len(har.Log.Entries) != 3 {
+		t.Fatalf("entries = %d, want 3", len(har.Log.Entries))
+	}
+	first := har.Log.Entries[0]
+	if first.PageRef != "failure_1" || first.Response.Status != http.StatusInternalServerError || first.Request.PostData == nil || first.Response.Content.Comment == "" {
+		t.Errorf("first entry = %+v", first)
+	}
+	if last := har.Log.Entries[2]; last.PageRef != "failure_2" || last.Response.Status != 0 || last.Error != "timeout" {
+		t.Errorf("last entry = %+v", last)
+	}
+}
@@ -0,0 +1,211 @@
+package evidence
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/) のうち、ベンチマーカーが書き出す項目
+
+type harLog struct {
+	Log harContent `json:"log"`
+}
+
+type harContent struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Pages   []harPage  `json:"pages"`
+	Entries []harEntry `json:"entries"`
+	Comment string     `json:"comment,omitempty"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// harPage エラー1件ごとに1ページとし、エラーメッセージを title にする
+type harPage struct {
+	StartedDateTime string         `json:"startedDateTime"`
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	PageTimings     harPageTimings `json:"pageTimings"`
+}
+
+type harPageTimings struct{}
+
+type harEntry struct {
+	PageRef         string      `json:"pageref"`
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// Error レスポンスを受け取れなかった理由 (HAR の独自拡張)
+	Error string `json:"_error,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponseContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status      int                `json:"status"`
+	StatusText  string             `json:"statusText"`
+	HTTPVersion string             `json:"httpVersion"`
+	Cookies     []harNameValue     `json:"cookies"`
+	Headers     []harNameValue     `json:"headers"`
+	Content     harResponseContent `json:"content"`
+	RedirectURL string             `json:"redirectURL"`
+	HeadersSize int                `json:"headersSize"`
+	BodySize    int64              `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harTime(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nvs := make([]harNameValue, 0, len(h))
+	for _, name := range names {
+		for _, v := range h[name] {
+			nvs = append(nvs, harNameValue{Name: name, Value: v})
+		}
+	}
+	return nvs
+}
+
+func harQuery(rawURL string) []harNameValue {
+	nvs := make([]harNameValue, 0)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nvs
+	}
+	return harHeaders(http.Header(u.Query()))
+}
+
+func newHAREntry(pageRef string, e Entry) harEntry {
+	req := harRequest{
+		Method:      e.Request.Method,
+		URL:         e.Request.URL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(e.Request.Header),
+		QueryString: harQuery(e.Request.URL),
+		HeadersSize: -1,
+		BodySize:    len(e.Request.Body),
+	}
+	if len(e.Request.Body) > 0 {
+		req.PostData = &harPostData{MimeType: e.Request.Header.Get("Content-Type"), Text: string(e.Request.Body)}
+	}
+
+	// レスポンスを受け取れなかったリクエストは status を0にする
+	res := harResponse{
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []harNameValue{},
+		Headers:     []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	if e.Response != nil {
+		res.Status = e.Response.StatusCode
+		res.StatusText = http.StatusText(e.Response.StatusCode)
+		res.Headers = harHeaders(e.Response.Header)
+		res.Content = harResponseContent{
+			Size:     e.Response.Size,
+			MimeType: e.Response.Header.Get("Content-Type"),
+			Text:     string(e.Response.Body),
+		}
+		if int64(len(e.Response.Body)) < e.Response.Size {
+			res.Content.Comment = "truncated to " + strconv.Itoa(len(e.Response.Body)) + " bytes"
+		}
+		res.BodySize = e.Response.Size
+	}
+
+	return harEntry{
+		PageRef:         pageRef,
+		StartedDateTime: harTime(e.StartedAt),
+		Time:            millis(e.Duration),
+		Request:         req,
+		Response:        res,
+		// 送信と受信の内訳は計測していないため、すべて wait に含める
+		Timings: harTimings{Send: 0, Wait: millis(e.Duration), Receive: 0},
+		Error:   e.Error,
+	}
+}
+
+// WriteHAR 記録したエラーとリクエストを HAR 形式で w に書き出す
+func (r *Recorder) WriteHAR(w io.Writer) error {
+	failures, dropped := r.Failures()
+
+	content := harContent{
+		Version: "1.2",
+		Creator: harCreator{Name: "isucon10-qualify-bench", Version: "1.0"},
+		Pages:   make([]harPage, 0, len(failures)),
+		Entries: make([]harEntry, 0),
+	}
+	if dropped > 0 {
+		content.Comment = strconv.Itoa(dropped) + " failures were not recorded"
+	}
+	for i, f := range failures {
+		id := "failure_" + strconv.Itoa(i+1)
+		content.Pages = append(content.Pages, harPage{
+			StartedDateTime: harTime(f.Entries[0].StartedAt),
+			ID:              id,
+			Title:           f.Message,
+		})
+		for _, e := range f.Entries {
+			content.Entries = append(content.Entries, newHAREntry(id, e))
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(harLog{Log: content})
+}
@@ -0,0 +1,263 @@
+package fails
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/morikuni/failure"
+)
+
+// 結果に出力するメッセージの言語
+const (
+	LocaleJa = "ja"
+	LocaleEn = "en"
+)
+
+// Severity エラーの重大度。fails のコードから決まる
+type Severity string
+
+const (
+	// SeverityCritical 1件でも失格になるエラー
+	SeverityCritical Severity = "critical"
+	// SeverityError 減点され、一定数を超えると失格になるエラー
+	SeverityError Severity = "error"
+	// SeverityWarning 大目に見るエラー
+	SeverityWarning Severity = "warning"
+)
+
+// Failure 記録したエラー
+// Code はエラーを作るときに Message で付けた値で、ベンチマークをまたいでエラーを集計するために使う
+type Failure struct {
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	Ja       string   `json:"ja"`
+	En       string   `json:"en"`
+}
+
+// Text locale のメッセージ。未対応の言語であれば日本語を返す
+func (f Failure) Text(locale string) string {
+	if locale == LocaleEn {
+		return f.En
+	}
+	return f.Ja
+}
+
+// msgContactOrganizers ベンチマーカーや想定外のエラーで、元のメッセージの代わりに記録するメッセージ
+const msgContactOrganizers = "運営に連絡してください"
+
+// codeContactOrganizers msgContactOrganizers のコード
+const codeContactOrganizers = "CONTACT_ORGANIZERS"
+
+// CodeUncataloged コードが付いていないエラーのコード
+const CodeUncataloged = "UNCATALOGED"
+
+// Coded コードを付けたメッセージ。Code が空のものは snapshot のパスのような補足のメッセージ
+type Coded struct {
+	Code string `json:"code,omitempty"`
+	Text string `json:"text"`
+}
+
+// Message code を付けたメッセージ。failure.Message の代わりにエラーを作るところで付ける
+// code は catalog に登録しておく
+func Message(code, text string) Coded {
+	return Coded{Code: code, Text: text}
+}
+
+// WrapError failure.Wrapper を満たす
+func (m Coded) WrapError(err error) error {
+	return &withCoded{m, err}
+}
+
+type withCoded struct {
+	coded      Coded
+	underlying error
+}
+
+func (w *withCoded) Error() string {
+	return fmt.Sprintf("%s: %s", w.coded.Text, w.underlying)
+}
+
+func (w *withCoded) UnwrapError() error {
+	return w.underlying
+}
+
+func (w *withCoded) Unwrap() error {
+	return w.underlying
+}
+
+// As failure.MessageOf などで failure.Message としても取り出せるようにする
+func (w *withCoded) As(x interface{}) bool {
+	switch t := x.(type) {
+	case *Coded:
+		*t = w.coded
+		return true
+	case *failure.Message:
+		*t = failure.Message(w.coded.Text)
+		return true
+	}
+	return false
+}
+
+// endpoints エンドポイントのコードの接頭辞と、メッセージに使うルート
+var endpoints = map[string]string{
+	"INITIALIZE":              "POST /initialize",
+	"CHAIR_DETAIL":            "GET /api/chair/:id",
+	"CHAIR_POST":              "POST /api/chair",
+	"CHAIR_SEARCH_CONDITION":  "GET /api/chair/search/condition",
+	"CHAIR_SEARCH":            "GET /api/chair/search",
+	"CHAIR_LOW_PRICED":        "GET /api/chair/low_priced",
+	"CHAIR_BUY":               "POST /api/chair/buy/:id",
+	"ESTATE_DETAIL":           "GET /api/estate/:id",
+	"ESTATE_POST":             "POST /api/estate",
+	"ESTATE_SEARCH_CONDITION": "GET /api/estate/search/condition",
+	"ESTATE_SEARCH":           "GET /api/estate/search",
+	"ESTATE_LOW_PRICED":       "GET /api/estate/low_priced",
+	"ESTATE_NAZOTTE":          "POST /api/estate/nazotte",
+	"ESTATE_REQ_DOC":          "POST /api/estate/req_doc/:id",
+	"RECOMMENDED_CHAIR":       "GET /api/recommended_chair/:id",
+	"RECOMMENDED_ESTATE":      "GET /api/recommended_estate/:id",
+}
+
+// details エンドポイントの接頭辞に続くコードの接尾辞と、英語のメッセージ
+var details = map[string]string{
+	"REQUEST_FAILED":         "request failed",
+	"REQUEST_TIMEOUT":        "request timed out",
+	"INVALID_STATUS":         "invalid status code",
+	"INVALID_RESPONSE":       "invalid response",
+	"INVALID_CONTENT":        "invalid response content",
+	"INVALID_JSON":           "failed to decode JSON",
+	"LANGUAGE_NOT_SET":       "implementation language is not set",
+	"SNAPSHOT_INVALID":       "invalid snapshot",
+	"SNAPSHOT_READ":          "failed to read a snapshot",
+	"SNAPSHOT_DIR_NOT_FOUND": "snapshot directory not found",
+	"SNAPSHOT_RESPONSE_BODY": "failed to unmarshal the response body of a snapshot",
+	"SNAPSHOT_REQUEST_BODY":  "failed to unmarshal the request body of a snapshot",
+	"SNAPSHOT_REQUEST_QUERY": "failed to unmarshal the request query of a snapshot",
+	// レスポンスの内容の検証で見つかった違反の種類
+	"ORDER":      "results are not in the expected order",
+	"STOCK":      "a sold-out chair is included",
+	"MEMBERSHIP": "results include unexpected items or miss expected ones",
+	"COUNT":      "the number of results is wrong",
+	"PAGE":       "the page of results is wrong",
+}
+
+// messages エンドポイントを含まないコードと、英語のメッセージ
+var messages = map[string]string{
+	codeContactOrganizers:                 "please contact the organizers",
+	"INVALID_ARGUMENTS":                   "failed to parse command line arguments",
+	"INVALID_MODE":                        "invalid mode",
+	"INVALID_LANG":                        "invalid language",
+	"ASSET_INITIALIZE":                    "failed to initialize assets",
+	"AGENT_SETUP":                         "failed to set up agents",
+	"AGENT_DISCONNECTED":                  "lost connection to an agent",
+	"VERIFY_TIMEOUT":                      "application compatibility check timed out",
+	"CHAIR_CSV_POST":                      "failed to post chairs as CSV",
+	"ESTATE_CSV_POST":                     "failed to post estates as CSV",
+	"CHAIR_CONDITION_NOT_LOADED":          "chair search condition is not loaded",
+	"ESTATE_CONDITION_NOT_LOADED":         "estate search condition is not loaded",
+	"CHAIR_DETAIL_FAILED":                 "failed to get a chair detail",
+	"CHAIR_BUY_FAILED":                    "failed to buy a chair",
+	"POSTED_CHAIR_INVALID":                "posted chair data is invalid",
+	"POSTED_ESTATE_INVALID":               "posted estate data is invalid",
+	"CHAIR_EXISTS_BEFORE_POST":            "a chair exists before it is posted",
+	"ESTATE_EXISTS_BEFORE_POST":           "an estate exists before it is posted",
+	"CHAIR_IN_STOCK_SOLD_OUT":             "a chair in stock is sold out",
+	"CHAIR_SOLD_OUT_LISTED":               "a sold-out chair is listed",
+	"CHAIR_SOLD_OUT_DETAIL":               "the detail of a sold-out chair is shown",
+	"UNREGISTERED_CHAIR_DETAIL_RESPONSE":  "invalid response for the detail of an unregistered chair",
+	"UNREGISTERED_CHAIR_DETAIL_CONTENT":   "invalid response content for the detail of an unregistered chair",
+	"UNREGISTERED_ESTATE_DETAIL_RESPONSE": "invalid response for the detail of an unregistered estate",
+	"REGISTERED_CHAIR_DETAIL_FAILED":      "failed to get the detail of a registered chair",
+	"REGISTERED_ESTATE_DETAIL_FAILED":     "failed to get the detail of a registered estate",
+}
+
+// severitySuffixes fails のコードごとにメッセージとコードに付ける接尾辞
+var severitySuffixes = map[failure.StringCode]struct {
+	code, ja, en string
+}{
+	ErrCritical:  {"", " (critical error)", " (critical error)"},
+	ErrTimeout:   {"_TIMEOUT", " (タイムアウトしました)", " (timed out)"},
+	ErrTemporary: {"_TEMPORARY", " (一時的なエラー)", " (temporary error)"},
+}
+
+// english code の英語のメッセージを catalog から引く
+// エンドポイントを含むコードは、接頭辞のルートと接尾辞のメッセージをつなげる
+func english(code string) (string, bool) {
+	if en, ok := messages[code]; ok {
+		return en, true
+	}
+	for prefix, route := range endpoints {
+		if !strings.HasPrefix(code, prefix+"_") {
+			continue
+		}
+		if en, ok := details[strings.TrimPrefix(code, prefix+"_")]; ok {
+			return route + ": " + en, true
+		}
+	}
+	return "", false
+}
+
+// MessagesOf err に付けられたメッセージを外側から順に返す。failure.Message で付けたものは Code が空になる
+func MessagesOf(err error) []Coded {
+	msgs := make([]Coded, 0, 2)
+	i := failure.NewIterator(err)
+	for i.Next() {
+		var c Coded
+		if i.As(&c) {
+			msgs = append(msgs, c)
+			continue
+		}
+		var msg failure.Message
+		if i.As(&msg) {
+			msgs = append(msgs, Coded{Text: msg.String()})
+		}
+	}
+	return msgs
+}
+
+// newFailure err と fails のコードから Failure を作る
+// 外側から順に見て最初にコードが付いていたメッセージでコードを決め、snapshot のパスのような
+// コードのないメッセージは括弧に入れて付け加える。内側のコードの付いたメッセージは使わない
+func newFailure(err error, code failure.Code) Failure {
+	msgs := MessagesOf(err)
+	if len(msgs) == 0 || code == ErrBenchmarker {
+		return Failure{Code: codeContactOrganizers, Severity: SeverityCritical, Ja: msgContactOrganizers, En: messages[codeContactOrganizers]}
+	}
+
+	f := Failure{Code: CodeUncataloged, Severity: SeverityError}
+	extras := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		switch {
+		case m.Code == "":
+			extras = append(extras, m.Text)
+		case f.Code == CodeUncataloged:
+			f.Code, f.Ja = m.Code, m.Text
+			f.En = m.Text
+			if en, ok := english(m.Code); ok {
+				f.En = en
+			}
+		}
+	}
+	if f.Code == CodeUncataloged {
+		f.Ja, f.En, extras = extras[0], extras[0], extras[1:]
+	}
+	if len(extras) > 0 {
+		detail := " (" + strings.Join(extras, ", ") + ")"
+		f.Ja += detail
+		f.En += detail
+	}
+
+	switch code {
+	case ErrCritical:
+		f.Severity = SeverityCritical
+	case ErrTimeout, ErrTemporary:
+		f.Severity = SeverityWarning
+	}
+	sc, _ := code.(failure.StringCode)
+	if s, ok := severitySuffixes[sc]; ok {
+		f.Code += s.code
+		f.Ja += s.ja
+		f.En += s.en
+	}
+	return f
+}
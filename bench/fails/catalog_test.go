@@ -0,0 +1,143 @@
+package fails
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/morikuni/failure"
+)
+
+func TestNewFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Failure
+	}{
+		{
+			name: "endpoint",
+			err:  failure.New(ErrApplication, Message("CHAIR_SEARCH_INVALID_CONTENT", "GET /api/chair/search: レスポンスの内容が不正です")),
+			want: Failure{Code: "CHAIR_SEARCH_INVALID_CONTENT", Severity: SeverityError, Ja: "GET /api/chair/search: レスポンスの内容が不正です", En: "GET /api/chair/search: invalid response content"},
+		},
+		{
+			name: "violation",
+			err:  failure.New(ErrApplication, Message("CHAIR_SEARCH_ORDER", "GET /api/chair/search: レスポンスの内容が不正です")),
+			want: Failure{Code: "CHAIR_SEARCH_ORDER", Severity: SeverityError, Ja: "GET /api/chair/search: レスポンスの内容が不正です", En: "GET /api/chair/search: results are not in the expected order"},
+		},
+		{
+			name: "status",
+			err:  failure.New(ErrApplication, Message("CHAIR_BUY_REQUEST_FAILED", "POST /api/chair/buy/:id: リクエストに失敗しました"), failure.Message("status: 400, code: SOLD_OUT")),
+			want: Failure{Code: "CHAIR_BUY_REQUEST_FAILED", Severity: SeverityError, Ja: "POST /api/chair/buy/:id: リクエストに失敗しました (status: 400, code: SOLD_OUT)", En: "POST /api/chair/buy/:id: request failed (status: 400, code: SOLD_OUT)"},
+		},
+		{
+			name: "timeout",
+			err:  failure.New(ErrTimeout, Message("ESTATE_DETAIL_REQUEST_FAILED", "GET /api/estate/:id: リクエストに失敗しました")),
+			want: Failure{Code: "ESTATE_DETAIL_REQUEST_FAILED_TIMEOUT", Severity: SeverityWarning, Ja: "GET /api/estate/:id: リクエストに失敗しました (タイムアウトしました)", En: "GET /api/estate/:id: request failed (timed out)"},
+		},
+		{
+			name: "critical",
+			err:  failure.New(ErrCritical, Message("INITIALIZE_LANGUAGE_NOT_SET", "POST /initialize: 実装言語が設定されていません")),
+			want: Failure{Code: "INITIALIZE_LANGUAGE_NOT_SET", Severity: SeverityCritical, Ja: "POST /initialize: 実装言語が設定されていません (critical error)", En: "POST /initialize: implementation language is not set (critical error)"},
+		},
+		{
+			name: "without endpoint",
+			err:  failure.New(ErrApplication, Message("CHAIR_SOLD_OUT_LISTED", "売り切れたイスが存在します")),
+			want: Failure{Code: "CHAIR_SOLD_OUT_LISTED", Severity: SeverityError, Ja: "売り切れたイスが存在します", En: "a sold-out chair is listed"},
+		},
+		{
+			name: "snapshot",
+			err:  failure.New(ErrApplication, Message("CHAIR_DETAIL_INVALID_RESPONSE", "GET /api/chair/:id: レスポンスが不正です"), failure.Messagef("snapshot: %s", "chair/1.json")),
+			want: Failure{Code: "CHAIR_DETAIL_INVALID_RESPONSE", Severity: SeverityError, Ja: "GET /api/chair/:id: レスポンスが不正です (snapshot: chair/1.json)", En: "GET /api/chair/:id: invalid response (snapshot: chair/1.json)"},
+		},
+		{
+			name: "outermost code",
+			err: failure.Translate(
+				failure.New(ErrApplication, Message("CHAIR_DETAIL_REQUEST_FAILED", "GET /api/chair/:id: リクエストに失敗しました")),
+				ErrApplication, Message("REGISTERED_CHAIR_DETAIL_FAILED", "登録済みイスの詳細取得に失敗しました"),
+			),
+			want: Failure{Code: "REGISTERED_CHAIR_DETAIL_FAILED", Severity: SeverityError, Ja: "登録済みイスの詳細取得に失敗しました", En: "failed to get the detail of a registered chair"},
+		},
+		{
+			name: "benchmarker",
+			err:  failure.New(ErrBenchmarker, Message("INVALID_MODE", "不正なモードです"), failure.Messagef("mode: %s", "fast")),
+			want: Failure{Code: "CONTACT_ORGANIZERS", Severity: SeverityCritical, Ja: "運営に連絡してください", En: "please contact the organizers"},
+		},
+		{
+			name: "uncataloged",
+			err:  failure.New(ErrApplication, failure.Message("なにかがおかしい")),
+			want: Failure{Code: CodeUncataloged, Severity: SeverityError, Ja: "なにかがおかしい", En: "なにかがおかしい"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := failure.CodeOf(tt.err)
+			if got := newFailure(tt.err, code); got != tt.want {
+				t.Errorf("newFailure() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageOf(t *testing.T) {
+	err := failure.New(ErrApplication, Message("CHAIR_SEARCH_ORDER", "GET /api/chair/search: レスポンスの内容が不正です"))
+	if msg, ok := failure.MessageOf(err); !ok || msg != "GET /api/chair/search: レスポンスの内容が不正です" {
+		t.Errorf("failure.MessageOf() = %q, %v", msg, ok)
+	}
+}
+
+// TestCatalogCoversMessages ソースコードでエラーに付けたコードがすべてカタログにあり、
+// コードを付けずに日本語のメッセージを付けているところがないか確認する
+func TestCatalogCoversMessages(t *testing.T) {
+	coded := regexp.MustCompile(`(?:fails\.Message|withErrorCode)\("([^"]*)"`)
+	endpoint := regexp.MustCompile(`(?:invalidContent|invalidResponse)\(.*, "([A-Z_]+)", "`)
+	uncoded := regexp.MustCompile(`failure\.Messagef?\("([^"]*[^\x00-\x7f][^"]*)"`)
+	err := filepath.Walk("..", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, m := range coded.FindAllStringSubmatch(string(b), -1) {
+			if _, ok := english(m[1]); !ok {
+				t.Errorf("%s: %s is not in the catalog", path, m[1])
+			}
+		}
+		for _, m := range endpoint.FindAllStringSubmatch(string(b), -1) {
+			if _, ok := endpoints[m[1]]; !ok {
+				t.Errorf("%s: %s is not an endpoint in the catalog", path, m[1])
+			}
+		}
+		for _, m := range uncoded.FindAllStringSubmatch(string(b), -1) {
+			t.Errorf("%s: %q has no code", path, m[1])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCatalogCodesAreUnique コードから英語のメッセージが1通りに決まるか確認する
+func TestCatalogCodesAreUnique(t *testing.T) {
+	seen := make(map[string]string)
+	for code, en := range messages {
+		seen[code] = en
+	}
+	for prefix, route := range endpoints {
+		for detail, en := range details {
+			code := prefix + "_" + detail
+			if other, ok := seen[code]; ok {
+				t.Errorf("%s is used for both %q and %q", code, route+": "+en, other)
+			}
+			seen[code] = route + ": " + en
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"log"
+	"strings"
 	"sync"
 
+	"github.com/isucon10-qualify/isucon10-qualify/bench/evidence"
 	"github.com/morikuni/failure"
 )
 
@@ -24,87 +26,201 @@ const (
 	ErrBot failure.StringCode = "error bot"
 )
 
-var (
+// Errors 1回のベンチマークで発生したエラーを集める
+type Errors struct {
 	msgs []string
+	// failures msgs と同じ順に、コードと重大度を付けたエラー
+	failures []Failure
 
 	critical    int
 	application int
 	trivial     int
 
-	failChan chan bool
+	// counts failure.Code ごとのエラー数
+	counts map[failure.Code]int
+
+	// failChan 失格条件を満たしたことの通知。受け取る側は Get で状態を確認するため、溜まっていれば捨てる
+	failChan chan struct{}
+
+	// forward 記録したエラーを渡す先。分散実行の agent が coordinator にエラーを送るために使う
+	forward func(err error)
 
 	mu sync.RWMutex
-)
+}
 
-func init() {
-	msgs = make([]string, 0, 100)
-	failChan = make(chan bool, 1)
+func New() *Errors {
+	return &Errors{
+		msgs:     make([]string, 0, 100),
+		failures: make([]Failure, 0, 100),
+		counts:   make(map[failure.Code]int),
+		failChan: make(chan struct{}, 1),
+	}
 }
 
-func GetMsgs() []string {
-	mu.RLock()
-	defer mu.RUnlock()
+type contextKey struct{}
 
-	return msgs[:]
+// WithErrors e を持つ context を返す
+func WithErrors(ctx context.Context, e *Errors) context.Context {
+	return context.WithValue(ctx, contextKey{}, e)
 }
 
-func Get() ([]string, int, int, int) {
-	mu.RLock()
-	defer mu.RUnlock()
-	return msgs[:], critical, application, trivial
+// FromContext ctx が持つ Errors を返す。持っていなければ nil を返す
+func FromContext(ctx context.Context) *Errors {
+	e, _ := ctx.Value(contextKey{}).(*Errors)
+	return e
 }
 
-func Add(err error) {
-	if err == nil {
+// Add ctx が持つ Errors にエラーを追加する
+// ctx が evidence.Recorder を持っていれば、エラーの原因になったリクエストの記録と結び付ける
+func Add(ctx context.Context, err error) {
+	FromContext(ctx).Add(err)
+	if err == nil || ignored(err) {
 		return
 	}
+	if msg, ok := failure.MessageOf(err); ok {
+		evidence.FromContext(ctx).Attach(ctx, msg)
+	}
+}
 
+// ignored ベンチマークの終了などで打ち切られたリクエストのエラーは記録しない
+func ignored(err error) bool {
 	cause := failure.CauseOf(err)
-	if errors.Is(cause, context.DeadlineExceeded) || errors.Is(cause, context.Canceled) {
+	return errors.Is(cause, context.DeadlineExceeded) || errors.Is(cause, context.Canceled)
+}
+
+func (e *Errors) GetMsgs() []string {
+	if e == nil {
+		return nil
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.msgs[:]
+}
+
+func (e *Errors) Get() ([]string, int, int, int) {
+	if e == nil {
+		return nil, 0, 0, 0
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.msgs[:], e.critical, e.application, e.trivial
+}
+
+// Failures 記録したエラーを、コードと重大度、日本語と英語のメッセージ付きで返す
+func (e *Errors) Failures() []Failure {
+	if e == nil {
+		return []Failure{}
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	f := make([]Failure, len(e.failures))
+	copy(f, e.failures)
+	return f
+}
+
+// Codes タイムライン等で集計するエラーの種類
+var Codes = []failure.StringCode{ErrCritical, ErrApplication, ErrTimeout, ErrTemporary, ErrBenchmarker, ErrBot}
+
+// ClassOf "error timeout" のような fails のコードから "timeout" のようなエラーの種類の名前を作る
+func ClassOf(code failure.StringCode) string {
+	return strings.TrimPrefix(code.ErrorCode(), "error ")
+}
+
+// CountByCode エラーの種類ごとの発生数
+func (e *Errors) CountByCode() map[failure.Code]int {
+	if e == nil {
+		return map[failure.Code]int{}
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	c := make(map[failure.Code]int, len(e.counts))
+	for code, n := range e.counts {
+		c[code] = n
+	}
+	return c
+}
+
+// Add エラーを追加する。Errors が nil の場合はログに出すだけにする
+func (e *Errors) Add(err error) {
+	if err == nil {
+		return
+	}
+
+	if ignored(err) {
+		return
+	}
+
+	if e == nil {
+		log.Printf("%+v", err)
 		return
 	}
 
-	mu.Lock()
-	defer mu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.forward != nil {
+		e.forward(err)
+	}
 
 	msg, ok := failure.MessageOf(err)
 	code, _ := failure.CodeOf(err)
+	e.counts[code]++
+	e.failures = append(e.failures, newFailure(err, code))
 
 	if ok {
 		switch code {
 		case ErrCritical:
 			msg += " (critical error)"
-			critical++
+			e.critical++
 		case ErrTimeout:
 			msg += " (タイムアウトしました)"
-			trivial++
+			e.trivial++
 		case ErrTemporary:
 			msg += " (一時的なエラー)"
-			trivial++
+			e.trivial++
 		case ErrApplication:
-			application++
+			e.application++
 		case ErrBenchmarker:
-			msgs = append(msgs, "運営に連絡してください")
-			critical++
+			e.msgs = append(e.msgs, msgContactOrganizers)
+			e.critical++
 			return
 		default:
-			application++
+			e.application++
 		}
 
-		msgs = append(msgs, msg)
+		e.msgs = append(e.msgs, msg)
 	} else {
 		// 想定外のエラーなのでcritical扱いにしておく
-		critical++
-		msgs = append(msgs, "運営に連絡してください")
+		e.critical++
+		e.msgs = append(e.msgs, msgContactOrganizers)
 	}
 
-	if critical > 0 || application >= 10 {
-		failChan <- true
+	if e.critical > 0 || e.application >= 10 {
+		select {
+		case e.failChan <- struct{}{}:
+		default:
+		}
 	}
 
 	log.Printf("%+v", err)
 }
 
-func Fail() chan bool {
-	return failChan
+// Forward 以降に記録するエラーを f にも渡す。f はロックを持ったまま呼ぶので、e を使ってはいけない
+func (e *Errors) Forward(f func(err error)) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.forward = f
+}
+
+// Fail 失格条件を満たすと通知されるチャネル
+func (e *Errors) Fail() <-chan struct{} {
+	if e == nil {
+		return nil
+	}
+	return e.failChan
 }
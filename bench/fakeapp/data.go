@@ -0,0 +1,160 @@
+package fakeapp
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+)
+
+const (
+	numOfChairs  = 500
+	numOfEstates = 5000
+)
+
+var (
+	chairColors   = []string{"黒", "白", "赤", "青", "緑", "黄"}
+	chairKinds    = []string{"ゲーミングチェア", "座椅子", "エルゴノミクス", "ハンモック"}
+	chairFeatures = []string{"折りたたみ可", "肘掛け", "キャスター", "リクライニング", "低反発", "高反発"}
+
+	estateFeatures = []string{"バストイレ別", "駅から徒歩5分", "ペット飼育可能", "オートロック", "角部屋", "日当たり良好"}
+)
+
+// rangeCondition bounds を境界にした範囲の条件を作る。最初と最後の範囲は片側が開いている
+func rangeCondition(prefix, suffix string, bounds ...int64) asset.RangeCondition {
+	ranges := make([]*asset.Range, 0, len(bounds)+1)
+	min := int64(-1)
+	for i, b := range bounds {
+		ranges = append(ranges, &asset.Range{ID: int64(i), Min: min, Max: b})
+		min = b
+	}
+	ranges = append(ranges, &asset.Range{ID: int64(len(bounds)), Min: min, Max: -1})
+	return asset.RangeCondition{Prefix: prefix, Suffix: suffix, Ranges: ranges}
+}
+
+func chairSearchCondition() asset.ChairSearchCondition {
+	return asset.ChairSearchCondition{
+		Width:   rangeCondition("", "cm", 80, 110, 150),
+		Height:  rangeCondition("", "cm", 80, 110, 150),
+		Depth:   rangeCondition("", "cm", 80, 110, 150),
+		Price:   rangeCondition("", "円", 3000, 6000, 9000, 12000, 15000),
+		Color:   asset.ListCondition{List: chairColors},
+		Feature: asset.ListCondition{List: chairFeatures},
+		Kind:    asset.ListCondition{List: chairKinds},
+	}
+}
+
+func estateSearchCondition() asset.EstateSearchCondition {
+	return asset.EstateSearchCondition{
+		DoorWidth:  rangeCondition("", "cm", 80, 110, 150),
+		DoorHeight: rangeCondition("", "cm", 80, 110, 150),
+		Rent:       rangeCondition("", "円", 50000, 100000, 150000),
+		Feature:    asset.ListCondition{List: estateFeatures},
+	}
+}
+
+func takeFeatures(rnd *rand.Rand, list []string) string {
+	s := make([]string, len(list))
+	copy(s, list)
+	rnd.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+	return strings.Join(s[:rnd.Intn(len(s)/2+1)], ",")
+}
+
+func generateChairs(rnd *rand.Rand) []asset.JSONChair {
+	chairs := make([]asset.JSONChair, 0, numOfChairs)
+	for i := 1; i <= numOfChairs; i++ {
+		chairs = append(chairs, asset.JSONChair{
+			ID:          int64(i),
+			Name:        "イス" + strconv.Itoa(i),
+			Description: "ベンチマーカーのテスト用のイス",
+			Thumbnail:   "/images/chair/" + strconv.Itoa(i) + ".png",
+			Price:       1000 + rnd.Int63n(19000),
+			Height:      50 + rnd.Int63n(150),
+			Width:       50 + rnd.Int63n(150),
+			Depth:       50 + rnd.Int63n(150),
+			Color:       chairColors[rnd.Intn(len(chairColors))],
+			Features:    takeFeatures(rnd, chairFeatures),
+			Popularity:  rnd.Int63n(100000),
+			Kind:        chairKinds[rnd.Intn(len(chairKinds))],
+			Stock:       1 + rnd.Int63n(5),
+		})
+	}
+	return chairs
+}
+
+func generateEstates(rnd *rand.Rand) []asset.JSONEstate {
+	estates := make([]asset.JSONEstate, 0, numOfEstates)
+	for i := 1; i <= numOfEstates; i++ {
+		estates = append(estates, asset.JSONEstate{
+			ID:          int64(i),
+			Thumbnail:   "/images/estate/" + strconv.Itoa(i) + ".png",
+			Name:        "物件" + strconv.Itoa(i),
+			Description: "ベンチマーカーのテスト用の物件",
+			Address:     "テスト県テスト市" + strconv.Itoa(i),
+			// なぞって検索の範囲になりうる日本の周辺に置く
+			Latitude:   32 + rnd.Float64()*13,
+			Longitude:  128 + rnd.Float64()*18,
+			DoorHeight: 50 + rnd.Int63n(150),
+			DoorWidth:  50 + rnd.Int63n(150),
+			Popularity: rnd.Int63n(100000),
+			Rent:       30000 + rnd.Int63n(170000),
+			Features:   takeFeatures(rnd, estateFeatures),
+		})
+	}
+	return estates
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(v)
+}
+
+func writeJSONLines(path string, n int, row func(i int) interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for i := 0; i < n; i++ {
+		if err := enc.Encode(row(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Generate seed から作ったイスと物件を、initial-data と webapp/fixture と同じ構成で dir に書き出す
+// asset.Initialize と NewServer にはどちらも dir を渡す
+func Generate(dir string, seed int64) error {
+	rnd := rand.New(rand.NewSource(seed))
+	chairs := generateChairs(rnd)
+	estates := generateEstates(rnd)
+
+	for _, d := range []string{"result/draft_data/chair", "result/draft_data/estate"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return err
+		}
+	}
+
+	err := writeJSONLines(filepath.Join(dir, "result/chair_json.txt"), len(chairs), func(i int) interface{} { return chairs[i] })
+	if err != nil {
+		return err
+	}
+	err = writeJSONLines(filepath.Join(dir, "result/estate_json.txt"), len(estates), func(i int) interface{} { return estates[i] })
+	if err != nil {
+		return err
+	}
+	if err := writeJSONFile(filepath.Join(dir, "chair_condition.json"), chairSearchCondition()); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(dir, "estate_condition.json"), estateSearchCondition())
+}
@@ -0,0 +1,203 @@
+package fakeapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+)
+
+// rangeFilter アプリケーションと同じく range id を Ranges の添字として扱い、範囲に入るかを判定する関数を返す
+func rangeFilter(q url.Values, key string, cond asset.RangeCondition) (func(v int64) bool, error) {
+	if q.Get(key) == "" {
+		return func(int64) bool { return true }, nil
+	}
+	index, err := strconv.Atoi(q.Get(key))
+	if err != nil || index < 0 || len(cond.Ranges) <= index {
+		return nil, fmt.Errorf("%s invalid: %v", key, q.Get(key))
+	}
+	r := cond.Ranges[index]
+	return func(v int64) bool {
+		return (r.Min == -1 || v >= r.Min) && (r.Max == -1 || v < r.Max)
+	}, nil
+}
+
+func listFilter(q url.Values, key string) func(v string) bool {
+	if q.Get(key) == "" {
+		return func(string) bool { return true }
+	}
+	list := strings.Split(q.Get(key), ",")
+	return func(v string) bool {
+		for _, l := range list {
+			if l == v {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func featureFilter(q url.Values) func(features string) bool {
+	if q.Get("features") == "" {
+		return func(string) bool { return true }
+	}
+	want := strings.Split(q.Get("features"), ",")
+	any := q.Get("featureMode") == "any"
+	return func(features string) bool {
+		has := make(map[string]bool)
+		for _, f := range strings.Split(features, ",") {
+			has[f] = true
+		}
+		for _, w := range want {
+			if any && has[w] {
+				return true
+			}
+			if !any && !has[w] {
+				return false
+			}
+		}
+		return !any
+	}
+}
+
+func paging(q url.Values) (int, int, error) {
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil {
+		return 0, 0, err
+	}
+	perPage, err := strconv.Atoi(q.Get("perPage"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return page, perPage, nil
+}
+
+// pageOf n 件のうち page ページ目の範囲
+func pageOf(n, page, perPage int) (int, int) {
+	start := page * perPage
+	if start > n {
+		start = n
+	}
+	end := start + perPage
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+func (s *Server) searchChairs(w http.ResponseWriter, r *http.Request, f Faults) {
+	q := r.URL.Query()
+	filters := make([]func(c *asset.JSONChair) bool, 0)
+	for _, rf := range []struct {
+		key   string
+		cond  asset.RangeCondition
+		value func(c *asset.JSONChair) int64
+	}{
+		{"priceRangeId", s.chairCondition.Price, func(c *asset.JSONChair) int64 { return c.Price }},
+		{"heightRangeId", s.chairCondition.Height, func(c *asset.JSONChair) int64 { return c.Height }},
+		{"widthRangeId", s.chairCondition.Width, func(c *asset.JSONChair) int64 { return c.Width }},
+		{"depthRangeId", s.chairCondition.Depth, func(c *asset.JSONChair) int64 { return c.Depth }},
+	} {
+		match, err := rangeFilter(q, rf.key, rf.cond)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		value := rf.value
+		filters = append(filters, func(c *asset.JSONChair) bool { return match(value(c)) })
+	}
+	kind, color, features := listFilter(q, "kind"), listFilter(q, "color"), featureFilter(q)
+	page, perPage, err := paging(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chairs := s.visibleChairs(f, func(c *asset.JSONChair) bool {
+		for _, match := range filters {
+			if !match(c) {
+				return false
+			}
+		}
+		return kind(c.Kind) && color(c.Color) && features(c.Features)
+	})
+	sortChairsByPopularity(chairs, f.WrongOrder)
+	start, end := pageOf(len(chairs), page, perPage)
+	writeJSON(w, chairsResponse{Count: int64(len(chairs)), Chairs: chairs[start:end]})
+}
+
+func (s *Server) searchEstates(w http.ResponseWriter, r *http.Request, f Faults) {
+	q := r.URL.Query()
+	filters := make([]func(e *asset.JSONEstate) bool, 0)
+	for _, rf := range []struct {
+		key   string
+		cond  asset.RangeCondition
+		value func(e *asset.JSONEstate) int64
+	}{
+		{"doorHeightRangeId", s.estateCondition.DoorHeight, func(e *asset.JSONEstate) int64 { return e.DoorHeight }},
+		{"doorWidthRangeId", s.estateCondition.DoorWidth, func(e *asset.JSONEstate) int64 { return e.DoorWidth }},
+		{"rentRangeId", s.estateCondition.Rent, func(e *asset.JSONEstate) int64 { return e.Rent }},
+	} {
+		match, err := rangeFilter(q, rf.key, rf.cond)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		value := rf.value
+		filters = append(filters, func(e *asset.JSONEstate) bool { return match(value(e)) })
+	}
+	features := featureFilter(q)
+	page, perPage, err := paging(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	estates := s.matchEstates(func(e *asset.JSONEstate) bool {
+		for _, match := range filters {
+			if !match(e) {
+				return false
+			}
+		}
+		return features(e.Features)
+	})
+	sortEstatesByPopularity(estates, f.WrongOrder)
+	start, end := pageOf(len(estates), page, perPage)
+	writeJSON(w, estatesResponse{Count: int64(len(estates)), Estates: estates[start:end]})
+}
+
+// inPolygon p が多角形の内側にあるかを ray casting で判定する
+func inPolygon(polygon []*client.Coordinate, lat, lon float64) bool {
+	inside := false
+	n := len(polygon)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Longitude > lon) != (b.Longitude > lon) {
+			x := (b.Latitude-a.Latitude)*(lon-a.Longitude)/(b.Longitude-a.Longitude) + a.Latitude
+			if lat < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+func (s *Server) nazotte(w http.ResponseWriter, r *http.Request) {
+	var polygon client.Coordinates
+	if err := json.NewDecoder(r.Body).Decode(&polygon); err != nil || len(polygon.Coordinates) == 0 {
+		http.Error(w, "coordinates are required", http.StatusBadRequest)
+		return
+	}
+
+	estates := s.matchEstates(func(e *asset.JSONEstate) bool {
+		return inPolygon(polygon.Coordinates, e.Latitude, e.Longitude)
+	})
+	sortEstatesByPopularity(estates, false)
+	estates = headEstates(estates, nazotteLimit)
+	writeJSON(w, estatesResponse{Count: int64(len(estates)), Estates: estates})
+}
@@ -0,0 +1,416 @@
+// Package fakeapp ベンチマーカーのテストで使う、ISUUMO の API を再現した httptest のサーバー
+// asset と同じデータを持ち、不具合を注入してベンチマーカーが検出できるかを確かめられる
+package fakeapp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+)
+
+const (
+	limit        = 20
+	nazotteLimit = 50
+)
+
+// Faults サーバーに注入する不具合。ゼロ値は正しく動くサーバーを表す
+type Faults struct {
+	// WrongOrder イスと物件の検索結果を popularity の昇順で返す
+	WrongOrder bool
+	// ShowSoldOut 在庫切れのイスも一覧や詳細に出す
+	ShowSoldOut bool
+	// Delay すべてのレスポンスをこの時間だけ遅らせる
+	Delay time.Duration
+	// InternalError パスがこの文字列で始まるリクエストに 500 を返す
+	InternalError string
+	// AllowBots ボットのリクエストを 503 で拒否せずに処理する
+	AllowBots bool
+	// RateLimited パスがこの文字列で始まるリクエストに 429 を返す
+	RateLimited string
+	// RetryAfter 429 に付ける Retry-After の秒数
+	RetryAfter int
+}
+
+// Server ISUUMO の API を再現したサーバー。入稿の API は扱わない
+type Server struct {
+	*httptest.Server
+
+	chairs          []*asset.JSONChair
+	estates         []*asset.JSONEstate
+	chairCondition  asset.ChairSearchCondition
+	estateCondition asset.EstateSearchCondition
+
+	faults      Faults
+	blockedBots int
+	rateLimited int
+	mu          sync.Mutex
+}
+
+// botUserAgents アプリケーションが拒否するボットの User-Agent
+var botUserAgents = []*regexp.Regexp{
+	regexp.MustCompile(`ISUCONbot(-Mobile)?`),
+	regexp.MustCompile(`ISUCONbot-Image\/`),
+	regexp.MustCompile(`Mediapartners-ISUCON`),
+	regexp.MustCompile(`ISUCONCoffee`),
+	regexp.MustCompile(`ISUCONFeedSeeker(Beta)?`),
+	regexp.MustCompile(`crawler \(https:\/\/isucon\.invalid\/(support\/faq\/|help\/jp\/)`),
+	regexp.MustCompile(`isubot`),
+	regexp.MustCompile(`Isupider`),
+	regexp.MustCompile(`Isupider(-image)?\+`),
+	regexp.MustCompile(`(?i)(bot|crawler|spider)(?:[-_ .\/;@()]|$)`),
+}
+
+func isBot(ua string) bool {
+	for _, re := range botUserAgents {
+		if re.MatchString(ua) {
+			return true
+		}
+	}
+	return false
+}
+
+func readJSONLines(path string, row func(dec *json.Decoder) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		if err := row(dec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readJSON(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// NewServer Generate で書き出したデータを読み込んで、サーバーを起動する
+func NewServer(dir string) (*Server, error) {
+	s := &Server{}
+
+	err := readJSONLines(filepath.Join(dir, "result/chair_json.txt"), func(dec *json.Decoder) error {
+		var c asset.JSONChair
+		if err := dec.Decode(&c); err != nil {
+			return err
+		}
+		s.chairs = append(s.chairs, &c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = readJSONLines(filepath.Join(dir, "result/estate_json.txt"), func(dec *json.Decoder) error {
+		var e asset.JSONEstate
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		s.estates = append(s.estates, &e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := readJSON(filepath.Join(dir, "chair_condition.json"), &s.chairCondition); err != nil {
+		return nil, err
+	}
+	if err := readJSON(filepath.Join(dir, "estate_condition.json"), &s.estateCondition); err != nil {
+		return nil, err
+	}
+
+	s.Server = httptest.NewServer(s)
+	return s, nil
+}
+
+// SetFaults 注入する不具合を切り替える
+func (s *Server) SetFaults(f Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+}
+
+// RateLimitedRequests 429 を返したリクエストの数
+func (s *Server) RateLimitedRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rateLimited
+}
+
+// BlockedBots 503 で拒否したボットのリクエストの数
+func (s *Server) BlockedBots() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blockedBots
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	f := s.faults
+	bot := !f.AllowBots && isBot(r.UserAgent())
+	if bot {
+		s.blockedBots++
+	}
+	limited := !bot && f.RateLimited != "" && strings.HasPrefix(r.URL.Path, f.RateLimited)
+	if limited {
+		s.rateLimited++
+	}
+	s.mu.Unlock()
+
+	if f.Delay > 0 {
+		t := time.NewTimer(f.Delay)
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			t.Stop()
+			return
+		}
+	}
+	if bot {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if limited {
+		w.Header().Set("Retry-After", strconv.Itoa(f.RetryAfter))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+	if f.InternalError != "" && strings.HasPrefix(r.URL.Path, f.InternalError) {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPost && path == "/initialize":
+		writeJSON(w, client.InitializeResponse{Language: "go"})
+	case r.Method == http.MethodGet && path == "/api/chair/low_priced":
+		s.lowPricedChairs(w, f)
+	case r.Method == http.MethodGet && path == "/api/chair/search/condition":
+		writeJSON(w, s.chairCondition)
+	case r.Method == http.MethodGet && path == "/api/chair/search":
+		s.searchChairs(w, r, f)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/api/chair/buy/"):
+		s.buyChair(w, strings.TrimPrefix(path, "/api/chair/buy/"))
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/api/chair/"):
+		s.chairDetail(w, strings.TrimPrefix(path, "/api/chair/"), f)
+	case r.Method == http.MethodGet && path == "/api/estate/low_priced":
+		s.lowPricedEstates(w)
+	case r.Method == http.MethodGet && path == "/api/estate/search/condition":
+		writeJSON(w, s.estateCondition)
+	case r.Method == http.MethodGet && path == "/api/estate/search":
+		s.searchEstates(w, r, f)
+	case r.Method == http.MethodPost && path == "/api/estate/nazotte":
+		s.nazotte(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/api/estate/req_doc/"):
+		s.requestDocument(w, strings.TrimPrefix(path, "/api/estate/req_doc/"))
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/api/estate/"):
+		s.estateDetail(w, strings.TrimPrefix(path, "/api/estate/"))
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/api/recommended_estate/"):
+		s.recommendedEstates(w, strings.TrimPrefix(path, "/api/recommended_estate/"))
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/api/recommended_chair/"):
+		s.recommendedChairs(w, strings.TrimPrefix(path, "/api/recommended_chair/"), f)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type chairsResponse struct {
+	Count  int64              `json:"count"`
+	Chairs []*asset.JSONChair `json:"chairs"`
+}
+
+type estatesResponse struct {
+	Count   int64               `json:"count"`
+	Estates []*asset.JSONEstate `json:"estates"`
+}
+
+func (s *Server) findChair(id string) *asset.JSONChair {
+	for _, c := range s.chairs {
+		if strconv.FormatInt(c.ID, 10) == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) findEstate(id string) *asset.JSONEstate {
+	for _, e := range s.estates {
+		if strconv.FormatInt(e.ID, 10) == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// visibleChairs 一覧に出すイス。ShowSoldOut が注入されていなければ在庫のあるものに限る
+func (s *Server) visibleChairs(f Faults, match func(c *asset.JSONChair) bool) []*asset.JSONChair {
+	chairs := make([]*asset.JSONChair, 0)
+	for _, c := range s.chairs {
+		if (c.Stock > 0 || f.ShowSoldOut) && match(c) {
+			chairs = append(chairs, c)
+		}
+	}
+	return chairs
+}
+
+func (s *Server) matchEstates(match func(e *asset.JSONEstate) bool) []*asset.JSONEstate {
+	estates := make([]*asset.JSONEstate, 0)
+	for _, e := range s.estates {
+		if match(e) {
+			estates = append(estates, e)
+		}
+	}
+	return estates
+}
+
+func sortChairsByPopularity(chairs []*asset.JSONChair, reverse bool) {
+	sort.Slice(chairs, func(i, j int) bool {
+		if chairs[i].Popularity != chairs[j].Popularity {
+			return (chairs[i].Popularity > chairs[j].Popularity) != reverse
+		}
+		return chairs[i].ID < chairs[j].ID
+	})
+}
+
+func sortEstatesByPopularity(estates []*asset.JSONEstate, reverse bool) {
+	sort.Slice(estates, func(i, j int) bool {
+		if estates[i].Popularity != estates[j].Popularity {
+			return (estates[i].Popularity > estates[j].Popularity) != reverse
+		}
+		return estates[i].ID < estates[j].ID
+	})
+}
+
+func headChairs(chairs []*asset.JSONChair, n int) []*asset.JSONChair {
+	if len(chairs) > n {
+		return chairs[:n]
+	}
+	return chairs
+}
+
+func headEstates(estates []*asset.JSONEstate, n int) []*asset.JSONEstate {
+	if len(estates) > n {
+		return estates[:n]
+	}
+	return estates
+}
+
+func (s *Server) lowPricedChairs(w http.ResponseWriter, f Faults) {
+	chairs := s.visibleChairs(f, func(*asset.JSONChair) bool { return true })
+	sort.Slice(chairs, func(i, j int) bool {
+		if chairs[i].Price != chairs[j].Price {
+			return chairs[i].Price < chairs[j].Price
+		}
+		return chairs[i].ID < chairs[j].ID
+	})
+	writeJSON(w, chairsResponse{Chairs: headChairs(chairs, limit)})
+}
+
+func (s *Server) lowPricedEstates(w http.ResponseWriter) {
+	estates := s.matchEstates(func(*asset.JSONEstate) bool { return true })
+	sort.Slice(estates, func(i, j int) bool {
+		if estates[i].Rent != estates[j].Rent {
+			return estates[i].Rent < estates[j].Rent
+		}
+		return estates[i].ID < estates[j].ID
+	})
+	writeJSON(w, estatesResponse{Estates: headEstates(estates, limit)})
+}
+
+func (s *Server) chairDetail(w http.ResponseWriter, id string, f Faults) {
+	c := s.findChair(id)
+	if c == nil || (c.Stock <= 0 && !f.ShowSoldOut) {
+		http.NotFound(w, nil)
+		return
+	}
+	writeJSON(w, c)
+}
+
+func (s *Server) estateDetail(w http.ResponseWriter, id string) {
+	e := s.findEstate(id)
+	if e == nil {
+		http.NotFound(w, nil)
+		return
+	}
+	writeJSON(w, e)
+}
+
+func (s *Server) buyChair(w http.ResponseWriter, id string) {
+	c := s.findChair(id)
+	if c == nil || c.Stock <= 0 {
+		http.NotFound(w, nil)
+		return
+	}
+	c.Stock--
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) requestDocument(w http.ResponseWriter, id string) {
+	if s.findEstate(id) == nil {
+		http.NotFound(w, nil)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// fits 幅 w と高さ h のドアを、3辺の長さが lengths のイスが通れるか
+func fits(lengths [3]int64, w, h int64) bool {
+	sort.Slice(lengths[:], func(i, j int) bool { return lengths[i] < lengths[j] })
+	if w > h {
+		w, h = h, w
+	}
+	return lengths[0] <= w && lengths[1] <= h
+}
+
+func (s *Server) recommendedEstates(w http.ResponseWriter, id string) {
+	c := s.findChair(id)
+	if c == nil {
+		http.Error(w, "chair not found", http.StatusBadRequest)
+		return
+	}
+	estates := s.matchEstates(func(e *asset.JSONEstate) bool {
+		return fits([3]int64{c.Width, c.Height, c.Depth}, e.DoorWidth, e.DoorHeight)
+	})
+	sortEstatesByPopularity(estates, false)
+	writeJSON(w, estatesResponse{Estates: headEstates(estates, limit)})
+}
+
+func (s *Server) recommendedChairs(w http.ResponseWriter, id string, f Faults) {
+	e := s.findEstate(id)
+	if e == nil {
+		http.Error(w, "estate not found", http.StatusBadRequest)
+		return
+	}
+	chairs := s.visibleChairs(f, func(c *asset.JSONChair) bool {
+		return fits([3]int64{c.Width, c.Height, c.Depth}, e.DoorWidth, e.DoorHeight)
+	})
+	sortChairsByPopularity(chairs, false)
+	writeJSON(w, chairsResponse{Chairs: headChairs(chairs, limit)})
+}
@@ -7,4 +7,5 @@ require (
 	github.com/google/uuid v1.1.1
 	github.com/morikuni/failure v0.12.1
 	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,369 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Request 1リクエストの計測結果
+type Request struct {
+	// Route "GET /api/chair/:id" のようなルートのテンプレート
+	Route string
+	// StatusCode レスポンスが得られなかった場合は0
+	StatusCode int
+	Latency    time.Duration
+	Bytes      int64
+	Level      int64
+	StartedAt  time.Time
+}
+
+// EndpointStats エンドポイントごとの集計結果。レイテンシはミリ秒
+type EndpointStats struct {
+	Route  string  `json:"route"`
+	Count  int     `json:"count"`
+	Errors int     `json:"errors"`
+	P50    float64 `json:"p50_ms"`
+	P90    float64 `json:"p90_ms"`
+	P99    float64 `json:"p99_ms"`
+	Max    float64 `json:"max_ms"`
+	RPS    float64 `json:"rps"`
+	Bytes  int64   `json:"bytes"`
+}
+
+// LevelStats 負荷レベルごとの集計結果
+type LevelStats struct {
+	Level     int64           `json:"level"`
+	Seconds   float64         `json:"seconds"`
+	Endpoints []EndpointStats `json:"endpoints"`
+}
+
+// Session open model で始めた1セッションの計測結果
+type Session struct {
+	Scenario string
+	// Intended 到着率から決まる、本来セッションを始めるはずだった時刻
+	Intended time.Time
+	Started  time.Time
+	Finished time.Time
+	Failed   bool
+}
+
+// SessionStats シナリオごとのセッションの集計結果。レイテンシはミリ秒
+// P50 などは予定した開始時刻から測ったもので、同時実行数の上限などで開始が遅れた分も含む (coordinated omission の補正)
+type SessionStats struct {
+	Scenario string  `json:"scenario"`
+	Count    int     `json:"count"`
+	Failed   int     `json:"failed"`
+	Dropped  int     `json:"dropped"`
+	P50      float64 `json:"p50_ms"`
+	P90      float64 `json:"p90_ms"`
+	P99      float64 `json:"p99_ms"`
+	Max      float64 `json:"max_ms"`
+	// ServiceP99 実際に開始した時刻から測ったp99
+	ServiceP99 float64 `json:"service_p99_ms"`
+}
+
+// Summary レポートに載せる集計結果
+type Summary struct {
+	Seconds   float64         `json:"seconds"`
+	Endpoints []EndpointStats `json:"endpoints"`
+	Levels    []LevelStats    `json:"levels"`
+	Sessions  []SessionStats  `json:"sessions,omitempty"`
+}
+
+// Recorder 1回のベンチマークのリクエストとセッションの計測結果を集める
+type Recorder struct {
+	mu       sync.Mutex
+	requests []Request
+	sessions []Session
+	// dropped シナリオごとの、開始が遅れすぎて始めなかったセッションの数
+	dropped map[string]int
+
+	inFlight int64
+}
+
+func New() *Recorder {
+	return &Recorder{
+		requests: make([]Request, 0, 100000),
+		sessions: make([]Session, 0, 10000),
+		dropped:  make(map[string]int),
+	}
+}
+
+type contextKey struct{}
+
+// WithRecorder r を持つ context を返す
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext ctx が持つ Recorder を返す。持っていなければ nil を返し、nil の Recorder は何も記録しない
+func FromContext(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(contextKey{}).(*Recorder)
+	return r
+}
+
+// Reset それまでの計測結果を破棄する。負荷走行の直前に呼ぶ
+func (r *Recorder) Reset() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = r.requests[:0]
+	r.sessions = r.sessions[:0]
+	r.dropped = make(map[string]int)
+}
+
+// Begin リクエストの送信前に呼び、レスポンスを読み終えたら End を呼ぶ
+func (r *Recorder) Begin() {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.inFlight, 1)
+}
+
+func (r *Recorder) End() {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.inFlight, -1)
+}
+
+// InFlight レスポンスを読み終えていないリクエストの数
+func (r *Recorder) InFlight() int64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.inFlight)
+}
+
+func (r *Recorder) Record(req Request) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+}
+
+// RequestsSince Reset してから n 件目以降に記録したリクエストを返す。分散実行の agent が計測結果を送るために使う
+func (r *Recorder) RequestsSince(n int) []Request {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n >= len(r.requests) {
+		return nil
+	}
+	rs := make([]Request, len(r.requests)-n)
+	copy(rs, r.requests[n:])
+	return rs
+}
+
+func (r *Recorder) RecordSession(s Session) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions = append(r.sessions, s)
+}
+
+// DropSession 開始が遅れすぎて始めなかったセッションを数える
+func (r *Recorder) DropSession(scenario string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropped[scenario]++
+}
+
+// Window 直近の区間の集計結果
+type Window struct {
+	Count int
+	// NoResponse レスポンスが得られなかったリクエストの数。タイムアウトを含む
+	NoResponse int
+	P99        time.Duration
+}
+
+// WindowSince since 以降にレスポンスを読み終えたリクエストを集計する
+func (r *Recorder) WindowSince(since time.Time) Window {
+	var w Window
+	if r == nil {
+		return w
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latencies := make([]time.Duration, 0)
+	// requests はレスポンスを読み終えた順に並んでいるため、後ろから辿る
+	for i := len(r.requests) - 1; i >= 0; i-- {
+		req := r.requests[i]
+		if req.StartedAt.Add(req.Latency).Before(since) {
+			break
+		}
+		w.Count++
+		if req.StatusCode == 0 {
+			w.NoResponse++
+		}
+		latencies = append(latencies, req.Latency)
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		w.P99 = percentile(latencies, 99)
+	}
+	return w
+}
+
+// RouteOf リクエストのパスからルートのテンプレートを作る。数値のパスパラメータは :id にまとめる
+func RouteOf(method, path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			segments[i] = ":id"
+		}
+	}
+	return method + " " + strings.Join(segments, "/")
+}
+
+// Summarize 記録したリクエストとセッションを集計する
+func (r *Recorder) Summarize() Summary {
+	if r == nil {
+		r = New()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summary := Summary{
+		Seconds:   window(r.requests).Seconds(),
+		Endpoints: summarizeEndpoints(r.requests),
+		Levels:    []LevelStats{},
+	}
+
+	byLevel := map[int64][]Request{}
+	for _, req := range r.requests {
+		byLevel[req.Level] = append(byLevel[req.Level], req)
+	}
+	for level, rs := range byLevel {
+		summary.Levels = append(summary.Levels, LevelStats{
+			Level:     level,
+			Seconds:   window(rs).Seconds(),
+			Endpoints: summarizeEndpoints(rs),
+		})
+	}
+	sort.Slice(summary.Levels, func(i, j int) bool { return summary.Levels[i].Level < summary.Levels[j].Level })
+
+	summary.Sessions = summarizeSessions(r.sessions, r.dropped)
+
+	return summary
+}
+
+func summarizeSessions(ss []Session, dropped map[string]int) []SessionStats {
+	byScenario := map[string][]Session{}
+	for _, s := range ss {
+		byScenario[s.Scenario] = append(byScenario[s.Scenario], s)
+	}
+	for scenario := range dropped {
+		if _, ok := byScenario[scenario]; !ok {
+			byScenario[scenario] = nil
+		}
+	}
+
+	stats := make([]SessionStats, 0, len(byScenario))
+	for scenario, ss := range byScenario {
+		st := SessionStats{Scenario: scenario, Count: len(ss), Dropped: dropped[scenario]}
+		if len(ss) > 0 {
+			latencies := make([]time.Duration, 0, len(ss))
+			services := make([]time.Duration, 0, len(ss))
+			for _, s := range ss {
+				if s.Failed {
+					st.Failed++
+				}
+				latencies = append(latencies, s.Finished.Sub(s.Intended))
+				services = append(services, s.Finished.Sub(s.Started))
+			}
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			sort.Slice(services, func(i, j int) bool { return services[i] < services[j] })
+			st.P50 = milliseconds(percentile(latencies, 50))
+			st.P90 = milliseconds(percentile(latencies, 90))
+			st.P99 = milliseconds(percentile(latencies, 99))
+			st.Max = milliseconds(latencies[len(latencies)-1])
+			st.ServiceP99 = milliseconds(percentile(services, 99))
+		}
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Scenario < stats[j].Scenario })
+
+	return stats
+}
+
+// window 最初のリクエストの開始から最後のリクエストの終了までの時間
+func window(rs []Request) time.Duration {
+	if len(rs) == 0 {
+		return 0
+	}
+	first, last := rs[0].StartedAt, rs[0].StartedAt.Add(rs[0].Latency)
+	for _, r := range rs[1:] {
+		if r.StartedAt.Before(first) {
+			first = r.StartedAt
+		}
+		if end := r.StartedAt.Add(r.Latency); end.After(last) {
+			last = end
+		}
+	}
+	return last.Sub(first)
+}
+
+func summarizeEndpoints(rs []Request) []EndpointStats {
+	seconds := window(rs).Seconds()
+
+	byRoute := map[string][]Request{}
+	for _, r := range rs {
+		byRoute[r.Route] = append(byRoute[r.Route], r)
+	}
+
+	stats := make([]EndpointStats, 0, len(byRoute))
+	for route, rs := range byRoute {
+		latencies := make([]time.Duration, 0, len(rs))
+		s := EndpointStats{Route: route, Count: len(rs)}
+		for _, r := range rs {
+			if r.StatusCode == 0 || r.StatusCode >= 400 {
+				s.Errors++
+			}
+			s.Bytes += r.Bytes
+			latencies = append(latencies, r.Latency)
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		s.P50 = milliseconds(percentile(latencies, 50))
+		s.P90 = milliseconds(percentile(latencies, 90))
+		s.P99 = milliseconds(percentile(latencies, 99))
+		s.Max = milliseconds(latencies[len(latencies)-1])
+		if seconds > 0 {
+			s.RPS = float64(s.Count) / seconds
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Route < stats[j].Route })
+
+	return stats
+}
+
+// percentile ソート済みのレイテンシから nearest-rank 法でパーセンタイルを求める
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (len(sorted)*p + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,94 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+)
+
+func Test_RouteOf(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: "GET", path: "/api/chair/123", want: "GET /api/chair/:id"},
+		{method: "POST", path: "/api/estate/req_doc/45", want: "POST /api/estate/req_doc/:id"},
+		{method: "GET", path: "/api/chair/search", want: "GET /api/chair/search"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := metrics.RouteOf(tt.method, tt.path); got != tt.want {
+				t.Errorf("RouteOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Summarize(t *testing.T) {
+	m := metrics.New()
+	now := time.Now()
+	for i := 1; i <= 100; i++ {
+		status := 200
+		if i%10 == 0 {
+			status = 500
+		}
+		m.Record(metrics.Request{
+			Route:      "GET /api/chair/:id",
+			StatusCode: status,
+			Latency:    time.Duration(i) * time.Millisecond,
+			Level:      int64(i % 2),
+			StartedAt:  now.Add(time.Duration(i) * 10 * time.Millisecond),
+		})
+	}
+
+	s := m.Summarize()
+	if len(s.Endpoints) != 1 || len(s.Levels) != 2 {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+	e := s.Endpoints[0]
+	if e.Count != 100 || e.Errors != 10 {
+		t.Errorf("count = %d, errors = %d", e.Count, e.Errors)
+	}
+	if e.P50 != 50 || e.P90 != 90 || e.P99 != 99 || e.Max != 100 {
+		t.Errorf("p50 = %v, p90 = %v, p99 = %v, max = %v", e.P50, e.P90, e.P99, e.Max)
+	}
+	if e.RPS <= 0 {
+		t.Errorf("rps = %v", e.RPS)
+	}
+}
+
+func Test_SummarizeSessions(t *testing.T) {
+	m := metrics.New()
+	now := time.Now()
+	for i := 1; i <= 10; i++ {
+		intended := now.Add(time.Duration(i) * time.Second)
+		// 同時実行数の上限で100ms待たされてから始まったセッション
+		started := intended.Add(100 * time.Millisecond)
+		m.RecordSession(metrics.Session{
+			Scenario: "chair_search",
+			Intended: intended,
+			Started:  started,
+			Finished: started.Add(time.Duration(i) * 10 * time.Millisecond),
+			Failed:   i == 10,
+		})
+	}
+	m.DropSession("chair_search")
+	m.DropSession("estate_search")
+
+	s := m.Summarize()
+	if len(s.Sessions) != 2 {
+		t.Fatalf("unexpected sessions: %+v", s.Sessions)
+	}
+	c := s.Sessions[0]
+	if c.Scenario != "chair_search" || c.Count != 10 || c.Failed != 1 || c.Dropped != 1 {
+		t.Errorf("unexpected session stats: %+v", c)
+	}
+	if c.Max != 200 || c.ServiceP99 != 100 {
+		t.Errorf("Max = %v, ServiceP99 = %v, want 200, 100", c.Max, c.ServiceP99)
+	}
+	if e := s.Sessions[1]; e.Scenario != "estate_search" || e.Count != 0 || e.Dropped != 1 {
+		t.Errorf("unexpected session stats: %+v", e)
+	}
+}
@@ -3,17 +3,43 @@ package parameter
 import "time"
 
 const (
-	NumOfSearchChairInScenario     = 2
-	NumOfSearchEstateInScenario    = 2
-	NumOfCheckChairSearchPaging    = 2
-	NumOfCheckEstateSearchPaging   = 2
-	LimitOfChairSearchPageDepth    = 5
-	LimitOfEstateSearchPageDepth   = 5
-	NumOfCheckChairDetailPage      = 2
-	NumOfCheckEstateDetailPage     = 2
-	PerPageOfChairSearch           = 25
-	PerPageOfEstateSearch          = 25
-	MaxLengthOfNazotteResponse     = 50
+	NumOfSearchChairInScenario   = 2
+	NumOfSearchEstateInScenario  = 2
+	NumOfCheckChairSearchPaging  = 2
+	NumOfCheckEstateSearchPaging = 2
+	LimitOfChairSearchPageDepth  = 5
+	LimitOfEstateSearchPageDepth = 5
+	NumOfCheckChairDetailPage    = 2
+	NumOfCheckEstateDetailPage   = 2
+	PerPageOfChairSearch         = 25
+	PerPageOfEstateSearch        = 25
+	MaxLengthOfNazotteResponse   = 50
+	// RateOfSearchOracleCheck 検索結果のうち、ベンチマーカーが持つデータと照合するレスポンスの割合
+	RateOfSearchOracleCheck = 0.2
+	// NumOfEvidenceEntries エラーの調査のために記録しておく直近のリクエストの数
+	NumOfEvidenceEntries = 1000
+	// MaxEvidenceBodySize 記録するリクエストとレスポンスのボディの最大バイト数
+	MaxEvidenceBodySize = 4096
+	// MaxEvidenceFailures リクエストの記録と結び付けるエラーの最大数
+	MaxEvidenceFailures = 100
+	// NumOfEvidencePerFailure エラー1件に結び付ける、同じセッションの直近のリクエストの数
+	NumOfEvidencePerFailure = 5
+)
+
+// 分散実行に関わる値
+const (
+	// AgentWaitTimeout coordinator が指定された数の agent の接続と準備を待つ時間
+	AgentWaitTimeout = 60 * time.Second
+	// AgentReportInterval agent が加点、エラー、リクエストの計測結果を送る間隔。coordinator も同じ間隔でスコアと負荷レベルを送る
+	AgentReportInterval = 100 * time.Millisecond
+	// AgentFinishTimeout 負荷走行の終了後に、agent の最後の送信を待つ時間
+	AgentFinishTimeout = 5 * time.Second
+	// AgentDialInterval agent が coordinator への接続を試みる間隔
+	AgentDialInterval = 1 * time.Second
+)
+
+// 負荷の掛け方に関わる値。-profile で指定された負荷プロファイルで上書きされる
+var (
 	SleepTimeOnFailScenario        = 1500 * time.Millisecond
 	SleepSwingOnFailScenario       = 500 // * time.Millisecond
 	SleepTimeOnUserAway            = 500 * time.Millisecond
@@ -26,8 +52,95 @@ const (
 	DefaultAPITimeout              = 2000 * time.Millisecond
 	InitializeTimeout              = 30 * time.Second
 	VerifyTimeout                  = 10 * time.Second
+	ConformanceTimeout             = 60 * time.Second
 	DraftTimeout                   = 5 * time.Second
 	LoadTimeout                    = 60 * time.Second
+	MaxSleepTimeOnRateLimited      = 5 * time.Second
+)
+
+// 互換性チェックに関わる値。-profile で指定された負荷プロファイルで上書きされる
+var (
+	// ConformanceConcurrency verify モードで同時に確認するSnapshotの数
+	ConformanceConcurrency = 16
+)
+
+const (
+	// ControlModeRatchet スコアに応じて負荷レベルを上げるだけ
+	ControlModeRatchet = "ratchet"
+	// ControlModeAdaptive タイムアウトやレイテンシが閾値を超え続けると負荷レベルを下げる
+	ControlModeAdaptive = "adaptive"
+)
+
+// 負荷レベルの制御に関わる値。-profile で指定された負荷プロファイルで上書きされる
+var (
+	ControlMode = ControlModeRatchet
+	// ControlInterval この間隔ごとに、直近の区間のタイムアウト数とp99レイテンシを確認する
+	ControlInterval = 1 * time.Second
+	// MaxTimeoutsPerControlInterval 1区間あたりに許容する、レスポンスが得られなかったリクエストの数
+	MaxTimeoutsPerControlInterval = 10
+	// MaxP99LatencyOfControl 1区間あたりに許容するp99レイテンシ
+	MaxP99LatencyOfControl = 1000 * time.Millisecond
+	// SustainedIntervalsToLevelDown 閾値を超えた区間がこの数だけ続くと負荷レベルを下げる
+	SustainedIntervalsToLevelDown = 3
+	// CooldownAfterLevelDown 負荷レベルを下げてから、再び上げられるようになるまでの時間
+	CooldownAfterLevelDown = 5 * time.Second
+)
+
+const (
+	// ArrivalModelClosed Workerがシナリオを終えるたびに次のシナリオを始める
+	ArrivalModelClosed = "closed"
+	// ArrivalModelOpen サーバーの応答を待たずに、決まった到着率で ArrivalMix のシナリオのセッションを始める
+	ArrivalModelOpen = "open"
+)
+
+const (
+	ArrivalPatternFixed = "fixed"
+	ArrivalPatternRamp  = "ramp"
+	ArrivalPatternStep  = "step"
+)
+
+// ArrivalStep step パターンで、Duration の間 Rate (セッション/秒) で到着させる
+type ArrivalStep struct {
+	Duration time.Duration
+	Rate     float64
+}
+
+// SessionMix open model で始めるセッションの、シナリオ名ごとの重み
+type SessionMix map[string]int
+
+// セッションの到着に関わる値。-profile で指定された負荷プロファイルで上書きされる
+var (
+	ArrivalModel   = ArrivalModelClosed
+	ArrivalPattern = ArrivalPatternFixed
+	// ArrivalRate fixed パターンの到着率 (セッション/秒)
+	ArrivalRate = 10.0
+	// ArrivalStartRate, ArrivalEndRate ramp パターンで ArrivalRampDuration かけて変化させる到着率
+	ArrivalStartRate    = 1.0
+	ArrivalEndRate      = 20.0
+	ArrivalRampDuration = 60 * time.Second
+	ArrivalSteps        = []ArrivalStep{}
+	// MaxConcurrentSessions 同時に実行するセッションの上限
+	MaxConcurrentSessions = 100
+	// MaxArrivalLag 予定した開始時刻からこれ以上遅れたセッションは、ユーザーが諦めたものとして始めない
+	MaxArrivalLag = 1000 * time.Millisecond
+	ArrivalMix    = SessionMix{"chair_search": 1, "estate_search": 1, "estate_nazotte_search": 1}
+)
+
+// EndpointWeights metrics.RouteOf の形式のエンドポイントごとの、成功したリクエスト1回あたりの点数
+type EndpointWeights map[string]int64
+
+// ErrorPenalties エラーの種類 (fails のコードから "error " を除いたもの) ごとの、エラー1件あたりの減点
+type ErrorPenalties map[string]int64
+
+// スコアの計算に関わる値。-profile で指定された負荷プロファイルで上書きされる
+var (
+	// ScoreWeights 指定されていないエンドポイントへのリクエストは加点しない
+	ScoreWeights = EndpointWeights{
+		"POST /api/chair/buy/:id":      1,
+		"POST /api/estate/req_doc/:id": 1,
+	}
+	// ScorePenalties 指定されていない種類のエラーは減点しない
+	ScorePenalties = ErrorPenalties{"application": 50}
 )
 
 var BoundaryOfLevel []int64 = []int64{
@@ -36,111 +149,105 @@ var BoundaryOfLevel []int64 = []int64{
 	1800, 2000,
 }
 
-type incWorkers struct {
-	ChairSearchWorker         int
-	EstateSearchWorker        int
-	EstateNazotteSearchWorker int
-	BotWorker                 int
-	ChairDraftPostWorker      int
-	EstateDraftPostWorker     int
-}
+// IncWorkers シナリオ名ごとに追加するWorkerの数。指定されていないシナリオのWorkerは追加しない
+type IncWorkers map[string]int
 
 // IncListOfWorkers 前のレベルとのWorkerの個数の差分を保持するList
-var ListOfIncWorkers = []incWorkers{
+var ListOfIncWorkers = []IncWorkers{
 	{ // level 00
-		ChairSearchWorker:         3,
-		EstateSearchWorker:        3,
-		EstateNazotteSearchWorker: 0,
-		BotWorker:                 0,
-		ChairDraftPostWorker:      0,
-		EstateDraftPostWorker:     0,
+		"chair_search":          3,
+		"estate_search":         3,
+		"estate_nazotte_search": 0,
+		"bot":                   0,
+		"chair_draft_post":      0,
+		"estate_draft_post":     0,
 	},
 	{ // level 01
-		ChairSearchWorker:         0,
-		EstateSearchWorker:        0,
-		EstateNazotteSearchWorker: 3,
-		BotWorker:                 0,
-		ChairDraftPostWorker:      0,
-		EstateDraftPostWorker:     0,
+		"chair_search":          0,
+		"estate_search":         0,
+		"estate_nazotte_search": 3,
+		"bot":                   0,
+		"chair_draft_post":      0,
+		"estate_draft_post":     0,
 	},
 	{ // level 02
-		ChairSearchWorker:         0,
-		EstateSearchWorker:        0,
-		EstateNazotteSearchWorker: 0,
-		BotWorker:                 5,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          0,
+		"estate_search":         0,
+		"estate_nazotte_search": 0,
+		"bot":                   5,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 	{ // level 03
-		ChairSearchWorker:         1,
-		EstateSearchWorker:        1,
-		EstateNazotteSearchWorker: 1,
-		BotWorker:                 1,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          1,
+		"estate_search":         1,
+		"estate_nazotte_search": 1,
+		"bot":                   1,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 	{ // level 04
-		ChairSearchWorker:         1,
-		EstateSearchWorker:        1,
-		EstateNazotteSearchWorker: 1,
-		BotWorker:                 1,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          1,
+		"estate_search":         1,
+		"estate_nazotte_search": 1,
+		"bot":                   1,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 	{ // level 05
-		ChairSearchWorker:         1,
-		EstateSearchWorker:        1,
-		EstateNazotteSearchWorker: 1,
-		BotWorker:                 1,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          1,
+		"estate_search":         1,
+		"estate_nazotte_search": 1,
+		"bot":                   1,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 	{ // level 06
-		ChairSearchWorker:         1,
-		EstateSearchWorker:        1,
-		EstateNazotteSearchWorker: 1,
-		BotWorker:                 1,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          1,
+		"estate_search":         1,
+		"estate_nazotte_search": 1,
+		"bot":                   1,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 	{ // level 07
-		ChairSearchWorker:         1,
-		EstateSearchWorker:        1,
-		EstateNazotteSearchWorker: 1,
-		BotWorker:                 1,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          1,
+		"estate_search":         1,
+		"estate_nazotte_search": 1,
+		"bot":                   1,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 	{ // level 08
-		ChairSearchWorker:         1,
-		EstateSearchWorker:        1,
-		EstateNazotteSearchWorker: 1,
-		BotWorker:                 1,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          1,
+		"estate_search":         1,
+		"estate_nazotte_search": 1,
+		"bot":                   1,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 	{ // level 09
-		ChairSearchWorker:         1,
-		EstateSearchWorker:        1,
-		EstateNazotteSearchWorker: 1,
-		BotWorker:                 1,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          1,
+		"estate_search":         1,
+		"estate_nazotte_search": 1,
+		"bot":                   1,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 	{ // level 10
-		ChairSearchWorker:         1,
-		EstateSearchWorker:        1,
-		EstateNazotteSearchWorker: 1,
-		BotWorker:                 1,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          1,
+		"estate_search":         1,
+		"estate_nazotte_search": 1,
+		"bot":                   1,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 	{ // level 11
-		ChairSearchWorker:         1,
-		EstateSearchWorker:        1,
-		EstateNazotteSearchWorker: 1,
-		BotWorker:                 1,
-		ChairDraftPostWorker:      1,
-		EstateDraftPostWorker:     1,
+		"chair_search":          1,
+		"estate_search":         1,
+		"estate_nazotte_search": 1,
+		"bot":                   1,
+		"chair_draft_post":      1,
+		"estate_draft_post":     1,
 	},
 }
@@ -0,0 +1,479 @@
+package parameter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Duration "1.5s" や "500ms" の形式で読み書きする time.Duration
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Level 負荷レベルごとの設定
+type Level struct {
+	// NextLevelScore このスコアに達すると次のレベルに上がる
+	NextLevelScore int64 `json:"next_level_score" yaml:"next_level_score"`
+	// IncWorkers このレベルに上がったときに追加するWorkerの数
+	IncWorkers IncWorkers `json:"inc_workers" yaml:"inc_workers"`
+}
+
+// ThinkTime シナリオの合間に待つ時間。Swing は待ち時間の揺らぎの幅
+type ThinkTime struct {
+	FailScenario          Duration `json:"fail_scenario" yaml:"fail_scenario"`
+	FailScenarioSwing     Duration `json:"fail_scenario_swing" yaml:"fail_scenario_swing"`
+	UserAway              Duration `json:"user_away" yaml:"user_away"`
+	UserAwaySwing         Duration `json:"user_away_swing" yaml:"user_away_swing"`
+	BotInterval           Duration `json:"bot_interval" yaml:"bot_interval"`
+	BotIntervalSwing      Duration `json:"bot_interval_swing" yaml:"bot_interval_swing"`
+	BeforePostDraft       Duration `json:"before_post_draft" yaml:"before_post_draft"`
+	BeforePostDraftSwing  Duration `json:"before_post_draft_swing" yaml:"before_post_draft_swing"`
+	MaxSleepOnRateLimited Duration `json:"max_sleep_on_rate_limited" yaml:"max_sleep_on_rate_limited"`
+}
+
+// Timeout 各フェーズやリクエストのタイムアウト
+type Timeout struct {
+	AbandonmentPage Duration `json:"abandonment_page" yaml:"abandonment_page"`
+	DefaultAPI      Duration `json:"default_api" yaml:"default_api"`
+	Initialize      Duration `json:"initialize" yaml:"initialize"`
+	Verify          Duration `json:"verify" yaml:"verify"`
+	Conformance     Duration `json:"conformance" yaml:"conformance"`
+	Draft           Duration `json:"draft" yaml:"draft"`
+	Load            Duration `json:"load" yaml:"load"`
+}
+
+// Conformance verify モードの互換性チェックの設定
+type Conformance struct {
+	Concurrency int `json:"concurrency" yaml:"concurrency"`
+}
+
+// Control 負荷レベルの制御方法
+type Control struct {
+	// Mode ratchet はレベルを上げるだけ、adaptive は閾値を超え続けるとレベルを下げる
+	Mode                   string   `json:"mode" yaml:"mode"`
+	Interval               Duration `json:"interval" yaml:"interval"`
+	MaxTimeouts            int      `json:"max_timeouts" yaml:"max_timeouts"`
+	MaxP99Latency          Duration `json:"max_p99_latency" yaml:"max_p99_latency"`
+	SustainedIntervals     int      `json:"sustained_intervals" yaml:"sustained_intervals"`
+	CooldownAfterLevelDown Duration `json:"cooldown_after_level_down" yaml:"cooldown_after_level_down"`
+}
+
+// Step step パターンの1段分
+type Step struct {
+	Duration Duration `json:"duration" yaml:"duration"`
+	Rate     float64  `json:"rate" yaml:"rate"`
+}
+
+// Arrival 検索シナリオのセッションの到着のさせ方
+type Arrival struct {
+	// Model closed はWorkerごとにシナリオを繰り返し、open は到着率に従ってセッションを始める
+	Model   string `json:"model" yaml:"model"`
+	Pattern string `json:"pattern" yaml:"pattern"`
+	// Rate fixed パターンの到着率 (セッション/秒)
+	Rate           float64    `json:"rate" yaml:"rate"`
+	StartRate      float64    `json:"start_rate" yaml:"start_rate"`
+	EndRate        float64    `json:"end_rate" yaml:"end_rate"`
+	RampDuration   Duration   `json:"ramp_duration" yaml:"ramp_duration"`
+	Steps          []Step     `json:"steps" yaml:"steps"`
+	MaxConcurrency int        `json:"max_concurrency" yaml:"max_concurrency"`
+	MaxLag         Duration   `json:"max_lag" yaml:"max_lag"`
+	Mix            SessionMix `json:"mix" yaml:"mix"`
+}
+
+// Scoring スコアの計算方法
+type Scoring struct {
+	Weights   EndpointWeights `json:"weights" yaml:"weights"`
+	Penalties ErrorPenalties  `json:"penalties" yaml:"penalties"`
+}
+
+// Profile 負荷プロファイル。省略した項目は組み込みの値が使われる
+type Profile struct {
+	Levels      []Level     `json:"levels" yaml:"levels"`
+	ThinkTime   ThinkTime   `json:"think_time" yaml:"think_time"`
+	Timeout     Timeout     `json:"timeout" yaml:"timeout"`
+	Conformance Conformance `json:"conformance" yaml:"conformance"`
+	Control     Control     `json:"control" yaml:"control"`
+	Arrival     Arrival     `json:"arrival" yaml:"arrival"`
+	Scoring     Scoring     `json:"scoring" yaml:"scoring"`
+}
+
+func swing(ms int) Duration {
+	return Duration(time.Duration(ms) * time.Millisecond)
+}
+
+// CurrentProfile 現在有効になっている値から Profile を作る
+func CurrentProfile() Profile {
+	levels := make([]Level, 0, len(ListOfIncWorkers))
+	for i, incWorkers := range ListOfIncWorkers {
+		level := Level{IncWorkers: incWorkers}
+		if i < len(BoundaryOfLevel) {
+			level.NextLevelScore = BoundaryOfLevel[i]
+		}
+		levels = append(levels, level)
+	}
+
+	// 読み込んだプロファイルで上書きしても有効な値が変わらないように複製する
+	weights := make(EndpointWeights, len(ScoreWeights))
+	for endpoint, w := range ScoreWeights {
+		weights[endpoint] = w
+	}
+	penalties := make(ErrorPenalties, len(ScorePenalties))
+	for class, p := range ScorePenalties {
+		penalties[class] = p
+	}
+
+	steps := make([]Step, 0, len(ArrivalSteps))
+	for _, step := range ArrivalSteps {
+		steps = append(steps, Step{Duration: Duration(step.Duration), Rate: step.Rate})
+	}
+
+	return Profile{
+		Levels: levels,
+		ThinkTime: ThinkTime{
+			FailScenario:          Duration(SleepTimeOnFailScenario),
+			FailScenarioSwing:     swing(SleepSwingOnFailScenario),
+			UserAway:              Duration(SleepTimeOnUserAway),
+			UserAwaySwing:         swing(SleepSwingOnUserAway),
+			BotInterval:           Duration(SleepTimeOnBotInterval),
+			BotIntervalSwing:      swing(SleepSwingOnBotInterval),
+			BeforePostDraft:       Duration(SleepBeforePostDraft),
+			BeforePostDraftSwing:  swing(SleepSwingBeforePostDraft),
+			MaxSleepOnRateLimited: Duration(MaxSleepTimeOnRateLimited),
+		},
+		Timeout: Timeout{
+			AbandonmentPage: Duration(ThresholdTimeOfAbandonmentPage),
+			DefaultAPI:      Duration(DefaultAPITimeout),
+			Initialize:      Duration(InitializeTimeout),
+			Verify:          Duration(VerifyTimeout),
+			Conformance:     Duration(ConformanceTimeout),
+			Draft:           Duration(DraftTimeout),
+			Load:            Duration(LoadTimeout),
+		},
+		Conformance: Conformance{
+			Concurrency: ConformanceConcurrency,
+		},
+		Control: Control{
+			Mode:                   ControlMode,
+			Interval:               Duration(ControlInterval),
+			MaxTimeouts:            MaxTimeoutsPerControlInterval,
+			MaxP99Latency:          Duration(MaxP99LatencyOfControl),
+			SustainedIntervals:     SustainedIntervalsToLevelDown,
+			CooldownAfterLevelDown: Duration(CooldownAfterLevelDown),
+		},
+		Arrival: Arrival{
+			Model:          ArrivalModel,
+			Pattern:        ArrivalPattern,
+			Rate:           ArrivalRate,
+			StartRate:      ArrivalStartRate,
+			EndRate:        ArrivalEndRate,
+			RampDuration:   Duration(ArrivalRampDuration),
+			Steps:          steps,
+			MaxConcurrency: MaxConcurrentSessions,
+			MaxLag:         Duration(MaxArrivalLag),
+			Mix:            ArrivalMix,
+		},
+		Scoring: Scoring{
+			Weights:   weights,
+			Penalties: penalties,
+		},
+	}
+}
+
+// LoadProfile 拡張子に応じて YAML か JSON の負荷プロファイルを読み込む
+func LoadProfile(path string) (Profile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	// levels と arrival.mix は丸ごと置き換える。scoring は指定した項目だけ上書きする
+	// UnmarshalStrict は値の入った map に同じキーを読み込むと重複として扱うため、scoring も空にして読み込んでから組み込みの値を補う
+	p := CurrentProfile()
+	p.Levels = nil
+	p.Arrival.Mix = nil
+	p.Scoring = Scoring{}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(b, &p)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&p)
+	default:
+		return Profile{}, fmt.Errorf("unsupported profile format: %s", path)
+	}
+	if err != nil {
+		return Profile{}, err
+	}
+
+	current := CurrentProfile()
+	if len(p.Levels) == 0 {
+		p.Levels = current.Levels
+	}
+	if len(p.Arrival.Mix) == 0 {
+		p.Arrival.Mix = current.Arrival.Mix
+	}
+	if p.Scoring.Weights == nil {
+		p.Scoring.Weights = make(EndpointWeights, len(current.Scoring.Weights))
+	}
+	for endpoint, w := range current.Scoring.Weights {
+		if _, ok := p.Scoring.Weights[endpoint]; !ok {
+			p.Scoring.Weights[endpoint] = w
+		}
+	}
+	if p.Scoring.Penalties == nil {
+		p.Scoring.Penalties = make(ErrorPenalties, len(current.Scoring.Penalties))
+	}
+	for class, penalty := range current.Scoring.Penalties {
+		if _, ok := p.Scoring.Penalties[class]; !ok {
+			p.Scoring.Penalties[class] = penalty
+		}
+	}
+
+	if err := p.Validate(); err != nil {
+		return Profile{}, err
+	}
+
+	return p, nil
+}
+
+func (p Profile) Validate() error {
+	if len(p.Levels) == 0 {
+		return fmt.Errorf("levels: at least one level is required")
+	}
+
+	var prev int64
+	for i, level := range p.Levels {
+		if i < len(p.Levels)-1 && level.NextLevelScore <= prev {
+			return fmt.Errorf("levels[%d].next_level_score: must be greater than %d", i, prev)
+		}
+		prev = level.NextLevelScore
+
+		for name, n := range level.IncWorkers {
+			if n < 0 {
+				return fmt.Errorf("levels[%d].inc_workers.%s: must not be negative", i, name)
+			}
+		}
+	}
+
+	positives := []struct {
+		name string
+		d    Duration
+	}{
+		{"think_time.fail_scenario", p.ThinkTime.FailScenario},
+		{"think_time.user_away", p.ThinkTime.UserAway},
+		{"think_time.bot_interval", p.ThinkTime.BotInterval},
+		{"think_time.before_post_draft", p.ThinkTime.BeforePostDraft},
+		{"think_time.max_sleep_on_rate_limited", p.ThinkTime.MaxSleepOnRateLimited},
+		{"timeout.abandonment_page", p.Timeout.AbandonmentPage},
+		{"timeout.default_api", p.Timeout.DefaultAPI},
+		{"timeout.initialize", p.Timeout.Initialize},
+		{"timeout.verify", p.Timeout.Verify},
+		{"timeout.conformance", p.Timeout.Conformance},
+		{"timeout.draft", p.Timeout.Draft},
+		{"timeout.load", p.Timeout.Load},
+		{"control.interval", p.Control.Interval},
+		{"control.max_p99_latency", p.Control.MaxP99Latency},
+		{"arrival.ramp_duration", p.Arrival.RampDuration},
+		{"arrival.max_lag", p.Arrival.MaxLag},
+	}
+	for _, v := range positives {
+		if v.d <= 0 {
+			return fmt.Errorf("%s: must be positive", v.name)
+		}
+	}
+
+	if p.Conformance.Concurrency < 1 {
+		return fmt.Errorf("conformance.concurrency: must be at least 1")
+	}
+
+	switch p.Control.Mode {
+	case ControlModeRatchet, ControlModeAdaptive:
+	default:
+		return fmt.Errorf("control.mode: must be %s or %s", ControlModeRatchet, ControlModeAdaptive)
+	}
+	if p.Control.MaxTimeouts < 0 {
+		return fmt.Errorf("control.max_timeouts: must not be negative")
+	}
+	if p.Control.SustainedIntervals < 1 {
+		return fmt.Errorf("control.sustained_intervals: must be at least 1")
+	}
+	if p.Control.CooldownAfterLevelDown < 0 {
+		return fmt.Errorf("control.cooldown_after_level_down: must not be negative")
+	}
+
+	if err := p.Arrival.validate(); err != nil {
+		return err
+	}
+	for endpoint, w := range p.Scoring.Weights {
+		if w < 0 {
+			return fmt.Errorf("scoring.weights.%s: must not be negative", endpoint)
+		}
+	}
+	for class, penalty := range p.Scoring.Penalties {
+		if penalty < 0 {
+			return fmt.Errorf("scoring.penalties.%s: must not be negative", class)
+		}
+	}
+
+	// 揺らぎはミリ秒単位で乱数を取るため 1ms 以上必要
+	swings := []struct {
+		name string
+		d    Duration
+	}{
+		{"think_time.fail_scenario_swing", p.ThinkTime.FailScenarioSwing},
+		{"think_time.user_away_swing", p.ThinkTime.UserAwaySwing},
+		{"think_time.bot_interval_swing", p.ThinkTime.BotIntervalSwing},
+		{"think_time.before_post_draft_swing", p.ThinkTime.BeforePostDraftSwing},
+	}
+	for _, v := range swings {
+		if time.Duration(v.d) < time.Millisecond {
+			return fmt.Errorf("%s: must be at least 1ms", v.name)
+		}
+	}
+
+	return nil
+}
+
+func (a Arrival) validate() error {
+	switch a.Model {
+	case ArrivalModelClosed, ArrivalModelOpen:
+	default:
+		return fmt.Errorf("arrival.model: must be %s or %s", ArrivalModelClosed, ArrivalModelOpen)
+	}
+
+	switch a.Pattern {
+	case ArrivalPatternFixed:
+		if a.Model == ArrivalModelOpen && a.Rate <= 0 {
+			return fmt.Errorf("arrival.rate: must be positive")
+		}
+	case ArrivalPatternRamp:
+		if a.StartRate < 0 || a.EndRate < 0 {
+			return fmt.Errorf("arrival.start_rate, arrival.end_rate: must not be negative")
+		}
+	case ArrivalPatternStep:
+		if a.Model == ArrivalModelOpen && len(a.Steps) == 0 {
+			return fmt.Errorf("arrival.steps: at least one step is required")
+		}
+		for i, step := range a.Steps {
+			if step.Duration <= 0 {
+				return fmt.Errorf("arrival.steps[%d].duration: must be positive", i)
+			}
+			if step.Rate < 0 {
+				return fmt.Errorf("arrival.steps[%d].rate: must not be negative", i)
+			}
+		}
+	default:
+		return fmt.Errorf("arrival.pattern: must be %s, %s or %s", ArrivalPatternFixed, ArrivalPatternRamp, ArrivalPatternStep)
+	}
+
+	if a.Rate < 0 {
+		return fmt.Errorf("arrival.rate: must not be negative")
+	}
+	if a.MaxConcurrency < 1 {
+		return fmt.Errorf("arrival.max_concurrency: must be at least 1")
+	}
+	total := 0
+	for name, weight := range a.Mix {
+		if weight < 0 {
+			return fmt.Errorf("arrival.mix.%s: must not be negative", name)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("arrival.mix: at least one scenario must have a positive weight")
+	}
+
+	return nil
+}
+
+// Apply 負荷プロファイルの値を有効にする。ベンチマーク開始前に呼ぶこと
+func Apply(p Profile) {
+	BoundaryOfLevel = make([]int64, 0, len(p.Levels))
+	ListOfIncWorkers = make([]IncWorkers, 0, len(p.Levels))
+	for _, level := range p.Levels {
+		BoundaryOfLevel = append(BoundaryOfLevel, level.NextLevelScore)
+		ListOfIncWorkers = append(ListOfIncWorkers, level.IncWorkers)
+	}
+
+	SleepTimeOnFailScenario = time.Duration(p.ThinkTime.FailScenario)
+	SleepSwingOnFailScenario = int(time.Duration(p.ThinkTime.FailScenarioSwing) / time.Millisecond)
+	SleepTimeOnUserAway = time.Duration(p.ThinkTime.UserAway)
+	SleepSwingOnUserAway = int(time.Duration(p.ThinkTime.UserAwaySwing) / time.Millisecond)
+	SleepTimeOnBotInterval = time.Duration(p.ThinkTime.BotInterval)
+	SleepSwingOnBotInterval = int(time.Duration(p.ThinkTime.BotIntervalSwing) / time.Millisecond)
+	SleepBeforePostDraft = time.Duration(p.ThinkTime.BeforePostDraft)
+	SleepSwingBeforePostDraft = int(time.Duration(p.ThinkTime.BeforePostDraftSwing) / time.Millisecond)
+	MaxSleepTimeOnRateLimited = time.Duration(p.ThinkTime.MaxSleepOnRateLimited)
+
+	ThresholdTimeOfAbandonmentPage = time.Duration(p.Timeout.AbandonmentPage)
+	DefaultAPITimeout = time.Duration(p.Timeout.DefaultAPI)
+	InitializeTimeout = time.Duration(p.Timeout.Initialize)
+	VerifyTimeout = time.Duration(p.Timeout.Verify)
+	ConformanceTimeout = time.Duration(p.Timeout.Conformance)
+	DraftTimeout = time.Duration(p.Timeout.Draft)
+	LoadTimeout = time.Duration(p.Timeout.Load)
+
+	ConformanceConcurrency = p.Conformance.Concurrency
+
+	ControlMode = p.Control.Mode
+	ControlInterval = time.Duration(p.Control.Interval)
+	MaxTimeoutsPerControlInterval = p.Control.MaxTimeouts
+	MaxP99LatencyOfControl = time.Duration(p.Control.MaxP99Latency)
+	SustainedIntervalsToLevelDown = p.Control.SustainedIntervals
+	CooldownAfterLevelDown = time.Duration(p.Control.CooldownAfterLevelDown)
+
+	ArrivalModel = p.Arrival.Model
+	ArrivalPattern = p.Arrival.Pattern
+	ArrivalRate = p.Arrival.Rate
+	ArrivalStartRate = p.Arrival.StartRate
+	ArrivalEndRate = p.Arrival.EndRate
+	ArrivalRampDuration = time.Duration(p.Arrival.RampDuration)
+	ArrivalSteps = make([]ArrivalStep, 0, len(p.Arrival.Steps))
+	for _, step := range p.Arrival.Steps {
+		ArrivalSteps = append(ArrivalSteps, ArrivalStep{Duration: time.Duration(step.Duration), Rate: step.Rate})
+	}
+	MaxConcurrentSessions = p.Arrival.MaxConcurrency
+	MaxArrivalLag = time.Duration(p.Arrival.MaxLag)
+	ArrivalMix = p.Arrival.Mix
+
+	ScoreWeights = p.Scoring.Weights
+	ScorePenalties = p.Scoring.Penalties
+}
@@ -0,0 +1,328 @@
+package parameter_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+)
+
+func writeProfile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		// want 組み込みのプロファイルから、指定した項目だけを書き換える
+		want    func(p *parameter.Profile)
+		wantErr string
+	}{
+		{
+			name:    "empty yaml",
+			file:    "profile.yaml",
+			content: "",
+			want:    func(p *parameter.Profile) {},
+		},
+		{
+			name: "yaml",
+			file: "profile.yaml",
+			content: `
+timeout:
+  load: 30s
+control:
+  mode: adaptive
+  cooldown_after_level_down: 1.5s
+`,
+			want: func(p *parameter.Profile) {
+				p.Timeout.Load = parameter.Duration(30 * time.Second)
+				p.Control.Mode = parameter.ControlModeAdaptive
+				p.Control.CooldownAfterLevelDown = parameter.Duration(1500 * time.Millisecond)
+			},
+		},
+		{
+			name:    "yml",
+			file:    "profile.yml",
+			content: "conformance:\n  concurrency: 4\n",
+			want:    func(p *parameter.Profile) { p.Conformance.Concurrency = 4 },
+		},
+		{
+			name:    "json",
+			file:    "profile.json",
+			content: `{"think_time": {"user_away": "2s", "user_away_swing": "300ms"}, "arrival": {"max_concurrency": 8}}`,
+			want: func(p *parameter.Profile) {
+				p.ThinkTime.UserAway = parameter.Duration(2 * time.Second)
+				p.ThinkTime.UserAwaySwing = parameter.Duration(300 * time.Millisecond)
+				p.Arrival.MaxConcurrency = 8
+			},
+		},
+		{
+			name: "levels are replaced",
+			file: "profile.yaml",
+			content: `
+levels:
+  - next_level_score: 100
+    inc_workers: {chair_search: 2}
+  - inc_workers: {estate_search: 1}
+`,
+			want: func(p *parameter.Profile) {
+				p.Levels = []parameter.Level{
+					{NextLevelScore: 100, IncWorkers: parameter.IncWorkers{"chair_search": 2}},
+					{IncWorkers: parameter.IncWorkers{"estate_search": 1}},
+				}
+			},
+		},
+		{
+			name:    "arrival mix is replaced",
+			file:    "profile.json",
+			content: `{"arrival": {"mix": {"chair_search": 1}}}`,
+			want:    func(p *parameter.Profile) { p.Arrival.Mix = parameter.SessionMix{"chair_search": 1} },
+		},
+		{
+			name:    "scoring overrides only the given entries",
+			file:    "profile.yaml",
+			content: "scoring:\n  weights:\n    POST /api/estate/nazotte: 3\n  penalties:\n    timeout: 2\n",
+			want: func(p *parameter.Profile) {
+				p.Scoring.Weights["POST /api/estate/nazotte"] = 3
+				p.Scoring.Penalties["timeout"] = 2
+			},
+		},
+		{
+			name:    "scoring overrides built-in entries",
+			file:    "profile.yaml",
+			content: "scoring:\n  weights:\n    POST /api/chair/buy/:id: 2\n  penalties:\n    application: 10\n",
+			want: func(p *parameter.Profile) {
+				p.Scoring.Weights["POST /api/chair/buy/:id"] = 2
+				p.Scoring.Penalties["application"] = 10
+			},
+		},
+		{name: "unknown yaml field", file: "profile.yaml", content: "timeout:\n  unknown: 1s\n", wantErr: "unknown"},
+		{name: "unknown json field", file: "profile.json", content: `{"control": {"unknown": 1}}`, wantErr: "unknown"},
+		{name: "invalid duration", file: "profile.yaml", content: "timeout:\n  load: fast\n", wantErr: "fast"},
+		{name: "invalid type", file: "profile.json", content: `{"conformance": {"concurrency": "4"}}`, wantErr: "concurrency"},
+		{name: "invalid json", file: "profile.json", content: `{"timeout": `, wantErr: "EOF"},
+		{name: "invalid value", file: "profile.yaml", content: "control:\n  mode: manual\n", wantErr: "control.mode"},
+		{name: "negative value", file: "profile.json", content: `{"timeout": {"load": "-1s"}}`, wantErr: "timeout.load"},
+		{name: "unsupported format", file: "profile.toml", content: "", wantErr: "unsupported profile format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parameter.LoadProfile(writeProfile(t, tt.file, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadProfile() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := parameter.CurrentProfile()
+			tt.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadProfile() = %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := parameter.LoadProfile(filepath.Join(os.TempDir(), "missing-profile.yaml")); err == nil {
+			t.Error("LoadProfile() returned no error")
+		}
+	})
+}
+
+// 同梱のプロファイルは組み込みの値と同じでなければならない
+func TestLoadProfile_Default(t *testing.T) {
+	got, err := parameter.LoadProfile("../profiles/default.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := parameter.CurrentProfile(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadProfile() = %+v, want %+v", got, want)
+	}
+}
+
+func TestProfile_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(p *parameter.Profile)
+		wantErr string
+	}{
+		{name: "built-in", modify: func(p *parameter.Profile) {}},
+		{name: "no levels", modify: func(p *parameter.Profile) { p.Levels = nil }, wantErr: "levels:"},
+		{
+			name: "last level without next_level_score",
+			modify: func(p *parameter.Profile) {
+				p.Levels = []parameter.Level{{NextLevelScore: 100}, {}}
+			},
+		},
+		{
+			name: "next_level_score not increasing",
+			modify: func(p *parameter.Profile) {
+				p.Levels = []parameter.Level{{NextLevelScore: 100}, {NextLevelScore: 100}, {}}
+			},
+			wantErr: "levels[1].next_level_score",
+		},
+		{
+			name: "negative inc_workers",
+			modify: func(p *parameter.Profile) {
+				p.Levels = []parameter.Level{{IncWorkers: parameter.IncWorkers{"chair_search": -1}}}
+			},
+			wantErr: "levels[0].inc_workers.chair_search",
+		},
+		{name: "zero think time", modify: func(p *parameter.Profile) { p.ThinkTime.UserAway = 0 }, wantErr: "think_time.user_away"},
+		{name: "zero timeout", modify: func(p *parameter.Profile) { p.Timeout.DefaultAPI = 0 }, wantErr: "timeout.default_api"},
+		{
+			name:    "swing below 1ms",
+			modify:  func(p *parameter.Profile) { p.ThinkTime.BotIntervalSwing = parameter.Duration(time.Microsecond) },
+			wantErr: "think_time.bot_interval_swing",
+		},
+		{name: "zero concurrency", modify: func(p *parameter.Profile) { p.Conformance.Concurrency = 0 }, wantErr: "conformance.concurrency"},
+		{name: "unknown control mode", modify: func(p *parameter.Profile) { p.Control.Mode = "manual" }, wantErr: "control.mode"},
+		{name: "negative max_timeouts", modify: func(p *parameter.Profile) { p.Control.MaxTimeouts = -1 }, wantErr: "control.max_timeouts"},
+		{name: "zero sustained_intervals", modify: func(p *parameter.Profile) { p.Control.SustainedIntervals = 0 }, wantErr: "control.sustained_intervals"},
+		{
+			name:    "negative cooldown",
+			modify:  func(p *parameter.Profile) { p.Control.CooldownAfterLevelDown = parameter.Duration(-time.Second) },
+			wantErr: "control.cooldown_after_level_down",
+		},
+		{name: "unknown arrival model", modify: func(p *parameter.Profile) { p.Arrival.Model = "poisson" }, wantErr: "arrival.model"},
+		{name: "unknown arrival pattern", modify: func(p *parameter.Profile) { p.Arrival.Pattern = "wave" }, wantErr: "arrival.pattern"},
+		{
+			name: "open model without rate",
+			modify: func(p *parameter.Profile) {
+				p.Arrival.Model, p.Arrival.Pattern, p.Arrival.Rate = parameter.ArrivalModelOpen, parameter.ArrivalPatternFixed, 0
+			},
+			wantErr: "arrival.rate",
+		},
+		{
+			name: "open model without steps",
+			modify: func(p *parameter.Profile) {
+				p.Arrival.Model, p.Arrival.Pattern, p.Arrival.Steps = parameter.ArrivalModelOpen, parameter.ArrivalPatternStep, nil
+			},
+			wantErr: "arrival.steps",
+		},
+		{
+			name: "step without duration",
+			modify: func(p *parameter.Profile) {
+				p.Arrival.Pattern, p.Arrival.Steps = parameter.ArrivalPatternStep, []parameter.Step{{Rate: 1}}
+			},
+			wantErr: "arrival.steps[0].duration",
+		},
+		{name: "zero max_concurrency", modify: func(p *parameter.Profile) { p.Arrival.MaxConcurrency = 0 }, wantErr: "arrival.max_concurrency"},
+		{
+			name:    "mix without weight",
+			modify:  func(p *parameter.Profile) { p.Arrival.Mix = parameter.SessionMix{"chair_search": 0} },
+			wantErr: "arrival.mix",
+		},
+		{
+			name: "negative weight",
+			modify: func(p *parameter.Profile) {
+				p.Scoring.Weights = parameter.EndpointWeights{"POST /api/chair/buy/:id": -1}
+			},
+			wantErr: "scoring.weights",
+		},
+		{
+			name:    "negative penalty",
+			modify:  func(p *parameter.Profile) { p.Scoring.Penalties = parameter.ErrorPenalties{"timeout": -1} },
+			wantErr: "scoring.penalties.timeout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parameter.CurrentProfile()
+			tt.modify(&p)
+			err := p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	builtin := parameter.CurrentProfile()
+	t.Cleanup(func() { parameter.Apply(builtin) })
+
+	tests := []struct {
+		name   string
+		modify func(p *parameter.Profile)
+	}{
+		{name: "nothing", modify: func(p *parameter.Profile) {}},
+		{
+			name: "levels",
+			modify: func(p *parameter.Profile) {
+				p.Levels = []parameter.Level{{NextLevelScore: 10, IncWorkers: parameter.IncWorkers{"chair_search": 1}}, {}}
+			},
+		},
+		{
+			name: "think time",
+			modify: func(p *parameter.Profile) {
+				p.ThinkTime.UserAway = parameter.Duration(3 * time.Second)
+				p.ThinkTime.FailScenarioSwing = parameter.Duration(250 * time.Millisecond)
+			},
+		},
+		{name: "timeout", modify: func(p *parameter.Profile) { p.Timeout.Draft = parameter.Duration(7 * time.Second) }},
+		{name: "conformance", modify: func(p *parameter.Profile) { p.Conformance.Concurrency = 2 }},
+		{
+			name: "control",
+			modify: func(p *parameter.Profile) {
+				p.Control.Mode = parameter.ControlModeAdaptive
+				p.Control.SustainedIntervals = 5
+			},
+		},
+		{
+			name: "arrival",
+			modify: func(p *parameter.Profile) {
+				p.Arrival.Pattern = parameter.ArrivalPatternStep
+				p.Arrival.Steps = []parameter.Step{{Duration: parameter.Duration(time.Second), Rate: 2}}
+				p.Arrival.Mix = parameter.SessionMix{"estate_search": 1}
+			},
+		},
+		{
+			name: "scoring",
+			modify: func(p *parameter.Profile) {
+				p.Scoring.Weights = parameter.EndpointWeights{"POST /api/chair/buy/:id": 5}
+				p.Scoring.Penalties = parameter.ErrorPenalties{}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parameter.Apply(builtin)
+			want := parameter.CurrentProfile()
+			tt.modify(&want)
+
+			parameter.Apply(want)
+			// 書き換えた項目だけが変わり、ほかの項目は組み込みの値のまま
+			if got := parameter.CurrentProfile(); !reflect.DeepEqual(got, want) {
+				t.Errorf("CurrentProfile() after Apply() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
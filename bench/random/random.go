@@ -0,0 +1,61 @@
+package random
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+)
+
+// Source 1回のベンチマークのすべての乱数列の元になるシード
+type Source struct {
+	mu   sync.RWMutex
+	seed int64
+}
+
+func NewSource(seed int64) *Source {
+	return &Source{seed: seed}
+}
+
+type contextKey struct{}
+
+// WithSource s を持つ context を返す
+func WithSource(ctx context.Context, s *Source) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext ctx が持つ Source を返す。持っていなければ nil を返し、nil の Source はシード0として扱う
+func FromContext(ctx context.Context) *Source {
+	s, _ := ctx.Value(contextKey{}).(*Source)
+	return s
+}
+
+// SetSeed シードを設定する。ベンチマーク開始前に呼ぶこと
+func (s *Source) SetSeed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seed = seed
+}
+
+func (s *Source) Seed() int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.seed
+}
+
+// New シードと name, index から決まる乱数列を作る
+// 同じシードであれば、同じ name と index の組には常に同じ乱数列が割り当てられる
+// 返り値の *rand.Rand はgoroutine-safeではないため、Workerごとに作ること
+func (s *Source) New(name string, index int64) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return rand.New(rand.NewSource(s.Seed() ^ int64(h.Sum64()) ^ index*0x5851f42d4c957f2d))
+}
+
+// Fork 親の乱数列から独立した乱数列を作る。別のgoroutineに渡す場合に使う
+func Fork(r *rand.Rand) *rand.Rand {
+	return rand.New(rand.NewSource(r.Int63()))
+}
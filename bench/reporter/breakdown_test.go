@@ -0,0 +1,75 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+	"github.com/morikuni/failure"
+)
+
+func TestReportScoreBreakdown(t *testing.T) {
+	weights, penalties := parameter.ScoreWeights, parameter.ScorePenalties
+	t.Cleanup(func() { parameter.ScoreWeights, parameter.ScorePenalties = weights, penalties })
+	parameter.ScoreWeights = parameter.EndpointWeights{"POST /api/chair/buy/:id": 10, "POST /api/estate/nazotte": 3}
+	parameter.ScorePenalties = parameter.ErrorPenalties{"application": 4, "timeout": 1}
+
+	sc := score.New()
+	e := fails.New()
+	ctx := score.WithScenario(score.WithScore(context.Background(), sc), "estate_nazotte_search")
+	score.Add(ctx, "POST /api/estate/nazotte")
+	score.Add(ctx, "POST /api/estate/nazotte")
+	score.Add(ctx, "GET /api/estate/:id")
+	score.Add(score.WithScenario(ctx, "chair_search"), "POST /api/chair/buy/:id")
+	e.Add(failure.New(fails.ErrApplication, fails.Message("ESTATE_DETAIL_INVALID_CONTENT", "GET /api/estate/:id: レスポンスの内容が不正です")))
+	e.Add(failure.New(fails.ErrTimeout, fails.Message("ESTATE_DETAIL_REQUEST_FAILED", "GET /api/estate/:id: リクエストに失敗しました")))
+	e.Add(failure.New(fails.ErrTemporary, fails.Message("ESTATE_DETAIL_REQUEST_FAILED", "GET /api/estate/:id: リクエストに失敗しました")))
+
+	var buf bytes.Buffer
+	r := New(sc, metrics.New())
+	r.writer = &buf
+	if err := r.Report(e); err != nil {
+		t.Fatal(err)
+	}
+	var got Stdout
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// 16点の加点から application 4点と timeout 1点を引く
+	if got.Score != 11 {
+		t.Errorf("score = %d, want 11", got.Score)
+	}
+	want := ScoreBreakdown{
+		Gained: []score.Gain{
+			{Scenario: "chair_search", Endpoint: "POST /api/chair/buy/:id", Count: 1, Points: 10},
+			{Scenario: "estate_nazotte_search", Endpoint: "GET /api/estate/:id", Count: 1, Points: 0},
+			{Scenario: "estate_nazotte_search", Endpoint: "POST /api/estate/nazotte", Count: 2, Points: 6},
+		},
+		Lost: []Loss{
+			{Class: "application", Count: 1, Penalty: 4, Points: 4},
+			{Class: "timeout", Count: 1, Penalty: 1, Points: 1},
+			{Class: "temporary", Count: 1, Penalty: 0, Points: 0},
+		},
+	}
+	if diff := cmp.Diff(want, got.ScoreBreakdown); diff != "" {
+		t.Errorf("score_breakdown mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	p := parameter.CurrentProfile()
+	if err := ValidateProfile(p); err != nil {
+		t.Fatalf("ValidateProfile() with the built-in profile: %v", err)
+	}
+	p.Scoring.Penalties["unknown"] = 1
+	if err := ValidateProfile(p); err == nil {
+		t.Error("ValidateProfile() with an unknown error class: want error")
+	}
+}
@@ -0,0 +1,32 @@
+package reporter
+
+import "github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+
+// reasons 結果の reason の英語のメッセージ
+var reasons = map[string]string{
+	"OK": "OK",
+	"コマンドライン引数のパースに失敗しました":    "failed to parse command line arguments",
+	"ジャーニーの読み込みに失敗しました":       "failed to load journeys",
+	"負荷プロファイルの読み込みに失敗しました":    "failed to load the profile",
+	"タイムラインの出力先が不正です":         "invalid timeline output",
+	"ベンチ対象サーバーのURLが不正です":      "invalid target server URL",
+	"ベンチマーカーの初期化に失敗しました":      "failed to initialize the benchmarker",
+	"agentの待ち受けに失敗しました":       "failed to listen for agents",
+	"agentの準備に失敗しました":         "failed to set up agents",
+	"POST /initializeに失敗しました": "POST /initialize failed",
+	"アプリケーション互換性チェックに失敗しました":  "application compatibility check failed",
+	"致命的なエラーが発生しました":          "a critical error occurred",
+	"アプリケーションエラーが10回以上発生しました": "application errors occurred 10 or more times",
+	"スコアが0点を下回りました":           "the score fell below 0",
+}
+
+// localizeReason reason を locale の言語にする。英語がなければそのまま返す
+func localizeReason(reason, locale string) string {
+	if locale != fails.LocaleEn {
+		return reason
+	}
+	if en, ok := reasons[reason]; ok {
+		return en
+	}
+	return reason
+}
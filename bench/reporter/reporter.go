@@ -4,9 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"sort"
 	"sync"
 
+	"github.com/morikuni/failure"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/conformance"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
 )
 
@@ -16,107 +23,248 @@ type Stdout struct {
 	Messages []Message `json:"messages"`
 	Reason   string    `json:"reason"`
 	Language string    `json:"language"`
+	// Locale messages と reason の言語 (ja, en)
+	Locale string `json:"locale"`
+	// Mode ベンチマークのモード (full, verify, load)
+	Mode string `json:"mode"`
+	// Conformance 互換性チェックの結果。verify モードでのみ出力する
+	Conformance *conformance.Report `json:"conformance,omitempty"`
+	// Seed ベンチマークで使われた乱数のシード
+	Seed int64 `json:"seed"`
+	// Profile ベンチマークで使われた負荷プロファイル
+	Profile parameter.Profile `json:"profile"`
+	// Metrics エンドポイントごとのレイテンシとスループット
+	Metrics metrics.Summary `json:"metrics"`
+	// LevelHistory 負荷レベルの変化の履歴
+	LevelHistory []score.LevelChange `json:"level_history"`
+	// ScoreBreakdown スコアの加点と減点の内訳
+	ScoreBreakdown ScoreBreakdown `json:"score_breakdown"`
+}
+
+// ScoreBreakdown スコアの内訳。Score は Gained の合計から Lost の合計を引いたもの (0点未満は0点)
+type ScoreBreakdown struct {
+	Gained []score.Gain `json:"gained"`
+	Lost   []Loss       `json:"lost"`
+}
+
+// Loss エラーの種類ごとの減点
+type Loss struct {
+	Class string `json:"class"`
+	Count int    `json:"count"`
+	// Penalty エラー1件あたりの減点
+	Penalty int64 `json:"penalty"`
+	Points  int64 `json:"points"`
+}
+
+// losses 発生したエラーの種類ごとに parameter.ScorePenalties の減点を計算する
+func losses(counts map[failure.Code]int) []Loss {
+	ls := make([]Loss, 0, len(fails.Codes))
+	for _, code := range fails.Codes {
+		n := counts[code]
+		if n == 0 {
+			continue
+		}
+		class := fails.ClassOf(code)
+		penalty := parameter.ScorePenalties[class]
+		ls = append(ls, Loss{Class: class, Count: n, Penalty: penalty, Points: int64(n) * penalty})
+	}
+	return ls
 }
 
-var mu sync.RWMutex
-var writer io.Writer
-var stdout *Stdout
+// ValidateProfile 負荷プロファイルの減点がすべて fails のエラーの種類に対するものか確認する
+func ValidateProfile(p parameter.Profile) error {
+	for class := range p.Scoring.Penalties {
+		known := false
+		for _, code := range fails.Codes {
+			if fails.ClassOf(code) == class {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("scoring.penalties.%s: unknown error class", class)
+		}
+	}
+	return nil
+}
+
+// Reporter 1回のベンチマークの結果を出力する
+type Reporter struct {
+	mu      sync.RWMutex
+	writer  io.Writer
+	stdout  *Stdout
+	score   *score.Score
+	metrics *metrics.Recorder
+}
 
-func init() {
-	stdout = &Stdout{
-		Pass:     false,
-		Score:    0,
-		Messages: make([]Message, 0),
-		Reason:   "",
-		Language: "",
+// New sc のスコアと m のリクエストの集計を結果として出力する Reporter を作る
+func New(sc *score.Score, m *metrics.Recorder) *Reporter {
+	return &Reporter{
+		writer: os.Stdout,
+		stdout: &Stdout{
+			Pass:     false,
+			Score:    0,
+			Messages: make([]Message, 0),
+			Reason:   "",
+			Language: "",
+			Locale:   fails.LocaleJa,
+			Profile:  parameter.CurrentProfile(),
+		},
+		score:   sc,
+		metrics: m,
 	}
 }
 
-func Report(msgs []string, critical, application, trivial int) error {
-	err := update(msgs, critical, application, trivial)
+// Report e のエラーで減点した結果を出力する
+func (r *Reporter) Report(e *fails.Errors) error {
+	err := r.update(e)
 	if err != nil {
 		return err
 	}
 
-	mu.RLock()
-	defer mu.RUnlock()
-	bytes, err := json.Marshal(stdout)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	bytes, err := json.Marshal(r.stdout)
 	if err != nil {
 		return err
 	}
-	fmt.Println(string(bytes))
+	fmt.Fprintln(r.writer, string(bytes))
 	return nil
 }
 
-func SetPassed(p bool) {
-	mu.Lock()
-	defer mu.Unlock()
-	stdout.Pass = p
+func (r *Reporter) SetPassed(p bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stdout.Pass = p
 }
 
-func SetReason(reason string) {
-	mu.Lock()
-	defer mu.Unlock()
-	stdout.Reason = reason
+func (r *Reporter) SetReason(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stdout.Reason = reason
 }
 
-func update(msgs []string, critical, application, trivial int) error {
-	mu.Lock()
-	defer mu.Unlock()
+func (r *Reporter) update(e *fails.Errors) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	row := score.GetScore()
-	deducation := int64(application * 50)
+	row := r.score.GetScore()
+	r.stdout.LevelHistory = r.score.History()
+	lost := losses(e.CountByCode())
+	r.stdout.ScoreBreakdown = ScoreBreakdown{Gained: r.score.Gains(), Lost: lost}
+	var deducation int64
+	for _, l := range lost {
+		deducation += l.Points
+	}
 	score := row - deducation
 	if score < 0 {
-		stdout.Pass = false
-		stdout.Reason = "スコアが0点を下回りました"
+		r.stdout.Pass = false
+		r.stdout.Reason = "スコアが0点を下回りました"
 		score = 0
 	}
-	stdout.Score = score
+	r.stdout.Score = score
 
-	stdout.Messages = UniqMsgs(msgs)
+	r.stdout.Messages = Aggregate(e.Failures(), r.stdout.Locale)
+	r.stdout.Reason = localizeReason(r.stdout.Reason, r.stdout.Locale)
+	r.stdout.Metrics = r.metrics.Summarize()
 	return nil
 }
 
-func SetLanguage(language string) {
-	mu.Lock()
-	defer mu.Unlock()
-	stdout.Language = language
+func (r *Reporter) SetLanguage(language string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stdout.Language = language
 }
 
+// SetLocale 結果のメッセージの言語を設定する
+func (r *Reporter) SetLocale(locale string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stdout.Locale = locale
+}
+
+func (r *Reporter) SetMode(mode string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stdout.Mode = mode
+}
+
+func (r *Reporter) SetConformance(c conformance.Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stdout.Conformance = &c
+}
+
+func (r *Reporter) SetSeed(seed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stdout.Seed = seed
+}
+
+func (r *Reporter) SetProfile(p parameter.Profile) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stdout.Profile = p
+}
+
+// Message 同じコードのエラーをまとめたもの。Text は Locale の言語で、まとめたうちで最も多いメッセージ
 type Message struct {
+	Code     string         `json:"code"`
+	Severity fails.Severity `json:"severity"`
+	Text     string         `json:"text"`
+	Count    int            `json:"count"`
+	// Samples 同じコードのうち、メッセージごとの件数。多い順に maxSamples 件まで
+	Samples []Sample `json:"samples"`
+}
+
+// Sample 同じコードで同じメッセージのエラーの件数
+type Sample struct {
 	Text  string `json:"text"`
 	Count int    `json:"count"`
 }
 
-func UniqMsgs(allMsgs []string) []Message {
-	if len(allMsgs) == 0 {
-		return []Message{}
-	}
+// maxSamples コードごとに出力するメッセージの数
+const maxSamples = 5
 
-	sort.Strings(allMsgs)
-	msgs := make([]Message, 0, len(allMsgs))
-
-	preMsg := allMsgs[0]
-	cnt := 0
-
-	// 適当にuniqする
-	for _, msg := range allMsgs {
-		if preMsg != msg {
-			msgs = append(msgs, Message{
-				Text:  preMsg,
-				Count: cnt,
-			})
-			preMsg = msg
-			cnt = 1
-		} else {
-			cnt++
+// Aggregate エラーをコードごとにまとめ、コードの順に並べる
+// 同じコードでもステータスコードなどでメッセージが異なるため、メッセージごとの件数を多い順 (同数なら先に発生した順) に残す
+func Aggregate(failures []fails.Failure, locale string) []Message {
+	byCode := make(map[string]*Message)
+	samples := make(map[string][]Sample)
+	for _, f := range failures {
+		text := f.Text(locale)
+		m, ok := byCode[f.Code]
+		if !ok {
+			m = &Message{Code: f.Code, Severity: f.Severity}
+			byCode[f.Code] = m
+		}
+		m.Count++
+
+		ss := samples[f.Code]
+		found := false
+		for i := range ss {
+			if ss[i].Text == text {
+				ss[i].Count++
+				found = true
+				break
+			}
+		}
+		if !found {
+			samples[f.Code] = append(ss, Sample{Text: text, Count: 1})
 		}
 	}
-	msgs = append(msgs, Message{
-		Text:  preMsg,
-		Count: cnt,
-	})
 
+	msgs := make([]Message, 0, len(byCode))
+	for code, m := range byCode {
+		ss := samples[code]
+		sort.SliceStable(ss, func(i, j int) bool { return ss[i].Count > ss[j].Count })
+		if len(ss) > maxSamples {
+			ss = ss[:maxSamples]
+		}
+		m.Text = ss[0].Text
+		m.Samples = ss
+		msgs = append(msgs, *m)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].Code < msgs[j].Code })
 	return msgs
 }
@@ -1,36 +1,85 @@
 package reporter_test
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/reporter"
 )
 
-func Test_uniqMsgs(t *testing.T) {
-	type args struct {
-		allMsgs []string
+func Test_aggregate(t *testing.T) {
+	failures := []fails.Failure{
+		{Code: "CHAIR_SEARCH_INVALID_CONTENT", Severity: fails.SeverityError, Ja: "GET /api/chair/search: レスポンスの内容が不正です", En: "GET /api/chair/search: invalid response content"},
+		{Code: "CHAIR_BUY_REQUEST_FAILED", Severity: fails.SeverityError, Ja: "POST /api/chair/buy/:id: リクエストに失敗しました (status: 500, code: )", En: "POST /api/chair/buy/:id: request failed (status: 500, code: )"},
+		{Code: "CHAIR_BUY_REQUEST_FAILED", Severity: fails.SeverityError, Ja: "POST /api/chair/buy/:id: リクエストに失敗しました (status: 400, code: )", En: "POST /api/chair/buy/:id: request failed (status: 400, code: )"},
+		{Code: "CHAIR_BUY_REQUEST_FAILED", Severity: fails.SeverityError, Ja: "POST /api/chair/buy/:id: リクエストに失敗しました (status: 400, code: )", En: "POST /api/chair/buy/:id: request failed (status: 400, code: )"},
+		{Code: "CHAIR_SEARCH_INVALID_CONTENT", Severity: fails.SeverityError, Ja: "GET /api/chair/search: レスポンスの内容が不正です", En: "GET /api/chair/search: invalid response content"},
 	}
 	tests := []struct {
-		name string
-		args args
-		want []reporter.Message
+		locale string
+		want   []reporter.Message
 	}{
 		{
-			args: args{
-				allMsgs: []string{"A", "B", "B"},
+			locale: fails.LocaleJa,
+			want: []reporter.Message{
+				{
+					Code: "CHAIR_BUY_REQUEST_FAILED", Severity: fails.SeverityError, Text: "POST /api/chair/buy/:id: リクエストに失敗しました (status: 400, code: )", Count: 3,
+					Samples: []reporter.Sample{
+						{Text: "POST /api/chair/buy/:id: リクエストに失敗しました (status: 400, code: )", Count: 2},
+						{Text: "POST /api/chair/buy/:id: リクエストに失敗しました (status: 500, code: )", Count: 1},
+					},
+				},
+				{
+					Code: "CHAIR_SEARCH_INVALID_CONTENT", Severity: fails.SeverityError, Text: "GET /api/chair/search: レスポンスの内容が不正です", Count: 2,
+					Samples: []reporter.Sample{{Text: "GET /api/chair/search: レスポンスの内容が不正です", Count: 2}},
+				},
 			},
+		},
+		{
+			locale: fails.LocaleEn,
 			want: []reporter.Message{
-				{Text: "A", Count: 1},
-				{Text: "B", Count: 2},
+				{
+					Code: "CHAIR_BUY_REQUEST_FAILED", Severity: fails.SeverityError, Text: "POST /api/chair/buy/:id: request failed (status: 400, code: )", Count: 3,
+					Samples: []reporter.Sample{
+						{Text: "POST /api/chair/buy/:id: request failed (status: 400, code: )", Count: 2},
+						{Text: "POST /api/chair/buy/:id: request failed (status: 500, code: )", Count: 1},
+					},
+				},
+				{
+					Code: "CHAIR_SEARCH_INVALID_CONTENT", Severity: fails.SeverityError, Text: "GET /api/chair/search: invalid response content", Count: 2,
+					Samples: []reporter.Sample{{Text: "GET /api/chair/search: invalid response content", Count: 2}},
+				},
 			},
 		},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := reporter.UniqMsgs(tt.args.allMsgs); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("uniqMsgs() = %v, want %v", got, tt.want)
+		t.Run(tt.locale, func(t *testing.T) {
+			if got := reporter.Aggregate(failures, tt.locale); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Aggregate() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func Test_aggregateLimitsSamples(t *testing.T) {
+	failures := make([]fails.Failure, 0, 8)
+	for i := 0; i < 8; i++ {
+		text := fmt.Sprintf("POST /api/chair/buy/:id: リクエストに失敗しました (status: %d, code: )", 500+i)
+		failures = append(failures, fails.Failure{Code: "CHAIR_BUY_REQUEST_FAILED", Severity: fails.SeverityError, Ja: text, En: text})
+	}
+	msgs := reporter.Aggregate(failures, fails.LocaleJa)
+	if len(msgs) != 1 {
+		t.Fatalf("len(Aggregate()) = %d, want 1", len(msgs))
+	}
+	if msgs[0].Count != 8 {
+		t.Errorf("Count = %d, want 8", msgs[0].Count)
+	}
+	if len(msgs[0].Samples) != 5 {
+		t.Errorf("len(Samples) = %d, want 5", len(msgs[0].Samples))
+	}
+	if msgs[0].Text != failures[0].Ja {
+		t.Errorf("Text = %q, want the first message %q", msgs[0].Text, failures[0].Ja)
+	}
+}
@@ -0,0 +1,69 @@
+package run
+
+import (
+	"context"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/conformance"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/evidence"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/reporter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/scenario"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+)
+
+// Run 1回のベンチマークの状態。エラー、スコア、結果の出力をベンチマークごとに持つ
+type Run struct {
+	Errors   *fails.Errors
+	Score    *score.Score
+	Reporter *reporter.Reporter
+	// Evidence エラーの原因になったリクエストとレスポンスの記録
+	Evidence *evidence.Recorder
+	// Metrics リクエストとセッションの集計
+	Metrics *metrics.Recorder
+	// Conformance 互換性チェックの結果
+	Conformance *conformance.Results
+	// Random Workerやセッションの乱数列を作るシード
+	Random *random.Source
+	// Workers 稼働中のWorkerの数
+	Workers *scenario.Workers
+}
+
+func New() *Run {
+	sc := score.New()
+	m := metrics.New()
+	return &Run{
+		Errors:      fails.New(),
+		Score:       sc,
+		Reporter:    reporter.New(sc, m),
+		Evidence:    evidence.NewRecorder(),
+		Metrics:     m,
+		Conformance: conformance.NewResults(),
+		Random:      random.NewSource(time.Now().UnixNano()),
+		Workers:     scenario.NewWorkers(),
+	}
+}
+
+type contextKey struct{}
+
+// Context parent に r を持たせた context を返す
+// シナリオやクライアントは fails.FromContext や score.FromContext で r のエラーとスコアを使う
+// リクエストの集計や乱数のシードも metrics.FromContext や random.FromContext で r のものを使う
+func (r *Run) Context(parent context.Context) context.Context {
+	ctx := context.WithValue(parent, contextKey{}, r)
+	ctx = fails.WithErrors(ctx, r.Errors)
+	ctx = evidence.WithRecorder(ctx, r.Evidence)
+	ctx = metrics.WithRecorder(ctx, r.Metrics)
+	ctx = conformance.WithResults(ctx, r.Conformance)
+	ctx = random.WithSource(ctx, r.Random)
+	ctx = scenario.WithWorkers(ctx, r.Workers)
+	return score.WithScore(ctx, r.Score)
+}
+
+// FromContext ctx が持つ Run を返す。持っていなければ nil を返す
+func FromContext(ctx context.Context) *Run {
+	r, _ := ctx.Value(contextKey{}).(*Run)
+	return r
+}
@@ -0,0 +1,77 @@
+package run_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/conformance"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/run"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+	"github.com/morikuni/failure"
+)
+
+func TestRunsAreIndependent(t *testing.T) {
+	a := run.New()
+	b := run.New()
+	ctxA := a.Context(context.Background())
+	ctxB := b.Context(context.Background())
+
+	// 失格の通知を誰も受け取らなくても Add はブロックしない
+	for i := 0; i < 20; i++ {
+		fails.Add(ctxA, failure.New(fails.ErrApplication, fails.Message("CHAIR_SEARCH_INVALID_CONTENT", "GET /api/chair/search: レスポンスの内容が不正です")))
+	}
+	score.Add(ctxB, "POST /api/chair/buy/:id")
+
+	if _, _, application, _ := a.Errors.Get(); application != 20 {
+		t.Errorf("application errors of a = %d, want 20", application)
+	}
+	if _, _, application, _ := b.Errors.Get(); application != 0 {
+		t.Errorf("application errors of b = %d, want 0", application)
+	}
+	if got := a.Score.GetScore(); got != 0 {
+		t.Errorf("score of a = %d, want 0", got)
+	}
+	if got := b.Score.GetScore(); got != 1 {
+		t.Errorf("score of b = %d, want 1", got)
+	}
+
+	select {
+	case <-fails.FromContext(ctxA).Fail():
+	default:
+		t.Error("fail notification of a was not sent")
+	}
+	select {
+	case <-fails.FromContext(ctxB).Fail():
+		t.Error("fail notification of b was sent")
+	default:
+	}
+
+	metrics.FromContext(ctxA).Record(metrics.Request{Route: "GET /api/chair/search", StatusCode: 200})
+	if n := len(a.Metrics.RequestsSince(0)); n != 1 {
+		t.Errorf("requests of a = %d, want 1", n)
+	}
+	if n := len(b.Metrics.RequestsSince(0)); n != 0 {
+		t.Errorf("requests of b = %d, want 0", n)
+	}
+
+	conformance.FromContext(ctxB).Add(conformance.KindScenario, "chair_search", "", nil)
+	if n := len(a.Conformance.Report().Checks); n != 0 {
+		t.Errorf("conformance checks of a = %d, want 0", n)
+	}
+	if n := len(b.Conformance.Report().Checks); n != 1 {
+		t.Errorf("conformance checks of b = %d, want 1", n)
+	}
+
+	a.Random.SetSeed(1)
+	b.Random.SetSeed(2)
+	if random.FromContext(ctxA).Seed() != 1 || random.FromContext(ctxB).Seed() != 2 {
+		t.Error("seeds of the runs are shared")
+	}
+
+	if run.FromContext(ctxA) != a {
+		t.Error("FromContext did not return the run attached to the context")
+	}
+}
@@ -0,0 +1,134 @@
+package scenario
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/evidence"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+)
+
+// arrivalPollInterval 到着率が0の間、到着率が変わっていないか確認する間隔
+const arrivalPollInterval = 100 * time.Millisecond
+
+// arrivalRate 負荷走行の開始から elapsed 経過した時点の到着率 (セッション/秒)
+func arrivalRate(elapsed time.Duration) float64 {
+	switch parameter.ArrivalPattern {
+	case parameter.ArrivalPatternRamp:
+		if elapsed >= parameter.ArrivalRampDuration {
+			return parameter.ArrivalEndRate
+		}
+		progress := float64(elapsed) / float64(parameter.ArrivalRampDuration)
+		return parameter.ArrivalStartRate + (parameter.ArrivalEndRate-parameter.ArrivalStartRate)*progress
+	case parameter.ArrivalPatternStep:
+		var end time.Duration
+		for _, step := range parameter.ArrivalSteps {
+			end += step.Duration
+			if elapsed < end {
+				return step.Rate
+			}
+		}
+		// 最後の段の到着率を保つ
+		if len(parameter.ArrivalSteps) == 0 {
+			return 0
+		}
+		return parameter.ArrivalSteps[len(parameter.ArrivalSteps)-1].Rate
+	default:
+		return parameter.ArrivalRate
+	}
+}
+
+// pickSession ArrivalMix の重みに従ってセッションのシナリオを選ぶ
+func pickSession(rnd *rand.Rand) Scenario {
+	names := make([]string, 0, len(parameter.ArrivalMix))
+	total := 0
+	for _, name := range Names() {
+		if parameter.ArrivalMix[name] > 0 {
+			names = append(names, name)
+			total += parameter.ArrivalMix[name]
+		}
+	}
+
+	r := rnd.Intn(total)
+	for _, name := range names {
+		r -= parameter.ArrivalMix[name]
+		if r < 0 {
+			s, _ := Lookup(name)
+			return s
+		}
+	}
+	return nil
+}
+
+// runArrivalDriver 到着率に従って arrival.mix のシナリオのセッションを始める (open model)
+// サーバーの応答が遅くても到着は遅らせず、同時実行数の上限で待った時間もセッションのレイテンシに含める
+func runArrivalDriver(ctx context.Context, rnd *rand.Rand) {
+	slots := make(chan struct{}, parameter.MaxConcurrentSessions)
+	startedAt := time.Now()
+	next := startedAt
+	var index int64
+
+	for {
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+
+		rate := arrivalRate(next.Sub(startedAt))
+		if rate <= 0 {
+			next = next.Add(arrivalPollInterval)
+			continue
+		}
+		intended := next
+		next = next.Add(time.Duration(float64(time.Second) / rate))
+
+		s := pickSession(rnd)
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		if time.Since(intended) > parameter.MaxArrivalLag {
+			<-slots
+			metrics.FromContext(ctx).DropSession(s.Name())
+			continue
+		}
+
+		go func(s Scenario, intended time.Time, rnd *rand.Rand) {
+			defer func() { <-slots }()
+			runSession(ctx, s, intended, rnd)
+		}(s, intended, random.FromContext(ctx).New(WorkerSession, index))
+		index++
+	}
+}
+
+// runSession 新しいユーザーとして1回だけシナリオを実行する
+func runSession(ctx context.Context, s Scenario, intended time.Time, rnd *rand.Rand) {
+	defer WorkersFromContext(ctx).started(WorkerSession)()
+
+	ctx = evidence.WithSession(score.WithScenario(ctx, s.Name()))
+	c := s.NewClient(rnd)
+	started := time.Now()
+	err := s.RunOnce(ctx, c, rnd)
+	if ctx.Err() != nil {
+		// 負荷走行の終了で打ち切られたセッションは集計しない
+		return
+	}
+
+	metrics.FromContext(ctx).RecordSession(metrics.Session{
+		Scenario: s.Name(),
+		Intended: intended,
+		Started:  started,
+		Finished: time.Now(),
+		Failed:   err != nil,
+	})
+}
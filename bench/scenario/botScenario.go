@@ -2,6 +2,7 @@ package scenario
 
 import (
 	"context"
+	"math/rand"
 	"strconv"
 	"sync"
 
@@ -10,22 +11,26 @@ import (
 	"github.com/morikuni/failure"
 )
 
-func botScenario(ctx context.Context, c *client.Client) {
+func botScenario(ctx context.Context, c *client.Client, rnd *rand.Rand) {
 	wg := sync.WaitGroup{}
 
+	// rnd はgoroutine-safeではないため、クエリは先に作っておく
+	chairQuery, chairErr := createRandomChairSearchQuery(ctx, rnd)
+	estateQuery, estateErr := createRandomEstateSearchQuery(ctx, rnd)
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		q, err := createRandomChairSearchQuery()
+		q, err := chairQuery, chairErr
 		if err != nil {
-			fails.Add(err)
+			fails.Add(ctx, err)
 		}
 		q.Set("perPage", "10")
 		chairs, err := c.SearchChairsWithQuery(ctx, q)
 		if err != nil {
 			code, _ := failure.CodeOf(err)
 			if code != fails.ErrBot {
-				fails.Add(err)
+				fails.Add(ctx, err)
 			}
 			return
 		}
@@ -37,7 +42,7 @@ func botScenario(ctx context.Context, c *client.Client) {
 				_, err := c.GetChairDetailFromID(ctx, id)
 				code, _ := failure.CodeOf(err)
 				if code != fails.ErrBot {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
 			}(strconv.FormatInt(chair.ID, 10))
 		}
@@ -46,9 +51,9 @@ func botScenario(ctx context.Context, c *client.Client) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		q, err := createRandomEstateSearchQuery()
+		q, err := estateQuery, estateErr
 		if err != nil {
-			fails.Add(err)
+			fails.Add(ctx, err)
 		}
 		q.Set("perPage", "10")
 
@@ -56,7 +61,7 @@ func botScenario(ctx context.Context, c *client.Client) {
 		if err != nil {
 			code, _ := failure.CodeOf(err)
 			if code != fails.ErrBot {
-				fails.Add(err)
+				fails.Add(ctx, err)
 			}
 			return
 		}
@@ -68,7 +73,7 @@ func botScenario(ctx context.Context, c *client.Client) {
 				_, err := c.GetEstateDetailFromID(ctx, id)
 				code, _ := failure.CodeOf(err)
 				if code != fails.ErrBot {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
 			}(strconv.FormatInt(estate.ID, 10))
 		}
@@ -0,0 +1,126 @@
+package scenario
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
+)
+
+func init() {
+	// イス検索から物件ページに行き、資料請求をするまでのシナリオ
+	Register(&userScenario{name: WorkerChairSearch, run: chairSearchScenario})
+	// 物件検索をして、資料請求をするシナリオ
+	Register(&userScenario{name: WorkerEstateSearch, run: estateSearchScenario})
+	// なぞって検索をするシナリオ
+	Register(&userScenario{name: WorkerEstateNazotteSearch, run: estateNazotteSearchScenario})
+	// ボットによる検索シナリオ
+	Register(&botWorkerScenario{})
+	// イスの入稿シナリオ
+	Register(&draftScenario{
+		name:  WorkerChairDraftPost,
+		files: func() *asset.FileIterator { return asset.ChairDraftFiles },
+		post:  chairDraftPostScenario,
+	})
+	// 物件の入稿シナリオ
+	Register(&draftScenario{
+		name:  WorkerEstateDraftPost,
+		files: func() *asset.FileIterator { return asset.EstateDraftFiles },
+		post:  estateDraftPostScenario,
+	})
+}
+
+// userScenario 一般ユーザーとして検索シナリオを繰り返す
+type userScenario struct {
+	name string
+	run  func(ctx context.Context, c *client.Client, rnd *rand.Rand) error
+}
+
+func (s *userScenario) Name() string {
+	return s.name
+}
+
+func (s *userScenario) NewClient(rnd *rand.Rand) *client.Client {
+	return client.NewClient(false, rnd)
+}
+
+func (s *userScenario) RunOnce(ctx context.Context, c *client.Client, rnd *rand.Rand) error {
+	return s.run(ctx, c, rnd)
+}
+
+func (s *userScenario) Classify(err error) ErrorClass {
+	return classifyError(err)
+}
+
+func (s *userScenario) ThinkTime(rnd *rand.Rand, i int) (time.Duration, bool) {
+	return time.Duration(rnd.Intn(100)) * time.Millisecond, true
+}
+
+// botWorkerScenario 応答を待たずに一定間隔でボットの検索を始める
+type botWorkerScenario struct{}
+
+func (s *botWorkerScenario) Name() string {
+	return WorkerBot
+}
+
+func (s *botWorkerScenario) NewClient(rnd *rand.Rand) *client.Client {
+	return client.NewClient(true, rnd)
+}
+
+func (s *botWorkerScenario) RunOnce(ctx context.Context, c *client.Client, rnd *rand.Rand) error {
+	go botScenario(ctx, c, random.Fork(rnd))
+	return nil
+}
+
+func (s *botWorkerScenario) Classify(err error) ErrorClass {
+	return classifyError(err)
+}
+
+func (s *botWorkerScenario) ThinkTime(rnd *rand.Rand, i int) (time.Duration, bool) {
+	if i == 0 {
+		return 0, true
+	}
+	r := rnd.Intn(parameter.SleepSwingOnBotInterval) - parameter.SleepSwingOnBotInterval/2
+	return parameter.SleepTimeOnBotInterval + time.Duration(r)*time.Millisecond, true
+}
+
+// draftScenario 入稿用のファイルを1つ取り出して入稿する。Workerは1回で終了する
+type draftScenario struct {
+	name string
+	// files 入稿用のファイル。asset の初期化後に決まるため、実行時に取り出す
+	files func() *asset.FileIterator
+	post  func(ctx context.Context, c *client.Client, filePath string)
+}
+
+func (s *draftScenario) Name() string {
+	return s.name
+}
+
+func (s *draftScenario) NewClient(rnd *rand.Rand) *client.Client {
+	return client.NewClientForDraft(rnd)
+}
+
+func (s *draftScenario) RunOnce(ctx context.Context, c *client.Client, rnd *rand.Rand) error {
+	filePath, err := s.files().Next()
+	if err != nil {
+		return nil
+	}
+	s.post(ctx, c, filePath)
+	return nil
+}
+
+func (s *draftScenario) Classify(err error) ErrorClass {
+	return classifyError(err)
+}
+
+func (s *draftScenario) ThinkTime(rnd *rand.Rand, i int) (time.Duration, bool) {
+	if i > 0 {
+		return 0, false
+	}
+	r := rnd.Intn(parameter.SleepSwingBeforePostDraft) - parameter.SleepSwingBeforePostDraft/2
+	return parameter.SleepBeforePostDraft + time.Duration(r)*time.Millisecond, true
+}
@@ -42,38 +42,38 @@ func loadChairsFromJSON(ctx context.Context, filePath string) ([]asset.Chair, er
 func chairDraftPostScenario(ctx context.Context, c *client.Client, filePath string) {
 	chairs, err := loadChairsFromJSON(ctx, filePath)
 	if err != nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical))
 		return
 	}
 
 	id := strconv.FormatInt(chairs[0].ID, 10)
 	chair, err := c.GetChairDetailFromID(ctx, id)
 	if err != nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical))
 		return
 	}
 	if chair != nil {
-		fails.Add(failure.New(fails.ErrCritical, failure.Message("入稿前のイスが存在しています")))
+		fails.Add(ctx, failure.New(fails.ErrCritical, fails.Message("CHAIR_EXISTS_BEFORE_POST", "入稿前のイスが存在しています")))
 		return
 	}
 
 	err = c.PostChairs(ctx, chairs)
 	if err != nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical))
 		return
 	}
 
 	chair, err = c.GetChairDetailFromID(ctx, id)
 	if err != nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical))
 		return
 	}
 	if chair == nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical, failure.Message("入稿したイスのデータが不正です")))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical, fails.Message("POSTED_CHAIR_INVALID", "入稿したイスのデータが不正です")))
 		return
 	}
 	if err := checkChairEqualToAsset(chair); err != nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical, failure.Message("入稿したイスのデータが不正です")))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical, fails.Message("POSTED_CHAIR_INVALID", "入稿したイスのデータが不正です")))
 		return
 	}
 }
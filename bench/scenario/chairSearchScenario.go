@@ -14,24 +14,21 @@ import (
 	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
 )
 
-func chairSearchScenario(ctx context.Context, c *client.Client) error {
+func chairSearchScenario(ctx context.Context, c *client.Client, rnd *rand.Rand) error {
 	t := time.Now()
 	chairs, estates, err := c.AccessTopPage(ctx)
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 
 	if err := checkChairsOrderedByPrice(chairs.Chairs, t); err != nil {
-		err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/low_priced: レスポンスの内容が不正です"))
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		err = invalidContent(err, "CHAIR_LOW_PRICED", "GET /api/chair/low_priced")
+		return failed(ctx, err)
 	}
 
 	if err := checkEstatesOrderedByRent(estates.Estates); err != nil {
-		err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/low_priced: レスポンスの内容が不正です"))
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		err = invalidContent(err, "ESTATE_LOW_PRICED", "GET /api/estate/low_priced")
+		return failed(ctx, err)
 	}
 
 	if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
@@ -41,8 +38,7 @@ func chairSearchScenario(ctx context.Context, c *client.Client) error {
 	t = time.Now()
 	err = c.AccessChairSearchPage(ctx)
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 	if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
 		return failure.New(fails.ErrTimeout)
@@ -51,31 +47,35 @@ func chairSearchScenario(ctx context.Context, c *client.Client) error {
 	// Search Chairs with Query
 	var cr *client.ChairsResponse
 	for i := 0; i < parameter.NumOfSearchChairInScenario; i++ {
-		q, err := createRandomChairSearchQuery()
+		q, err := createRandomChairSearchQuery(ctx, rnd)
 		if err != nil {
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			return failed(ctx, err)
 		}
 
 		t = time.Now()
 		_cr, err := c.SearchChairsWithQuery(ctx, q)
 		if err != nil {
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			return failed(ctx, err)
 		}
 
 		if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
 			return failure.New(fails.ErrTimeout)
 		}
 
+		if rnd.Float64() < parameter.RateOfSearchOracleCheck {
+			if err := checkChairSearchResult(q, _cr, t); err != nil {
+				err = invalidContent(err, "CHAIR_SEARCH", "GET /api/chair/search")
+				return failed(ctx, err)
+			}
+		}
+
 		if len(_cr.Chairs) == 0 {
 			continue
 		}
 
 		if err := checkChairsOrderedByPopularity(_cr.Chairs, t); err != nil {
-			err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/search: レスポンスの内容が不正です"))
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			err = invalidContent(err, "CHAIR_SEARCH", "GET /api/chair/search")
+			return failed(ctx, err)
 		}
 
 		cr = _cr
@@ -88,28 +88,33 @@ func chairSearchScenario(ctx context.Context, c *client.Client) error {
 		}
 
 		for j := 0; j < parameter.NumOfCheckChairSearchPaging; j++ {
-			q.Set("page", strconv.Itoa(rand.Intn(numOfPages)))
+			q.Set("page", strconv.Itoa(rnd.Intn(numOfPages)))
 
 			t := time.Now()
 			_cr, err := c.SearchChairsWithQuery(ctx, q)
 			if err != nil {
-				fails.Add(err)
-				return failure.New(fails.ErrApplication)
+				return failed(ctx, err)
 			}
 
 			if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
 				return failure.New(fails.ErrTimeout)
 			}
 
+			if rnd.Float64() < parameter.RateOfSearchOracleCheck {
+				if err := checkChairSearchResult(q, _cr, t); err != nil {
+					err = invalidContent(err, "CHAIR_SEARCH", "GET /api/chair/search")
+					return failed(ctx, err)
+				}
+			}
+
 			if len(_cr.Chairs) == 0 {
-				fails.Add(err)
+				fails.Add(ctx, err)
 				return failure.New(fails.ErrApplication)
 			}
 
 			if err := checkChairsOrderedByPopularity(_cr.Chairs, t); err != nil {
-				err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/search: レスポンスの内容が不正です"))
-				fails.Add(err)
-				return failure.New(fails.ErrApplication)
+				err = invalidContent(err, "CHAIR_SEARCH", "GET /api/chair/search")
+				return failed(ctx, err)
 			}
 
 			cr = _cr
@@ -132,14 +137,13 @@ func chairSearchScenario(ctx context.Context, c *client.Client) error {
 	var chair *asset.Chair
 	var er *client.EstatesResponse
 	for i := 0; i < parameter.NumOfCheckChairDetailPage; i++ {
-		randomPosition := rand.Intn(len(cr.Chairs))
+		randomPosition := rnd.Intn(len(cr.Chairs))
 		targetID = cr.Chairs[randomPosition].ID
 		t = time.Now()
 		chair, er, err = c.AccessChairDetailPage(ctx, targetID)
 
 		if err != nil {
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			return failed(ctx, err)
 		}
 
 		if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
@@ -151,15 +155,13 @@ func chairSearchScenario(ctx context.Context, c *client.Client) error {
 		}
 
 		if err := checkChairEqualToAsset(chair); err != nil {
-			err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/:id: レスポンスの内容が不正です"))
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			err = invalidContent(err, "CHAIR_DETAIL", "GET /api/chair/:id")
+			return failed(ctx, err)
 		}
 
 		if err := checkRecommendedEstates(er.Estates, chair); err != nil {
-			err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/recommended_estate/:id: レスポンスの内容が不正です"))
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			err = invalidContent(err, "RECOMMENDED_ESTATE", "GET /api/recommended_estate/:id")
+			return failed(ctx, err)
 		}
 	}
 
@@ -170,22 +172,20 @@ func chairSearchScenario(ctx context.Context, c *client.Client) error {
 	// Buy Chair
 	err = c.BuyChair(ctx, strconv.FormatInt(targetID, 10))
 	if err != nil {
-		if _chair, err := asset.GetChairFromID(targetID); err != nil || _chair.GetStock() > 0 {
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+		if _chair, aErr := asset.GetChairFromID(targetID); aErr != nil || !_chair.MaybeSoldOut() {
+			return failed(ctx, err)
 		}
 	}
 
 	// Get detail of Estate
 	targetID = -1
 	for i := 0; i < parameter.NumOfCheckEstateDetailPage; i++ {
-		randomPosition := rand.Intn(len(er.Estates))
+		randomPosition := rnd.Intn(len(er.Estates))
 		targetID = er.Estates[randomPosition].ID
 		t = time.Now()
-		e, err := c.AccessEstateDetailPage(ctx, targetID)
+		e, cr, err := c.AccessEstateDetailPage(ctx, targetID)
 		if err != nil {
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			return failed(ctx, err)
 		}
 
 		if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
@@ -193,9 +193,13 @@ func chairSearchScenario(ctx context.Context, c *client.Client) error {
 		}
 
 		if err := checkEstateEqualToAsset(e); err != nil {
-			err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/:id: レスポンスの内容が不正です"))
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			err = invalidContent(err, "ESTATE_DETAIL", "GET /api/estate/:id")
+			return failed(ctx, err)
+		}
+
+		if err := checkRecommendedChairs(cr.Chairs, e, t); err != nil {
+			err = invalidContent(err, "RECOMMENDED_CHAIR", "GET /api/recommended_chair/:id")
+			return failed(ctx, err)
 		}
 	}
 
@@ -207,8 +211,7 @@ func chairSearchScenario(ctx context.Context, c *client.Client) error {
 	err = c.RequestEstateDocument(ctx, strconv.FormatInt(targetID, 10))
 
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 
 	return nil
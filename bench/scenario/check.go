@@ -1,13 +1,54 @@
 package scenario
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"sort"
 	"time"
 
+	"github.com/morikuni/failure"
+
 	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+)
+
+// 検証で見つかった違反の種類。エンドポイントのコードの接頭辞に続けてエラーのコードにする
+const (
+	violationContent    = "INVALID_CONTENT"
+	violationOrder      = "ORDER"
+	violationStock      = "STOCK"
+	violationMembership = "MEMBERSHIP"
+	violationCount      = "COUNT"
+	violationPage       = "PAGE"
 )
 
+// violation レスポンスの内容の検証で見つかった違反
+type violation struct {
+	kind string
+	msg  string
+}
+
+func (v *violation) Error() string {
+	return v.msg
+}
+
+func newViolation(kind, format string, args ...interface{}) error {
+	return &violation{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+// invalidContent 検証で見つかった違反を、エンドポイントと違反の種類ごとのコードを付けたエラーにする
+// endpoint はコードの接頭辞 (CHAIR_SEARCH など) で、route はメッセージに使う
+func invalidContent(err error, endpoint, route string) error {
+	kind := violationContent
+	var v *violation
+	if errors.As(err, &v) {
+		kind = v.kind
+	}
+	return failure.Translate(err, fails.ErrApplication, fails.Message(endpoint+"_"+kind, route+": レスポンスの内容が不正です"))
+}
+
 func checkEstateEqualToAsset(e *asset.Estate) error {
 	estate, err := asset.GetEstateFromID(e.ID)
 	if err != nil {
@@ -15,7 +56,8 @@ func checkEstateEqualToAsset(e *asset.Estate) error {
 	}
 
 	if !estate.Equal(e) {
-		return fmt.Errorf("物件の情報が不正です")
+		return newViolation(violationContent, "物件の情報が不正です")
+
 	}
 
 	return nil
@@ -31,7 +73,7 @@ func checkEstatesOrderedByRent(e []asset.Estate) error {
 		r := estate.Rent
 
 		if rent > r {
-			return fmt.Errorf("物件が賃料順に並んでいません")
+			return newViolation(violationOrder, "物件が賃料順に並んでいません")
 		}
 		rent = r
 	}
@@ -55,12 +97,45 @@ func checkRecommendedEstates(estates []asset.Estate, chair *asset.Chair) error {
 			shorterDoorLen, longerDoorLen = longerDoorLen, shorterDoorLen
 		}
 		if firstMin > shorterDoorLen || secondMin > longerDoorLen {
-			return fmt.Errorf("イスがドアを通過できない物件がおすすめされています")
+			return newViolation(violationMembership, "イスがドアを通過できない物件がおすすめされています")
 		}
 
 		p := estate.GetPopularity()
 		if i > 0 && popularity < p {
-			return fmt.Errorf("物件がpopularity順に並んでいません")
+			return newViolation(violationOrder, "物件がpopularity順に並んでいません")
+		}
+		popularity = p
+	}
+	return nil
+}
+
+func checkRecommendedChairs(chairs []asset.Chair, estate *asset.Estate, t time.Time) error {
+	shorterDoorLen, longerDoorLen := estate.DoorWidth, estate.DoorHeight
+	if shorterDoorLen > longerDoorLen {
+		shorterDoorLen, longerDoorLen = longerDoorLen, shorterDoorLen
+	}
+
+	var popularity int64 = -1
+	for i, chair := range chairs {
+		_chair, err := asset.GetChairFromID(chair.ID)
+		if err != nil {
+			return err
+		}
+
+		err = checkChairInStock(_chair, t)
+		if err != nil {
+			return err
+		}
+
+		lengths := [3]int64{_chair.Width, _chair.Height, _chair.Depth}
+		sort.Slice(lengths[:], func(i, j int) bool { return lengths[i] < lengths[j] })
+		if lengths[0] > shorterDoorLen || lengths[1] > longerDoorLen {
+			return newViolation(violationMembership, "ドアを通過できないイスがおすすめされています")
+		}
+
+		p := _chair.GetPopularity()
+		if i > 0 && popularity < p {
+			return newViolation(violationOrder, "イスがpopularity順に並んでいません")
 		}
 		popularity = p
 	}
@@ -76,7 +151,7 @@ func checkEstatesOrderedByPopularity(e []asset.Estate) error {
 		}
 		p := e.GetPopularity()
 		if i > 0 && popularity < p {
-			return fmt.Errorf("物件がpopularity順に並んでいません")
+			return newViolation(violationOrder, "物件がpopularity順に並んでいません")
 		}
 		popularity = p
 	}
@@ -90,7 +165,8 @@ func checkChairEqualToAsset(c *asset.Chair) error {
 	}
 
 	if !chair.Equal(c) {
-		return fmt.Errorf("イスの情報が不正です")
+		return newViolation(violationContent, "イスの情報が不正です")
+
 	}
 
 	return nil
@@ -107,7 +183,7 @@ func checkChairInStock(c *asset.Chair, t time.Time) error {
 	}
 
 	if t.After(*soldOutTime) {
-		return fmt.Errorf("イスの在庫がありません")
+		return newViolation(violationStock, "イスの在庫がありません")
 	}
 
 	return nil
@@ -133,7 +209,7 @@ func checkChairsOrderedByPrice(c []asset.Chair, t time.Time) error {
 		p := _chair.Price
 
 		if price > p {
-			return fmt.Errorf("イスが価格順に並んでいません")
+			return newViolation(violationOrder, "イスが価格順に並んでいません")
 		}
 		price = p
 	}
@@ -157,7 +233,7 @@ func checkChairsOrderedByPopularity(c []asset.Chair, t time.Time) error {
 		p := _chair.GetPopularity()
 
 		if i > 0 && popularity < p {
-			return fmt.Errorf("イスがpopularity順に並んでいません")
+			return newViolation(violationOrder, "イスがpopularity順に並んでいません")
 		}
 		popularity = p
 	}
@@ -165,23 +241,92 @@ func checkChairsOrderedByPopularity(c []asset.Chair, t time.Time) error {
 	return nil
 }
 
-func checkEstatesInBoundingBox(estates []asset.Estate, boundingBox [2]point) error {
-	for _, estate := range estates {
+// nazotteBoundaryEpsilon 多角形の辺からこの距離(度)以内にある物件は、含まれていても含まれていなくてもよい
+// アプリケーションは物件と多角形の座標を小数点以下6桁に丸めて判定するため、その誤差を許容する
+const nazotteBoundaryEpsilon = 2e-6
+
+// checkEstatesInPolygon なぞって検索の結果を、ベンチマーカーが持つ物件から計算した結果と比較する
+// 多角形の外の物件が含まれていないこと、popularity順で上位の物件が欠けていないことを確認する
+func checkEstatesInPolygon(estates []asset.Estate, polygon []point, t time.Time) error {
+	returned := make(map[int64]bool, len(estates))
+	for i, estate := range estates {
 		e, err := asset.GetEstateFromID(estate.ID)
 		if err != nil || !e.Equal(&estate) {
-			return fmt.Errorf("物件の情報が不正です")
+			return newViolation(violationContent, "物件の情報が不正です")
+
+		}
+
+		inside, onBoundary := containsPoint(polygon, point{Latitude: e.Latitude, Longitude: e.Longitude})
+		if !inside && !onBoundary {
+			return newViolation(violationMembership, "範囲外の物件があります: ID %v, Coordinate(%v, %v)", e.ID, e.Latitude, e.Longitude)
 		}
 
-		if !(boundingBox[0].Latitude <= e.Latitude && boundingBox[1].Latitude >= e.Latitude) {
-			return fmt.Errorf("バウンディングボックス外の物件があります: BoundingBox((%v, %v), (%v, %v)), Coordinate(%v, %v)",
-				boundingBox[0].Latitude, boundingBox[0].Longitude, boundingBox[1].Latitude, boundingBox[1].Latitude, e.Latitude, e.Longitude)
+		if i > 0 && !estateRankedBefore(estates[i-1].ID, e) {
+			return newViolation(violationOrder, "物件がpopularity順に並んでいません")
 		}
+		returned[e.ID] = true
+	}
+
+	var last *asset.Estate
+	if len(estates) >= parameter.MaxLengthOfNazotteResponse {
+		last, _ = asset.GetEstateFromID(estates[len(estates)-1].ID)
+	}
 
-		if !(boundingBox[0].Longitude <= e.Longitude && boundingBox[1].Longitude >= e.Longitude) {
-			return fmt.Errorf("バウンディングボックス外の物件があります: BoundingBox((%v, %v), (%v, %v)), Coordinate(%v, %v)",
-				boundingBox[0].Latitude, boundingBox[0].Longitude, boundingBox[1].Latitude, boundingBox[1].Latitude, e.Latitude, e.Longitude)
+	for _, e := range asset.GetEstates() {
+		if returned[e.ID] || !e.StoredBefore(t) {
+			continue
 		}
+		inside, onBoundary := containsPoint(polygon, point{Latitude: e.Latitude, Longitude: e.Longitude})
+		if !inside || onBoundary {
+			continue
+		}
+		// 件数の上限で切られた物件は欠けていてよい
+		if last != nil && !estateRankedBefore(e.ID, last) {
+			continue
+		}
+		return newViolation(violationMembership, "範囲内の物件が含まれていません: ID %v", e.ID)
 	}
 
 	return nil
 }
+
+// estateRankedBefore なぞって検索の並び順 (popularity の降順, id の昇順) で id の物件が e より前にあるか
+func estateRankedBefore(id int64, e *asset.Estate) bool {
+	other, err := asset.GetEstateFromID(id)
+	if err != nil {
+		return false
+	}
+	if other.GetPopularity() != e.GetPopularity() {
+		return other.GetPopularity() > e.GetPopularity()
+	}
+	return other.ID < e.ID
+}
+
+// containsPoint p が多角形の内側にあるかを ray casting で判定する
+// 辺から nazotteBoundaryEpsilon 以内にある場合は onBoundary を返す
+func containsPoint(polygon []point, p point) (inside bool, onBoundary bool) {
+	n := len(polygon)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if distanceToSegment(p, a, b) <= nazotteBoundaryEpsilon {
+			onBoundary = true
+		}
+		if (a.Longitude > p.Longitude) != (b.Longitude > p.Longitude) {
+			lat := (b.Latitude-a.Latitude)*(p.Longitude-a.Longitude)/(b.Longitude-a.Longitude) + a.Latitude
+			if p.Latitude < lat {
+				inside = !inside
+			}
+		}
+	}
+	return inside, onBoundary
+}
+
+func distanceToSegment(p, a, b point) float64 {
+	dx, dy := b.Latitude-a.Latitude, b.Longitude-a.Longitude
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.Latitude-a.Latitude, p.Longitude-a.Longitude)
+	}
+	r := ((p.Latitude-a.Latitude)*dx + (p.Longitude-a.Longitude)*dy) / (dx*dx + dy*dy)
+	r = math.Max(0, math.Min(1, r))
+	return math.Hypot(p.Latitude-(a.Latitude+r*dx), p.Longitude-(a.Longitude+r*dy))
+}
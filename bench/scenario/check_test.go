@@ -0,0 +1,247 @@
+package scenario
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+)
+
+func Test_invalidContent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "order", err: checkEstatesOrderedByRent([]asset.Estate{{ID: 1, Rent: 200}, {ID: 2, Rent: 100}}), want: "ESTATE_LOW_PRICED_ORDER"},
+		{name: "stock", err: newViolation(violationStock, "イスの在庫がありません"), want: "ESTATE_LOW_PRICED_STOCK"},
+		{name: "membership", err: newViolation(violationMembership, "範囲内の物件が含まれていません: ID %v", 1), want: "ESTATE_LOW_PRICED_MEMBERSHIP"},
+		{name: "other error", err: errors.New("not found"), want: "ESTATE_LOW_PRICED_INVALID_CONTENT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err == nil {
+				t.Fatal("the check returned no error")
+			}
+			e := fails.New()
+			e.Add(invalidContent(tt.err, "ESTATE_LOW_PRICED", "GET /api/estate/low_priced"))
+			if got := e.Failures()[0].Code; got != tt.want {
+				t.Errorf("code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// loadEstates estates だけを asset に読み込み、入稿が確定した後の時刻を返す
+func loadEstates(t *testing.T, estates []asset.JSONEstate) time.Time {
+	dir, err := ioutil.TempDir("", "estates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for _, d := range []string{"result/draft_data/chair", "result/draft_data/estate"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := make([]byte, 0)
+	for _, e := range estates {
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(append(lines, b...), '\n')
+	}
+	files := map[string][]byte{
+		"result/chair_json.txt":  {},
+		"result/estate_json.txt": lines,
+		"chair_condition.json":   []byte("{}"),
+		"estate_condition.json":  []byte("{}"),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := fails.New()
+	asset.Initialize(fails.WithErrors(context.Background(), e), dir, dir)
+	if msgs := e.GetMsgs(); len(msgs) > 0 {
+		t.Fatalf("asset.Initialize: %v", msgs)
+	}
+	return time.Now().Add(time.Second)
+}
+
+// returnedEstates ids の物件を、レスポンスで返ってきた順に並べる
+func returnedEstates(ids []int64) []asset.Estate {
+	estates := make([]asset.Estate, 0, len(ids))
+	for _, id := range ids {
+		e, err := asset.GetEstateFromID(id)
+		if err != nil {
+			// ベンチマーカーが持っていない物件が返ってきた場合
+			e = &asset.Estate{ID: id}
+		}
+		estates = append(estates, *e)
+	}
+	return estates
+}
+
+// nazotteCode なぞって検索の検証結果に付くエラーコード。エラーがなければ空
+func nazotteCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	e := fails.New()
+	e.Add(invalidContent(err, "ESTATE_NAZOTTE", "POST /api/estate/nazotte"))
+	return e.Failures()[0].Code
+}
+
+// concavePolygon 緯度 0 の側が経度 3 から 7 まで緯度 7 の深さで凹んだ U 字形の多角形
+var concavePolygon = []point{
+	{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 7}, {7, 7}, {7, 3}, {0, 3},
+}
+
+func Test_distanceToSegment(t *testing.T) {
+	tests := []struct {
+		name string
+		p    point
+		a, b point
+		want float64
+	}{
+		{name: "projection on the segment", p: point{1, 2}, a: point{0, 0}, b: point{4, 0}, want: 2},
+		{name: "on the segment", p: point{2, 0}, a: point{0, 0}, b: point{4, 0}, want: 0},
+		{name: "beyond a", p: point{-3, 4}, a: point{0, 0}, b: point{4, 0}, want: 5},
+		{name: "beyond b", p: point{7, -4}, a: point{0, 0}, b: point{4, 0}, want: 5},
+		{name: "diagonal", p: point{0, 2}, a: point{0, 0}, b: point{2, 2}, want: math.Sqrt2},
+		{name: "degenerate segment", p: point{3, 4}, a: point{0, 0}, b: point{0, 0}, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := distanceToSegment(tt.p, tt.a, tt.b); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("distanceToSegment() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_containsPoint(t *testing.T) {
+	tests := []struct {
+		name           string
+		p              point
+		wantInside     bool
+		wantOnBoundary bool
+	}{
+		{name: "left arm", p: point{5, 1.5}, wantInside: true},
+		{name: "right arm", p: point{5, 8.5}, wantInside: true},
+		{name: "bottom of the U", p: point{8.5, 5}, wantInside: true},
+		{name: "in the notch", p: point{3, 5}},
+		{name: "outside the bounding box", p: point{20, 20}},
+		{name: "inside within the margin", p: point{5, 3 - nazotteBoundaryEpsilon/2}, wantInside: true, wantOnBoundary: true},
+		{name: "outside within the margin", p: point{5, 3 + nazotteBoundaryEpsilon/2}, wantOnBoundary: true},
+		{name: "inside past the margin", p: point{5, 3 - nazotteBoundaryEpsilon*2}, wantInside: true},
+		{name: "outside past the margin", p: point{5, 3 + nazotteBoundaryEpsilon*2}},
+		{name: "notch bottom within the margin", p: point{7 - nazotteBoundaryEpsilon/2, 5}, wantOnBoundary: true},
+		{name: "notch bottom past the margin", p: point{7 + nazotteBoundaryEpsilon*2, 5}, wantInside: true},
+		{name: "inner corner within the margin", p: point{7 - nazotteBoundaryEpsilon/2, 3 + nazotteBoundaryEpsilon/2}, wantOnBoundary: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inside, onBoundary := containsPoint(concavePolygon, tt.p)
+			if inside != tt.wantInside || onBoundary != tt.wantOnBoundary {
+				t.Errorf("containsPoint() = %v, %v, want %v, %v", inside, onBoundary, tt.wantInside, tt.wantOnBoundary)
+			}
+		})
+	}
+}
+
+func Test_checkEstatesInPolygon(t *testing.T) {
+	// popularity の降順に並べたときに ID の順になる
+	now := loadEstates(t, []asset.JSONEstate{
+		{ID: 1, Latitude: 5, Longitude: 1.5, Popularity: 100},
+		{ID: 2, Latitude: 5, Longitude: 8.5, Popularity: 90},
+		{ID: 3, Latitude: 8.5, Longitude: 5, Popularity: 80},
+		{ID: 4, Latitude: 3, Longitude: 5, Popularity: 70},
+		{ID: 5, Latitude: 20, Longitude: 20, Popularity: 60},
+		{ID: 6, Latitude: 5, Longitude: 3 - nazotteBoundaryEpsilon/2, Popularity: 50},
+		{ID: 7, Latitude: 5, Longitude: 3 + nazotteBoundaryEpsilon/2, Popularity: 40},
+		{ID: 8, Latitude: 5, Longitude: 3 - nazotteBoundaryEpsilon*2, Popularity: 30},
+		{ID: 9, Latitude: 5, Longitude: 3 + nazotteBoundaryEpsilon*2, Popularity: 20},
+	})
+
+	tests := []struct {
+		name string
+		ids  []int64
+		want string
+	}{
+		{name: "inside only", ids: []int64{1, 2, 3, 8}},
+		{name: "with estates within the margin", ids: []int64{1, 2, 3, 6, 7, 8}},
+		{name: "missing an estate inside past the margin", ids: []int64{1, 2, 3}, want: "ESTATE_NAZOTTE_MEMBERSHIP"},
+		{name: "missing the bottom of the U", ids: []int64{1, 2, 8}, want: "ESTATE_NAZOTTE_MEMBERSHIP"},
+		{name: "estate in the notch", ids: []int64{1, 2, 3, 4, 8}, want: "ESTATE_NAZOTTE_MEMBERSHIP"},
+		{name: "estate outside past the margin", ids: []int64{1, 2, 3, 8, 9}, want: "ESTATE_NAZOTTE_MEMBERSHIP"},
+		{name: "estate far outside", ids: []int64{1, 2, 3, 5, 8}, want: "ESTATE_NAZOTTE_MEMBERSHIP"},
+		{name: "not ordered by popularity", ids: []int64{2, 1, 3, 8}, want: "ESTATE_NAZOTTE_ORDER"},
+		{name: "unknown estate", ids: []int64{1, 2, 3, 8, 100}, want: "ESTATE_NAZOTTE_INVALID_CONTENT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkEstatesInPolygon(returnedEstates(tt.ids), concavePolygon, now)
+			if got := nazotteCode(err); got != tt.want {
+				t.Errorf("code = %q, want %q (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+// 件数の上限で切られたときは、popularity が同じなら ID の小さい物件から返っていなければならない
+func Test_checkEstatesInPolygonCutOff(t *testing.T) {
+	estates := make([]asset.JSONEstate, 0)
+	for id := int64(1); id <= 60; id++ {
+		// 46 から 55 までは popularity が同じで、上限の 50 件目をまたぐ
+		popularity := 1000 - id
+		if id >= 46 && id <= 55 {
+			popularity = 100
+		} else if id > 55 {
+			popularity = 50
+		}
+		estates = append(estates, asset.JSONEstate{ID: id, Latitude: 5, Longitude: 1 + float64(id)/100, Popularity: popularity})
+	}
+	now := loadEstates(t, estates)
+
+	ids := func(from, to int64, more ...int64) []int64 {
+		s := make([]int64, 0)
+		for id := from; id <= to; id++ {
+			s = append(s, id)
+		}
+		return append(s, more...)
+	}
+	tests := []struct {
+		name string
+		ids  []int64
+		want string
+	}{
+		{name: "cut off in the tie", ids: ids(1, parameter.MaxLengthOfNazotteResponse)},
+		{name: "skipped a smaller id in the tie", ids: ids(1, 49, 51), want: "ESTATE_NAZOTTE_MEMBERSHIP"},
+		{name: "skipped the whole tie", ids: ids(1, 45, 56, 57, 58, 59, 60), want: "ESTATE_NAZOTTE_MEMBERSHIP"},
+		{name: "tie not ordered by id", ids: ids(1, 48, 50, 49), want: "ESTATE_NAZOTTE_ORDER"},
+		{name: "under the limit", ids: ids(1, 49), want: "ESTATE_NAZOTTE_MEMBERSHIP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkEstatesInPolygon(returnedEstates(tt.ids), concavePolygon, now)
+			if got := nazotteCode(err); got != tt.want {
+				t.Errorf("code = %q, want %q (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
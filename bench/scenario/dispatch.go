@@ -0,0 +1,37 @@
+package scenario
+
+import (
+	"context"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+)
+
+// Dispatcher 負荷レベルごとに追加するWorkerを起動する先
+type Dispatcher interface {
+	// Dispatch incWorkers で指定された数だけWorkerを起動し、ctx が終了したら止める
+	Dispatch(ctx context.Context, incWorkers parameter.IncWorkers)
+}
+
+// Local このプロセスでWorkerを起動する Dispatcher。分散実行の agent は割り当てられたWorkerをこれで起動する
+var Local Dispatcher = localDispatcher{}
+
+type localDispatcher struct{}
+
+func (localDispatcher) Dispatch(ctx context.Context, incWorkers parameter.IncWorkers) {
+	startWorkers(ctx, incWorkers)
+}
+
+type dispatcherKey struct{}
+
+// WithDispatcher 負荷走行で d にWorkerを起動させる context を返す。分散実行の coordinator が使う
+func WithDispatcher(ctx context.Context, d Dispatcher) context.Context {
+	return context.WithValue(ctx, dispatcherKey{}, d)
+}
+
+// dispatcherOf ctx が持つ Dispatcher を返す。持っていなければ Local を返す
+func dispatcherOf(ctx context.Context) Dispatcher {
+	if d, ok := ctx.Value(dispatcherKey{}).(Dispatcher); ok {
+		return d
+	}
+	return Local
+}
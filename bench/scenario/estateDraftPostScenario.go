@@ -42,28 +42,28 @@ func loadEstatesFromJSON(ctx context.Context, filePath string) ([]asset.Estate,
 func estateDraftPostScenario(ctx context.Context, c *client.Client, filePath string) {
 	estates, err := loadEstatesFromJSON(ctx, filePath)
 	if err != nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical))
 	}
 
 	id := strconv.FormatInt(estates[0].ID, 10)
 	estate, _ := c.GetEstateDetailFromID(ctx, id)
 	if estate != nil {
-		fails.Add(failure.New(fails.ErrCritical, failure.Message("入稿前の物件が存在しています")))
+		fails.Add(ctx, failure.New(fails.ErrCritical, fails.Message("ESTATE_EXISTS_BEFORE_POST", "入稿前の物件が存在しています")))
 		return
 	}
 
 	err = c.PostEstates(ctx, estates)
 	if err != nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical))
 		return
 	}
 
 	estate, err = c.GetEstateDetailFromID(ctx, id)
 	if err != nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical))
 		return
 	}
 	if err := checkEstateEqualToAsset(estate); err != nil {
-		fails.Add(failure.Translate(err, fails.ErrCritical, failure.Message("入稿した物件のデータが不正です")))
+		fails.Add(ctx, failure.Translate(err, fails.ErrCritical, fails.Message("POSTED_ESTATE_INVALID", "入稿した物件のデータが不正です")))
 	}
 }
@@ -57,24 +57,24 @@ const (
 	numOfMinPoints     = 10
 )
 
-func createRandomConvexhull() []point {
-	famousPlace := famousPlaces[rand.Intn(len(famousPlaces))]
+func createRandomConvexhull(rnd *rand.Rand) []point {
+	famousPlace := famousPlaces[rnd.Intn(len(famousPlaces))]
 
-	width := rand.Float64()*(rangeMaxWidth-rangeMinWidth) + rangeMinWidth
-	height := rand.Float64()*(rangeMaxHeight-rangeMinHeight) + rangeMinHeight
+	width := rnd.Float64()*(rangeMaxWidth-rangeMinWidth) + rangeMinWidth
+	height := rnd.Float64()*(rangeMaxHeight-rangeMinHeight) + rangeMinHeight
 	center := point{
-		Latitude:  famousPlace.Latitude + (rand.Float64()-0.5)*rangeDiffLatitude,
-		Longitude: famousPlace.Longitude + (rand.Float64()-0.5)*rangeDiffLongitude,
+		Latitude:  famousPlace.Latitude + (rnd.Float64()-0.5)*rangeDiffLatitude,
+		Longitude: famousPlace.Longitude + (rnd.Float64()-0.5)*rangeDiffLongitude,
 	}
 
-	pointCounts := rand.Intn(numOfMaxPoints-numOfMinPoints) + numOfMinPoints
+	pointCounts := rnd.Intn(numOfMaxPoints-numOfMinPoints) + numOfMinPoints
 
 	points := []point{}
 
 	for i := 0; i < pointCounts; i++ {
 		points = append(points, point{
-			Latitude:  center.Latitude + (rand.Float64()-0.5)*width,
-			Longitude: center.Longitude + (rand.Float64()-0.5)*height,
+			Latitude:  center.Latitude + (rnd.Float64()-0.5)*width,
+			Longitude: center.Longitude + (rnd.Float64()-0.5)*height,
 		})
 	}
 
@@ -138,56 +138,21 @@ func contains(s []int64, e int64) bool {
 	return false
 }
 
-func getBoundingBox(points []point) [2]point {
-	boundingBox := [2]point{
-		{
-			// TopLeftCorner
-			Latitude: points[0].Latitude, Longitude: points[0].Longitude,
-		},
-		{
-			// BottomRightCorner
-			Latitude: points[0].Latitude, Longitude: points[0].Longitude,
-		},
-	}
-
-	po := points[1:]
-
-	for _, p := range po {
-		if boundingBox[0].Latitude > p.Latitude {
-			boundingBox[0].Latitude = p.Latitude
-		}
-		if boundingBox[0].Longitude > p.Longitude {
-			boundingBox[0].Longitude = p.Longitude
-		}
-
-		if boundingBox[1].Latitude < p.Latitude {
-			boundingBox[1].Latitude = p.Latitude
-		}
-		if boundingBox[1].Longitude < p.Longitude {
-			boundingBox[1].Longitude = p.Longitude
-		}
-	}
-	return boundingBox
-}
-
-func estateNazotteSearchScenario(ctx context.Context, c *client.Client) error {
+func estateNazotteSearchScenario(ctx context.Context, c *client.Client, rnd *rand.Rand) error {
 	t := time.Now()
 	chairs, estates, err := c.AccessTopPage(ctx)
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 
 	if err := checkChairsOrderedByPrice(chairs.Chairs, t); err != nil {
-		err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/low_priced: レスポンスの内容が不正です"))
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		err = invalidContent(err, "CHAIR_LOW_PRICED", "GET /api/chair/low_priced")
+		return failed(ctx, err)
 	}
 
 	if err := checkEstatesOrderedByRent(estates.Estates); err != nil {
-		err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/low_priced: レスポンスの内容が不正です"))
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		err = invalidContent(err, "ESTATE_LOW_PRICED", "GET /api/estate/low_priced")
+		return failed(ctx, err)
 	}
 
 	if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
@@ -197,8 +162,7 @@ func estateNazotteSearchScenario(ctx context.Context, c *client.Client) error {
 	t = time.Now()
 	err = c.AccessEstateNazottePage(ctx)
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 	if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
 		return failure.New(fails.ErrTimeout)
@@ -206,15 +170,13 @@ func estateNazotteSearchScenario(ctx context.Context, c *client.Client) error {
 
 	// Nazotte Search
 	// create nazotte data randomly
-	convexHulled := createRandomConvexhull()
+	convexHulled := createRandomConvexhull(rnd)
 	polygon := ToCoordinates(convexHulled)
-	boundingBox := getBoundingBox(convexHulled)
 
 	t = time.Now()
 	er, err := c.SearchEstatesNazotte(ctx, polygon)
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 
 	if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
@@ -222,28 +184,25 @@ func estateNazotteSearchScenario(ctx context.Context, c *client.Client) error {
 	}
 
 	if len(er.Estates) > parameter.MaxLengthOfNazotteResponse {
-		err = failure.New(fails.ErrApplication, failure.Message("POST /api/estate/nazotte: レスポンスの内容が不正です"))
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		err = failure.New(fails.ErrApplication, fails.Message("ESTATE_NAZOTTE_COUNT", "POST /api/estate/nazotte: レスポンスの内容が不正です"))
+		return failed(ctx, err)
 	}
 
-	if err := checkEstatesInBoundingBox(er.Estates, boundingBox); err != nil {
-		err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/nazotte: レスポンスの内容が不正です"))
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+	if err := checkEstatesInPolygon(er.Estates, convexHulled, t); err != nil {
+		err = invalidContent(err, "ESTATE_NAZOTTE", "GET /api/estate/nazotte")
+		return failed(ctx, err)
 	}
 
 	if len(er.Estates) == 0 {
 		return nil
 	}
 
-	randomPosition := rand.Intn(len(er.Estates))
+	randomPosition := rnd.Intn(len(er.Estates))
 	targetID := er.Estates[randomPosition].ID
 	t = time.Now()
-	e, err := c.AccessEstateDetailPage(ctx, targetID)
+	e, cr, err := c.AccessEstateDetailPage(ctx, targetID)
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 
 	if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
@@ -252,15 +211,18 @@ func estateNazotteSearchScenario(ctx context.Context, c *client.Client) error {
 
 	estate, err := asset.GetEstateFromID(e.ID)
 	if err != nil || !e.Equal(estate) {
-		err = failure.New(fails.ErrApplication, failure.Message("GET /api/estate/:id: レスポンスの内容が不正です"))
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		err = failure.New(fails.ErrApplication, fails.Message("ESTATE_DETAIL_INVALID_CONTENT", "GET /api/estate/:id: レスポンスの内容が不正です"))
+		return failed(ctx, err)
+	}
+
+	if err := checkRecommendedChairs(cr.Chairs, e, t); err != nil {
+		err = invalidContent(err, "RECOMMENDED_CHAIR", "GET /api/recommended_chair/:id")
+		return failed(ctx, err)
 	}
 
 	err = c.RequestEstateDocument(ctx, strconv.FormatInt(targetID, 10))
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 
 	return nil
@@ -14,25 +14,22 @@ import (
 	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
 )
 
-func estateSearchScenario(ctx context.Context, c *client.Client) error {
+func estateSearchScenario(ctx context.Context, c *client.Client, rnd *rand.Rand) error {
 
 	t := time.Now()
 	chairs, estates, err := c.AccessTopPage(ctx)
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 
 	if err := checkChairsOrderedByPrice(chairs.Chairs, t); err != nil {
-		err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/low_priced: レスポンスの内容が不正です"))
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		err = invalidContent(err, "CHAIR_LOW_PRICED", "GET /api/chair/low_priced")
+		return failed(ctx, err)
 	}
 
 	if err := checkEstatesOrderedByRent(estates.Estates); err != nil {
-		err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/low_priced: レスポンスの内容が不正です"))
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		err = invalidContent(err, "ESTATE_LOW_PRICED", "GET /api/estate/low_priced")
+		return failed(ctx, err)
 	}
 
 	if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
@@ -42,8 +39,7 @@ func estateSearchScenario(ctx context.Context, c *client.Client) error {
 	t = time.Now()
 	err = c.AccessEstateSearchPage(ctx)
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 	if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
 		return failure.New(fails.ErrTimeout)
@@ -52,31 +48,35 @@ func estateSearchScenario(ctx context.Context, c *client.Client) error {
 	// Search Estates with Query
 	var er *client.EstatesResponse
 	for i := 0; i < parameter.NumOfSearchEstateInScenario; i++ {
-		q, err := createRandomEstateSearchQuery()
+		q, err := createRandomEstateSearchQuery(ctx, rnd)
 		if err != nil {
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			return failed(ctx, err)
 		}
 
 		t = time.Now()
 		_er, err := c.SearchEstatesWithQuery(ctx, q)
 		if err != nil {
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			return failed(ctx, err)
 		}
 
 		if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
 			return failure.New(fails.ErrTimeout)
 		}
 
+		if rnd.Float64() < parameter.RateOfSearchOracleCheck {
+			if err := checkEstateSearchResult(q, _er, t); err != nil {
+				err = invalidContent(err, "ESTATE_SEARCH", "GET /api/estate/search")
+				return failed(ctx, err)
+			}
+		}
+
 		if len(_er.Estates) == 0 {
 			continue
 		}
 
 		if err := checkEstatesOrderedByPopularity(_er.Estates); err != nil {
-			err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/search: レスポンスの内容が不正です"))
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			err = invalidContent(err, "ESTATE_SEARCH", "GET /api/estate/search")
+			return failed(ctx, err)
 		}
 
 		er = _er
@@ -90,28 +90,33 @@ func estateSearchScenario(ctx context.Context, c *client.Client) error {
 		}
 
 		for j := 0; j < parameter.NumOfCheckEstateSearchPaging; j++ {
-			q.Set("page", strconv.Itoa(rand.Intn(numOfPages)))
+			q.Set("page", strconv.Itoa(rnd.Intn(numOfPages)))
 
 			t := time.Now()
 			_er, err := c.SearchEstatesWithQuery(ctx, q)
 			if err != nil {
-				fails.Add(err)
-				return failure.New(fails.ErrApplication)
+				return failed(ctx, err)
 			}
 
 			if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
 				return failure.New(fails.ErrTimeout)
 			}
 
+			if rnd.Float64() < parameter.RateOfSearchOracleCheck {
+				if err := checkEstateSearchResult(q, _er, t); err != nil {
+					err = invalidContent(err, "ESTATE_SEARCH", "GET /api/estate/search")
+					return failed(ctx, err)
+				}
+			}
+
 			if len(_er.Estates) == 0 {
-				fails.Add(err)
+				fails.Add(ctx, err)
 				return failure.New(fails.ErrApplication)
 			}
 
 			if err := checkEstatesOrderedByPopularity(er.Estates); err != nil {
-				err = failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/search: レスポンスの内容が不正です"))
-				fails.Add(err)
-				return failure.New(fails.ErrApplication)
+				err = invalidContent(err, "ESTATE_SEARCH", "GET /api/estate/search")
+				return failed(ctx, err)
 			}
 
 			er = _er
@@ -132,13 +137,12 @@ func estateSearchScenario(ctx context.Context, c *client.Client) error {
 	// Get Details with ID from previously searched list
 	var targetID int64 = -1
 	for i := 0; i < parameter.NumOfCheckEstateDetailPage; i++ {
-		randomPosition := rand.Intn(len(er.Estates))
+		randomPosition := rnd.Intn(len(er.Estates))
 		targetID = er.Estates[randomPosition].ID
 		t = time.Now()
-		e, err := c.AccessEstateDetailPage(ctx, targetID)
+		e, cr, err := c.AccessEstateDetailPage(ctx, targetID)
 		if err != nil {
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			return failed(ctx, err)
 		}
 
 		if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
@@ -147,9 +151,13 @@ func estateSearchScenario(ctx context.Context, c *client.Client) error {
 
 		estate, err := asset.GetEstateFromID(e.ID)
 		if err != nil || !e.Equal(estate) {
-			err = failure.New(fails.ErrApplication, failure.Message("GET /api/estate/:id: レスポンスの内容が不正です"))
-			fails.Add(err)
-			return failure.New(fails.ErrApplication)
+			err = failure.New(fails.ErrApplication, fails.Message("ESTATE_DETAIL_INVALID_CONTENT", "GET /api/estate/:id: レスポンスの内容が不正です"))
+			return failed(ctx, err)
+		}
+
+		if err := checkRecommendedChairs(cr.Chairs, e, t); err != nil {
+			err = invalidContent(err, "RECOMMENDED_CHAIR", "GET /api/recommended_chair/:id")
+			return failed(ctx, err)
 		}
 	}
 
@@ -160,8 +168,7 @@ func estateSearchScenario(ctx context.Context, c *client.Client) error {
 	err = c.RequestEstateDocument(ctx, strconv.FormatInt(targetID, 10))
 
 	if err != nil {
-		fails.Add(err)
-		return failure.New(fails.ErrApplication)
+		return failed(ctx, err)
 	}
 
 	return nil
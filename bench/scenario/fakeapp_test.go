@@ -0,0 +1,197 @@
+package scenario
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/evidence"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fakeapp"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+	"github.com/morikuni/failure"
+)
+
+// newFakeApp テスト用のデータを asset とフェイクのサーバーに読み込み、クライアントの接続先にする
+func newFakeApp(t *testing.T) (*fakeapp.Server, context.Context, *fails.Errors, *evidence.Recorder) {
+	dir, err := ioutil.TempDir("", "fakeapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := fakeapp.Generate(dir, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	e := fails.New()
+	ev := evidence.NewRecorder()
+	ctx := score.WithScore(fails.WithErrors(context.Background(), e), score.New())
+	ctx = evidence.WithRecorder(ctx, ev)
+	asset.Initialize(ctx, dir, dir)
+	if msgs := e.GetMsgs(); len(msgs) > 0 {
+		t.Fatalf("asset.Initialize: %v", msgs)
+	}
+
+	srv, err := fakeapp.NewServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	if err := client.SetShareTargetURLs(srv.URL, ""); err != nil {
+		t.Fatal(err)
+	}
+	return srv, ctx, e, ev
+}
+
+// buyOutCheapestChair 最も安いイスを売り切れにする
+func buyOutCheapestChair(ctx context.Context, t *testing.T) {
+	c := client.NewClient(false, rand.New(rand.NewSource(1)))
+	cr, err := c.GetLowPricedChair(ctx)
+	if err != nil || len(cr.Chairs) == 0 {
+		t.Fatalf("GetLowPricedChair() = %v, %v", cr, err)
+	}
+	id := cr.Chairs[0].ID
+	chair, _ := asset.GetChairFromID(id)
+	for chair.GetStock() > 0 {
+		if err := c.BuyChair(ctx, strconv.FormatInt(id, 10)); err != nil {
+			t.Fatalf("BuyChair() = %v", err)
+		}
+	}
+}
+
+func runBotScenario(ctx context.Context, c *client.Client, rnd *rand.Rand) error {
+	botScenario(ctx, c, rnd)
+	return nil
+}
+
+func TestScenariosWithFakeApp(t *testing.T) {
+	tests := []struct {
+		name    string
+		faults  fakeapp.Faults
+		prepare func(ctx context.Context, t *testing.T)
+		bot     bool
+		run     func(ctx context.Context, c *client.Client, rnd *rand.Rand) error
+		// wantCode シナリオが返すエラーのコード。空であればエラーを返さない
+		wantCode failure.StringCode
+		// wantMsg fails に記録されるメッセージ。空であれば何も記録されない
+		wantMsg string
+		// wantScored 購入か資料請求まで進んでスコアが加算されたか
+		wantScored bool
+		// wantBlocked ボットのリクエストが拒否されたか
+		wantBlocked bool
+	}{
+		{name: "chair search", run: chairSearchScenario, wantScored: true},
+		{name: "estate search", run: estateSearchScenario, wantScored: true},
+		{name: "nazotte search", run: estateNazotteSearchScenario, wantScored: true},
+		{
+			name:     "wrong order",
+			faults:   fakeapp.Faults{WrongOrder: true},
+			run:      estateSearchScenario,
+			wantCode: fails.ErrApplication,
+			wantMsg:  "GET /api/estate/search: レスポンスの内容が不正です",
+		},
+		{
+			name:     "sold-out chair shown",
+			faults:   fakeapp.Faults{ShowSoldOut: true},
+			prepare:  buyOutCheapestChair,
+			run:      chairSearchScenario,
+			wantCode: fails.ErrApplication,
+			wantMsg:  "GET /api/chair/low_priced: レスポンスの内容が不正です",
+		},
+		{
+			name:       "sold-out chair hidden",
+			prepare:    buyOutCheapestChair,
+			run:        chairSearchScenario,
+			wantScored: true,
+		},
+		{
+			name:     "slow responses",
+			faults:   fakeapp.Faults{Delay: 1200 * time.Millisecond},
+			run:      estateNazotteSearchScenario,
+			wantCode: fails.ErrTimeout,
+		},
+		{
+			name:     "500",
+			faults:   fakeapp.Faults{InternalError: "/api/estate/nazotte"},
+			run:      estateNazotteSearchScenario,
+			wantCode: fails.ErrApplication,
+			wantMsg:  "POST /api/estate/nazotte: レスポンスコードが不正です",
+		},
+		{name: "bots blocked", bot: true, run: runBotScenario, wantBlocked: true},
+		// ボットを拒否するかどうかはアプリケーションに任されているため、拒否しなくてもエラーにはならない
+		{name: "bots not blocked", faults: fakeapp.Faults{AllowBots: true}, bot: true, run: runBotScenario},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, ctx, e, ev := newFakeApp(t)
+			if tt.prepare != nil {
+				tt.prepare(ctx, t)
+			}
+			srv.SetFaults(tt.faults)
+			before := score.FromContext(ctx).GetScore()
+
+			rnd := rand.New(rand.NewSource(1))
+			err := tt.run(evidence.WithSession(ctx), client.NewClient(tt.bot, rnd), rnd)
+
+			code, _ := failure.CodeOf(err)
+			if tt.wantCode == "" && err != nil || tt.wantCode != "" && code != tt.wantCode {
+				t.Errorf("scenario returned %v, want code %q", err, tt.wantCode)
+			}
+			msgs := e.GetMsgs()
+			if tt.wantMsg == "" && len(msgs) > 0 || tt.wantMsg != "" && (len(msgs) != 1 || msgs[0] != tt.wantMsg) {
+				t.Errorf("fails messages = %q, want %q", msgs, tt.wantMsg)
+			}
+			// エラーには、原因になったリクエストとレスポンスの記録が結び付く
+			if tt.wantMsg != "" {
+				failures, _ := ev.Failures()
+				if len(failures) != 1 {
+					t.Fatalf("evidence failures = %d, want 1", len(failures))
+				}
+				last := failures[0].Entries[len(failures[0].Entries)-1]
+				if msg := last.Route + ": "; last.Response == nil || msg != tt.wantMsg[:len(msg)] {
+					t.Errorf("evidence of %q = %+v", tt.wantMsg, last)
+				}
+			}
+			if scored := score.FromContext(ctx).GetScore() > before; scored != tt.wantScored {
+				t.Errorf("score = %d -> %d, want scored %v", before, score.FromContext(ctx).GetScore(), tt.wantScored)
+			}
+			if blocked := srv.BlockedBots() > 0; blocked != tt.wantBlocked {
+				t.Errorf("blocked bots = %d, want blocked %v", srv.BlockedBots(), tt.wantBlocked)
+			}
+		})
+	}
+}
+
+// 429 が返ってきたら、Workerは Retry-After だけ待ってから次のシナリオを始める
+func TestWorkerBacksOffOnRateLimit(t *testing.T) {
+	srv, ctx, _, _ := newFakeApp(t)
+	srv.SetFaults(fakeapp.Faults{RateLimited: "/api/chair/low_priced", RetryAfter: 3})
+	s, ok := Lookup(WorkerChairSearch)
+	if !ok {
+		t.Fatalf("%s is not registered", WorkerChairSearch)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	err := s.RunOnce(evidence.WithSession(ctx), s.NewClient(rnd), rnd)
+	if retryAfter, ok := client.RetryAfterOf(err); !ok || retryAfter != 3*time.Second {
+		t.Fatalf("RetryAfterOf(%v) = %v, %v, want 3s", err, retryAfter, ok)
+	}
+	if class := s.Classify(err); class != ErrorClassRateLimited {
+		t.Fatalf("Classify() = %v, want ErrorClassRateLimited", class)
+	}
+
+	// 失敗したときの待ち時間 (最大 1.75 秒) では次のシナリオを始めてしまうが、Retry-After の 3 秒は待つ
+	before := srv.RateLimitedRequests()
+	runCtx, cancel := context.WithTimeout(ctx, 2500*time.Millisecond)
+	defer cancel()
+	runWorker(runCtx, s, rnd)
+	if n := srv.RateLimitedRequests() - before; n != 1 {
+		t.Errorf("rate limited requests = %d, want 1", n)
+	}
+}
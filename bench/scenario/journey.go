@@ -0,0 +1,530 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/morikuni/failure"
+	"gopkg.in/yaml.v2"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+)
+
+const (
+	JourneyClientUser = "user"
+	JourneyClientBot  = "bot"
+)
+
+// Journey YAML で定義したユーザーの一連の行動。登録するとシナリオとして負荷プロファイルから使える
+type Journey struct {
+	Name string `yaml:"name"`
+	// Client user か bot。省略時は user
+	Client string        `yaml:"client"`
+	Steps  []JourneyStep `yaml:"steps"`
+}
+
+// JourneyStep Journey の1ステップ。Action か Loop のどちらかを指定する
+type JourneyStep struct {
+	Action string `yaml:"action"`
+	// Probability このステップを実行する確率。省略時は必ず実行する
+	Probability *float64 `yaml:"probability"`
+	// Think ステップの前に待つ時間
+	Think parameter.Duration `yaml:"think"`
+	// Loop Steps を繰り返す回数
+	Loop  int           `yaml:"loop"`
+	Steps []JourneyStep `yaml:"steps"`
+	// Query search_chairs と search_estates で、new なら新しい検索条件、same なら直前の検索条件を使う
+	Query string `yaml:"query"`
+	// Page search_chairs と search_estates で、first なら最初のページ、random なら直前の件数から選んだページを開く
+	Page string `yaml:"page"`
+	// Assert レスポンスの確認方法。省略時は action で使えるすべての確認を行い、[] なら確認しない
+	Assert []string `yaml:"assert"`
+}
+
+// journeyState Journey の実行中に、ユーザーが見ている画面の状態
+type journeyState struct {
+	c   *client.Client
+	rnd *rand.Rand
+
+	// chairs, estates 直前に表示された一覧。詳細ページに進むときに選ぶ
+	chairs  []asset.Chair
+	estates []asset.Estate
+
+	chairQuery  url.Values
+	chairCount  int64
+	estateQuery url.Values
+	estateCount int64
+
+	// chair, estate 直前に開いた詳細ページ。購入や資料請求の対象になる
+	chair  *asset.Chair
+	estate *asset.Estate
+}
+
+type journeyAction struct {
+	// asserts 使える確認の名前
+	asserts []string
+	run     func(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error
+}
+
+var journeyActions = map[string]journeyAction{
+	"top_page":            {asserts: []string{"low_priced"}, run: journeyTopPage},
+	"chair_search_page":   {run: journeyPage((*client.Client).AccessChairSearchPage)},
+	"estate_search_page":  {run: journeyPage((*client.Client).AccessEstateSearchPage)},
+	"estate_nazotte_page": {run: journeyPage((*client.Client).AccessEstateNazottePage)},
+	"search_chairs":       {asserts: []string{"popularity", "oracle"}, run: journeySearchChairs},
+	"search_estates":      {asserts: []string{"popularity", "oracle"}, run: journeySearchEstates},
+	"nazotte_search":      {asserts: []string{"in_polygon"}, run: journeyNazotteSearch},
+	"chair_detail":        {asserts: []string{"equal_to_asset", "recommended"}, run: journeyChairDetail},
+	"estate_detail":       {asserts: []string{"equal_to_asset", "recommended"}, run: journeyEstateDetail},
+	"buy_chair":           {run: journeyBuyChair},
+	"request_document":    {run: journeyRequestDocument},
+}
+
+// invalidResponse レスポンスの確認に失敗したことを記録する
+func invalidResponse(ctx context.Context, err error, endpoint, route string) error {
+	return failed(ctx, invalidContent(err, endpoint, route))
+}
+
+// abandoned ページの表示に時間がかかり、ユーザーが離脱したか
+func abandoned(t time.Time) error {
+	if time.Since(t) > parameter.ThresholdTimeOfAbandonmentPage {
+		return failure.New(fails.ErrTimeout)
+	}
+	return nil
+}
+
+func journeyTopPage(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error {
+	t := time.Now()
+	chairs, estates, err := s.c.AccessTopPage(ctx)
+	if err != nil {
+		return failed(ctx, err)
+	}
+
+	if asserts["low_priced"] {
+		if err := checkChairsOrderedByPrice(chairs.Chairs, t); err != nil {
+			return invalidResponse(ctx, err, "CHAIR_LOW_PRICED", "GET /api/chair/low_priced")
+		}
+		if err := checkEstatesOrderedByRent(estates.Estates); err != nil {
+			return invalidResponse(ctx, err, "ESTATE_LOW_PRICED", "GET /api/estate/low_priced")
+		}
+	}
+
+	if err := abandoned(t); err != nil {
+		return err
+	}
+
+	s.chairs = chairs.Chairs
+	s.estates = estates.Estates
+	return nil
+}
+
+func journeyPage(access func(c *client.Client, ctx context.Context) error) func(context.Context, *journeyState, JourneyStep, map[string]bool) error {
+	return func(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error {
+		t := time.Now()
+		if err := access(s.c, ctx); err != nil {
+			return failed(ctx, err)
+		}
+		return abandoned(t)
+	}
+}
+
+// searchPage step.Page に従って開くページを決める
+func searchPage(rnd *rand.Rand, page string, count int64, perPage, limit int) int {
+	if page != "random" {
+		return 0
+	}
+	numOfPages := int(count) / perPage
+	if numOfPages > limit {
+		numOfPages = limit
+	}
+	if numOfPages == 0 {
+		return 0
+	}
+	return rnd.Intn(numOfPages)
+}
+
+func journeySearchChairs(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error {
+	if step.Query != "same" || s.chairQuery == nil {
+		q, err := createRandomChairSearchQuery(ctx, s.rnd)
+		if err != nil {
+			return failed(ctx, err)
+		}
+		s.chairQuery = q
+		s.chairCount = 0
+	}
+	q := s.chairQuery
+	q.Set("page", strconv.Itoa(searchPage(s.rnd, step.Page, s.chairCount, parameter.PerPageOfChairSearch, parameter.LimitOfChairSearchPageDepth)))
+
+	t := time.Now()
+	cr, err := s.c.SearchChairsWithQuery(ctx, q)
+	if err != nil {
+		return failed(ctx, err)
+	}
+	if err := abandoned(t); err != nil {
+		return err
+	}
+
+	if asserts["oracle"] && s.rnd.Float64() < parameter.RateOfSearchOracleCheck {
+		if err := checkChairSearchResult(q, cr, t); err != nil {
+			return invalidResponse(ctx, err, "CHAIR_SEARCH", "GET /api/chair/search")
+		}
+	}
+	if asserts["popularity"] {
+		if err := checkChairsOrderedByPopularity(cr.Chairs, t); err != nil {
+			return invalidResponse(ctx, err, "CHAIR_SEARCH", "GET /api/chair/search")
+		}
+	}
+
+	s.chairs = cr.Chairs
+	s.chairCount = cr.Count
+	return nil
+}
+
+func journeySearchEstates(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error {
+	if step.Query != "same" || s.estateQuery == nil {
+		q, err := createRandomEstateSearchQuery(ctx, s.rnd)
+		if err != nil {
+			return failed(ctx, err)
+		}
+		s.estateQuery = q
+		s.estateCount = 0
+	}
+	q := s.estateQuery
+	q.Set("page", strconv.Itoa(searchPage(s.rnd, step.Page, s.estateCount, parameter.PerPageOfEstateSearch, parameter.LimitOfEstateSearchPageDepth)))
+
+	t := time.Now()
+	er, err := s.c.SearchEstatesWithQuery(ctx, q)
+	if err != nil {
+		return failed(ctx, err)
+	}
+	if err := abandoned(t); err != nil {
+		return err
+	}
+
+	if asserts["oracle"] && s.rnd.Float64() < parameter.RateOfSearchOracleCheck {
+		if err := checkEstateSearchResult(q, er, t); err != nil {
+			return invalidResponse(ctx, err, "ESTATE_SEARCH", "GET /api/estate/search")
+		}
+	}
+	if asserts["popularity"] {
+		if err := checkEstatesOrderedByPopularity(er.Estates); err != nil {
+			return invalidResponse(ctx, err, "ESTATE_SEARCH", "GET /api/estate/search")
+		}
+	}
+
+	s.estates = er.Estates
+	s.estateCount = er.Count
+	return nil
+}
+
+func journeyNazotteSearch(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error {
+	convexHulled := createRandomConvexhull(s.rnd)
+
+	t := time.Now()
+	er, err := s.c.SearchEstatesNazotte(ctx, ToCoordinates(convexHulled))
+	if err != nil {
+		return failed(ctx, err)
+	}
+	if err := abandoned(t); err != nil {
+		return err
+	}
+
+	if asserts["in_polygon"] {
+		if len(er.Estates) > parameter.MaxLengthOfNazotteResponse {
+			return invalidResponse(ctx, newViolation(violationCount, "物件の数が多すぎます"), "ESTATE_NAZOTTE", "POST /api/estate/nazotte")
+		}
+		if err := checkEstatesInPolygon(er.Estates, convexHulled, t); err != nil {
+			return invalidResponse(ctx, err, "ESTATE_NAZOTTE", "POST /api/estate/nazotte")
+		}
+	}
+
+	s.estates = er.Estates
+	return nil
+}
+
+func journeyChairDetail(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error {
+	if len(s.chairs) == 0 {
+		return nil
+	}
+	targetID := s.chairs[s.rnd.Intn(len(s.chairs))].ID
+
+	t := time.Now()
+	chair, er, err := s.c.AccessChairDetailPage(ctx, targetID)
+	if err != nil {
+		return failed(ctx, err)
+	}
+	if err := abandoned(t); err != nil {
+		return err
+	}
+
+	// 売り切れたイスの詳細ページは表示されない
+	s.chair = chair
+	if chair == nil {
+		return nil
+	}
+
+	if asserts["equal_to_asset"] {
+		if err := checkChairEqualToAsset(chair); err != nil {
+			return invalidResponse(ctx, err, "CHAIR_DETAIL", "GET /api/chair/:id")
+		}
+	}
+	if asserts["recommended"] {
+		if err := checkRecommendedEstates(er.Estates, chair); err != nil {
+			return invalidResponse(ctx, err, "RECOMMENDED_ESTATE", "GET /api/recommended_estate/:id")
+		}
+	}
+
+	s.estates = er.Estates
+	return nil
+}
+
+func journeyEstateDetail(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error {
+	if len(s.estates) == 0 {
+		return nil
+	}
+	targetID := s.estates[s.rnd.Intn(len(s.estates))].ID
+
+	t := time.Now()
+	estate, cr, err := s.c.AccessEstateDetailPage(ctx, targetID)
+	if err != nil {
+		return failed(ctx, err)
+	}
+	if err := abandoned(t); err != nil {
+		return err
+	}
+
+	if estate == nil {
+		return invalidResponse(ctx, fmt.Errorf("物件が見つかりません: ID %v", targetID), "ESTATE_DETAIL", "GET /api/estate/:id")
+	}
+	if asserts["equal_to_asset"] {
+		if err := checkEstateEqualToAsset(estate); err != nil {
+			return invalidResponse(ctx, err, "ESTATE_DETAIL", "GET /api/estate/:id")
+		}
+	}
+	if asserts["recommended"] {
+		if err := checkRecommendedChairs(cr.Chairs, estate, t); err != nil {
+			return invalidResponse(ctx, err, "RECOMMENDED_CHAIR", "GET /api/recommended_chair/:id")
+		}
+	}
+
+	s.estate = estate
+	s.chairs = cr.Chairs
+	return nil
+}
+
+func journeyBuyChair(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error {
+	if s.chair == nil {
+		return nil
+	}
+
+	err := s.c.BuyChair(ctx, strconv.FormatInt(s.chair.ID, 10))
+	if err != nil {
+		// 他のユーザーが先に買って在庫がなくなった (かもしれない) 場合は失敗してよい
+		if chair, aErr := asset.GetChairFromID(s.chair.ID); aErr != nil || !chair.MaybeSoldOut() {
+			return failed(ctx, err)
+		}
+	}
+	return nil
+}
+
+func journeyRequestDocument(ctx context.Context, s *journeyState, step JourneyStep, asserts map[string]bool) error {
+	if s.estate == nil {
+		return nil
+	}
+
+	err := s.c.RequestEstateDocument(ctx, strconv.FormatInt(s.estate.ID, 10))
+	if err != nil {
+		return failed(ctx, err)
+	}
+	return nil
+}
+
+// Validate Journey の定義が正しいか確認する
+func (j *Journey) Validate() error {
+	if j.Name == "" {
+		return fmt.Errorf("name: required")
+	}
+	if j.Client != "" && j.Client != JourneyClientUser && j.Client != JourneyClientBot {
+		return fmt.Errorf("client: must be %s or %s", JourneyClientUser, JourneyClientBot)
+	}
+	if len(j.Steps) == 0 {
+		return fmt.Errorf("steps: at least one step is required")
+	}
+	return validateSteps("steps", j.Steps)
+}
+
+func validateSteps(path string, steps []JourneyStep) error {
+	for i, step := range steps {
+		p := fmt.Sprintf("%s[%d]", path, i)
+
+		if step.Probability != nil && (*step.Probability < 0 || 1 < *step.Probability) {
+			return fmt.Errorf("%s.probability: must be between 0 and 1", p)
+		}
+		if step.Think < 0 {
+			return fmt.Errorf("%s.think: must not be negative", p)
+		}
+
+		if step.Action == "" {
+			if step.Loop < 1 || len(step.Steps) == 0 {
+				return fmt.Errorf("%s: either action or loop with steps is required", p)
+			}
+			if err := validateSteps(p+".steps", step.Steps); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if step.Loop != 0 || len(step.Steps) != 0 {
+			return fmt.Errorf("%s: action cannot be combined with loop", p)
+		}
+		action, ok := journeyActions[step.Action]
+		if !ok {
+			return fmt.Errorf("%s.action: unknown action %s", p, step.Action)
+		}
+		if step.Query != "" && step.Query != "new" && step.Query != "same" {
+			return fmt.Errorf("%s.query: must be new or same", p)
+		}
+		if step.Page != "" && step.Page != "first" && step.Page != "random" {
+			return fmt.Errorf("%s.page: must be first or random", p)
+		}
+		for _, a := range step.Assert {
+			if !containsString(action.asserts, a) {
+				return fmt.Errorf("%s.assert: %s is not available for %s", p, a, step.Action)
+			}
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// runSteps steps を順に実行する。失敗したステップがあればそこで Journey を終える
+func runSteps(ctx context.Context, s *journeyState, steps []JourneyStep) error {
+	for _, step := range steps {
+		if step.Probability != nil && s.rnd.Float64() >= *step.Probability {
+			continue
+		}
+		if !sleep(ctx, time.Duration(step.Think)) {
+			return nil
+		}
+
+		if step.Action == "" {
+			for i := 0; i < step.Loop; i++ {
+				if err := runSteps(ctx, s, step.Steps); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		action := journeyActions[step.Action]
+		names := step.Assert
+		if names == nil {
+			names = action.asserts
+		}
+		asserts := make(map[string]bool, len(names))
+		for _, name := range names {
+			asserts[name] = true
+		}
+
+		if err := action.run(ctx, s, step, asserts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// journeyScenario Journey を Scenario として実行する
+type journeyScenario struct {
+	journey *Journey
+}
+
+func (s *journeyScenario) Name() string {
+	return s.journey.Name
+}
+
+func (s *journeyScenario) NewClient(rnd *rand.Rand) *client.Client {
+	return client.NewClient(s.journey.Client == JourneyClientBot, rnd)
+}
+
+func (s *journeyScenario) RunOnce(ctx context.Context, c *client.Client, rnd *rand.Rand) error {
+	return runSteps(ctx, &journeyState{c: c, rnd: rnd}, s.journey.Steps)
+}
+
+func (s *journeyScenario) Classify(err error) ErrorClass {
+	return classifyError(err)
+}
+
+func (s *journeyScenario) ThinkTime(rnd *rand.Rand, i int) (time.Duration, bool) {
+	return time.Duration(rnd.Intn(100)) * time.Millisecond, true
+}
+
+// LoadJourney YAML ファイルから Journey を読み込む
+func LoadJourney(path string) (*Journey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var j Journey
+	if err := yaml.UnmarshalStrict(b, &j); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := j.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &j, nil
+}
+
+// RegisterJourneys path の Journey をシナリオとして登録する。ディレクトリなら中の YAML ファイルをすべて登録する
+func RegisterJourneys(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{path}
+	if info.IsDir() {
+		paths = nil
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, matches...)
+		}
+		sort.Strings(paths)
+	}
+
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		j, err := LoadJourney(p)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := Lookup(j.Name); ok {
+			return nil, fmt.Errorf("%s: scenario %s is already registered", p, j.Name)
+		}
+		Register(&journeyScenario{journey: j})
+		names = append(names, j.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,54 @@
+package scenario
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func Test_LoadJourney(t *testing.T) {
+	j, err := LoadJourney("../journeys/chair_buyer.yaml")
+	if err != nil {
+		t.Fatalf("LoadJourney() error = %v", err)
+	}
+	if j.Name != "chair_buyer" || len(j.Steps) == 0 {
+		t.Errorf("unexpected journey: %+v", j)
+	}
+}
+
+func TestJourney_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			yaml: "name: j\nsteps:\n- action: top_page\n- loop: 2\n  steps:\n  - action: search_estates\n    page: random\n    assert: [popularity]\n",
+		},
+		{name: "unknown action", yaml: "name: j\nsteps:\n- action: fly\n", wantErr: "unknown action"},
+		{name: "unknown assert", yaml: "name: j\nsteps:\n- action: buy_chair\n  assert: [oracle]\n", wantErr: "not available"},
+		{name: "probability", yaml: "name: j\nsteps:\n- action: top_page\n  probability: 1.5\n", wantErr: "probability"},
+		{name: "empty loop", yaml: "name: j\nsteps:\n- loop: 2\n", wantErr: "either action or loop"},
+		{name: "no name", yaml: "steps:\n- action: top_page\n", wantErr: "name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var j Journey
+			if err := yaml.UnmarshalStrict([]byte(tt.yaml), &j); err != nil {
+				t.Fatal(err)
+			}
+			err := j.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
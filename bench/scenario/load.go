@@ -2,201 +2,85 @@ package scenario
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"math/rand"
 	"time"
 
-	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
-	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
-	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
-	"github.com/morikuni/failure"
 )
 
-func runEstateSearchWorker(ctx context.Context) {
-
-	c := client.NewClient(false)
-
-	for {
-		r := rand.Intn(100)
-		t := time.NewTimer(time.Duration(r) * time.Millisecond)
-		select {
-		case <-t.C:
-		case <-ctx.Done():
-			t.Stop()
-			return
+// startWorkers incWorkers で指定された数だけ、シナリオごとのWorkerを起動する
+func startWorkers(ctx context.Context, incWorkers parameter.IncWorkers) {
+	for _, name := range Names() {
+		// open model で到着率に従って始めるシナリオは、Workerを起動しない
+		if parameter.ArrivalModel == parameter.ArrivalModelOpen && parameter.ArrivalMix[name] > 0 {
+			continue
 		}
-		err := estateSearchScenario(ctx, c)
-		if err != nil {
-			code, _ := failure.CodeOf(err)
-			if code == fails.ErrTimeout {
-				r := rand.Intn(parameter.SleepSwingOnUserAway) - parameter.SleepSwingOnUserAway*0.5
-				s := parameter.SleepTimeOnFailScenario + time.Duration(r)*time.Millisecond
-				t = time.NewTimer(s)
-			} else {
-				r := rand.Intn(parameter.SleepSwingOnFailScenario) - parameter.SleepSwingOnFailScenario*0.5
-				s := parameter.SleepTimeOnFailScenario + time.Duration(r)*time.Millisecond
-				t = time.NewTimer(s)
-			}
-			select {
-			case <-t.C:
-			case <-ctx.Done():
-				t.Stop()
-				return
-			}
+		s, _ := Lookup(name)
+		for i := 0; i < incWorkers[name]; i++ {
+			go runWorker(ctx, s, newWorkerRand(ctx, name))
 		}
 	}
 }
 
-func runChairSearchWorker(ctx context.Context) {
-
-	c := client.NewClient(false)
-
-	for {
-		r := rand.Intn(100)
-		t := time.NewTimer(time.Duration(r) * time.Millisecond)
-		select {
-		case <-t.C:
-		case <-ctx.Done():
-			t.Stop()
-			return
+// checkWorkers 負荷レベルに合わせてWorkerを増減させる
+// baseLevel より上のレベルで追加したWorkerは、レベルが下がったときに止められるようレベルごとの context で動かす
+func checkWorkers(ctx context.Context, baseLevel int64) {
+	cancels := make([]context.CancelFunc, 0)
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
 		}
-		err := chairSearchScenario(ctx, c)
-		if err != nil {
-			code, _ := failure.CodeOf(err)
-			if code == fails.ErrTimeout {
-				r := rand.Intn(parameter.SleepSwingOnUserAway) - parameter.SleepSwingOnUserAway*0.5
-				s := parameter.SleepTimeOnFailScenario + time.Duration(r)*time.Millisecond
-				t = time.NewTimer(s)
-			} else {
-				r := rand.Intn(parameter.SleepSwingOnFailScenario) - parameter.SleepSwingOnFailScenario*0.5
-				s := parameter.SleepTimeOnFailScenario + time.Duration(r)*time.Millisecond
-				t = time.NewTimer(s)
-			}
-			select {
-			case <-t.C:
-			case <-ctx.Done():
-				t.Stop()
-				return
-			}
-		}
-	}
-}
-
-func runEstateNazotteSearchWorker(ctx context.Context) {
-
-	c := client.NewClient(false)
-
-	for {
-		r := rand.Intn(100)
-		t := time.NewTimer(time.Duration(r) * time.Millisecond)
-		select {
-		case <-t.C:
-		case <-ctx.Done():
-			t.Stop()
-			return
-		}
-		err := estateNazotteSearchScenario(ctx, c)
-		if err != nil {
-			code, _ := failure.CodeOf(err)
-			if code == fails.ErrTimeout {
-				r := rand.Intn(parameter.SleepSwingOnUserAway) - parameter.SleepSwingOnUserAway*0.5
-				s := parameter.SleepTimeOnFailScenario + time.Duration(r)*time.Millisecond
-				t = time.NewTimer(s)
-			} else {
-				r := rand.Intn(parameter.SleepSwingOnFailScenario) - parameter.SleepSwingOnFailScenario*0.5
-				s := parameter.SleepTimeOnFailScenario + time.Duration(r)*time.Millisecond
-				t = time.NewTimer(s)
-			}
-			select {
-			case <-t.C:
-			case <-ctx.Done():
-				t.Stop()
-				return
-			}
-		}
-	}
-}
-
-func runBotWorker(ctx context.Context) {
+	}()
 
-	c := client.NewClient(true)
-
-	for {
-		go botScenario(ctx, c)
-		r := rand.Intn(parameter.SleepSwingOnBotInterval) - parameter.SleepSwingOnBotInterval*0.5
-		s := parameter.SleepTimeOnBotInterval + time.Duration(r)*time.Millisecond
-		t := time.NewTimer(s)
-		select {
-		case <-t.C:
-		case <-ctx.Done():
-			t.Stop()
-			return
+	// 通知の値ではなく現在のレベルに合わせることで、レベルの上下が重なってもWorkerの数がずれないようにする
+	reconcile := func() {
+		level := score.FromContext(ctx).GetLevel()
+		for baseLevel+int64(len(cancels)) < level {
+			log.Println("負荷レベルが上昇しました。")
+			l := baseLevel + int64(len(cancels)) + 1
+			levelCtx, cancel := context.WithCancel(ctx)
+			cancels = append(cancels, cancel)
+			dispatcherOf(ctx).Dispatch(levelCtx, parameter.ListOfIncWorkers[l])
 		}
-	}
-}
-
-func runChairDraftPostWorker(ctx context.Context) {
-	c := client.NewClientForDraft()
-
-	r := rand.Intn(parameter.SleepSwingBeforePostDraft) - parameter.SleepSwingBeforePostDraft*0.5
-	s := parameter.SleepBeforePostDraft + time.Duration(r)*time.Millisecond
-	t := time.NewTimer(s)
-	select {
-	case <-t.C:
-		filePath, err := asset.ChairDraftFiles.Next()
-		if err != nil {
-			return
+		for baseLevel+int64(len(cancels)) > level && len(cancels) > 0 {
+			log.Println("負荷レベルが低下しました。")
+			cancels[len(cancels)-1]()
+			cancels = cancels[:len(cancels)-1]
 		}
-		chairDraftPostScenario(ctx, c, filePath)
-	case <-ctx.Done():
-		t.Stop()
-		return
 	}
-}
 
-func runEstateDraftPostWorker(ctx context.Context) {
-	c := client.NewClientForDraft()
-
-	r := rand.Intn(parameter.SleepSwingBeforePostDraft) - parameter.SleepSwingBeforePostDraft*0.5
-	s := parameter.SleepBeforePostDraft + time.Duration(r)*time.Millisecond
-	t := time.NewTimer(s)
-	select {
-	case <-t.C:
-		filePath, err := asset.EstateDraftFiles.Next()
-		if err != nil {
-			return
-		}
-		estateDraftPostScenario(ctx, c, filePath)
-	case <-ctx.Done():
-		t.Stop()
+	var tick <-chan time.Time
+	if parameter.ControlMode == parameter.ControlModeAdaptive {
+		ticker := time.NewTicker(parameter.ControlInterval)
+		defer ticker.Stop()
+		tick = ticker.C
 	}
-}
+	overloaded := 0
 
-func checkWorkers(ctx context.Context) {
 	for {
 		select {
-		case level := <-score.LevelUp():
-			log.Println("負荷レベルが上昇しました。")
-			incWorkers := parameter.ListOfIncWorkers[level]
-			for i := 0; i < incWorkers.ChairSearchWorker; i++ {
-				go runChairSearchWorker(ctx)
-			}
-			for i := 0; i < incWorkers.EstateSearchWorker; i++ {
-				go runEstateSearchWorker(ctx)
+		case <-score.FromContext(ctx).LevelUp():
+			reconcile()
+		case now := <-tick:
+			reason, ok := checkOverload(ctx, now.Add(-parameter.ControlInterval))
+			if !ok {
+				overloaded = 0
+				continue
 			}
-			for i := 0; i < incWorkers.EstateNazotteSearchWorker; i++ {
-				go runEstateNazotteSearchWorker(ctx)
+			overloaded++
+			if overloaded < parameter.SustainedIntervalsToLevelDown {
+				continue
 			}
-			for i := 0; i < incWorkers.BotWorker; i++ {
-				go runBotWorker(ctx)
+			overloaded = 0
+			if score.FromContext(ctx).GetLevel() <= baseLevel {
+				continue
 			}
-			for i := 0; i < incWorkers.ChairDraftPostWorker; i++ {
-				go runChairDraftPostWorker(ctx)
-			}
-			for i := 0; i < incWorkers.EstateDraftPostWorker; i++ {
-				go runEstateDraftPostWorker(ctx)
+			if _, ok := score.FromContext(ctx).LevelDown(reason); ok {
+				reconcile()
 			}
 		case <-ctx.Done():
 			return
@@ -204,39 +88,25 @@ func checkWorkers(ctx context.Context) {
 	}
 }
 
-func Load(ctx context.Context) {
-	level := score.GetLevel()
-	incWorkers := parameter.ListOfIncWorkers[level]
-
-	// 物件検索をして、資料請求をするシナリオ
-	for i := 0; i < incWorkers.ChairSearchWorker; i++ {
-		go runChairSearchWorker(ctx)
+// checkOverload since 以降の区間でタイムアウトかp99レイテンシが閾値を超えていれば、その理由を返す
+func checkOverload(ctx context.Context, since time.Time) (string, bool) {
+	w := metrics.FromContext(ctx).WindowSince(since)
+	if w.NoResponse > parameter.MaxTimeoutsPerControlInterval {
+		return fmt.Sprintf("timeouts %d > %d", w.NoResponse, parameter.MaxTimeoutsPerControlInterval), true
 	}
-
-	// イス検索から物件ページに行き、資料請求をするまでのシナリオ
-	for i := 0; i < incWorkers.EstateSearchWorker; i++ {
-		go runEstateSearchWorker(ctx)
-	}
-
-	// なぞって検索をするシナリオ
-	for i := 0; i < incWorkers.EstateNazotteSearchWorker; i++ {
-		go runEstateNazotteSearchWorker(ctx)
-	}
-
-	// ボットによる検索シナリオ
-	for i := 0; i < incWorkers.BotWorker; i++ {
-		go runBotWorker(ctx)
+	if w.P99 > parameter.MaxP99LatencyOfControl {
+		return fmt.Sprintf("p99 %v > %v", w.P99, parameter.MaxP99LatencyOfControl), true
 	}
+	return "", false
+}
 
-	// イスの入稿シナリオ
-	for i := 0; i < incWorkers.ChairDraftPostWorker; i++ {
-		go runChairDraftPostWorker(ctx)
-	}
+func Load(ctx context.Context) {
+	level := score.FromContext(ctx).GetLevel()
+	dispatcherOf(ctx).Dispatch(ctx, parameter.ListOfIncWorkers[level])
 
-	// 物件の入稿シナリオ
-	for i := 0; i < incWorkers.EstateDraftPostWorker; i++ {
-		go runEstateDraftPostWorker(ctx)
+	if parameter.ArrivalModel == parameter.ArrivalModelOpen {
+		go runArrivalDriver(ctx, random.FromContext(ctx).New("arrival", 0))
 	}
 
-	go checkWorkers(ctx)
+	go checkWorkers(ctx, level)
 }
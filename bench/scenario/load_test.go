@@ -0,0 +1,209 @@
+package scenario
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+)
+
+const controlInterval = 10 * time.Millisecond
+
+// recordingDispatcher Workerを起動する代わりに、レベルごとの context を記録する
+type recordingDispatcher struct {
+	mu   sync.Mutex
+	ctxs []context.Context
+}
+
+func (d *recordingDispatcher) Dispatch(ctx context.Context, _ parameter.IncWorkers) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ctxs = append(d.ctxs, ctx)
+}
+
+// active 止められていないレベルの数
+func (d *recordingDispatcher) active() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, ctx := range d.ctxs {
+		if ctx.Err() == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (d *recordingDispatcher) dispatched() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.ctxs)
+}
+
+func setControlParameters(t *testing.T, cooldown time.Duration) {
+	mode, interval, timeouts, p99 := parameter.ControlMode, parameter.ControlInterval, parameter.MaxTimeoutsPerControlInterval, parameter.MaxP99LatencyOfControl
+	sustained, c := parameter.SustainedIntervalsToLevelDown, parameter.CooldownAfterLevelDown
+	boundary, weights := parameter.BoundaryOfLevel, parameter.ScoreWeights
+	t.Cleanup(func() {
+		parameter.ControlMode, parameter.ControlInterval, parameter.MaxTimeoutsPerControlInterval, parameter.MaxP99LatencyOfControl = mode, interval, timeouts, p99
+		parameter.SustainedIntervalsToLevelDown, parameter.CooldownAfterLevelDown = sustained, c
+		parameter.BoundaryOfLevel, parameter.ScoreWeights = boundary, weights
+	})
+	parameter.ControlMode = parameter.ControlModeAdaptive
+	parameter.ControlInterval = controlInterval
+	parameter.MaxTimeoutsPerControlInterval = 2
+	parameter.MaxP99LatencyOfControl = time.Second
+	parameter.SustainedIntervalsToLevelDown = 2
+	parameter.CooldownAfterLevelDown = cooldown
+	parameter.BoundaryOfLevel = []int64{1, 2, 3, 4}
+	parameter.ScoreWeights = parameter.EndpointWeights{"POST /api/chair/buy/:id": 1}
+}
+
+// startCheckWorkers レベル baseLevel から checkWorkers を動かし、テストの終わりに止める
+func startCheckWorkers(t *testing.T, baseLevel int) (context.Context, *recordingDispatcher) {
+	d := &recordingDispatcher{}
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = WithDispatcher(ctx, d)
+	ctx = score.WithScore(ctx, score.New())
+	ctx = metrics.WithRecorder(ctx, metrics.New())
+	addPoints(ctx, baseLevel)
+
+	done := make(chan struct{})
+	go func() {
+		checkWorkers(ctx, int64(baseLevel))
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return ctx, d
+}
+
+func addPoints(ctx context.Context, n int) {
+	for i := 0; i < n; i++ {
+		score.Add(ctx, "POST /api/chair/buy/:id")
+	}
+}
+
+// recordResponses 区間の終わりより後に読み終えたことにして、どの区間でも数えられるようにする
+func recordResponses(ctx context.Context, n int, statusCode int, latency time.Duration) {
+	for i := 0; i < n; i++ {
+		metrics.FromContext(ctx).Record(metrics.Request{
+			Route:      "GET /api/chair/:id",
+			StatusCode: statusCode,
+			Latency:    latency,
+			StartedAt:  time.Now().Add(time.Hour),
+		})
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_checkWorkers(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeouts   int
+		latency    time.Duration
+		wantReason string
+	}{
+		{name: "timeouts past the threshold", timeouts: 3, latency: 10 * time.Millisecond, wantReason: "timeouts 3 > 2"},
+		{name: "p99 past the threshold", latency: 2 * time.Second, wantReason: "p99 2s > 1s"},
+		{name: "within the thresholds", timeouts: 2, latency: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setControlParameters(t, time.Hour)
+			ctx, d := startCheckWorkers(t, 1)
+			s := score.FromContext(ctx)
+			addPoints(ctx, 2)
+			waitFor(t, "workers of level 3", func() bool { return d.active() == 2 })
+
+			recordResponses(ctx, tt.timeouts, 0, tt.latency)
+			recordResponses(ctx, 10, 200, tt.latency)
+
+			if tt.wantReason == "" {
+				time.Sleep(10 * controlInterval)
+				if got := s.GetLevel(); got != 3 || d.active() != 2 {
+					t.Fatalf("level = %d, active = %d, want 3, 2", got, d.active())
+				}
+				return
+			}
+
+			// 閾値を超え続けるとレベルごとに下げ、baseLevel より下には下げない
+			waitFor(t, "level down to the base level", func() bool { return s.GetLevel() == 1 && d.active() == 0 })
+			time.Sleep(10 * controlInterval)
+			if got := s.GetLevel(); got != 1 {
+				t.Fatalf("level = %d, want the base level 1", got)
+			}
+			downs := 0
+			for _, c := range s.History() {
+				if c.Reason == "score" {
+					continue
+				}
+				downs++
+				if c.Reason != tt.wantReason {
+					t.Errorf("reason = %q, want %q", c.Reason, tt.wantReason)
+				}
+			}
+			if downs != 2 {
+				t.Errorf("level downs = %d, want 2", downs)
+			}
+		})
+	}
+}
+
+func Test_checkWorkersSustainedIntervals(t *testing.T) {
+	setControlParameters(t, time.Hour)
+	parameter.SustainedIntervalsToLevelDown = 1000
+	ctx, d := startCheckWorkers(t, 0)
+	addPoints(ctx, 1)
+	waitFor(t, "workers of level 1", func() bool { return d.active() == 1 })
+
+	// 閾値を超えた区間が続いた数が足りなければ下げない
+	recordResponses(ctx, 3, 0, 10*time.Millisecond)
+	time.Sleep(10 * controlInterval)
+	if got := score.FromContext(ctx).GetLevel(); got != 1 || d.active() != 1 {
+		t.Fatalf("level = %d, active = %d, want 1, 1", got, d.active())
+	}
+}
+
+func Test_checkWorkersRecovery(t *testing.T) {
+	cooldown := 100 * time.Millisecond
+	setControlParameters(t, cooldown)
+	ctx, d := startCheckWorkers(t, 1)
+	s := score.FromContext(ctx)
+	addPoints(ctx, 1)
+	waitFor(t, "workers of level 2", func() bool { return d.active() == 1 })
+
+	recordResponses(ctx, 3, 0, 10*time.Millisecond)
+	waitFor(t, "level down", func() bool { return s.GetLevel() == 1 && d.active() == 0 })
+	metrics.FromContext(ctx).Reset()
+
+	// レベル1の幅 (1点) を超えて加点されても、クールダウンの間は上げない
+	addPoints(ctx, 2)
+	time.Sleep(5 * controlInterval)
+	if got := s.GetLevel(); got != 1 || d.dispatched() != 1 {
+		t.Fatalf("level during cooldown = %d, dispatched = %d, want 1, 1", got, d.dispatched())
+	}
+
+	time.Sleep(cooldown)
+	addPoints(ctx, 1)
+	waitFor(t, "workers of level 2 again", func() bool { return s.GetLevel() == 2 && d.active() == 1 })
+	if got := d.dispatched(); got != 2 {
+		t.Errorf("dispatched = %d, want 2", got)
+	}
+}
@@ -0,0 +1,307 @@
+package scenario
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+)
+
+// oracleCandidate ベンチマーカーが持つデータから求めた、検索結果に含まれうるイスや物件
+type oracleCandidate struct {
+	ID         int64
+	Popularity int64
+	// Ambiguous リクエスト中に入稿や購入があり、検索結果に含まれるかどうか決まらない
+	Ambiguous bool
+}
+
+// rangeOf アプリケーションと同じく、range id を Ranges の添字として扱う
+func rangeOf(cond asset.RangeCondition, rangeID string) (*asset.Range, error) {
+	index, err := strconv.Atoi(rangeID)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || len(cond.Ranges) <= index {
+		return nil, fmt.Errorf("unexpected range id: %v", rangeID)
+
+	}
+	return cond.Ranges[index], nil
+}
+
+func inRange(r *asset.Range, v int64) bool {
+	if r == nil {
+		return true
+	}
+	if r.Min != -1 && v < r.Min {
+		return false
+	}
+	if r.Max != -1 && v >= r.Max {
+		return false
+	}
+	return true
+}
+
+func inList(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, l := range list {
+		if l == v {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFeatures features をカンマ区切りのトークン単位で完全一致させる
+func matchFeatures(features string, want []string, mode string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	has := make(map[string]bool)
+	for _, f := range strings.Split(features, ",") {
+		has[f] = true
+	}
+	for _, w := range want {
+		if mode == "any" && has[w] {
+			return true
+		}
+		if mode != "any" && !has[w] {
+			return false
+		}
+	}
+	return mode != "any"
+}
+
+func splitQuery(q url.Values, key string) []string {
+	if q.Get(key) == "" {
+		return nil
+	}
+	return strings.Split(q.Get(key), ",")
+}
+
+// parseRanges key ごとに range を解釈する。指定されていない key は nil になる
+func parseRanges(q url.Values, conds map[string]asset.RangeCondition) (map[string]*asset.Range, error) {
+	ranges := make(map[string]*asset.Range, len(conds))
+	for key, cond := range conds {
+		if q.Get(key) == "" {
+			continue
+		}
+		r, err := rangeOf(cond, q.Get(key))
+		if err != nil {
+			return nil, err
+		}
+		ranges[key] = r
+	}
+	return ranges, nil
+}
+
+func parsePaging(q url.Values) (int, int, error) {
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil {
+		return 0, 0, err
+	}
+	perPage, err := strconv.Atoi(q.Get("perPage"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return page, perPage, nil
+}
+
+// chairCandidates q に一致するイスを、t に始まったリクエストの時点で検索結果に含まれうるものに絞って返す
+func chairCandidates(q url.Values, t time.Time) ([]oracleCandidate, error) {
+	condition, err := asset.GetChairSearchCondition()
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := parseRanges(q, map[string]asset.RangeCondition{
+		"priceRangeId":  condition.Price,
+		"heightRangeId": condition.Height,
+		"widthRangeId":  condition.Width,
+		"depthRangeId":  condition.Depth,
+	})
+	if err != nil {
+		return nil, err
+	}
+	kinds := splitQuery(q, "kind")
+	colors := splitQuery(q, "color")
+	features := splitQuery(q, "features")
+	featureMode := q.Get("featureMode")
+
+	candidates := make([]oracleCandidate, 0)
+	for _, c := range asset.GetChairs() {
+		if !inRange(ranges["priceRangeId"], c.Price) ||
+			!inRange(ranges["heightRangeId"], c.Height) ||
+			!inRange(ranges["widthRangeId"], c.Width) ||
+			!inRange(ranges["depthRangeId"], c.Depth) ||
+			!inList(kinds, c.Kind) ||
+			!inList(colors, c.Color) ||
+			!matchFeatures(c.Features, features, featureMode) {
+			continue
+		}
+
+		ambiguous := !c.StoredBefore(t)
+		if c.GetStock() > 0 {
+			// 購入リクエストの結果を受け取る前に、アプリケーション側では売り切れているかもしれない
+			ambiguous = ambiguous || c.MaybeSoldOut()
+		} else {
+			soldOutTime := c.GetSoldOutTime()
+			if soldOutTime == nil || soldOutTime.Before(t) {
+				continue
+			}
+			// リクエスト中に売り切れたイスは、含まれていても含まれていなくてもよい
+			ambiguous = true
+		}
+
+		candidates = append(candidates, oracleCandidate{ID: c.ID, Popularity: c.GetPopularity(), Ambiguous: ambiguous})
+	}
+	return candidates, nil
+}
+
+// estateCandidates q に一致する物件を、t に始まったリクエストの時点で検索結果に含まれうるものに絞って返す
+func estateCandidates(q url.Values, t time.Time) ([]oracleCandidate, error) {
+	condition, err := asset.GetEstateSearchCondition()
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := parseRanges(q, map[string]asset.RangeCondition{
+		"doorHeightRangeId": condition.DoorHeight,
+		"doorWidthRangeId":  condition.DoorWidth,
+		"rentRangeId":       condition.Rent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	features := splitQuery(q, "features")
+	featureMode := q.Get("featureMode")
+
+	candidates := make([]oracleCandidate, 0)
+	for _, e := range asset.GetEstates() {
+		if !inRange(ranges["doorHeightRangeId"], e.DoorHeight) ||
+			!inRange(ranges["doorWidthRangeId"], e.DoorWidth) ||
+			!inRange(ranges["rentRangeId"], e.Rent) ||
+			!matchFeatures(e.Features, features, featureMode) {
+			continue
+		}
+		ambiguous := !e.StoredBefore(t)
+		candidates = append(candidates, oracleCandidate{ID: e.ID, Popularity: e.GetPopularity(), Ambiguous: ambiguous})
+	}
+	return candidates, nil
+}
+
+// checkSearchResult 検索結果を、候補から求めた結果と照合する
+// 含まれるかどうか決まらない候補があるため、件数とページの位置は上限と下限の範囲で確認する
+func checkSearchResult(candidates []oracleCandidate, ids []int64, count int64, page, perPage int) error {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Popularity != candidates[j].Popularity {
+			return candidates[i].Popularity > candidates[j].Popularity
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+
+	position := make(map[int64]int, len(candidates))
+	// definiteBefore[i] candidates[:i] に含まれる、必ず検索結果に含まれる候補の数
+	definiteBefore := make([]int, len(candidates)+1)
+	for i, c := range candidates {
+		position[c.ID] = i
+		definiteBefore[i+1] = definiteBefore[i]
+		if !c.Ambiguous {
+			definiteBefore[i+1]++
+		}
+	}
+	numOfDefinite := definiteBefore[len(candidates)]
+	numOfPossible := len(candidates)
+
+	if count < int64(numOfDefinite) || int64(numOfPossible) < count {
+		return newViolation(violationCount, "検索結果の件数が不正です: count %v", count)
+	}
+
+	offset := page * perPage
+	minLength := clamp(numOfDefinite-offset, 0, perPage)
+	maxLength := clamp(numOfPossible-offset, 0, perPage)
+	if len(ids) < minLength || maxLength < len(ids) {
+		return newViolation(violationCount, "検索結果の件数が不正です: page %v, length %v", page, len(ids))
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	prev := -1
+	for _, id := range ids {
+		i, ok := position[id]
+		if !ok {
+			return newViolation(violationMembership, "検索条件に一致しない結果が含まれています: ID %v", id)
+		}
+		if i <= prev {
+			return newViolation(violationOrder, "検索結果がpopularity順に並んでいません: ID %v", id)
+		}
+		if prev >= 0 && definiteBefore[i]-definiteBefore[prev+1] > 0 {
+			return newViolation(violationMembership, "検索結果に含まれるべき結果が欠けています: ID %v より前", id)
+		}
+		prev = i
+	}
+
+	first := position[ids[0]]
+	if offset < definiteBefore[first] || first < offset {
+		return newViolation(violationPage, "検索結果のページの位置が不正です: page %v", page)
+	}
+
+	if len(ids) < perPage && definiteBefore[numOfPossible]-definiteBefore[prev+1] > 0 {
+		return newViolation(violationMembership, "検索結果に含まれるべき結果が欠けています: ID %v より後", ids[len(ids)-1])
+	}
+
+	return nil
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// checkChairSearchResult t に始まったイスの検索リクエストの結果を、ベンチマーカーが持つイスと照合する
+func checkChairSearchResult(q url.Values, cr *client.ChairsResponse, t time.Time) error {
+	page, perPage, err := parsePaging(q)
+	if err != nil {
+		return nil
+	}
+	candidates, err := chairCandidates(q, t)
+	if err != nil {
+		// ベンチマーカーが解釈できない検索条件の場合は照合しない
+		return nil
+	}
+
+	ids := make([]int64, 0, len(cr.Chairs))
+	for _, c := range cr.Chairs {
+		ids = append(ids, c.ID)
+	}
+	return checkSearchResult(candidates, ids, cr.Count, page, perPage)
+}
+
+// checkEstateSearchResult t に始まった物件の検索リクエストの結果を、ベンチマーカーが持つ物件と照合する
+func checkEstateSearchResult(q url.Values, er *client.EstatesResponse, t time.Time) error {
+	page, perPage, err := parsePaging(q)
+	if err != nil {
+		return nil
+	}
+	candidates, err := estateCandidates(q, t)
+	if err != nil {
+		// ベンチマーカーが解釈できない検索条件の場合は照合しない
+		return nil
+	}
+
+	ids := make([]int64, 0, len(er.Estates))
+	for _, e := range er.Estates {
+		ids = append(ids, e.ID)
+	}
+	return checkSearchResult(candidates, ids, er.Count, page, perPage)
+}
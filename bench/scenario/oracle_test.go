@@ -0,0 +1,69 @@
+package scenario
+
+import (
+	"testing"
+)
+
+func Test_checkSearchResult(t *testing.T) {
+	// popularity順: 1, 2(ambiguous), 3, 4, 5
+	candidates := func() []oracleCandidate {
+		return []oracleCandidate{
+			{ID: 5, Popularity: 10},
+			{ID: 3, Popularity: 30},
+			{ID: 1, Popularity: 50},
+			{ID: 4, Popularity: 20},
+			{ID: 2, Popularity: 40, Ambiguous: true},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		ids     []int64
+		count   int64
+		page    int
+		perPage int
+		wantErr bool
+	}{
+		{name: "ambiguous included", ids: []int64{1, 2, 3}, count: 5, page: 0, perPage: 3},
+		{name: "ambiguous excluded", ids: []int64{1, 3, 4}, count: 4, page: 0, perPage: 3},
+		{name: "second page", ids: []int64{4, 5}, count: 5, page: 1, perPage: 3},
+		{name: "second page without ambiguous", ids: []int64{5}, count: 4, page: 1, perPage: 3},
+		{name: "unknown id", ids: []int64{1, 6, 3}, count: 5, page: 0, perPage: 3, wantErr: true},
+		{name: "wrong order", ids: []int64{3, 1, 4}, count: 5, page: 0, perPage: 3, wantErr: true},
+		{name: "missing definite", ids: []int64{1, 4, 5}, count: 4, page: 0, perPage: 3, wantErr: true},
+		{name: "count too small", ids: []int64{1, 3, 4}, count: 3, page: 0, perPage: 3, wantErr: true},
+		{name: "wrong page position", ids: []int64{1, 2, 3}, count: 5, page: 1, perPage: 3, wantErr: true},
+		{name: "short page", ids: []int64{1, 3}, count: 4, page: 0, perPage: 3, wantErr: true},
+		{name: "empty page", ids: []int64{}, count: 4, page: 0, perPage: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSearchResult(candidates(), tt.ids, tt.count, tt.page, tt.perPage)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSearchResult() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_matchFeatures(t *testing.T) {
+	tests := []struct {
+		features string
+		want     []string
+		mode     string
+		match    bool
+	}{
+		{features: "ソファー,スリッパ", want: nil, match: true},
+		{features: "ソファー,スリッパ", want: []string{"ソファー", "スリッパ"}, match: true},
+		{features: "ソファー,スリッパ", want: []string{"ソファー", "バス"}, match: false},
+		{features: "ソファー,スリッパ", want: []string{"ソファー", "バス"}, mode: "any", match: true},
+		{features: "ソファー,スリッパ", want: []string{"バス"}, mode: "any", match: false},
+		// 部分一致ではなくトークン単位で一致させる
+		{features: "バス・トイレ別", want: []string{"トイレ"}, match: false},
+	}
+	for _, tt := range tests {
+		if got := matchFeatures(tt.features, tt.want, tt.mode); got != tt.match {
+			t.Errorf("matchFeatures(%q, %q, %q) = %v, want %v", tt.features, tt.want, tt.mode, got, tt.match)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/evidence"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+	"github.com/morikuni/failure"
+)
+
+// ErrorClass シナリオが失敗した後、Workerがどれだけ待つかを決めるためのエラーの分類
+type ErrorClass int
+
+const (
+	// ErrorClassNone 待たずに次のシナリオを始める
+	ErrorClassNone ErrorClass = iota
+	// ErrorClassRateLimited 429 が返ってきたので Retry-After に従って待つ
+	ErrorClassRateLimited
+	// ErrorClassTimeout ユーザーが離脱したものとして待つ
+	ErrorClassTimeout
+	// ErrorClassFailure 失敗したシナリオの後と同じだけ待つ
+	ErrorClassFailure
+)
+
+// Scenario 負荷走行でWorkerが繰り返し実行するシナリオ
+type Scenario interface {
+	// Name 負荷プロファイルやタイムラインで使う名前
+	Name() string
+	// NewClient Workerやセッションが使うクライアントを作る
+	NewClient(rnd *rand.Rand) *client.Client
+	// RunOnce シナリオを1回実行する
+	RunOnce(ctx context.Context, c *client.Client, rnd *rand.Rand) error
+	// Classify RunOnce が返したエラーを分類する
+	Classify(err error) ErrorClass
+	// ThinkTime i 回目の RunOnce の前に待つ時間。ok が false なら Worker を終了する
+	ThinkTime(rnd *rand.Rand, i int) (d time.Duration, ok bool)
+}
+
+var (
+	registry   = map[string]Scenario{}
+	registryMu sync.RWMutex
+)
+
+// Register シナリオを登録する。同じ名前のシナリオは登録できない
+func Register(s Scenario) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[s.Name()]; ok {
+		panic(fmt.Sprintf("scenario: %s is already registered", s.Name()))
+	}
+	registry[s.Name()] = s
+}
+
+// Lookup 名前から登録されたシナリオを探す
+func Lookup(name string) (Scenario, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	s, ok := registry[name]
+	return s, ok
+}
+
+// Names 登録されたシナリオの名前を辞書順で返す
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateProfile 負荷プロファイルで指定されたシナリオがすべて登録されているか確認する
+func ValidateProfile(p parameter.Profile) error {
+	for i, level := range p.Levels {
+		for name := range level.IncWorkers {
+			if _, ok := Lookup(name); !ok {
+				return fmt.Errorf("levels[%d].inc_workers.%s: unknown scenario", i, name)
+			}
+		}
+	}
+	for name := range p.Arrival.Mix {
+		if _, ok := Lookup(name); !ok {
+			return fmt.Errorf("arrival.mix.%s: unknown scenario", name)
+		}
+	}
+	return nil
+}
+
+// failed シナリオの失敗として err を記録する
+// Worker が Retry-After やタイムアウトに応じて待てるように、元のエラーを包んで返す
+func failed(ctx context.Context, err error) error {
+	fails.Add(ctx, err)
+	return failure.Wrap(err)
+}
+
+// classifyError fails のエラーコードからエラーを分類する
+func classifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassNone
+	}
+	if _, ok := client.RetryAfterOf(err); ok {
+		return ErrorClassRateLimited
+	}
+	if code, _ := failure.CodeOf(err); code == fails.ErrTimeout {
+		return ErrorClassTimeout
+	}
+	return ErrorClassFailure
+}
+
+// backoff シナリオが失敗した後に待つ時間
+func backoff(rnd *rand.Rand, class ErrorClass, err error) time.Duration {
+	switch class {
+	case ErrorClassRateLimited:
+		retryAfter, _ := client.RetryAfterOf(err)
+		return sleepTimeOnRateLimited(rnd, retryAfter)
+	case ErrorClassTimeout:
+		r := rnd.Intn(parameter.SleepSwingOnUserAway) - parameter.SleepSwingOnUserAway/2
+		return parameter.SleepTimeOnFailScenario + time.Duration(r)*time.Millisecond
+	case ErrorClassFailure:
+		r := rnd.Intn(parameter.SleepSwingOnFailScenario) - parameter.SleepSwingOnFailScenario/2
+		return parameter.SleepTimeOnFailScenario + time.Duration(r)*time.Millisecond
+	default:
+		return 0
+	}
+}
+
+// sleepTimeOnRateLimited 429 が返ってきた場合の待ち時間。Retry-After がなければ失敗時と同じだけ待つ
+func sleepTimeOnRateLimited(rnd *rand.Rand, retryAfter time.Duration) time.Duration {
+	if retryAfter <= 0 {
+		return parameter.SleepTimeOnFailScenario
+	}
+	if retryAfter > parameter.MaxSleepTimeOnRateLimited {
+		return parameter.MaxSleepTimeOnRateLimited
+	}
+	r := rnd.Intn(parameter.SleepSwingOnUserAway)
+	return retryAfter + time.Duration(r)*time.Millisecond
+}
+
+// sleep ctx が終了した場合は false を返す
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		t.Stop()
+		return false
+	}
+}
+
+// runWorker ctx が終了するか ThinkTime が終了を指示するまで、シナリオを繰り返し実行する
+func runWorker(ctx context.Context, s Scenario, rnd *rand.Rand) {
+	defer WorkersFromContext(ctx).started(s.Name())()
+
+	ctx = score.WithScenario(ctx, s.Name())
+	c := s.NewClient(rnd)
+
+	for i := 0; ; i++ {
+		d, ok := s.ThinkTime(rnd, i)
+		if !ok || !sleep(ctx, d) {
+			return
+		}
+		err := s.RunOnce(evidence.WithSession(ctx), c, rnd)
+		if err == nil {
+			continue
+		}
+		if !sleep(ctx, backoff(rnd, s.Classify(err), err)) {
+			return
+		}
+	}
+}
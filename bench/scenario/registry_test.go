@@ -0,0 +1,20 @@
+package scenario
+
+import (
+	"testing"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+)
+
+func Test_ValidateProfile(t *testing.T) {
+	p := parameter.CurrentProfile()
+	if err := ValidateProfile(p); err != nil {
+		t.Fatalf("ValidateProfile() with the built-in profile: %v", err)
+	}
+
+	p.Levels = append([]parameter.Level{}, p.Levels...)
+	p.Levels[0] = parameter.Level{NextLevelScore: p.Levels[0].NextLevelScore, IncWorkers: parameter.IncWorkers{"unknown": 1}}
+	if err := ValidateProfile(p); err == nil {
+		t.Error("ValidateProfile() with an unknown scenario: want error")
+	}
+}
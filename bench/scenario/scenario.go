@@ -19,10 +19,10 @@ func Initialize(ctx context.Context) *client.InitializeResponse {
 	res, err := initialize(ctx)
 	if err != nil {
 		if ctx.Err() != nil {
-			err = failure.New(fails.ErrCritical, failure.Message("POST /initialize: リクエストがタイムアウトしました"))
-			fails.Add(err)
+			err = failure.New(fails.ErrCritical, fails.Message("INITIALIZE_REQUEST_TIMEOUT", "POST /initialize: リクエストがタイムアウトしました"))
+			fails.Add(ctx, err)
 		} else {
-			fails.Add(err)
+			fails.Add(ctx, err)
 		}
 	}
 	return res
@@ -34,7 +34,7 @@ func Validation(ctx context.Context) {
 	go Load(cancelCtx)
 
 	select {
-	case <-fails.Fail():
+	case <-fails.FromContext(ctx).Fail():
 		log.Println("fail条件を満たしました")
 		return
 	case <-cancelCtx.Done():
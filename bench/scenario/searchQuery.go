@@ -1,6 +1,7 @@
 package scenario
 
 import (
+	"context"
 	"math/rand"
 	"net/url"
 	"strconv"
@@ -11,21 +12,33 @@ import (
 	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
 )
 
-func randomTakeMany(slice []string, minLength, maxLength int) []string {
+func randomTakeMany(rnd *rand.Rand, slice []string, minLength, maxLength int) []string {
 	s := make([]string, len(slice))
 	copy(s, slice)
-	rand.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
-	length := rand.Intn(maxLength-minLength) + minLength
+	rnd.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+	length := rnd.Intn(maxLength-minLength) + minLength
 	return s[:length]
 }
 
-func createRandomChairSearchQuery() (url.Values, error) {
+// randomFeatureMode features の一致条件を選ぶ。指定しない場合はすべてに一致(all)として扱われる
+func randomFeatureMode(rnd *rand.Rand) string {
+	switch rnd.Intn(3) {
+	case 0:
+		return "all"
+	case 1:
+		return "any"
+	default:
+		return ""
+	}
+}
+
+func createRandomChairSearchQuery(ctx context.Context, rnd *rand.Rand) (url.Values, error) {
 	condition, err := asset.GetChairSearchCondition()
 	if err != nil {
 		return nil, err
 	}
 
-	level := score.GetLevel()
+	level := score.FromContext(ctx).GetLevel()
 	paramNum := int(level/2 + 1)
 
 	q := url.Values{}
@@ -33,52 +46,55 @@ func createRandomChairSearchQuery() (url.Values, error) {
 	q.Set("page", "0")
 
 	for i := 0; i < paramNum; i++ {
-		r := rand.Intn(9)
+		r := rnd.Intn(9)
 		if level >= 2 {
-			r += rand.Intn(1)
+			r += rnd.Intn(2)
 		}
 
 		switch r {
 		case 0, 1, 2:
-			priceRangeID := condition.Price.Ranges[rand.Intn(len(condition.Price.Ranges))].ID
+			priceRangeID := condition.Price.Ranges[rnd.Intn(len(condition.Price.Ranges))].ID
 			q.Set("priceRangeId", strconv.FormatInt(priceRangeID, 10))
 
 		case 3, 4:
-			heightRangeID := condition.Height.Ranges[rand.Intn(len(condition.Height.Ranges))].ID
+			heightRangeID := condition.Height.Ranges[rnd.Intn(len(condition.Height.Ranges))].ID
 			q.Set("heightRangeId", strconv.FormatInt(heightRangeID, 10))
 
 		case 5:
-			widthRangeID := condition.Width.Ranges[rand.Intn(len(condition.Width.Ranges))].ID
+			widthRangeID := condition.Width.Ranges[rnd.Intn(len(condition.Width.Ranges))].ID
 			q.Set("widthRangeId", strconv.FormatInt(widthRangeID, 10))
 
 		case 6:
-			depthRangeID := condition.Depth.Ranges[rand.Intn(len(condition.Depth.Ranges))].ID
+			depthRangeID := condition.Depth.Ranges[rnd.Intn(len(condition.Depth.Ranges))].ID
 			q.Set("depthRangeId", strconv.FormatInt(depthRangeID, 10))
 
 		case 7:
-			kind := condition.Kind.List[rand.Intn(len(condition.Kind.List))]
-			q.Set("kind", kind)
+			kinds := strings.Join(randomTakeMany(rnd, condition.Kind.List, 1, 3), ",")
+			q.Set("kind", kinds)
 
 		case 8:
-			color := condition.Color.List[rand.Intn(len(condition.Color.List))]
-			q.Set("color", color)
+			colors := strings.Join(randomTakeMany(rnd, condition.Color.List, 1, 3), ",")
+			q.Set("color", colors)
 
 		case 9:
-			features := strings.Join(randomTakeMany(condition.Feature.List, 1, 3), ",")
+			features := strings.Join(randomTakeMany(rnd, condition.Feature.List, 1, 3), ",")
 			q.Set("features", features)
+			if mode := randomFeatureMode(rnd); mode != "" {
+				q.Set("featureMode", mode)
+			}
 		}
 	}
 
 	return q, nil
 }
 
-func createRandomEstateSearchQuery() (url.Values, error) {
+func createRandomEstateSearchQuery(ctx context.Context, rnd *rand.Rand) (url.Values, error) {
 	condition, err := asset.GetEstateSearchCondition()
 	if err != nil {
 		return nil, err
 	}
 
-	level := score.GetLevel()
+	level := score.FromContext(ctx).GetLevel()
 	paramNum := int(level/2 + 1)
 
 	q := url.Values{}
@@ -86,27 +102,30 @@ func createRandomEstateSearchQuery() (url.Values, error) {
 	q.Set("page", "0")
 
 	for i := 0; i < paramNum; i++ {
-		r := rand.Intn(5)
+		r := rnd.Intn(5)
 		if level >= 2 {
-			r += rand.Intn(1)
+			r += rnd.Intn(2)
 		}
 
 		switch r {
 		case 0, 1, 2:
-			rentRangeID := condition.Rent.Ranges[rand.Intn(len(condition.Rent.Ranges))].ID
+			rentRangeID := condition.Rent.Ranges[rnd.Intn(len(condition.Rent.Ranges))].ID
 			q.Set("rentRangeId", strconv.FormatInt(rentRangeID, 10))
 
 		case 3:
-			doorHeightRangeID := condition.DoorHeight.Ranges[rand.Intn(len(condition.DoorHeight.Ranges))].ID
+			doorHeightRangeID := condition.DoorHeight.Ranges[rnd.Intn(len(condition.DoorHeight.Ranges))].ID
 			q.Set("doorHeightRangeId", strconv.FormatInt(doorHeightRangeID, 10))
 
 		case 4:
-			doorWidthRangeID := condition.DoorWidth.Ranges[rand.Intn(len(condition.DoorWidth.Ranges))].ID
+			doorWidthRangeID := condition.DoorWidth.Ranges[rnd.Intn(len(condition.DoorWidth.Ranges))].ID
 			q.Set("doorWidthRangeId", strconv.FormatInt(doorWidthRangeID, 10))
 
 		case 5:
-			features := strings.Join(randomTakeMany(condition.Feature.List, 1, 3), ",")
+			features := strings.Join(randomTakeMany(rnd, condition.Feature.List, 1, 3), ",")
 			q.Set("features", features)
+			if mode := randomFeatureMode(rnd); mode != "" {
+				q.Set("featureMode", mode)
+			}
 		}
 	}
 
@@ -6,11 +6,14 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/conformance"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
 	"github.com/morikuni/failure"
 	"golang.org/x/sync/errgroup"
 )
@@ -19,43 +22,37 @@ import (
 // 早い段階でベンチマークをFailさせて早期リターンさせるのが目的
 // ex) Search API を叩いて初期状態を確認する
 func Verify(ctx context.Context, dataDir, fixtureDir string) {
-	ctx, cancel := context.WithTimeout(ctx, parameter.VerifyTimeout)
-	defer cancel()
+	verify(ctx, dataDir, fixtureDir, parameter.VerifyTimeout, false)
+}
 
-	doneChan := make(chan bool)
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				close(doneChan)
-				return
-			case <-fails.Fail():
-			}
-		}
-	}()
+// VerifyConformance すべてのSnapshotを使って互換性チェックを行う
+// 結果は conformance パッケージに記録される
+func VerifyConformance(ctx context.Context, dataDir, fixtureDir string) {
+	verify(ctx, dataDir, fixtureDir, parameter.ConformanceTimeout, true)
+}
+
+func verify(ctx context.Context, dataDir, fixtureDir string, timeout time.Duration, allSnapshots bool) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
 	c := client.NewClientForVerify()
 
-	verifyWithSnapshot(ctx, c, filepath.Join(dataDir, "result/verification_data"))
+	verifyWithSnapshot(ctx, c, random.FromContext(ctx).New("verify", 0), filepath.Join(dataDir, "result/verification_data"), allSnapshots)
 	if ctx.Err() != nil {
-		err := failure.New(fails.ErrCritical, failure.Message("アプリケーション互換性チェックがタイムアウトしました"))
-		fails.Add(err)
+		err := failure.New(fails.ErrCritical, fails.Message("VERIFY_TIMEOUT", "アプリケーション互換性チェックがタイムアウトしました"))
+		fails.Add(ctx, err)
 	}
 
 	verifyWithScenario(ctx, c, fixtureDir, dataDir)
 	if ctx.Err() != nil {
-		err := failure.New(fails.ErrCritical, failure.Message("アプリケーション互換性チェックがタイムアウトしました"))
-		fails.Add(err)
+		err := failure.New(fails.ErrCritical, fails.Message("VERIFY_TIMEOUT", "アプリケーション互換性チェックがタイムアウトしました"))
+		fails.Add(ctx, err)
 	}
 
-	cancel()
-	<-doneChan
-	for {
-		select {
-		case <-fails.Fail():
-		default:
-			return
-		}
+	// 互換性チェック中の失格の通知が負荷走行に残らないよう捨てておく
+	select {
+	case <-fails.FromContext(ctx).Fail():
+	default:
 	}
 }
 
@@ -63,20 +60,20 @@ func verifyPostEstates(ctx context.Context, c *client.Client, estates []asset.Es
 	id := strconv.FormatInt(estates[0].ID, 10)
 	estate, err := c.GetEstateDetailFromID(ctx, id)
 	if err == nil {
-		return failure.Translate(err, fails.ErrApplication, failure.Message("未登録物件の詳細取得のレスポンスが不正です"))
+		return failure.Translate(err, fails.ErrApplication, fails.Message("UNREGISTERED_ESTATE_DETAIL_RESPONSE", "未登録物件の詳細取得のレスポンスが不正です"))
 	}
 
 	err = c.PostEstates(ctx, estates)
 	if err != nil {
-		return failure.Translate(err, fails.ErrApplication, failure.Message("物件のCSV入稿に失敗しました"))
+		return failure.Translate(err, fails.ErrApplication, fails.Message("ESTATE_CSV_POST", "物件のCSV入稿に失敗しました"))
 	}
 
 	estate, err = c.GetEstateDetailFromID(ctx, id)
 	if err != nil {
-		return failure.Translate(err, fails.ErrApplication, failure.Message("登録済み物件の詳細取得に失敗しました"))
+		return failure.Translate(err, fails.ErrApplication, fails.Message("REGISTERED_ESTATE_DETAIL_FAILED", "登録済み物件の詳細取得に失敗しました"))
 	}
 	if estate == nil {
-		return failure.New(fails.ErrApplication, failure.Message("登録済み物件の詳細取得に失敗しました"))
+		return failure.New(fails.ErrApplication, fails.Message("REGISTERED_ESTATE_DETAIL_FAILED", "登録済み物件の詳細取得に失敗しました"))
 	}
 
 	return nil
@@ -86,23 +83,23 @@ func verifyPostChairs(ctx context.Context, c *client.Client, chairs []asset.Chai
 	id := strconv.FormatInt(chairs[0].ID, 10)
 	chair, err := c.GetChairDetailFromID(ctx, id)
 	if err != nil {
-		return failure.Translate(err, fails.ErrApplication, failure.Message("未登録イスの詳細取得のレスポンスが不正です"))
+		return failure.Translate(err, fails.ErrApplication, fails.Message("UNREGISTERED_CHAIR_DETAIL_RESPONSE", "未登録イスの詳細取得のレスポンスが不正です"))
 	}
 	if chair != nil {
-		return failure.New(fails.ErrApplication, failure.Message("未登録イスの詳細取得のレスポンスの内容が不正です"))
+		return failure.New(fails.ErrApplication, fails.Message("UNREGISTERED_CHAIR_DETAIL_CONTENT", "未登録イスの詳細取得のレスポンスの内容が不正です"))
 	}
 
 	err = c.PostChairs(ctx, chairs)
 	if err != nil {
-		return failure.Translate(err, fails.ErrApplication, failure.Message("イスのCSV入稿に失敗しました"))
+		return failure.Translate(err, fails.ErrApplication, fails.Message("CHAIR_CSV_POST", "イスのCSV入稿に失敗しました"))
 	}
 
 	chair, err = c.GetChairDetailFromID(ctx, id)
 	if err != nil {
-		return failure.Translate(err, fails.ErrApplication, failure.Message("登録済みイスの詳細取得に失敗しました"))
+		return failure.Translate(err, fails.ErrApplication, fails.Message("REGISTERED_CHAIR_DETAIL_FAILED", "登録済みイスの詳細取得に失敗しました"))
 	}
 	if chair == nil {
-		return failure.New(fails.ErrApplication, failure.Message("登録済みイスの詳細取得に失敗しました"))
+		return failure.New(fails.ErrApplication, fails.Message("REGISTERED_CHAIR_DETAIL_FAILED", "登録済みイスの詳細取得に失敗しました"))
 	}
 
 	return nil
@@ -116,10 +113,10 @@ func verifyChairStock(ctx context.Context, c *client.Client, id int64) error {
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return ctxErr
 		}
-		return failure.Translate(err, fails.ErrApplication, failure.Message("イスの詳細取得に失敗しました"))
+		return failure.Translate(err, fails.ErrApplication, fails.Message("CHAIR_DETAIL_FAILED", "イスの詳細取得に失敗しました"))
 	}
 	if chair == nil {
-		return failure.New(fails.ErrApplication, failure.Message("在庫のあるはずのイスが売り切れになっています"))
+		return failure.New(fails.ErrApplication, fails.Message("CHAIR_IN_STOCK_SOLD_OUT", "在庫のあるはずのイスが売り切れになっています"))
 	}
 
 	err = c.BuyChair(ctx, strID)
@@ -127,7 +124,7 @@ func verifyChairStock(ctx context.Context, c *client.Client, id int64) error {
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return ctxErr
 		}
-		return failure.Translate(err, fails.ErrApplication, failure.Message("イスの購入に失敗しました"))
+		return failure.Translate(err, fails.ErrApplication, fails.Message("CHAIR_BUY_FAILED", "イスの購入に失敗しました"))
 	}
 
 	chair, err = c.GetChairDetailFromID(ctx, strID)
@@ -135,14 +132,14 @@ func verifyChairStock(ctx context.Context, c *client.Client, id int64) error {
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return ctxErr
 		}
-		return failure.Translate(err, fails.ErrApplication, failure.Message("売り切れたイスが存在します"))
+		return failure.Translate(err, fails.ErrApplication, fails.Message("CHAIR_SOLD_OUT_LISTED", "売り切れたイスが存在します"))
 	}
 
 	if chair != nil {
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return ctxErr
 		}
-		return failure.New(fails.ErrApplication, failure.Message("売り切れたイスの詳細が表示されています"))
+		return failure.New(fails.ErrApplication, fails.Message("CHAIR_SOLD_OUT_DETAIL", "売り切れたイスの詳細が表示されています"))
 	}
 
 	return nil
@@ -177,7 +174,7 @@ func verifyWithScenario(ctx context.Context, c *client.Client, fixtureDir, snaps
 	})
 
 	if err := eg.Wait(); err != nil {
-		fails.Add(failure.Translate(err, fails.ErrBenchmarker))
+		fails.Add(ctx, failure.Translate(err, fails.ErrBenchmarker))
 		return
 	}
 
@@ -186,8 +183,9 @@ func verifyWithScenario(ctx context.Context, c *client.Client, fixtureDir, snaps
 	go func() {
 		defer wg.Done()
 		err := verifyPostEstates(ctx, c, estates)
+		conformance.FromContext(ctx).Add(conformance.KindScenario, "POST /api/estate", "", err)
 		if err != nil {
-			fails.Add(err)
+			fails.Add(ctx, err)
 		}
 	}()
 
@@ -195,8 +193,9 @@ func verifyWithScenario(ctx context.Context, c *client.Client, fixtureDir, snaps
 	go func() {
 		defer wg.Done()
 		err := verifyPostChairs(ctx, c, chairs)
+		conformance.FromContext(ctx).Add(conformance.KindScenario, "POST /api/chair", "", err)
 		if err != nil {
-			fails.Add(err)
+			fails.Add(ctx, err)
 		}
 	}()
 
@@ -206,8 +205,9 @@ func verifyWithScenario(ctx context.Context, c *client.Client, fixtureDir, snaps
 	go func() {
 		defer wg.Done()
 		err := verifyChairStock(ctx, c, chairs[0].ID)
+		conformance.FromContext(ctx).Add(conformance.KindScenario, "POST /api/chair/buy/:id", "", err)
 		if err != nil {
-			fails.Add(err)
+			fails.Add(ctx, err)
 		}
 	}()
 
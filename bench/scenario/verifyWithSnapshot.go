@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"strconv"
@@ -17,7 +18,9 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/asset"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/client"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/conformance"
 	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
 	"github.com/morikuni/failure"
 )
 
@@ -76,12 +79,12 @@ func loadSnapshotFromFile(filePath string) (*Snapshot, error) {
 func verifyChairDetail(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/id: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_DETAIL_SNAPSHOT_READ", "GET /api/chair/id: Snapshotの読み込みに失敗しました"))
 	}
 
 	idx := strings.LastIndex(snapshot.Request.Resource, "/")
 	if idx == -1 || idx == len(snapshot.Request.Resource)-1 {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/:id: 不正なSnapshotです"), failure.Messagef("snapshot: %s", filePath))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_DETAIL_SNAPSHOT_INVALID", "GET /api/chair/:id: 不正なSnapshotです"), failure.Messagef("snapshot: %s", filePath))
 	}
 
 	id := snapshot.Request.Resource[idx+1:]
@@ -90,34 +93,34 @@ func verifyChairDetail(ctx context.Context, c *client.Client, filePath string) e
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/:id: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("CHAIR_DETAIL_INVALID_RESPONSE", "GET /api/chair/:id: レスポンスが不正です"))
 		}
 
 		var expected *asset.Chair
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/:id: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_DETAIL_SNAPSHOT_RESPONSE_BODY", "GET /api/chair/:id: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if actual == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/:id: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.New(fails.ErrApplication, fails.Message("CHAIR_DETAIL_INVALID_RESPONSE", "GET /api/chair/:id: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if !cmp.Equal(*expected, *actual, ignoreChairUnexported) {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/:id: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual, ignoreChairUnexported), fails.ErrApplication, fails.Message("CHAIR_DETAIL_INVALID_RESPONSE", "GET /api/chair/:id: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	case http.StatusNotFound:
 		if actual != nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/:id: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("CHAIR_DETAIL_INVALID_RESPONSE", "GET /api/chair/:id: レスポンスが不正です"))
 		}
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/:id: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("CHAIR_DETAIL_INVALID_RESPONSE", "GET /api/chair/:id: レスポンスが不正です"))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/:id: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("CHAIR_DETAIL_INVALID_RESPONSE", "GET /api/chair/:id: レスポンスが不正です"))
 		}
 	}
 
@@ -127,7 +130,7 @@ func verifyChairDetail(ctx context.Context, c *client.Client, filePath string) e
 func verifyChairSearchCondition(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/search/condition: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_SEARCH_CONDITION_SNAPSHOT_READ", "GET /api/chair/search/condition: Snapshotの読み込みに失敗しました"))
 	}
 
 	actual, err := c.GetChairSearchCondition(ctx)
@@ -135,22 +138,22 @@ func verifyChairSearchCondition(ctx context.Context, c *client.Client, filePath
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/search/condition: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("CHAIR_SEARCH_CONDITION_INVALID_RESPONSE", "GET /api/chair/search/condition: レスポンスが不正です"))
 		}
 
 		var expected *asset.ChairSearchCondition
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/search/condition: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_SEARCH_CONDITION_SNAPSHOT_RESPONSE_BODY", "GET /api/chair/search/condition: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if !cmp.Equal(*expected, *actual, ignoreChairUnexported) {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/search/condition: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual, ignoreChairUnexported), fails.ErrApplication, fails.Message("CHAIR_SEARCH_CONDITION_INVALID_RESPONSE", "GET /api/chair/search/condition: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/search/condition: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("CHAIR_SEARCH_CONDITION_INVALID_RESPONSE", "GET /api/chair/search/condition: レスポンスが不正です"))
 		}
 	}
 
@@ -160,12 +163,12 @@ func verifyChairSearchCondition(ctx context.Context, c *client.Client, filePath
 func verifyChairSearch(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/search: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_SEARCH_SNAPSHOT_READ", "GET /api/chair/search: Snapshotの読み込みに失敗しました"))
 	}
 
 	q, err := url.ParseQuery(snapshot.Request.Query)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/search: Request QueryのUnmarshalでエラーが発生しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_SEARCH_SNAPSHOT_REQUEST_QUERY", "GET /api/chair/search: Request QueryのUnmarshalでエラーが発生しました"))
 	}
 
 	actual, err := c.SearchChairsWithQuery(ctx, q)
@@ -173,22 +176,22 @@ func verifyChairSearch(ctx context.Context, c *client.Client, filePath string) e
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/search: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("CHAIR_SEARCH_INVALID_RESPONSE", "GET /api/chair/search: レスポンスが不正です"))
 		}
 
 		var expected *client.ChairsResponse
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/search: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_SEARCH_SNAPSHOT_RESPONSE_BODY", "GET /api/chair/search: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if !cmp.Equal(*expected, *actual, ignoreChairUnexported) {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/search: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual, ignoreChairUnexported), fails.ErrApplication, fails.Message("CHAIR_SEARCH_INVALID_RESPONSE", "GET /api/chair/search: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/search: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("CHAIR_SEARCH_INVALID_RESPONSE", "GET /api/chair/search: レスポンスが不正です"))
 		}
 	}
 
@@ -198,12 +201,12 @@ func verifyChairSearch(ctx context.Context, c *client.Client, filePath string) e
 func verifyEstateDetail(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/id: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_DETAIL_SNAPSHOT_READ", "GET /api/estate/id: Snapshotの読み込みに失敗しました"))
 	}
 
 	idx := strings.LastIndex(snapshot.Request.Resource, "/")
 	if idx == -1 || idx == len(snapshot.Request.Resource)-1 {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/:id: 不正なSnapshotです"), failure.Messagef("snapshot: %s", filePath))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_DETAIL_SNAPSHOT_INVALID", "GET /api/estate/:id: 不正なSnapshotです"), failure.Messagef("snapshot: %s", filePath))
 	}
 
 	id := snapshot.Request.Resource[idx+1:]
@@ -212,22 +215,22 @@ func verifyEstateDetail(ctx context.Context, c *client.Client, filePath string)
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/:id: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("ESTATE_DETAIL_INVALID_RESPONSE", "GET /api/estate/:id: レスポンスが不正です"))
 		}
 
 		var expected *asset.Estate
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/:id: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_DETAIL_SNAPSHOT_RESPONSE_BODY", "GET /api/estate/:id: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if !cmp.Equal(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude) {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/estate/:id: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude), fails.ErrApplication, fails.Message("ESTATE_DETAIL_INVALID_RESPONSE", "GET /api/estate/:id: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/estate/:id: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("ESTATE_DETAIL_INVALID_RESPONSE", "GET /api/estate/:id: レスポンスが不正です"))
 		}
 	}
 
@@ -237,7 +240,7 @@ func verifyEstateDetail(ctx context.Context, c *client.Client, filePath string)
 func verifyEstateSearchCondition(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/search/condition: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_SEARCH_CONDITION_SNAPSHOT_READ", "GET /api/estate/search/condition: Snapshotの読み込みに失敗しました"))
 	}
 
 	actual, err := c.GetEstateSearchCondition(ctx)
@@ -245,22 +248,22 @@ func verifyEstateSearchCondition(ctx context.Context, c *client.Client, filePath
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/search/condition: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("ESTATE_SEARCH_CONDITION_INVALID_RESPONSE", "GET /api/estate/search/condition: レスポンスが不正です"))
 		}
 
 		var expected *asset.EstateSearchCondition
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/search/condition: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_SEARCH_CONDITION_SNAPSHOT_RESPONSE_BODY", "GET /api/estate/search/condition: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if !cmp.Equal(*expected, *actual) {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/estate/search/condition: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual), fails.ErrApplication, fails.Message("ESTATE_SEARCH_CONDITION_INVALID_RESPONSE", "GET /api/estate/search/condition: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/estate/search/condition: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("ESTATE_SEARCH_CONDITION_INVALID_RESPONSE", "GET /api/estate/search/condition: レスポンスが不正です"))
 		}
 	}
 
@@ -270,12 +273,12 @@ func verifyEstateSearchCondition(ctx context.Context, c *client.Client, filePath
 func verifyEstateSearch(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/search: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_SEARCH_SNAPSHOT_READ", "GET /api/estate/search: Snapshotの読み込みに失敗しました"))
 	}
 
 	q, err := url.ParseQuery(snapshot.Request.Query)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/search: Request QueryのUnmarshalでエラーが発生しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_SEARCH_SNAPSHOT_REQUEST_QUERY", "GET /api/estate/search: Request QueryのUnmarshalでエラーが発生しました"))
 	}
 
 	actual, err := c.SearchEstatesWithQuery(ctx, q)
@@ -283,22 +286,22 @@ func verifyEstateSearch(ctx context.Context, c *client.Client, filePath string)
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/search: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("ESTATE_SEARCH_INVALID_RESPONSE", "GET /api/estate/search: レスポンスが不正です"))
 		}
 
 		var expected *client.EstatesResponse
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/search: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_SEARCH_SNAPSHOT_RESPONSE_BODY", "GET /api/estate/search: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if !cmp.Equal(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude) {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/estate/search: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude), fails.ErrApplication, fails.Message("ESTATE_SEARCH_INVALID_RESPONSE", "GET /api/estate/search: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/estate/search: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("ESTATE_SEARCH_INVALID_RESPONSE", "GET /api/estate/search: レスポンスが不正です"))
 		}
 	}
 
@@ -308,7 +311,7 @@ func verifyEstateSearch(ctx context.Context, c *client.Client, filePath string)
 func verifyLowPricedChair(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/low_priced: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_LOW_PRICED_SNAPSHOT_READ", "GET /api/chair/low_priced: Snapshotの読み込みに失敗しました"))
 	}
 
 	actual, err := c.GetLowPricedChair(ctx)
@@ -316,22 +319,22 @@ func verifyLowPricedChair(ctx context.Context, c *client.Client, filePath string
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/chair/low_priced: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("CHAIR_LOW_PRICED_INVALID_RESPONSE", "GET /api/chair/low_priced: レスポンスが不正です"))
 		}
 
 		var expected *client.ChairsResponse
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/low_priced: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_LOW_PRICED_SNAPSHOT_RESPONSE_BODY", "GET /api/chair/low_priced: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if !cmp.Equal(*expected, *actual, ignoreChairUnexported) {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/low_priced: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual, ignoreChairUnexported), fails.ErrApplication, fails.Message("CHAIR_LOW_PRICED_INVALID_RESPONSE", "GET /api/chair/low_priced: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/chair/low_priced: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("CHAIR_LOW_PRICED_INVALID_RESPONSE", "GET /api/chair/low_priced: レスポンスが不正です"))
 		}
 	}
 
@@ -341,7 +344,7 @@ func verifyLowPricedChair(ctx context.Context, c *client.Client, filePath string
 func verifyLowPricedEstate(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/low_priced: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_LOW_PRICED_SNAPSHOT_READ", "GET /api/estate/low_priced: Snapshotの読み込みに失敗しました"))
 	}
 
 	actual, err := c.GetLowPricedEstate(ctx)
@@ -349,22 +352,22 @@ func verifyLowPricedEstate(ctx context.Context, c *client.Client, filePath strin
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/estate/low_priced: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("ESTATE_LOW_PRICED_INVALID_RESPONSE", "GET /api/estate/low_priced: レスポンスが不正です"))
 		}
 
 		var expected *client.EstatesResponse
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/low_priced: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_LOW_PRICED_SNAPSHOT_RESPONSE_BODY", "GET /api/estate/low_priced: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if !cmp.Equal(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude) {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/estate/low_priced: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude), fails.ErrApplication, fails.Message("ESTATE_LOW_PRICED_INVALID_RESPONSE", "GET /api/estate/low_priced: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/estate/low_priced: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("ESTATE_LOW_PRICED_INVALID_RESPONSE", "GET /api/estate/low_priced: レスポンスが不正です"))
 		}
 	}
 
@@ -374,16 +377,16 @@ func verifyLowPricedEstate(ctx context.Context, c *client.Client, filePath strin
 func verifyRecommendedEstateWithChair(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/recommended_estate/:id: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("RECOMMENDED_ESTATE_SNAPSHOT_READ", "GET /api/recommended_estate/:id: Snapshotの読み込みに失敗しました"))
 	}
 
 	idx := strings.LastIndex(snapshot.Request.Resource, "/")
 	if idx == -1 || idx == len(snapshot.Request.Resource)-1 {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/recommended_estate/:id: 不正なSnapshotです"), failure.Messagef("snapshot: %s", filePath))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("RECOMMENDED_ESTATE_SNAPSHOT_INVALID", "GET /api/recommended_estate/:id: 不正なSnapshotです"), failure.Messagef("snapshot: %s", filePath))
 	}
 	id, err := strconv.ParseInt(snapshot.Request.Resource[idx+1:], 10, 64)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/recommended_estate/:id: 不正なSnapshotです"), failure.Messagef("snapshot: %s", filePath))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("RECOMMENDED_ESTATE_SNAPSHOT_INVALID", "GET /api/recommended_estate/:id: 不正なSnapshotです"), failure.Messagef("snapshot: %s", filePath))
 	}
 
 	actual, err := c.GetRecommendedEstatesFromChair(ctx, id)
@@ -391,21 +394,21 @@ func verifyRecommendedEstateWithChair(ctx context.Context, c *client.Client, fil
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("GET /api/recommended_estate/:id: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("RECOMMENDED_ESTATE_INVALID_RESPONSE", "GET /api/recommended_estate/:id: レスポンスが不正です"))
 		}
 
 		var expected *client.EstatesResponse
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/recommended_estate/:id: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("RECOMMENDED_ESTATE_SNAPSHOT_RESPONSE_BODY", "GET /api/recommended_estate/:id: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 		if !cmp.Equal(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude) {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/recommended_estate/:id: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude), fails.ErrApplication, fails.Message("RECOMMENDED_ESTATE_INVALID_RESPONSE", "GET /api/recommended_estate/:id: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("GET /api/recommended_estate/:id: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("RECOMMENDED_ESTATE_INVALID_RESPONSE", "GET /api/recommended_estate/:id: レスポンスが不正です"))
 		}
 	}
 
@@ -415,13 +418,13 @@ func verifyRecommendedEstateWithChair(ctx context.Context, c *client.Client, fil
 func verifyEstateNazotte(ctx context.Context, c *client.Client, filePath string) error {
 	snapshot, err := loadSnapshotFromFile(filePath)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("POST /api/estate/nazotte: Snapshotの読み込みに失敗しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_NAZOTTE_SNAPSHOT_READ", "POST /api/estate/nazotte: Snapshotの読み込みに失敗しました"))
 	}
 
 	var coordinates *client.Coordinates
 	err = json.Unmarshal([]byte(snapshot.Request.Body), &coordinates)
 	if err != nil {
-		return failure.Translate(err, fails.ErrBenchmarker, failure.Message("POST /api/estate/nazotte: Request BodyのUnmarshalでエラーが発生しました"))
+		return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_NAZOTTE_SNAPSHOT_REQUEST_BODY", "POST /api/estate/nazotte: Request BodyのUnmarshalでエラーが発生しました"))
 	}
 
 	actual, err := c.SearchEstatesNazotte(ctx, coordinates)
@@ -429,218 +432,258 @@ func verifyEstateNazotte(ctx context.Context, c *client.Client, filePath string)
 	switch snapshot.Response.StatusCode {
 	case http.StatusOK:
 		if err != nil {
-			return failure.Translate(err, fails.ErrApplication, failure.Message("POST /api/estate/nazotte: レスポンスが不正です"))
+			return failure.Translate(err, fails.ErrApplication, fails.Message("ESTATE_NAZOTTE_INVALID_RESPONSE", "POST /api/estate/nazotte: レスポンスが不正です"))
 		}
 
 		var expected *client.EstatesResponse
 		err = json.Unmarshal([]byte(snapshot.Response.Body), &expected)
 		if err != nil {
-			return failure.Translate(err, fails.ErrBenchmarker, failure.Message("POST /api/estate/nazotte: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_NAZOTTE_SNAPSHOT_RESPONSE_BODY", "POST /api/estate/nazotte: SnapshotのResponse BodyのUnmarshalでエラーが発生しました"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 		if !cmp.Equal(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude) {
-			return failure.New(fails.ErrApplication, failure.Message("POST /api/estate/nazotte: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
+			return failure.Translate(conformance.Mismatch(*expected, *actual, ignoreEstateUnexported, ignoreEstateLatitude, ignoreEstateLongitude), fails.ErrApplication, fails.Message("ESTATE_NAZOTTE_INVALID_RESPONSE", "POST /api/estate/nazotte: レスポンスが不正です"), failure.Messagef("snapshot: %s", filePath))
 		}
 
 	default:
 		if err == nil {
-			return failure.New(fails.ErrApplication, failure.Message("POST /api/estate/nazotte: レスポンスが不正です"))
+			return failure.New(fails.ErrApplication, fails.Message("ESTATE_NAZOTTE_INVALID_RESPONSE", "POST /api/estate/nazotte: レスポンスが不正です"))
 		}
 	}
 
 	return nil
 }
 
-func verifyWithSnapshot(ctx context.Context, c *client.Client, snapshotsParentsDirPath string) {
+// pickSnapshots 確認するSnapshotを選ぶ。all が true ならすべてのSnapshotを確認する
+func pickSnapshots(rnd *rand.Rand, snapshots []os.FileInfo, n int, all bool) []os.FileInfo {
+	if all {
+		return snapshots
+	}
+	picked := make([]os.FileInfo, 0, n)
+	for i := 0; i < n; i++ {
+		picked = append(picked, snapshots[rnd.Intn(len(snapshots))])
+	}
+	return picked
+}
+
+func verifyWithSnapshot(ctx context.Context, c *client.Client, rnd *rand.Rand, snapshotsParentsDirPath string, all bool) {
 	wg := sync.WaitGroup{}
 
+	// すべてのSnapshotを確認するときは、対象に送るリクエストが多くなりすぎないよう同時に確認する数を抑える
+	acquire, release := func() {}, func() {}
+	if all {
+		sem := make(chan struct{}, parameter.ConformanceConcurrency)
+		acquire = func() { sem <- struct{}{} }
+		release = func() { <-sem }
+	}
+
 	snapshotsDirPath := filepath.Join(snapshotsParentsDirPath, "chair_detail")
 	snapshots, err := ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/:id: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_DETAIL_SNAPSHOT_DIR_NOT_FOUND", "GET /api/chair/:id: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyChairDetail; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyChairDetail, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyChairDetail(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "GET /api/chair/:id", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
 	snapshotsDirPath = filepath.Join(snapshotsParentsDirPath, "chair_search_condition")
 	snapshots, err = ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/search/condition: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_SEARCH_CONDITION_SNAPSHOT_DIR_NOT_FOUND", "GET /api/chair/search/condition: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyChairSearchCondition; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyChairSearchCondition, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyChairSearchCondition(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "GET /api/chair/search/condition", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
 	snapshotsDirPath = filepath.Join(snapshotsParentsDirPath, "chair_search")
 	snapshots, err = ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/search: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_SEARCH_SNAPSHOT_DIR_NOT_FOUND", "GET /api/chair/search: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyChairSearch; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyChairSearch, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyChairSearch(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "GET /api/chair/search", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
 	snapshotsDirPath = filepath.Join(snapshotsParentsDirPath, "estate_detail")
 	snapshots, err = ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/:id: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_DETAIL_SNAPSHOT_DIR_NOT_FOUND", "GET /api/estate/:id: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyEstateDetail; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyEstateDetail, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyEstateDetail(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "GET /api/estate/:id", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
 	snapshotsDirPath = filepath.Join(snapshotsParentsDirPath, "estate_search_condition")
 	snapshots, err = ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/search/condition: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_SEARCH_CONDITION_SNAPSHOT_DIR_NOT_FOUND", "GET /api/estate/search/condition: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyEstateSearchCondition; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyEstateSearchCondition, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyEstateSearchCondition(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "GET /api/estate/search/condition", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
 	snapshotsDirPath = filepath.Join(snapshotsParentsDirPath, "estate_search")
 	snapshots, err = ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/search: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_SEARCH_SNAPSHOT_DIR_NOT_FOUND", "GET /api/estate/search: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyEstateSearch; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyEstateSearch, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyEstateSearch(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "GET /api/estate/search", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
 	snapshotsDirPath = filepath.Join(snapshotsParentsDirPath, "chair_low_priced")
 	snapshots, err = ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/chair/low_priced: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("CHAIR_LOW_PRICED_SNAPSHOT_DIR_NOT_FOUND", "GET /api/chair/low_priced: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyLowPricedChair; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyLowPricedChair, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyLowPricedChair(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "GET /api/chair/low_priced", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
 	snapshotsDirPath = filepath.Join(snapshotsParentsDirPath, "estate_low_priced")
 	snapshots, err = ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/estate/low_priced: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_LOW_PRICED_SNAPSHOT_DIR_NOT_FOUND", "GET /api/estate/low_priced: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyLowPricedEstate; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyLowPricedEstate, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyLowPricedEstate(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "GET /api/estate/low_priced", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
 	snapshotsDirPath = filepath.Join(snapshotsParentsDirPath, "recommended_estate_with_chair")
 	snapshots, err = ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("GET /api/recommended_estate/:id: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("RECOMMENDED_ESTATE_SNAPSHOT_DIR_NOT_FOUND", "GET /api/recommended_estate/:id: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyRecommendedEstateWithChair; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyRecommendedEstateWithChair, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyRecommendedEstateWithChair(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "GET /api/recommended_estate/:id", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
 	snapshotsDirPath = filepath.Join(snapshotsParentsDirPath, "estate_nazotte")
 	snapshots, err = ioutil.ReadDir(snapshotsDirPath)
 	if err != nil {
-		err := failure.Translate(err, fails.ErrBenchmarker, failure.Message("POST /api/estate/nazotte: Snapshotディレクトリがありません"))
-		fails.Add(err)
+		err := failure.Translate(err, fails.ErrBenchmarker, fails.Message("ESTATE_NAZOTTE_SNAPSHOT_DIR_NOT_FOUND", "POST /api/estate/nazotte: Snapshotディレクトリがありません"))
+		fails.Add(ctx, err)
 	} else {
-		for i := 0; i < NumOfVerifyEstateNazotte; i++ {
+		for _, snapshot := range pickSnapshots(rnd, snapshots, NumOfVerifyEstateNazotte, all) {
+			acquire()
 			wg.Add(1)
-			r := rand.Intn(len(snapshots))
 			go func(filePath string) {
 				err := verifyEstateNazotte(ctx, c, filePath)
+				conformance.FromContext(ctx).Add(conformance.KindSnapshot, "POST /api/estate/nazotte", filePath, err)
 				if err != nil {
-					fails.Add(err)
+					fails.Add(ctx, err)
 				}
+				release()
 				wg.Done()
-			}(path.Join(snapshotsDirPath, snapshots[r].Name()))
+			}(path.Join(snapshotsDirPath, snapshot.Name()))
 		}
 	}
 
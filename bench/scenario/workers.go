@@ -0,0 +1,131 @@
+package scenario
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/random"
+)
+
+// 組み込みのシナリオの名前。タイムラインの列名にも使われる
+const (
+	WorkerChairSearch         = "chair_search"
+	WorkerEstateSearch        = "estate_search"
+	WorkerEstateNazotteSearch = "estate_nazotte_search"
+	WorkerBot                 = "bot"
+	WorkerChairDraftPost      = "chair_draft_post"
+	WorkerEstateDraftPost     = "estate_draft_post"
+	// WorkerSession open model で実行中のセッション
+	WorkerSession = "session"
+)
+
+// WorkerNames 稼働数を数えるWorkerの種類。登録されたシナリオと open model のセッション
+func WorkerNames() []string {
+	return append(Names(), WorkerSession)
+}
+
+// Workers 1回のベンチマークで動いているWorkerの数と、種類ごとに起動したWorkerの数
+type Workers struct {
+	activeMu sync.Mutex
+	active   map[string]*int64
+
+	// remote 分散実行で agent ごとに動いているWorkerの数
+	remoteMu sync.Mutex
+	remote   map[string]map[string]int64
+
+	// seq 種類ごとに何番目に起動したWorkerかを数える
+	seqMu sync.Mutex
+	seq   map[string]int64
+}
+
+func NewWorkers() *Workers {
+	return &Workers{
+		active: map[string]*int64{},
+		remote: map[string]map[string]int64{},
+		seq:    map[string]int64{},
+	}
+}
+
+type workersKey struct{}
+
+// WithWorkers w を持つ context を返す
+func WithWorkers(ctx context.Context, w *Workers) context.Context {
+	return context.WithValue(ctx, workersKey{}, w)
+}
+
+// WorkersFromContext ctx が持つ Workers を返す。持っていなければ nil を返し、nil の Workers は何も数えない
+func WorkersFromContext(ctx context.Context) *Workers {
+	w, _ := ctx.Value(workersKey{}).(*Workers)
+	return w
+}
+
+func (w *Workers) activeCounter(name string) *int64 {
+	w.activeMu.Lock()
+	defer w.activeMu.Unlock()
+	n, ok := w.active[name]
+	if !ok {
+		n = new(int64)
+		w.active[name] = n
+	}
+	return n
+}
+
+// started 稼働中のWorkerの数を増やし、Worker終了時に呼ぶ関数を返す
+func (w *Workers) started(name string) func() {
+	if w == nil {
+		return func() {}
+	}
+	n := w.activeCounter(name)
+	atomic.AddInt64(n, 1)
+	return func() {
+		atomic.AddInt64(n, -1)
+	}
+}
+
+// SetRemote 分散実行で agent が動かしている種類ごとのWorkerの数を記録する
+func (w *Workers) SetRemote(agent string, workers map[string]int64) {
+	if w == nil {
+		return
+	}
+	w.remoteMu.Lock()
+	defer w.remoteMu.Unlock()
+	w.remote[agent] = workers
+}
+
+// Active 種類ごとの稼働中のWorkerの数。分散実行では agent のWorkerも含める
+func (w *Workers) Active() map[string]int64 {
+	names := WorkerNames()
+	workers := make(map[string]int64, len(names))
+	if w == nil {
+		for _, name := range names {
+			workers[name] = 0
+		}
+		return workers
+	}
+	for _, name := range names {
+		workers[name] = atomic.LoadInt64(w.activeCounter(name))
+	}
+
+	w.remoteMu.Lock()
+	defer w.remoteMu.Unlock()
+	for _, remote := range w.remote {
+		for _, name := range names {
+			workers[name] += remote[name]
+		}
+	}
+	return workers
+}
+
+// newWorkerRand Workerごとの乱数列を作る。同じシードと同じ負荷レベルの推移なら同じ乱数列になる
+func newWorkerRand(ctx context.Context, name string) *rand.Rand {
+	var index int64
+	if w := WorkersFromContext(ctx); w != nil {
+		w.seqMu.Lock()
+		index = w.seq[name]
+		w.seq[name]++
+		w.seqMu.Unlock()
+	}
+	return random.FromContext(ctx).New(name, index)
+}
@@ -1,45 +1,227 @@
 package score
 
 import (
+	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
 )
 
-var (
-	score     int64 = 0
-	level     int64 = 0
-	maxLevel  int64 = int64(len(parameter.BoundaryOfLevel)) - 1
+// LevelChange 負荷レベルの変化
+type LevelChange struct {
+	Time   time.Time `json:"time"`
+	Level  int64     `json:"level"`
+	Score  int64     `json:"score"`
+	Reason string    `json:"reason"`
+}
+
+// Gain シナリオとエンドポイントごとの加点
+type Gain struct {
+	// Scenario リクエストを送ったシナリオ。シナリオの外で送ったリクエストは空になる
+	Scenario string `json:"scenario"`
+	Endpoint string `json:"endpoint"`
+	// Count 成功したリクエストの数。重みが0のエンドポイントも数える
+	Count  int64 `json:"count"`
+	Points int64 `json:"points"`
+}
+
+type gainKey struct {
+	scenario string
+	endpoint string
+}
+
+// Score 1回のベンチマークのスコアと負荷レベルを管理する
+type Score struct {
+	score     int64
+	gains     map[gainKey]*Gain
+	level     int64
 	levelChan chan int64
-	mu        sync.RWMutex
-)
+	// holdUntil この時刻までは負荷レベルを上げない
+	holdUntil time.Time
+	// raiseAt 負荷レベルを下げたあと、スコアがこの値に達するまでは負荷レベルを上げない
+	raiseAt int64
+	history []LevelChange
+	// follower 加点の内訳だけを記録し、スコアと負荷レベルは Sync で受け取る
+	follower bool
+	mu       sync.RWMutex
+}
+
+func New() *Score {
+	return &Score{
+		gains:     make(map[gainKey]*Gain),
+		levelChan: make(chan int64, 1),
+		history:   make([]LevelChange, 0, 100),
+	}
+}
+
+// NewFollower 分散実行の agent が使う Score を作る
+// 加点の内訳だけを記録し、スコアと負荷レベルは coordinator が集計したものを Sync で受け取る
+func NewFollower() *Score {
+	s := New()
+	s.follower = true
+	return s
+}
+
+type contextKey struct{}
+
+// WithScore s を持つ context を返す
+func WithScore(ctx context.Context, s *Score) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext ctx が持つ Score を返す。持っていなければ nil を返す
+// nil の Score はスコアを数えず、負荷レベルは常に0になる
+func FromContext(ctx context.Context) *Score {
+	s, _ := ctx.Value(contextKey{}).(*Score)
+	return s
+}
+
+type scenarioKey struct{}
+
+// WithScenario 加点の内訳に記録するシナリオ名を持つ context を返す
+func WithScenario(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, scenarioKey{}, name)
+}
+
+// ScenarioOf ctx が持つシナリオ名を返す
+func ScenarioOf(ctx context.Context) string {
+	name, _ := ctx.Value(scenarioKey{}).(string)
+	return name
+}
+
+// Add ctx が持つ Score に、リクエストが成功したエンドポイントの重みだけ加点する
+func Add(ctx context.Context, endpoint string) {
+	FromContext(ctx).Add(ScenarioOf(ctx), endpoint)
+}
+
+// Add endpoint へのリクエストが成功したことを記録し、parameter.ScoreWeights の重みだけ加点する
+func (s *Score) Add(scenario, endpoint string) {
+	if s == nil {
+		return
+	}
+	points := parameter.ScoreWeights[endpoint]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := gainKey{scenario: scenario, endpoint: endpoint}
+	g, ok := s.gains[key]
+	if !ok {
+		g = &Gain{Scenario: scenario, Endpoint: endpoint}
+		s.gains[key] = g
+	}
+	g.Count++
+	g.Points += points
+	if points == 0 || s.follower {
+		return
+	}
+
+	s.score += points
+	maxLevel := int64(len(parameter.BoundaryOfLevel)) - 1
+	if s.level < maxLevel && s.score >= parameter.BoundaryOfLevel[s.level] && s.score >= s.raiseAt && !time.Now().Before(s.holdUntil) {
+		s.level++
+		s.history = append(s.history, LevelChange{Time: time.Now(), Level: s.level, Score: s.score, Reason: "score"})
+		// 受け取る側は GetLevel で現在のレベルを確認するため、通知が溜まっていれば捨ててよい
+		select {
+		case s.levelChan <- s.level:
+		default:
+		}
+	}
+}
+
+// Gains シナリオとエンドポイントごとの加点を、シナリオ名とエンドポイントの順に並べて返す
+func (s *Score) Gains() []Gain {
+	if s == nil {
+		return []Gain{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	gains := make([]Gain, 0, len(s.gains))
+	for _, g := range s.gains {
+		gains = append(gains, *g)
+	}
+	sort.Slice(gains, func(i, j int) bool {
+		if gains[i].Scenario != gains[j].Scenario {
+			return gains[i].Scenario < gains[j].Scenario
+		}
+		return gains[i].Endpoint < gains[j].Endpoint
+	})
+	return gains
+}
+
+// LevelDown 負荷レベルを1つ下げ、parameter.CooldownAfterLevelDown の間はレベルを上げないようにする
+// スコアは下げる前のレベルの境界を超えたままなので、下げたレベルの幅だけ新たに加点されるまではレベルを上げない
+func (s *Score) LevelDown(reason string) (int64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.level == 0 {
+		return s.level, false
+	}
+	s.level--
+	now := time.Now()
+	s.holdUntil = now.Add(parameter.CooldownAfterLevelDown)
+	s.raiseAt = s.score + levelWidth(s.level)
+	s.history = append(s.history, LevelChange{Time: now, Level: s.level, Score: s.score, Reason: reason})
+	return s.level, true
+}
+
+// levelWidth level から1つ上げるのに必要なスコアの幅
+func levelWidth(level int64) int64 {
+	if level == 0 {
+		return parameter.BoundaryOfLevel[0]
+	}
+	return parameter.BoundaryOfLevel[level] - parameter.BoundaryOfLevel[level-1]
+}
 
-func init() {
-	levelChan = make(chan int64, 1)
+// Sync coordinator が集計したスコアと負荷レベルに合わせる。NewFollower で作った Score で使う
+func (s *Score) Sync(score, level int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.score = score
+	s.level = level
 }
 
-func IncrementScore() {
-	mu.Lock()
-	defer mu.Unlock()
-	score++
-	if level < maxLevel && score >= parameter.BoundaryOfLevel[level] {
-		level++
-		levelChan <- level
+func (s *Score) GetScore() int64 {
+	if s == nil {
+		return 0
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.score
 }
 
-func GetScore() int64 {
-	mu.RLock()
-	defer mu.RUnlock()
-	return score
+func (s *Score) GetLevel() int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.level
 }
 
-func GetLevel() int64 {
-	mu.RLock()
-	defer mu.RUnlock()
-	return level
+// History 負荷レベルの変化の履歴
+func (s *Score) History() []LevelChange {
+	if s == nil {
+		return []LevelChange{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h := make([]LevelChange, len(s.history))
+	copy(h, s.history)
+	return h
 }
 
-func LevelUp() chan int64 {
-	return levelChan
+// LevelUp 負荷レベルが上がると通知されるチャネル
+func (s *Score) LevelUp() <-chan int64 {
+	if s == nil {
+		return nil
+	}
+	return s.levelChan
 }
@@ -0,0 +1,99 @@
+package score_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/parameter"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+)
+
+const scoredEndpoint = "POST /api/chair/buy/:id"
+
+func setLevelParameters(t *testing.T, cooldown time.Duration) {
+	boundary, weights, c := parameter.BoundaryOfLevel, parameter.ScoreWeights, parameter.CooldownAfterLevelDown
+	t.Cleanup(func() {
+		parameter.BoundaryOfLevel, parameter.ScoreWeights, parameter.CooldownAfterLevelDown = boundary, weights, c
+	})
+	parameter.BoundaryOfLevel = []int64{10, 20, 30, 40}
+	parameter.ScoreWeights = parameter.EndpointWeights{scoredEndpoint: 1}
+	parameter.CooldownAfterLevelDown = cooldown
+}
+
+func addPoints(s *score.Score, n int) {
+	for i := 0; i < n; i++ {
+		s.Add("", scoredEndpoint)
+	}
+}
+
+func TestLevelDown(t *testing.T) {
+	setLevelParameters(t, 0)
+	s := score.New()
+	if _, ok := s.LevelDown("p99"); ok {
+		t.Fatal("LevelDown() at level 0 returned ok")
+	}
+
+	steps := []struct {
+		name      string
+		points    int
+		levelDown string
+		wantLevel int64
+	}{
+		{name: "past boundaries", points: 25, wantLevel: 2},
+		{name: "level down", levelDown: "timeouts 11 > 10", wantLevel: 1},
+		// スコアはレベル1の境界 (20) を超えたままだが、レベル1の幅 (10) だけ加点されるまでは上げない
+		{name: "points below the width", points: 9, wantLevel: 1},
+		{name: "points past the width", points: 1, wantLevel: 2},
+		{name: "level down again", levelDown: "p99 2s > 1s", wantLevel: 1},
+		{name: "level down to 0", levelDown: "p99 2s > 1s", wantLevel: 0},
+		{name: "points below the width of level 0", points: 9, wantLevel: 0},
+		{name: "points past the width of level 0", points: 1, wantLevel: 1},
+		// 待つのは下げたレベルの分だけで、その上の境界はすでに超えていれば1点ごとに上げる
+		{name: "already past the next boundary", points: 1, wantLevel: 2},
+	}
+	for _, st := range steps {
+		addPoints(s, st.points)
+		if st.levelDown != "" {
+			level, ok := s.LevelDown(st.levelDown)
+			if !ok || level != st.wantLevel {
+				t.Fatalf("%s: LevelDown() = %d, %v, want %d, true", st.name, level, ok, st.wantLevel)
+			}
+			h := s.History()
+			if last := h[len(h)-1]; last.Level != st.wantLevel || last.Reason != st.levelDown {
+				t.Errorf("%s: last history = %+v", st.name, last)
+			}
+		}
+		if got := s.GetLevel(); got != st.wantLevel {
+			t.Fatalf("%s: level = %d, want %d", st.name, got, st.wantLevel)
+		}
+	}
+}
+
+func TestLevelDownCooldown(t *testing.T) {
+	cooldown := 50 * time.Millisecond
+	setLevelParameters(t, cooldown)
+	s := score.New()
+	addPoints(s, 20)
+	if _, ok := s.LevelDown("timeouts 11 > 10"); !ok {
+		t.Fatal("LevelDown() returned not ok")
+	}
+
+	// 幅を超えて加点されても、クールダウンの間は上げない
+	addPoints(s, 15)
+	if got := s.GetLevel(); got != 1 {
+		t.Fatalf("level during cooldown = %d, want 1", got)
+	}
+
+	time.Sleep(cooldown + 10*time.Millisecond)
+	addPoints(s, 1)
+	if got := s.GetLevel(); got != 2 {
+		t.Fatalf("level after cooldown = %d, want 2", got)
+	}
+}
+
+func TestLevelDownNil(t *testing.T) {
+	var s *score.Score
+	if level, ok := s.LevelDown("p99"); level != 0 || ok {
+		t.Errorf("LevelDown() = %d, %v, want 0, false", level, ok)
+	}
+}
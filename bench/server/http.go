@@ -0,0 +1,267 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// maxRequestBodySize ジョブの投入で受け付けるリクエストボディの大きさ
+	maxRequestBodySize = 1 << 20
+	// pollInterval 進捗を流す間に、ログとタイムラインの追記を確認する間隔
+	pollInterval = 500 * time.Millisecond
+)
+
+type handler struct {
+	q *Queue
+}
+
+// Handler ジョブを扱う HTTP API
+//
+//	POST   /jobs             ジョブを投入する
+//	GET    /jobs             ジョブの一覧
+//	GET    /jobs/:id         ジョブ
+//	DELETE /jobs/:id         ジョブを取り消す
+//	GET    /jobs/:id/report  結果の JSON
+//	GET    /jobs/:id/events  進捗 (Server-Sent Events)
+func Handler(q *Queue) http.Handler {
+	h := &handler{q: q}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", h.jobs)
+	mux.HandleFunc("/jobs/", h.job)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (h *handler) jobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.q.List())
+	case http.MethodPost:
+		var req Request
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		job, err := h.q.Add(req)
+		if err != nil {
+			var invalid invalidRequestError
+			if errors.As(err, &invalid) {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusCreated, job)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+	}
+}
+
+// job /jobs/:id と /jobs/:id/report, /jobs/:id/events
+func (h *handler) job(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	id, sub := parts[0], ""
+	if len(parts) == 2 {
+		sub = parts[1]
+	}
+	if len(parts) > 2 {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	job, ok := h.q.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, job)
+	case sub == "" && r.Method == http.MethodDelete:
+		job, err := h.q.Cancel(id)
+		switch err {
+		case nil:
+			writeJSON(w, http.StatusAccepted, job)
+		case errFinished:
+			writeError(w, http.StatusConflict, err)
+		default:
+			writeError(w, http.StatusInternalServerError, err)
+		}
+	case sub == "report" && r.Method == http.MethodGet:
+		h.report(w, job)
+	case sub == "events" && r.Method == http.MethodGet:
+		h.events(w, r, id)
+	case sub == "" || sub == "report" || sub == "events":
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+	}
+}
+
+func (h *handler) report(w http.ResponseWriter, job Job) {
+	if job.Status != StatusDone {
+		writeError(w, http.StatusConflict, fmt.Errorf("job is %s", job.Status))
+		return
+	}
+	f, err := os.Open(h.q.path(job.ID, reportFile))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("failed to write report: %v", err)
+	}
+}
+
+// tail 追記されるファイルを、前回読んだところから行ごとに読む
+type tail struct {
+	path   string
+	offset int64
+	// rest 改行で終わっていない書きかけの行
+	rest []byte
+}
+
+func (t *tail) lines() ([]string, error) {
+	f, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < t.offset {
+		// ジョブを実行し直すと最初から書き直される
+		t.offset, t.rest = 0, nil
+	}
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	t.offset += int64(len(b))
+
+	b = append(t.rest, b...)
+	i := bytes.LastIndexByte(b, '\n')
+	if i < 0 {
+		t.rest = b
+		return nil, nil
+	}
+	t.rest = append([]byte{}, b[i+1:]...)
+	return strings.Split(string(b[:i]), "\n"), nil
+}
+
+func writeEvent(w io.Writer, event, data string) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// events ジョブの進捗を Server-Sent Events で流す。ジョブが終わるか接続が切れるまで続ける
+//
+//	job     ジョブ。接続したときと状態が変わったときに送る
+//	log     ベンチマーカーのログの1行
+//	sample  タイムラインの1秒ごとの状態 (timeline.Sample の JSON)
+//
+// 接続する前のログとタイムラインも最初から送る
+func (h *handler) events(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	sources := []struct {
+		event string
+		tail  *tail
+	}{
+		{"log", &tail{path: h.q.path(id, logFile)}},
+		{"sample", &tail{path: h.q.path(id, timelineFile)}},
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var last Status
+	for {
+		changed := h.q.Changed()
+		job, _ := h.q.Get(id)
+		if last == "" {
+			if err := sendJob(w, job); err != nil {
+				return
+			}
+		}
+		// ジョブが終わったときには出力も書き終わっているので、ここで読めば取りこぼさない
+		for _, s := range sources {
+			lines, err := s.tail.lines()
+			if err != nil {
+				log.Printf("failed to read %s: %v", s.tail.path, err)
+			}
+			for _, line := range lines {
+				if err := writeEvent(w, s.event, line); err != nil {
+					return
+				}
+			}
+		}
+		if last != "" && job.Status != last {
+			if err := sendJob(w, job); err != nil {
+				return
+			}
+		}
+		last = job.Status
+		flusher.Flush()
+
+		if job.Status.finished() {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+func sendJob(w io.Writer, job Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return writeEvent(w, "job", string(b))
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Status ジョブの状態
+type Status string
+
+const (
+	// StatusQueued 実行を待っている
+	StatusQueued Status = "queued"
+	// StatusRunning 実行している
+	StatusRunning Status = "running"
+	// StatusDone ベンチマークが終わり、結果が保存された (結果が合格とは限らない)
+	StatusDone Status = "done"
+	// StatusFailed ベンチマーカーが結果を出力せずに終了した
+	StatusFailed Status = "failed"
+	// StatusCanceled 実行前か実行中に取り消された
+	StatusCanceled Status = "canceled"
+)
+
+// finished s がこれ以上変わらない状態か
+func (s Status) finished() bool {
+	return s == StatusDone || s == StatusFailed || s == StatusCanceled
+}
+
+// ジョブのディレクトリに置くファイル
+const (
+	jobFile         = "job.json"
+	profileJSONFile = "profile.json"
+	profileYAMLFile = "profile.yaml"
+	reportFile      = "report.json"
+	timelineFile    = "timeline.jsonl"
+	logFile         = "bench.log"
+)
+
+// Request ジョブの投入で受け付ける内容
+type Request struct {
+	TargetURL string `json:"target_url"`
+	// Profile 負荷プロファイル。JSON のオブジェクトか、YAML の文字列で指定する。省略すると組み込みのものを使う
+	Profile json.RawMessage `json:"profile,omitempty"`
+	// Seed 乱数のシード。0 なら投入時に決める
+	Seed int64 `json:"seed"`
+}
+
+// Job 1回のベンチマーク。ジョブのディレクトリの job.json に保存する
+type Job struct {
+	ID        string `json:"id"`
+	TargetURL string `json:"target_url"`
+	Seed      int64  `json:"seed"`
+	// ProfileFile ジョブのディレクトリにある負荷プロファイルのファイル名。組み込みのものを使う場合は空
+	ProfileFile string     `json:"profile_file,omitempty"`
+	Status      Status     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	// Pass, Score, Reason 結果の要約。StatusDone のときだけ入る
+	Pass   *bool  `json:"pass,omitempty"`
+	Score  *int64 `json:"score,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Error StatusFailed になった理由
+	Error string `json:"error,omitempty"`
+}
+
+// summary 結果の JSON のうち Job に載せる項目
+type summary struct {
+	Pass   bool   `json:"pass"`
+	Score  int64  `json:"score"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	errNotFound = errors.New("job not found")
+	errFinished = errors.New("job is already finished")
+)
+
+// invalidRequestError 投入されたジョブの内容が不正であることを表す
+type invalidRequestError struct {
+	err error
+}
+
+func (e invalidRequestError) Error() string {
+	return e.err.Error()
+}
+
+// Queue ディスクに保存するジョブの待ち行列。ジョブは dir/<id> のディレクトリに1つずつ置く
+// ベンチマーカーはグローバルな状態を持つので、ジョブは投入された順に1つずつ実行する
+type Queue struct {
+	dir string
+	// validateProfile 負荷プロファイルのファイルを検証する。nil なら検証しない
+	validateProfile func(path string) error
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	nextID int
+	// changed ジョブの状態が変わるたびに close して作り直す
+	changed chan struct{}
+	// cancels 実行中のジョブを止める
+	cancels map[string]context.CancelFunc
+	// canceled 実行中に取り消されたジョブ
+	canceled map[string]bool
+}
+
+// Open dir に保存されたジョブを読み込む。実行中のまま終わっていたジョブは、最初から実行し直すために待ち行列に戻す
+func Open(dir string, validateProfile func(path string) error) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &Queue{
+		dir:             dir,
+		validateProfile: validateProfile,
+		jobs:            make(map[string]*Job),
+		nextID:          1,
+		changed:         make(chan struct{}),
+		cancels:         make(map[string]context.CancelFunc),
+		canceled:        make(map[string]bool),
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, info.Name(), jobFile))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		job := &Job{}
+		if err := json.Unmarshal(b, job); err != nil {
+			return nil, fmt.Errorf("%s: %v", info.Name(), err)
+		}
+		if job.Status == StatusRunning {
+			if err := q.requeue(job); err != nil {
+				return nil, err
+			}
+		}
+		q.jobs[job.ID] = job
+		if n, err := strconv.Atoi(job.ID); err == nil && n >= q.nextID {
+			q.nextID = n + 1
+		}
+	}
+	return q, nil
+}
+
+func (q *Queue) path(id, name string) string {
+	return filepath.Join(q.dir, id, name)
+}
+
+// save job を job.json に書き出す。書きかけのファイルが残らないように書き出してから置き換える
+func (q *Queue) save(job *Job) error {
+	b, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := q.path(job.ID, jobFile+".tmp")
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path(job.ID, jobFile))
+}
+
+// requeue 実行が途中で止まったジョブを待ち行列に戻し、途中までの出力を消す
+func (q *Queue) requeue(job *Job) error {
+	for _, name := range []string{reportFile, timelineFile, logFile} {
+		if err := os.Remove(q.path(job.ID, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	job.Status = StatusQueued
+	job.StartedAt = nil
+	return q.save(job)
+}
+
+// notify 状態の変化を待っているものを起こす。q.mu を持って呼ぶ
+func (q *Queue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Changed 次にジョブの状態が変わったときに close される channel を返す
+func (q *Queue) Changed() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.changed
+}
+
+func validateTargetURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("target_url: unsupported scheme: %s", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("target_url: host is required: %s", s)
+	}
+	return nil
+}
+
+// writeProfile 負荷プロファイルを一時ファイルに書き出して検証し、ファイルのパスと拡張子を返す
+func (q *Queue) writeProfile(raw json.RawMessage) (string, string, error) {
+	ext := ".json"
+	b := []byte(raw)
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		// 文字列で渡されたものは YAML として扱う
+		ext, b = ".yaml", []byte(s)
+	}
+
+	f, err := ioutil.TempFile(q.dir, "profile-*"+ext)
+	if err != nil {
+		return "", "", err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+
+	if q.validateProfile != nil {
+		if err := q.validateProfile(f.Name()); err != nil {
+			os.Remove(f.Name())
+			return "", "", invalidRequestError{fmt.Errorf("profile: %v", err)}
+		}
+	}
+	return f.Name(), ext, nil
+}
+
+// Add ジョブを検証して待ち行列の最後に加える
+func (q *Queue) Add(req Request) (Job, error) {
+	if err := validateTargetURL(req.TargetURL); err != nil {
+		return Job{}, invalidRequestError{err}
+	}
+	profilePath, ext := "", ""
+	if len(req.Profile) > 0 && string(req.Profile) != "null" {
+		var err error
+		profilePath, ext, err = q.writeProfile(req.Profile)
+		if err != nil {
+			return Job{}, err
+		}
+		defer os.Remove(profilePath)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := &Job{
+		ID:        fmt.Sprintf("%06d", q.nextID),
+		TargetURL: req.TargetURL,
+		Seed:      req.Seed,
+		Status:    StatusQueued,
+		CreatedAt: time.Now(),
+	}
+	if job.Seed == 0 {
+		job.Seed = time.Now().UnixNano()
+	}
+	if err := os.Mkdir(filepath.Join(q.dir, job.ID), 0755); err != nil {
+		return Job{}, err
+	}
+	q.nextID++
+	if profilePath != "" {
+		if ext == ".json" {
+			job.ProfileFile = profileJSONFile
+		} else {
+			job.ProfileFile = profileYAMLFile
+		}
+		if err := os.Rename(profilePath, q.path(job.ID, job.ProfileFile)); err != nil {
+			return Job{}, err
+		}
+	}
+	if err := q.save(job); err != nil {
+		return Job{}, err
+	}
+
+	q.jobs[job.ID] = job
+	q.notify()
+	return *job, nil
+}
+
+// Get id のジョブを返す
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List すべてのジョブを投入された順に返す
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// Cancel id のジョブを取り消す。実行中であればベンチマーカーを止める
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, errNotFound
+	}
+	switch job.Status {
+	case StatusQueued:
+		now := time.Now()
+		job.Status = StatusCanceled
+		job.FinishedAt = &now
+		if err := q.save(job); err != nil {
+			return Job{}, err
+		}
+		q.notify()
+	case StatusRunning:
+		// 状態はベンチマーカーが止まってから Run が変える
+		q.canceled[id] = true
+		q.cancels[id]()
+	default:
+		return *job, errFinished
+	}
+	return *job, nil
+}
+
+// start 最も前に投入された待ち状態のジョブを実行中にする。なければ nil を返す
+func (q *Queue) start(ctx context.Context) (*Job, context.Context, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var next *Job
+	for _, job := range q.jobs {
+		if job.Status == StatusQueued && (next == nil || job.ID < next.ID) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil, nil
+	}
+
+	now := time.Now()
+	next.Status = StatusRunning
+	next.StartedAt = &now
+	if err := q.save(next); err != nil {
+		return nil, nil, err
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+	q.cancels[next.ID] = cancel
+	q.notify()
+	job := *next
+	return &job, jobCtx, nil
+}
+
+// finish 実行を終えたジョブの状態を err と結果の JSON から決める
+// ctx が終了していれば、サーバーを止めたものとして待ち行列に戻す
+func (q *Queue) finish(ctx context.Context, id string, err error) error {
+	var sum summary
+	if err == nil {
+		var b []byte
+		b, err = ioutil.ReadFile(q.path(id, reportFile))
+		if err == nil {
+			err = json.Unmarshal(b, &sum)
+		}
+		if err != nil {
+			err = fmt.Errorf("invalid report: %v", err)
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.jobs[id]
+	q.cancels[id]()
+	delete(q.cancels, id)
+	canceled := q.canceled[id]
+	delete(q.canceled, id)
+	defer q.notify()
+
+	if !canceled && ctx.Err() != nil {
+		return q.requeue(job)
+	}
+
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case canceled:
+		job.Status = StatusCanceled
+	case err != nil:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	default:
+		job.Status = StatusDone
+		job.Pass, job.Score, job.Reason = &sum.Pass, &sum.Score, sum.Reason
+	}
+	return q.save(job)
+}
+
+// Run ctx が終了するまで、待ち状態のジョブを1つずつ run で実行する
+func (q *Queue) Run(ctx context.Context, run Runner) error {
+	for {
+		changed := q.Changed()
+		job, jobCtx, err := q.start(ctx)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+				continue
+			}
+		}
+
+		err = run(jobCtx, *job, filepath.Join(q.dir, job.ID))
+		if err := q.finish(ctx, job.ID, err); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
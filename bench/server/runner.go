@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// Runner ジョブを1つ実行し、ジョブのディレクトリ dir に結果の JSON、タイムライン、ログを書き出す
+// ctx が終了したらすぐに実行をやめる
+type Runner func(ctx context.Context, job Job, dir string) error
+
+// Command ベンチマーカーの実行ファイル path を子プロセスとして実行する Runner を返す
+// args は -data-dir のようにすべてのジョブに共通する引数
+// 負荷プロファイルやシードの設定が前のジョブから残らないように、ジョブごとにプロセスを分ける
+func Command(path string, args ...string) Runner {
+	return func(ctx context.Context, job Job, dir string) error {
+		report, err := os.Create(filepath.Join(dir, reportFile))
+		if err != nil {
+			return err
+		}
+		defer report.Close()
+		log, err := os.Create(filepath.Join(dir, logFile))
+		if err != nil {
+			return err
+		}
+		defer log.Close()
+
+		a := append([]string{}, args...)
+		a = append(a,
+			"-target-url", job.TargetURL,
+			"-seed", strconv.FormatInt(job.Seed, 10),
+			"-timeline", filepath.Join(dir, timelineFile),
+		)
+		if job.ProfileFile != "" {
+			a = append(a, "-profile", filepath.Join(dir, job.ProfileFile))
+		}
+
+		cmd := exec.CommandContext(ctx, path, a...)
+		cmd.Stdout = report
+		cmd.Stderr = log
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("benchmarker exited: %v", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// fakeRunner ベンチマーカーの代わりにログ、タイムライン、結果の JSON を書き出す
+func fakeRunner(ctx context.Context, job Job, dir string) error {
+	files := map[string]string{
+		logFile:      "=== initialize ===\n=== validation ===\n",
+		timelineFile: `{"elapsed":1,"score":10,"level":0}` + "\n" + `{"elapsed":2,"score":30,"level":1}` + "\n",
+		reportFile:   `{"pass":true,"score":30,"reason":"OK","seed":` + jsonNumber(job.Seed) + "}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jsonNumber(n int64) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func waitFor(t *testing.T, q *Queue, id string, status Status) Job {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		changed := q.Changed()
+		if job, _ := q.Get(id); job.Status == status {
+			return job
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			job, _ := q.Get(id)
+			t.Fatalf("job %s is %s, want %s", id, job.Status, status)
+		}
+	}
+}
+
+func TestQueueIsPersistent(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := q.Add(Request{TargetURL: "http://localhost:1323", Profile: json.RawMessage(`{"control":{"mode":"ratchet"}}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.Add(Request{TargetURL: "http://localhost:1323", Seed: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Seed == 0 || second.Seed != 42 || first.ProfileFile != profileJSONFile {
+		t.Errorf("unexpected jobs: %+v, %+v", first, second)
+	}
+
+	// 実行中にサーバーが止まったものとして、最初のジョブを途中まで実行する
+	if _, _, err := q.start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(q.path(first.ID, logFile), []byte("=== initialize ===\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := q.List()
+	if len(jobs) != 2 || jobs[0].ID != first.ID || jobs[1].ID != second.ID {
+		t.Fatalf("unexpected jobs after reopen: %+v", jobs)
+	}
+	if jobs[0].Status != StatusQueued || jobs[0].StartedAt != nil {
+		t.Errorf("interrupted job is not requeued: %+v", jobs[0])
+	}
+	if _, err := os.Stat(q.path(first.ID, logFile)); !os.IsNotExist(err) {
+		t.Errorf("output of interrupted job is left: %v", err)
+	}
+	if third, err := q.Add(Request{TargetURL: "http://localhost:1323"}); err != nil || third.ID <= second.ID {
+		t.Errorf("Add() after reopen = %+v, %v", third, err)
+	}
+}
+
+func TestQueueCancelsRunningJob(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx, func(ctx context.Context, job Job, dir string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	job, err := q.Add(Request{TargetURL: "http://localhost:1323"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, q, job.ID, StatusRunning)
+	if _, err := q.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, q, job.ID, StatusCanceled)
+	if _, err := q.Cancel(job.ID); err != errFinished {
+		t.Errorf("Cancel() of canceled job = %v, want %v", err, errFinished)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, func(path string) error {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(b, []byte("unknown")) {
+			return errors.New("unknown scenario")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx, fakeRunner)
+	ts := httptest.NewServer(Handler(q))
+	defer ts.Close()
+
+	for _, body := range []string{
+		`{"target_url":"localhost:1323"}`,
+		`{"target_url":"http://localhost:1323","profile":"arrival:\n  mix:\n    unknown: 1\n"}`,
+		`{"target_url":"http://localhost:1323","unknown":1}`,
+	} {
+		res, err := http.Post(ts.URL+"/jobs", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST /jobs %s = %d, want %d", body, res.StatusCode, http.StatusBadRequest)
+		}
+	}
+
+	res, err := http.Post(ts.URL+"/jobs", "application/json", strings.NewReader(`{"target_url":"http://localhost:1323","profile":"control:\n  mode: ratchet\n","seed":7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job Job
+	err = json.NewDecoder(res.Body).Decode(&job)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusCreated || job.Seed != 7 || job.ProfileFile != profileYAMLFile {
+		t.Fatalf("POST /jobs = %d, %+v", res.StatusCode, job)
+	}
+
+	// 進捗はジョブが終わるまで流れる
+	res, err = http.Get(ts.URL + "/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(map[string]int)
+	var last Job
+	sc := bufio.NewScanner(res.Body)
+	event := ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+			events[event]++
+		case strings.HasPrefix(line, "data: ") && event == "job":
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &last); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	res.Body.Close()
+	if events["log"] != 2 || events["sample"] != 2 {
+		t.Errorf("events = %v", events)
+	}
+	if last.Status != StatusDone || last.Score == nil || *last.Score != 30 || last.Pass == nil || !*last.Pass {
+		t.Errorf("last job event = %+v", last)
+	}
+
+	res, err = http.Get(ts.URL + "/jobs/" + job.ID + "/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report map[string]interface{}
+	err = json.NewDecoder(res.Body).Decode(&report)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report["seed"] != float64(7) {
+		t.Errorf("GET /jobs/%s/report = %v", job.ID, report)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"/jobs/"+job.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("DELETE /jobs/%s = %d, want %d", job.ID, res.StatusCode, http.StatusConflict)
+	}
+
+	res, err = http.Get(ts.URL + "/jobs/999999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /jobs/999999 = %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+}
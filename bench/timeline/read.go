@@ -0,0 +1,88 @@
+package timeline
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Read Run が format で書き出したタイムラインを読み込む
+func Read(r io.Reader, format string) ([]Sample, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(r)
+	case FormatJSONL:
+		return readJSONL(r)
+	default:
+		return nil, fmt.Errorf("unsupported timeline format: %s", format)
+	}
+}
+
+func readJSONL(r io.Reader) ([]Sample, error) {
+	samples := make([]Sample, 0)
+	dec := json.NewDecoder(r)
+	for {
+		var s Sample
+		err := dec.Decode(&s)
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+}
+
+// readCSV Worker やエラーの種類の列は、書き出したときのヘッダーに従って読み込む
+func readCSV(r io.Reader) ([]Sample, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]Sample, 0, len(records))
+	if len(records) == 0 {
+		return samples, nil
+	}
+
+	header := records[0]
+	for i, record := range records[1:] {
+		s := Sample{Workers: make(map[string]int64), Errors: make(map[string]int)}
+		for j, name := range header {
+			if j >= len(record) {
+				return nil, fmt.Errorf("line %d: missing column %s", i+2, name)
+			}
+			v := record[j]
+			var err error
+			switch {
+			case name == "time":
+				s.Time, err = time.Parse(time.RFC3339Nano, v)
+			case name == "elapsed":
+				s.Elapsed, err = strconv.ParseFloat(v, 64)
+			case name == "score":
+				s.Score, err = strconv.ParseInt(v, 10, 64)
+			case name == "level":
+				s.Level, err = strconv.ParseInt(v, 10, 64)
+			case name == "in_flight":
+				s.InFlight, err = strconv.ParseInt(v, 10, 64)
+			case strings.HasPrefix(name, "workers."):
+				var n int64
+				n, err = strconv.ParseInt(v, 10, 64)
+				s.Workers[strings.TrimPrefix(name, "workers.")] = n
+			case strings.HasPrefix(name, "errors."):
+				var n int
+				n, err = strconv.Atoi(v)
+				s.Errors[strings.TrimPrefix(name, "errors.")] = n
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %v", i+2, name, err)
+			}
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
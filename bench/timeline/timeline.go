@@ -0,0 +1,164 @@
+package timeline
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/isucon10-qualify/isucon10-qualify/bench/fails"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/metrics"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/scenario"
+	"github.com/isucon10-qualify/isucon10-qualify/bench/score"
+)
+
+const SamplingInterval = 1 * time.Second
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Sample ある時点でのベンチマークの状態
+type Sample struct {
+	Time     time.Time        `json:"time"`
+	Elapsed  float64          `json:"elapsed"`
+	Score    int64            `json:"score"`
+	Level    int64            `json:"level"`
+	Workers  map[string]int64 `json:"workers"`
+	InFlight int64            `json:"in_flight"`
+	Errors   map[string]int   `json:"errors"`
+}
+
+// FormatOf ファイルの拡張子から出力形式を決める
+func FormatOf(path string) (string, error) {
+	switch filepath.Ext(path) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".jsonl":
+		return FormatJSONL, nil
+	default:
+		return "", fmt.Errorf("unsupported timeline format: %s", path)
+	}
+}
+
+func take(e *fails.Errors, sc *score.Score, m *metrics.Recorder, workers *scenario.Workers, startedAt time.Time) Sample {
+	counts := e.CountByCode()
+	errors := make(map[string]int, len(fails.Codes))
+	for _, code := range fails.Codes {
+		errors[fails.ClassOf(code)] = counts[code]
+	}
+
+	now := time.Now()
+	return Sample{
+		Time:     now,
+		Elapsed:  now.Sub(startedAt).Seconds(),
+		Score:    sc.GetScore(),
+		Level:    sc.GetLevel(),
+		Workers:  workers.Active(),
+		InFlight: m.InFlight(),
+		Errors:   errors,
+	}
+}
+
+type writer interface {
+	Write(s Sample) error
+	Flush() error
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) Write(s Sample) error {
+	return w.enc.Encode(s)
+}
+
+func (w *jsonlWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (w *csvWriter) Write(s Sample) error {
+	if !w.wroteHeader {
+		header := []string{"time", "elapsed", "score", "level"}
+		for _, name := range scenario.WorkerNames() {
+			header = append(header, "workers."+name)
+		}
+		header = append(header, "in_flight")
+		for _, code := range fails.Codes {
+			header = append(header, "errors."+fails.ClassOf(code))
+		}
+		if err := w.w.Write(header); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	record := []string{
+		s.Time.Format(time.RFC3339Nano),
+		strconv.FormatFloat(s.Elapsed, 'f', 3, 64),
+		strconv.FormatInt(s.Score, 10),
+		strconv.FormatInt(s.Level, 10),
+	}
+	for _, name := range scenario.WorkerNames() {
+		record = append(record, strconv.FormatInt(s.Workers[name], 10))
+	}
+	record = append(record, strconv.FormatInt(s.InFlight, 10))
+	for _, code := range fails.Codes {
+		record = append(record, strconv.Itoa(s.Errors[fails.ClassOf(code)]))
+	}
+	return w.w.Write(record)
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// Run ctx が終了するまで SamplingInterval ごとに状態を書き出す。終了時にも1度書き出す
+// エラーとスコアは ctx が持つものを使う
+func Run(ctx context.Context, out io.Writer, format string) error {
+	var w writer
+	switch format {
+	case FormatCSV:
+		w = &csvWriter{w: csv.NewWriter(out)}
+	case FormatJSONL:
+		w = &jsonlWriter{enc: json.NewEncoder(out)}
+	default:
+		return fmt.Errorf("unsupported timeline format: %s", format)
+	}
+
+	e := fails.FromContext(ctx)
+	sc := score.FromContext(ctx)
+	m := metrics.FromContext(ctx)
+	workers := scenario.WorkersFromContext(ctx)
+	startedAt := time.Now()
+	ticker := time.NewTicker(SamplingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.Write(take(e, sc, m, workers, startedAt)); err != nil {
+				return err
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			if err := w.Write(take(e, sc, m, workers, startedAt)); err != nil {
+				return err
+			}
+			return w.Flush()
+		}
+	}
+}
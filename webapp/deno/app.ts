@@ -5,6 +5,7 @@ import { organ } from "https://raw.githubusercontent.com/denjucks/organ/master/m
 import { camelCase } from "https://deno.land/x/case/mod.ts";
 import { parse } from "https://deno.land/std/encoding/csv.ts";
 import { multiParser } from "https://deno.land/x/multiparser/mod.ts";
+import { loadRateLimitConfig, RateLimiter } from "./ratelimit.ts";
 
 const currentEnv = Deno.env.toObject();
 const decoder = new TextDecoder();
@@ -41,6 +42,17 @@ const db = await new Client().connect(dbinfo);
 const camelcaseKeys = (obj: any) =>
   Object.fromEntries(Object.entries(obj).map(([k, v]) => [camelCase(k), v]));
 
+function sendError(
+  ctx: any,
+  status: number,
+  code: string,
+  message: string,
+  field?: string,
+) {
+  ctx.response.status = status;
+  ctx.response.body = field ? { code, message, field } : { code, message };
+}
+
 const router = new Router();
 
 router.post("/initialize", async (ctx) => {
@@ -62,7 +74,9 @@ router.post("/initialize", async (ctx) => {
     const status = await p.status();
     if (!status.success) {
       const output = await p.output();
-      throw new Error("Deno run is failed " + output);
+      console.error("Deno run is failed " + output);
+      sendError(ctx, 500, "INITIALIZE_FAILED", "failed to initialize database");
+      return;
     }
   }
   ctx.response.body = {
@@ -86,12 +100,109 @@ router.get("/api/chair/low_priced", async (ctx) => {
     );
     ctx.response.body = { chairs: cs.map(camelcaseKeys) };
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 
-router.get("/api/chair/search", async (ctx, next) => {
+function buildFeatureCondition(features: string[], featureMode: string) {
+  const joiner = featureMode === "any" ? " OR " : " AND ";
+  const matches = features.map(() => "FIND_IN_SET(?, features) > 0");
+  return [`(${matches.join(joiner)})`, features] as [string, string[]];
+}
+
+function withoutKey(q: any, key: string) {
+  const without = { ...q };
+  delete without[key];
+  return without;
+}
+
+async function countFacets(
+  table: string,
+  condition: any,
+  buckets: string[],
+  bucketParams: any[],
+) {
+  if (buckets.length === 0) {
+    return [];
+  }
+  const columns = buckets.map(
+    (bucket, i) => `COUNT(CASE WHEN ${bucket} THEN 1 END) AS c${i}`,
+  );
+  const where = condition.searchQueries.length > 0
+    ? ` WHERE ${condition.searchQueries.join(" AND ")}`
+    : "";
+  const [row] = await db.query(
+    `SELECT ${columns.join(", ")} FROM ${table}${where}`,
+    [...bucketParams, ...condition.queryParams],
+  );
+  return buckets.map((_, i) => row[`c${i}`]);
+}
+
+async function countRangeFacets(
+  table: string,
+  condition: any,
+  column: string,
+  rangeCondition: any,
+) {
+  const buckets = [];
+  const bucketParams = [];
+  for (const range of rangeCondition.ranges) {
+    const bucket = [];
+    if (range.min !== -1) {
+      bucket.push(`${column} >= ?`);
+      bucketParams.push(range.min);
+    }
+    if (range.max !== -1) {
+      bucket.push(`${column} < ?`);
+      bucketParams.push(range.max);
+    }
+    buckets.push(bucket.length > 0 ? bucket.join(" AND ") : "TRUE");
+  }
+  const counts = await countFacets(table, condition, buckets, bucketParams);
+  return rangeCondition.ranges.map((range: any, i: number) => ({
+    id: range.id,
+    count: counts[i],
+  }));
+}
+
+async function countListFacets(
+  table: string,
+  condition: any,
+  list: string[],
+  bucket: (name: string) => [string, any[]],
+) {
+  const buckets = [];
+  const bucketParams = [];
+  for (const name of list) {
+    const [b, params] = bucket(name);
+    buckets.push(b);
+    bucketParams.push(...params);
+  }
+  const counts = await countFacets(table, condition, buckets, bucketParams);
+  return list.map((name, i) => ({ name, count: counts[i] }));
+}
+
+function columnEqualBucket(column: string) {
+  return (name: string) => [`${column} = ?`, [name]] as [string, any[]];
+}
+
+// 現在の条件に feature を1つ追加したときの件数を数えるための条件
+// any のときは OR の中に追加する必要があるため、返り値の key の条件を外して features の条件を作り直す
+function featureFacetBucket(
+  q: any,
+): [string, (name: string) => [string, any[]]] {
+  if (q.featureMode !== "any" || !q.features) {
+    return ["", (name) => buildFeatureCondition([name], "all")];
+  }
+  const current = q.features.split(",");
+  return [
+    "features",
+    (name) => buildFeatureCondition([...current, name], "any"),
+  ];
+}
+
+function buildChairSearchCondition(q: any): any {
   const searchQueries = [];
   const queryParams = [];
   const {
@@ -102,16 +213,19 @@ router.get("/api/chair/search", async (ctx, next) => {
     kind,
     color,
     features,
-    page,
-    perPage,
-  } = helpers.getQuery(ctx);
+    featureMode,
+  } = q;
 
   if (!!priceRangeId) {
     const chairPrice = chairSearchCondition["price"].ranges[priceRangeId];
     if (chairPrice == null) {
-      ctx.response.status = 400;
-      ctx.response.body = "priceRangeID invalid";
-      return;
+      return {
+        error: {
+          code: "INVALID_RANGE_ID",
+          message: "priceRangeID invalid",
+          field: "priceRangeId",
+        },
+      };
     }
 
     if (chairPrice.min !== -1) {
@@ -128,9 +242,13 @@ router.get("/api/chair/search", async (ctx, next) => {
   if (!!heightRangeId) {
     const chairHeight = chairSearchCondition["height"].ranges[heightRangeId];
     if (chairHeight == null) {
-      ctx.response.status = 400;
-      ctx.response.body = "heightRangeId invalid";
-      return;
+      return {
+        error: {
+          code: "INVALID_RANGE_ID",
+          message: "heightRangeId invalid",
+          field: "heightRangeId",
+        },
+      };
     }
 
     if (chairHeight.min !== -1) {
@@ -147,9 +265,13 @@ router.get("/api/chair/search", async (ctx, next) => {
   if (!!widthRangeId) {
     const chairWidth = chairSearchCondition["width"].ranges[widthRangeId];
     if (chairWidth == null) {
-      ctx.response.status = 400;
-      ctx.response.body = "widthRangeId invalid";
-      return;
+      return {
+        error: {
+          code: "INVALID_RANGE_ID",
+          message: "widthRangeId invalid",
+          field: "widthRangeId",
+        },
+      };
     }
 
     if (chairWidth.min !== -1) {
@@ -166,9 +288,13 @@ router.get("/api/chair/search", async (ctx, next) => {
   if (!!depthRangeId) {
     const chairDepth = chairSearchCondition["depth"].ranges[depthRangeId];
     if (chairDepth == null) {
-      ctx.response.status = 400;
-      ctx.response.body = "depthRangeId invalid";
-      return;
+      return {
+        error: {
+          code: "INVALID_RANGE_ID",
+          message: "depthRangeId invalid",
+          field: "depthRangeId",
+        },
+      };
     }
 
     if (chairDepth.min !== -1) {
@@ -183,26 +309,56 @@ router.get("/api/chair/search", async (ctx, next) => {
   }
 
   if (!!kind) {
-    searchQueries.push("kind = ? ");
-    queryParams.push(kind);
+    const kinds = kind.split(",");
+    searchQueries.push(`kind IN (${kinds.map(() => "?").join(",")}) `);
+    queryParams.push(...kinds);
   }
 
   if (!!color) {
-    searchQueries.push("color = ? ");
-    queryParams.push(color);
+    const colors = color.split(",");
+    searchQueries.push(`color IN (${colors.map(() => "?").join(",")}) `);
+    queryParams.push(...colors);
+  }
+
+  if (!!featureMode && featureMode !== "all" && featureMode !== "any") {
+    return {
+      error: {
+        code: "INVALID_FEATURE_MODE",
+        message: "featureMode invalid",
+        field: "featureMode",
+      },
+    };
   }
 
   if (!!features) {
-    const featureConditions = features.split(",");
-    for (const featureCondition of featureConditions) {
-      searchQueries.push("features LIKE ?");
-      queryParams.push(`%${featureCondition}%`);
-    }
+    const [featureQuery, featureParams] = buildFeatureCondition(
+      features.split(","),
+      featureMode,
+    );
+    searchQueries.push(featureQuery);
+    queryParams.push(...featureParams);
   }
 
-  if (searchQueries.length === 0) {
+  return { searchQueries, queryParams };
+}
+
+router.get("/api/chair/search", async (ctx) => {
+  const query = helpers.getQuery(ctx);
+  const { error, searchQueries, queryParams } = buildChairSearchCondition(query);
+  if (error) {
     ctx.response.status = 400;
-    ctx.response.body = "Search condition not found";
+    ctx.response.body = error;
+    return;
+  }
+  const { page, perPage } = query;
+
+  if (searchQueries.length === 0) {
+    sendError(
+      ctx,
+      400,
+      "MISSING_SEARCH_CONDITION",
+      "at least one search condition is required",
+    );
     return;
   }
 
@@ -211,14 +367,18 @@ router.get("/api/chair/search", async (ctx, next) => {
   const perPageNum = parseInt(perPage, 10);
 
   if (!page || Number.isNaN(pageNum)) {
-    ctx.response.status = 400;
-    ctx.response.body = `page condition invalid ${page}`;
+    sendError(ctx, 400, "INVALID_PAGE", "page must be an integer", "page");
     return;
   }
 
   if (!perPage || Number.isNaN(perPageNum)) {
-    ctx.response.status = 400;
-    ctx.response.body = `perPage condition invalid ${perPage}`;
+    sendError(
+      ctx,
+      400,
+      "INVALID_PER_PAGE",
+      "perPage must be an integer",
+      "perPage",
+    );
     return;
   }
 
@@ -243,8 +403,8 @@ router.get("/api/chair/search", async (ctx, next) => {
       chairs,
     };
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 
@@ -252,51 +412,110 @@ router.get("/api/chair/search/condition", (ctx) => {
   ctx.response.body = chairSearchCondition;
 });
 
+router.get("/api/chair/search/facets", async (ctx) => {
+  const query = helpers.getQuery(ctx);
+  const { error } = buildChairSearchCondition(query);
+  if (error) {
+    ctx.response.status = 400;
+    ctx.response.body = error;
+    return;
+  }
+  const without = (key: string) => {
+    const condition = buildChairSearchCondition(withoutKey(query, key));
+    condition.searchQueries.push("stock > 0");
+    return condition;
+  };
+
+  try {
+    const facets: any = {};
+    for (
+      const [name, key, column] of [
+        ["price", "priceRangeId", "price"],
+        ["height", "heightRangeId", "height"],
+        ["width", "widthRangeId", "width"],
+        ["depth", "depthRangeId", "depth"],
+      ]
+    ) {
+      facets[name] = await countRangeFacets(
+        "chair",
+        without(key),
+        column,
+        chairSearchCondition[name],
+      );
+    }
+    for (const name of ["kind", "color"]) {
+      facets[name] = await countListFacets(
+        "chair",
+        without(name),
+        chairSearchCondition[name].list,
+        columnEqualBucket(name),
+      );
+    }
+    const [featureKey, bucket] = featureFacetBucket(query);
+    facets.feature = await countListFacets(
+      "chair",
+      without(featureKey),
+      chairSearchCondition["feature"].list,
+      bucket,
+    );
+    ctx.response.body = facets;
+  } catch (e) {
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
+  }
+});
+
 router.get("/api/chair/:id", async (ctx) => {
   try {
     const id = ctx.params.id;
     const [chair] = await db.query("SELECT * FROM chair WHERE id = ?", [id]);
-    if (chair == null || chair.stock <= 0) {
-      ctx.response.status = 404;
-      ctx.response.body = "Not Found";
+    if (chair == null) {
+      sendError(ctx, 404, "CHAIR_NOT_FOUND", "chair not found");
+      return;
+    }
+    if (chair.stock <= 0) {
+      sendError(ctx, 404, "CHAIR_SOLD_OUT", "chair is sold out");
       return;
     }
     ctx.response.body = camelcaseKeys(chair);
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 
 router.post("/api/chair/buy/:id", async (ctx) => {
   try {
     const id = ctx.params.id;
-    await db.transaction(async (conn) => {
+    const found = await db.transaction(async (conn) => {
       const result = await conn.execute(
         "SELECT * FROM chair WHERE id = ? AND stock > 0 FOR UPDATE",
         [id],
       );
       if (result.rows?.[0] == null) {
-        ctx.response.status = 404;
-        ctx.response.body = "Not Found";
         await conn.execute("ROLLBACK");
-        return;
+        return false;
       }
       const chair = result.rows[0];
       await conn.execute(
         "UPDATE chair SET stock = ? WHERE id = ?",
         [chair.stock - 1, id],
       );
+      return true;
     });
+    if (!found) {
+      sendError(ctx, 404, "CHAIR_NOT_FOUND", "chair not found or sold out");
+      return;
+    }
 
     ctx.response.body = { ok: true };
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 
-router.get("/api/estate/search", async (ctx) => {
+function buildEstateSearchCondition(q: any): any {
   const searchQueries = [];
   const queryParams = [];
   const {
@@ -304,17 +523,20 @@ router.get("/api/estate/search", async (ctx) => {
     doorWidthRangeId,
     rentRangeId,
     features,
-    page,
-    perPage,
-  } = helpers.getQuery(ctx);
+    featureMode,
+  } = q;
 
   if (!!doorHeightRangeId) {
     const doorHeight =
       estateSearchCondition["doorHeight"].ranges[doorHeightRangeId];
     if (doorHeight == null) {
-      ctx.response.status = 400;
-      ctx.response.body = "doorHeightRangeId invalid";
-      return;
+      return {
+        error: {
+          code: "INVALID_RANGE_ID",
+          message: "doorHeightRangeId invalid",
+          field: "doorHeightRangeId",
+        },
+      };
     }
 
     if (doorHeight.min !== -1) {
@@ -332,9 +554,13 @@ router.get("/api/estate/search", async (ctx) => {
     const doorWidth =
       estateSearchCondition["doorWidth"].ranges[doorWidthRangeId];
     if (doorWidth == null) {
-      ctx.response.status = 400;
-      ctx.response.body = "doorWidthRangeId invalid";
-      return;
+      return {
+        error: {
+          code: "INVALID_RANGE_ID",
+          message: "doorWidthRangeId invalid",
+          field: "doorWidthRangeId",
+        },
+      };
     }
 
     if (doorWidth.min !== -1) {
@@ -351,9 +577,13 @@ router.get("/api/estate/search", async (ctx) => {
   if (!!rentRangeId) {
     const rent = estateSearchCondition["rent"].ranges[rentRangeId];
     if (rent == null) {
-      ctx.response.status = 400;
-      ctx.response.body = "rentRangeId invalid";
-      return;
+      return {
+        error: {
+          code: "INVALID_RANGE_ID",
+          message: "rentRangeId invalid",
+          field: "rentRangeId",
+        },
+      };
     }
 
     if (rent.min !== -1) {
@@ -367,17 +597,45 @@ router.get("/api/estate/search", async (ctx) => {
     }
   }
 
+  if (!!featureMode && featureMode !== "all" && featureMode !== "any") {
+    return {
+      error: {
+        code: "INVALID_FEATURE_MODE",
+        message: "featureMode invalid",
+        field: "featureMode",
+      },
+    };
+  }
+
   if (!!features) {
-    const featureConditions = features.split(",");
-    for (const featureCondition of featureConditions) {
-      searchQueries.push("features LIKE ?");
-      queryParams.push(`%${featureCondition}%`);
-    }
+    const [featureQuery, featureParams] = buildFeatureCondition(
+      features.split(","),
+      featureMode,
+    );
+    searchQueries.push(featureQuery);
+    queryParams.push(...featureParams);
   }
 
-  if (searchQueries.length === 0) {
+  return { searchQueries, queryParams };
+}
+
+router.get("/api/estate/search", async (ctx) => {
+  const query = helpers.getQuery(ctx);
+  const { error, searchQueries, queryParams } = buildEstateSearchCondition(query);
+  if (error) {
     ctx.response.status = 400;
-    ctx.response.body = "Search condition not found";
+    ctx.response.body = error;
+    return;
+  }
+  const { page, perPage } = query;
+
+  if (searchQueries.length === 0) {
+    sendError(
+      ctx,
+      400,
+      "MISSING_SEARCH_CONDITION",
+      "at least one search condition is required",
+    );
     return;
   }
 
@@ -385,14 +643,18 @@ router.get("/api/estate/search", async (ctx) => {
   const perPageNum = parseInt(perPage, 10);
 
   if (!page || Number.isNaN(pageNum)) {
-    ctx.response.status = 400;
-    ctx.response.body = `page condition invalid ${page}`;
+    sendError(ctx, 400, "INVALID_PAGE", "page must be an integer", "page");
     return;
   }
 
   if (!perPage || Number.isNaN(perPageNum)) {
-    ctx.response.status = 400;
-    ctx.response.body = `perPage condition invalid ${perPage}`;
+    sendError(
+      ctx,
+      400,
+      "INVALID_PER_PAGE",
+      "perPage must be an integer",
+      "perPage",
+    );
     return;
   }
 
@@ -416,8 +678,8 @@ router.get("/api/estate/search", async (ctx) => {
       estates: estates.map(camelcaseKeys),
     };
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 
@@ -425,12 +687,52 @@ router.get("/api/estate/search/condition", (ctx) => {
   ctx.response.body = estateSearchCondition;
 });
 
+router.get("/api/estate/search/facets", async (ctx) => {
+  const query = helpers.getQuery(ctx);
+  const { error } = buildEstateSearchCondition(query);
+  if (error) {
+    ctx.response.status = 400;
+    ctx.response.body = error;
+    return;
+  }
+  const without = (key: string) =>
+    buildEstateSearchCondition(withoutKey(query, key));
+
+  try {
+    const facets: any = {};
+    for (
+      const [name, key, column] of [
+        ["doorHeight", "doorHeightRangeId", "door_height"],
+        ["doorWidth", "doorWidthRangeId", "door_width"],
+        ["rent", "rentRangeId", "rent"],
+      ]
+    ) {
+      facets[name] = await countRangeFacets(
+        "estate",
+        without(key),
+        column,
+        estateSearchCondition[name],
+      );
+    }
+    const [featureKey, bucket] = featureFacetBucket(query);
+    facets.feature = await countListFacets(
+      "estate",
+      without(featureKey),
+      estateSearchCondition["feature"].list,
+      bucket,
+    );
+    ctx.response.body = facets;
+  } catch (e) {
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
+  }
+});
+
 router.post("/api/estate/req_doc/:id", async (ctx) => {
   const id = ctx.params.id;
   const [estate] = await db.query("SELECT * FROM estate WHERE id = ?", [id]);
   if (estate == null) {
-    ctx.response.status = 404;
-    ctx.response.body = "Not Found";
+    sendError(ctx, 404, "ESTATE_NOT_FOUND", "estate not found");
     return;
   }
   ctx.response.body = { ok: true };
@@ -440,8 +742,28 @@ router.post("/api/estate/nazotte", async (ctx) => {
   const result = ctx.request.body(); // content type automatically detected
   let coordinates;
   if (result.type === "json") {
-    const val = await result.value; // an object of parsed JSON
-    coordinates = val.coordinates;
+    try {
+      const val = await result.value; // an object of parsed JSON
+      coordinates = val.coordinates;
+    } catch (e) {
+      sendError(
+        ctx,
+        400,
+        "INVALID_REQUEST_BODY",
+        "failed to parse request body",
+      );
+      return;
+    }
+  }
+  if (!Array.isArray(coordinates) || coordinates.length === 0) {
+    sendError(
+      ctx,
+      400,
+      "MISSING_COORDINATES",
+      "coordinates are required",
+      "coordinates",
+    );
+    return;
   }
   const longitudes = coordinates.map((c: { longitude: number }) => c.longitude);
   const latitudes = coordinates.map((c: { latitude: number }) => c.latitude);
@@ -505,8 +827,8 @@ router.post("/api/estate/nazotte", async (ctx) => {
     results.count = results.estates.length;
     ctx.response.body = results;
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 
@@ -515,14 +837,13 @@ router.get("/api/estate/:id", async (ctx) => {
     const id = ctx.params.id;
     const [estate] = await db.query("SELECT * FROM estate WHERE id = ?", [id]);
     if (estate == null) {
-      ctx.response.status = 404;
-      ctx.response.body = "Estate Not Found";
+      sendError(ctx, 404, "ESTATE_NOT_FOUND", "estate not found");
       return;
     }
     ctx.response.body = camelcaseKeys(estate);
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 
@@ -530,8 +851,7 @@ router.post("/api/estate/req_doc/:id", async (ctx) => {
   const id = ctx.params.id;
   const [estate] = await db.query("SELECT * FROM estate WHERE id = ?", [id]);
   if (estate == null) {
-    ctx.response.status = 404;
-    ctx.response.body = "Not Found";
+    sendError(ctx, 404, "ESTATE_NOT_FOUND", "estate not found");
     return;
   }
   ctx.response.body = { ok: true };
@@ -541,6 +861,10 @@ router.get("/api/recommended_estate/:id", async (ctx) => {
   try {
     const id = ctx.params.id;
     const [chair] = await db.query("SELECT * FROM chair WHERE id = ?", [id]);
+    if (chair == null) {
+      sendError(ctx, 400, "CHAIR_NOT_FOUND", "chair not found", "id");
+      return;
+    }
     const w = chair.width;
     const h = chair.height;
     const d = chair.depth;
@@ -564,8 +888,46 @@ router.get("/api/recommended_estate/:id", async (ctx) => {
     );
     ctx.response.body = { estates: es.map(camelcaseKeys) };
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
+  }
+});
+
+router.get("/api/recommended_chair/:id", async (ctx) => {
+  try {
+    const id = ctx.params.id;
+    const { maxPrice } = helpers.getQuery(ctx);
+    if (!!maxPrice && !(/^\d+$/.test(maxPrice))) {
+      sendError(
+        ctx,
+        400,
+        "INVALID_MAX_PRICE",
+        "maxPrice must be a non-negative integer",
+        "maxPrice",
+      );
+      return;
+    }
+    const [estate] = await db.query("SELECT * FROM estate WHERE id = ?", [id]);
+    if (estate == null) {
+      sendError(ctx, 400, "ESTATE_NOT_FOUND", "estate not found", "id");
+      return;
+    }
+    const w = estate.door_width;
+    const h = estate.door_height;
+    let sql =
+      "SELECT * FROM chair WHERE stock > 0 AND ((width <= ? AND height <= ?) OR (width <= ? AND depth <= ?) OR (height <= ? AND width <= ?) OR (height <= ? AND depth <= ?) OR (depth <= ? AND width <= ?) OR (depth <= ? AND height <= ?))";
+    const params = [w, h, w, h, w, h, w, h, w, h, w, h];
+    if (!!maxPrice) {
+      sql += " AND price <= ?";
+      params.push(Number(maxPrice));
+    }
+    sql += " ORDER BY popularity DESC, id ASC LIMIT ?";
+    params.push(LIMIT);
+    const cs = await db.query(sql, params);
+    ctx.response.body = { chairs: cs.map(camelcaseKeys) };
+  } catch (e) {
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 
@@ -573,8 +935,7 @@ router.post("/api/chair", async (ctx) => {
   try {
     const form = await multiParser(ctx.request.serverRequest);
     if (!form || !form.chairs) {
-      ctx.response.status = 400;
-      ctx.response.body = "Bad Request";
+      sendError(ctx, 400, "MISSING_CSV", "csv file is required", "chairs");
       return;
     }
     const content = decoder.decode((form.chairs as any).content);
@@ -591,8 +952,8 @@ router.post("/api/chair", async (ctx) => {
     ctx.response.status = 201;
     ctx.response.body = { ok: true };
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 
@@ -600,8 +961,7 @@ router.post("/api/estate", async (ctx) => {
   try {
     const form = await multiParser(ctx.request.serverRequest);
     if (!form || !form.estates) {
-      ctx.response.status = 400;
-      ctx.response.body = "Bad Request";
+      sendError(ctx, 400, "MISSING_CSV", "csv file is required", "estates");
       return;
     }
     const content = decoder.decode((form.estates as any).content);
@@ -618,12 +978,43 @@ router.post("/api/estate", async (ctx) => {
     ctx.response.status = 201;
     ctx.response.body = { ok: true };
   } catch (e) {
-    ctx.response.status = 500;
-    ctx.response.body = e.toString();
+    console.error(e);
+    sendError(ctx, 500, "DATABASE_ERROR", "database error");
   }
 });
 const app = new Application();
 app.use(organ());
+// すべてのエラーを { code, message, field } の形式で返す
+app.use(async (ctx, next) => {
+  try {
+    await next();
+  } catch (e) {
+    console.error(e);
+    sendError(ctx, 500, "INTERNAL_SERVER_ERROR", "Internal Server Error");
+    return;
+  }
+  if (ctx.response.body != null) {
+    return;
+  }
+  if (ctx.response.status === 404) {
+    sendError(ctx, 404, "ROUTE_NOT_FOUND", "Not Found");
+  } else if (ctx.response.status === 405) {
+    sendError(ctx, 405, "METHOD_NOT_ALLOWED", "Method Not Allowed");
+  }
+});
+if (currentEnv.RATE_LIMIT_CONFIG) {
+  const limiter = new RateLimiter(
+    await loadRateLimitConfig(currentEnv.RATE_LIMIT_CONFIG),
+  );
+  app.use(limiter.middleware((ctx, retryAfter) =>
+    sendError(
+      ctx,
+      429,
+      "RATE_LIMITED",
+      `rate limit exceeded, retry after ${retryAfter} seconds`,
+    )
+  ));
+}
 app.use(router.routes());
 app.use(router.allowedMethods());
 
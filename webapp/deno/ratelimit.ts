@@ -0,0 +1,131 @@
+const RATE_LIMIT_KEY_IP = "ip";
+const RATE_LIMIT_KEY_USER_AGENT = "user_agent";
+
+// これ以上アクセスのないバケットは破棄する
+const BUCKET_IDLE_TIMEOUT = 10 * 60 * 1000;
+
+interface RateLimitBudget {
+  rate: number;
+  burst: number;
+}
+
+interface RateLimitConfig {
+  key: string;
+  default: RateLimitBudget;
+  routes: Record<string, RateLimitBudget>;
+}
+
+interface TokenBucket {
+  tokens: number;
+  updateAt: number;
+}
+
+// Go 実装と同じ形式の設定を読み込む。ルートは "POST /api/estate/nazotte" の形式で指定する
+export async function loadRateLimitConfig(
+  path: string,
+): Promise<RateLimitConfig> {
+  const config: RateLimitConfig = {
+    key: RATE_LIMIT_KEY_IP,
+    default: { rate: 0, burst: 0 },
+    routes: {},
+    ...JSON.parse(await Deno.readTextFile(path)),
+  };
+
+  if (
+    config.key !== RATE_LIMIT_KEY_IP &&
+    config.key !== RATE_LIMIT_KEY_USER_AGENT
+  ) {
+    throw new Error(`invalid rate limit key: ${config.key}`);
+  }
+  for (const budget of [config.default, ...Object.values(config.routes)]) {
+    if (budget.rate > 0 && !(budget.burst >= 1)) {
+      throw new Error("burst must be greater than 0 when rate is set");
+    }
+  }
+
+  return config;
+}
+
+// routeOf Go 実装のルートに合わせて、数字のパスパラメータを :id に置き換える
+function routeOf(ctx: any): string {
+  const path = ctx.request.url.pathname.replace(/\/\d+(?=\/|$)/g, "/:id");
+  return `${ctx.request.method} ${path}`;
+}
+
+// clientOf echo の RealIP と同じ順でクライアントの IP を決める
+function clientOf(ctx: any, key: string): string {
+  const headers = ctx.request.headers;
+  if (key === RATE_LIMIT_KEY_USER_AGENT) {
+    return headers.get("User-Agent") ?? "";
+  }
+  const forwardedFor = headers.get("X-Forwarded-For");
+  if (forwardedFor) {
+    return forwardedFor.split(", ")[0];
+  }
+  return headers.get("X-Real-IP") ?? ctx.request.ip;
+}
+
+export class RateLimiter {
+  private buckets = new Map<string, TokenBucket>();
+  private sweptAt = Date.now();
+
+  constructor(private config: RateLimitConfig) {}
+
+  budget(route: string): RateLimitBudget {
+    return this.config.routes[route] ?? this.config.default;
+  }
+
+  // トークンを1つ消費する。消費できなかった場合は次にトークンが補充されるまでのミリ秒を返す
+  take(key: string, budget: RateLimitBudget, now: number): [boolean, number] {
+    if (now - this.sweptAt > BUCKET_IDLE_TIMEOUT) {
+      for (const [k, b] of this.buckets) {
+        if (now - b.updateAt > BUCKET_IDLE_TIMEOUT) {
+          this.buckets.delete(k);
+        }
+      }
+      this.sweptAt = now;
+    }
+
+    let b = this.buckets.get(key);
+    if (b == null) {
+      b = { tokens: budget.burst, updateAt: now };
+      this.buckets.set(key, b);
+    }
+
+    b.tokens = Math.min(
+      budget.burst,
+      b.tokens + ((now - b.updateAt) / 1000) * budget.rate,
+    );
+    b.updateAt = now;
+
+    if (b.tokens >= 1) {
+      b.tokens--;
+      return [true, 0];
+    }
+
+    return [false, ((1 - b.tokens) / budget.rate) * 1000];
+  }
+
+  // 制限したリクエストは onLimited(ctx, Retry-After の秒数) でレスポンスを作る
+  middleware(onLimited: (ctx: any, retryAfter: number) => void) {
+    return async (ctx: any, next: () => Promise<void>) => {
+      const route = routeOf(ctx);
+      const budget = this.budget(route);
+      if (!(budget.rate > 0)) {
+        await next();
+        return;
+      }
+
+      const client = clientOf(ctx, this.config.key);
+      const [ok, wait] = this.take(`${route}\x00${client}`, budget, Date.now());
+      if (!ok) {
+        const retryAfter = Math.ceil(wait / 1000);
+        ctx.response.headers.set("Retry-After", String(retryAfter));
+        onLimited(ctx, retryAfter);
+        return;
+      }
+
+      await next();
+    };
+  }
+}
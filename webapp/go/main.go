@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -23,6 +24,38 @@ import (
 const Limit = 20
 const NazotteLimit = 50
 
+// featureMode を指定しない場合は FeatureModeAll として扱う
+const (
+	FeatureModeAll = "all"
+	FeatureModeAny = "any"
+)
+
+// エラーレスポンスの code。クライアントが判別に使うので値は変更しないこと
+const (
+	ErrCodeInvalidID              = "INVALID_ID"
+	ErrCodeInvalidRequestBody     = "INVALID_REQUEST_BODY"
+	ErrCodeMissingEmail           = "MISSING_EMAIL"
+	ErrCodeMissingCSV             = "MISSING_CSV"
+	ErrCodeCSVRead                = "CSV_READ_FAILED"
+	ErrCodeInvalidCSVRecord       = "INVALID_CSV_RECORD"
+	ErrCodeInvalidRangeID         = "INVALID_RANGE_ID"
+	ErrCodeInvalidFeatureMode     = "INVALID_FEATURE_MODE"
+	ErrCodeMissingSearchCondition = "MISSING_SEARCH_CONDITION"
+	ErrCodeInvalidPage            = "INVALID_PAGE"
+	ErrCodeInvalidPerPage         = "INVALID_PER_PAGE"
+	ErrCodeInvalidMaxPrice        = "INVALID_MAX_PRICE"
+	ErrCodeMissingCoordinates     = "MISSING_COORDINATES"
+	ErrCodeChairNotFound          = "CHAIR_NOT_FOUND"
+	ErrCodeChairSoldOut           = "CHAIR_SOLD_OUT"
+	ErrCodeEstateNotFound         = "ESTATE_NOT_FOUND"
+	ErrCodeRouteNotFound          = "ROUTE_NOT_FOUND"
+	ErrCodeMethodNotAllowed       = "METHOD_NOT_ALLOWED"
+	ErrCodeRateLimited            = "RATE_LIMITED"
+	ErrCodeInitializeFailed       = "INITIALIZE_FAILED"
+	ErrCodeDatabase               = "DATABASE_ERROR"
+	ErrCodeInternal               = "INTERNAL_SERVER_ERROR"
+)
+
 var db *sqlx.DB
 var mySQLConnectionData *MySQLConnectionEnv
 var chairSearchCondition ChairSearchCondition
@@ -125,6 +158,61 @@ type ChairSearchCondition struct {
 	Kind    ListCondition  `json:"kind"`
 }
 
+type RangeFacet struct {
+	ID    int64 `json:"id"`
+	Count int64 `json:"count"`
+}
+
+type ListFacet struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type ChairSearchFacets struct {
+	Width   []RangeFacet `json:"width"`
+	Height  []RangeFacet `json:"height"`
+	Depth   []RangeFacet `json:"depth"`
+	Price   []RangeFacet `json:"price"`
+	Color   []ListFacet  `json:"color"`
+	Feature []ListFacet  `json:"feature"`
+	Kind    []ListFacet  `json:"kind"`
+}
+
+type EstateSearchFacets struct {
+	DoorWidth  []RangeFacet `json:"doorWidth"`
+	DoorHeight []RangeFacet `json:"doorHeight"`
+	Rent       []RangeFacet `json:"rent"`
+	Feature    []ListFacet  `json:"feature"`
+}
+
+// ErrorResponse エラー時に返すレスポンスの形式
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+// APIError ハンドラが返すエラー。httpErrorHandler で ErrorResponse に変換される
+type APIError struct {
+	Status   int
+	Response ErrorResponse
+}
+
+func (e *APIError) Error() string {
+	if e.Response.Field != "" {
+		return fmt.Sprintf("%s (%s): %s", e.Response.Code, e.Response.Field, e.Response.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Response.Code, e.Response.Message)
+}
+
+func newAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Response: ErrorResponse{Code: code, Message: message}}
+}
+
+func newFieldError(status int, code, message, field string) *APIError {
+	return &APIError{Status: status, Response: ErrorResponse{Code: code, Message: message, Field: field}}
+}
+
 type BoundingBox struct {
 	// TopLeftCorner 緯度経度が共に最小値になるような点の情報を持っている
 	TopLeftCorner Coordinate
@@ -244,9 +332,18 @@ func main() {
 	e.Debug = true
 	e.Logger.SetLevel(log.DEBUG)
 
+	e.HTTPErrorHandler = httpErrorHandler
+
 	// Middleware
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	if path := os.Getenv("RATE_LIMIT_CONFIG"); path != "" {
+		config, err := loadRateLimitConfig(path)
+		if err != nil {
+			e.Logger.Fatalf("rate limit config load failed : %v", err)
+		}
+		e.Use(newRateLimiter(*config).Middleware)
+	}
 
 	// Initialize
 	e.POST("/initialize", initialize)
@@ -257,6 +354,7 @@ func main() {
 	e.GET("/api/chair/search", searchChairs)
 	e.GET("/api/chair/low_priced", getLowPricedChair)
 	e.GET("/api/chair/search/condition", getChairSearchCondition)
+	e.GET("/api/chair/search/facets", getChairSearchFacets)
 	e.POST("/api/chair/buy/:id", buyChair)
 
 	// Estate Handler
@@ -267,7 +365,9 @@ func main() {
 	e.POST("/api/estate/req_doc/:id", postEstateRequestDocument)
 	e.POST("/api/estate/nazotte", searchEstateNazotte)
 	e.GET("/api/estate/search/condition", getEstateSearchCondition)
+	e.GET("/api/estate/search/facets", getEstateSearchFacets)
 	e.GET("/api/recommended_estate/:id", searchRecommendedEstateWithChair)
+	e.GET("/api/recommended_chair/:id", searchRecommendedChairWithEstate)
 
 	mySQLConnectionData = NewMySQLConnectionEnv()
 
@@ -284,6 +384,42 @@ func main() {
 	e.Logger.Fatal(e.Start(serverPort))
 }
 
+// httpErrorHandler すべてのエラーを ErrorResponse の形式で返す
+func httpErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	var apiErr *APIError
+	switch e := err.(type) {
+	case *APIError:
+		apiErr = e
+	case *echo.HTTPError:
+		switch e.Code {
+		case http.StatusNotFound:
+			apiErr = newAPIError(e.Code, ErrCodeRouteNotFound, fmt.Sprint(e.Message))
+		case http.StatusMethodNotAllowed:
+			apiErr = newAPIError(e.Code, ErrCodeMethodNotAllowed, fmt.Sprint(e.Message))
+		case http.StatusInternalServerError:
+			apiErr = newAPIError(e.Code, ErrCodeInternal, fmt.Sprint(e.Message))
+		default:
+			apiErr = newAPIError(e.Code, strings.ToUpper(strings.ReplaceAll(http.StatusText(e.Code), " ", "_")), fmt.Sprint(e.Message))
+		}
+	default:
+		c.Logger().Errorf("unexpected error : %v", err)
+		apiErr = newAPIError(http.StatusInternalServerError, ErrCodeInternal, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(apiErr.Status)
+	} else {
+		err = c.JSON(apiErr.Status, apiErr.Response)
+	}
+	if err != nil {
+		c.Logger().Errorf("failed to send error response : %v", err)
+	}
+}
+
 func initialize(c echo.Context) error {
 	sqlDir := filepath.Join("..", "mysql", "db")
 	paths := []string{
@@ -304,7 +440,7 @@ func initialize(c echo.Context) error {
 		)
 		if err := exec.Command("bash", "-c", cmdStr).Run(); err != nil {
 			c.Logger().Errorf("Initialize script error : %v", err)
-			return c.NoContent(http.StatusInternalServerError)
+			return newAPIError(http.StatusInternalServerError, ErrCodeInitializeFailed, "failed to initialize database")
 		}
 	}
 
@@ -317,7 +453,7 @@ func getChairDetail(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.Echo().Logger.Errorf("Request parameter \"id\" parse error : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidID, "id must be an integer", "id")
 	}
 
 	chair := Chair{}
@@ -326,13 +462,13 @@ func getChairDetail(c echo.Context) error {
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.Echo().Logger.Infof("requested id's chair not found : %v", id)
-			return c.NoContent(http.StatusNotFound)
+			return newAPIError(http.StatusNotFound, ErrCodeChairNotFound, "chair not found")
 		}
 		c.Echo().Logger.Errorf("Failed to get the chair from id : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	} else if chair.Stock <= 0 {
 		c.Echo().Logger.Infof("requested id's chair is sold out : %v", id)
-		return c.NoContent(http.StatusNotFound)
+		return newAPIError(http.StatusNotFound, ErrCodeChairSoldOut, "chair is sold out")
 	}
 
 	return c.JSON(http.StatusOK, chair)
@@ -342,24 +478,24 @@ func postChair(c echo.Context) error {
 	header, err := c.FormFile("chairs")
 	if err != nil {
 		c.Logger().Errorf("failed to get form file: %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeMissingCSV, "csv file is required", "chairs")
 	}
 	f, err := header.Open()
 	if err != nil {
 		c.Logger().Errorf("failed to open form file: %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newFieldError(http.StatusInternalServerError, ErrCodeCSVRead, "failed to open csv file", "chairs")
 	}
 	defer f.Close()
 	records, err := csv.NewReader(f).ReadAll()
 	if err != nil {
 		c.Logger().Errorf("failed to read csv: %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newFieldError(http.StatusInternalServerError, ErrCodeCSVRead, "failed to read csv file", "chairs")
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
 		c.Logger().Errorf("failed to begin tx: %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 	defer tx.Rollback()
 	for _, row := range records {
@@ -379,30 +515,29 @@ func postChair(c echo.Context) error {
 		stock := rm.NextInt()
 		if err := rm.Err(); err != nil {
 			c.Logger().Errorf("failed to read record: %v", err)
-			return c.NoContent(http.StatusBadRequest)
+			return newFieldError(http.StatusBadRequest, ErrCodeInvalidCSVRecord, "invalid csv record", "chairs")
 		}
 		_, err := tx.Exec("INSERT INTO chair(id, name, description, thumbnail, price, height, width, depth, color, features, kind, popularity, stock) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)", id, name, description, thumbnail, price, height, width, depth, color, features, kind, popularity, stock)
 		if err != nil {
 			c.Logger().Errorf("failed to insert chair: %v", err)
-			return c.NoContent(http.StatusInternalServerError)
+			return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 		}
 	}
 	if err := tx.Commit(); err != nil {
 		c.Logger().Errorf("failed to commit tx: %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 	return c.NoContent(http.StatusCreated)
 }
 
-func searchChairs(c echo.Context) error {
+func buildChairSearchCondition(q url.Values) ([]string, []interface{}, error) {
 	conditions := make([]string, 0)
 	params := make([]interface{}, 0)
 
-	if c.QueryParam("priceRangeId") != "" {
-		chairPrice, err := getRange(chairSearchCondition.Price, c.QueryParam("priceRangeId"))
+	if q.Get("priceRangeId") != "" {
+		chairPrice, err := getRange(chairSearchCondition.Price, q.Get("priceRangeId"))
 		if err != nil {
-			c.Echo().Logger.Infof("priceRangeID invalid, %v : %v", c.QueryParam("priceRangeId"), err)
-			return c.NoContent(http.StatusBadRequest)
+			return nil, nil, newFieldError(http.StatusBadRequest, ErrCodeInvalidRangeID, fmt.Sprintf("priceRangeID invalid, %v : %v", q.Get("priceRangeId"), err), "priceRangeId")
 		}
 
 		if chairPrice.Min != -1 {
@@ -415,11 +550,10 @@ func searchChairs(c echo.Context) error {
 		}
 	}
 
-	if c.QueryParam("heightRangeId") != "" {
-		chairHeight, err := getRange(chairSearchCondition.Height, c.QueryParam("heightRangeId"))
+	if q.Get("heightRangeId") != "" {
+		chairHeight, err := getRange(chairSearchCondition.Height, q.Get("heightRangeId"))
 		if err != nil {
-			c.Echo().Logger.Infof("heightRangeIf invalid, %v : %v", c.QueryParam("heightRangeId"), err)
-			return c.NoContent(http.StatusBadRequest)
+			return nil, nil, newFieldError(http.StatusBadRequest, ErrCodeInvalidRangeID, fmt.Sprintf("heightRangeID invalid, %v : %v", q.Get("heightRangeId"), err), "heightRangeId")
 		}
 
 		if chairHeight.Min != -1 {
@@ -432,11 +566,10 @@ func searchChairs(c echo.Context) error {
 		}
 	}
 
-	if c.QueryParam("widthRangeId") != "" {
-		chairWidth, err := getRange(chairSearchCondition.Width, c.QueryParam("widthRangeId"))
+	if q.Get("widthRangeId") != "" {
+		chairWidth, err := getRange(chairSearchCondition.Width, q.Get("widthRangeId"))
 		if err != nil {
-			c.Echo().Logger.Infof("widthRangeID invalid, %v : %v", c.QueryParam("widthRangeId"), err)
-			return c.NoContent(http.StatusBadRequest)
+			return nil, nil, newFieldError(http.StatusBadRequest, ErrCodeInvalidRangeID, fmt.Sprintf("widthRangeID invalid, %v : %v", q.Get("widthRangeId"), err), "widthRangeId")
 		}
 
 		if chairWidth.Min != -1 {
@@ -449,11 +582,10 @@ func searchChairs(c echo.Context) error {
 		}
 	}
 
-	if c.QueryParam("depthRangeId") != "" {
-		chairDepth, err := getRange(chairSearchCondition.Depth, c.QueryParam("depthRangeId"))
+	if q.Get("depthRangeId") != "" {
+		chairDepth, err := getRange(chairSearchCondition.Depth, q.Get("depthRangeId"))
 		if err != nil {
-			c.Echo().Logger.Infof("depthRangeId invalid, %v : %v", c.QueryParam("depthRangeId"), err)
-			return c.NoContent(http.StatusBadRequest)
+			return nil, nil, newFieldError(http.StatusBadRequest, ErrCodeInvalidRangeID, fmt.Sprintf("depthRangeId invalid, %v : %v", q.Get("depthRangeId"), err), "depthRangeId")
 		}
 
 		if chairDepth.Min != -1 {
@@ -466,26 +598,45 @@ func searchChairs(c echo.Context) error {
 		}
 	}
 
-	if c.QueryParam("kind") != "" {
-		conditions = append(conditions, "kind = ?")
-		params = append(params, c.QueryParam("kind"))
+	if q.Get("kind") != "" {
+		kinds := strings.Split(q.Get("kind"), ",")
+		conditions = append(conditions, "kind IN ("+placeholders(len(kinds))+")")
+		for _, k := range kinds {
+			params = append(params, k)
+		}
 	}
 
-	if c.QueryParam("color") != "" {
-		conditions = append(conditions, "color = ?")
-		params = append(params, c.QueryParam("color"))
+	if q.Get("color") != "" {
+		colors := strings.Split(q.Get("color"), ",")
+		conditions = append(conditions, "color IN ("+placeholders(len(colors))+")")
+		for _, color := range colors {
+			params = append(params, color)
+		}
 	}
 
-	if c.QueryParam("features") != "" {
-		for _, f := range strings.Split(c.QueryParam("features"), ",") {
-			conditions = append(conditions, "features LIKE CONCAT('%', ?, '%')")
-			params = append(params, f)
-		}
+	if !isValidFeatureMode(q.Get("featureMode")) {
+		return nil, nil, newFieldError(http.StatusBadRequest, ErrCodeInvalidFeatureMode, fmt.Sprintf("featureMode invalid, %v", q.Get("featureMode")), "featureMode")
+	}
+
+	if q.Get("features") != "" {
+		featureCondition, featureParams := buildFeatureCondition(strings.Split(q.Get("features"), ","), q.Get("featureMode"))
+		conditions = append(conditions, featureCondition)
+		params = append(params, featureParams...)
+	}
+
+	return conditions, params, nil
+}
+
+func searchChairs(c echo.Context) error {
+	conditions, params, err := buildChairSearchCondition(c.QueryParams())
+	if err != nil {
+		c.Echo().Logger.Infof("%v", err)
+		return err
 	}
 
 	if len(conditions) == 0 {
 		c.Echo().Logger.Infof("Search condition not found")
-		return c.NoContent(http.StatusBadRequest)
+		return newAPIError(http.StatusBadRequest, ErrCodeMissingSearchCondition, "at least one search condition is required")
 	}
 
 	conditions = append(conditions, "stock > 0")
@@ -493,13 +644,13 @@ func searchChairs(c echo.Context) error {
 	page, err := strconv.Atoi(c.QueryParam("page"))
 	if err != nil {
 		c.Logger().Infof("Invalid format page parameter : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidPage, "page must be an integer", "page")
 	}
 
 	perPage, err := strconv.Atoi(c.QueryParam("perPage"))
 	if err != nil {
 		c.Logger().Infof("Invalid format perPage parameter : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidPerPage, "perPage must be an integer", "perPage")
 	}
 
 	searchQuery := "SELECT * FROM chair WHERE "
@@ -511,7 +662,7 @@ func searchChairs(c echo.Context) error {
 	err = db.Get(&res.Count, countQuery+searchCondition, params...)
 	if err != nil {
 		c.Logger().Errorf("searchChairs DB execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	chairs := []Chair{}
@@ -522,7 +673,7 @@ func searchChairs(c echo.Context) error {
 			return c.JSON(http.StatusOK, ChairSearchResponse{Count: 0, Chairs: []Chair{}})
 		}
 		c.Logger().Errorf("searchChairs DB execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	res.Chairs = chairs
@@ -534,25 +685,25 @@ func buyChair(c echo.Context) error {
 	m := echo.Map{}
 	if err := c.Bind(&m); err != nil {
 		c.Echo().Logger.Infof("post buy chair failed : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusBadRequest, ErrCodeInvalidRequestBody, "failed to parse request body")
 	}
 
 	_, ok := m["email"].(string)
 	if !ok {
 		c.Echo().Logger.Info("post buy chair failed : email not found in request body")
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeMissingEmail, "email is required", "email")
 	}
 
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.Echo().Logger.Infof("post buy chair failed : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidID, "id must be an integer", "id")
 	}
 
 	tx, err := db.Beginx()
 	if err != nil {
 		c.Echo().Logger.Errorf("failed to create transaction : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 	defer tx.Rollback()
 
@@ -561,22 +712,22 @@ func buyChair(c echo.Context) error {
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.Echo().Logger.Infof("buyChair chair id \"%v\" not found", id)
-			return c.NoContent(http.StatusNotFound)
+			return newAPIError(http.StatusNotFound, ErrCodeChairNotFound, "chair not found or sold out")
 		}
 		c.Echo().Logger.Errorf("DB Execution Error: on getting a chair by id : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	_, err = tx.Exec("UPDATE chair SET stock = stock - 1 WHERE id = ?", id)
 	if err != nil {
 		c.Echo().Logger.Errorf("chair stock update failed : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	err = tx.Commit()
 	if err != nil {
 		c.Echo().Logger.Errorf("transaction commit error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -586,6 +737,77 @@ func getChairSearchCondition(c echo.Context) error {
 	return c.JSON(http.StatusOK, chairSearchCondition)
 }
 
+// getChairSearchFacets 現在の検索条件で各選択肢を選んだときにヒットする在庫ありのイスの件数を返す
+// 件数は searchChairs の count と一致する
+func getChairSearchFacets(c echo.Context) error {
+	q := c.QueryParams()
+	if _, _, err := buildChairSearchCondition(q); err != nil {
+		c.Echo().Logger.Infof("%v", err)
+		return err
+	}
+
+	var facets ChairSearchFacets
+	var err error
+
+	rangeFacets := []struct {
+		key    string
+		column string
+		cond   RangeCondition
+		facets *[]RangeFacet
+	}{
+		{"priceRangeId", "price", chairSearchCondition.Price, &facets.Price},
+		{"heightRangeId", "height", chairSearchCondition.Height, &facets.Height},
+		{"widthRangeId", "width", chairSearchCondition.Width, &facets.Width},
+		{"depthRangeId", "depth", chairSearchCondition.Depth, &facets.Depth},
+	}
+	for _, rf := range rangeFacets {
+		*rf.facets, err = countRangeFacets("chair", chairSearchConditionWithout(q, rf.key), rf.column, rf.cond)
+		if err != nil {
+			c.Logger().Errorf("getChairSearchFacets DB execution error : %v", err)
+			return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
+		}
+	}
+
+	listFacets := []struct {
+		key    string
+		column string
+		list   []string
+		facets *[]ListFacet
+	}{
+		{"kind", "kind", chairSearchCondition.Kind.List, &facets.Kind},
+		{"color", "color", chairSearchCondition.Color.List, &facets.Color},
+	}
+	for _, lf := range listFacets {
+		*lf.facets, err = countListFacets("chair", chairSearchConditionWithout(q, lf.key), lf.list, columnEqualBucket(lf.column))
+		if err != nil {
+			c.Logger().Errorf("getChairSearchFacets DB execution error : %v", err)
+			return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
+		}
+	}
+
+	featureKey, bucket := featureFacetBucket(q)
+	facets.Feature, err = countListFacets("chair", chairSearchConditionWithout(q, featureKey), chairSearchCondition.Feature.List, bucket)
+	if err != nil {
+		c.Logger().Errorf("getChairSearchFacets DB execution error : %v", err)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
+	}
+
+	return c.JSON(http.StatusOK, facets)
+}
+
+func chairSearchConditionWithout(q url.Values, key string) sqlCondition {
+	without := url.Values{}
+	for k, v := range q {
+		if k != key {
+			without[k] = v
+		}
+	}
+	// 検証済みのクエリなのでエラーにはならない
+	conditions, params, _ := buildChairSearchCondition(without)
+	conditions = append(conditions, "stock > 0")
+	return sqlCondition{conditions: conditions, params: params}
+}
+
 func getLowPricedChair(c echo.Context) error {
 	var chairs []Chair
 	query := `SELECT * FROM chair WHERE stock > 0 ORDER BY price ASC, id ASC LIMIT ?`
@@ -596,7 +818,7 @@ func getLowPricedChair(c echo.Context) error {
 			return c.JSON(http.StatusOK, ChairListResponse{[]Chair{}})
 		}
 		c.Logger().Errorf("getLowPricedChair DB execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	return c.JSON(http.StatusOK, ChairListResponse{Chairs: chairs})
@@ -606,7 +828,7 @@ func getEstateDetail(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.Echo().Logger.Infof("Request parameter \"id\" parse error : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidID, "id must be an integer", "id")
 	}
 
 	var estate Estate
@@ -614,10 +836,10 @@ func getEstateDetail(c echo.Context) error {
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.Echo().Logger.Infof("getEstateDetail estate id %v not found", id)
-			return c.NoContent(http.StatusNotFound)
+			return newAPIError(http.StatusNotFound, ErrCodeEstateNotFound, "estate not found")
 		}
 		c.Echo().Logger.Errorf("Database Execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	return c.JSON(http.StatusOK, estate)
@@ -636,28 +858,52 @@ func getRange(cond RangeCondition, rangeID string) (*Range, error) {
 	return cond.Ranges[RangeIndex], nil
 }
 
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func isValidFeatureMode(mode string) bool {
+	return mode == "" || mode == FeatureModeAll || mode == FeatureModeAny
+}
+
+// buildFeatureCondition カンマ区切りで保存されている features をトークン単位で完全一致させる条件を作る
+// mode が FeatureModeAny のときはいずれか、それ以外のときはすべてのトークンを含むものに一致する
+func buildFeatureCondition(features []string, mode string) (string, []interface{}) {
+	conditions := make([]string, 0, len(features))
+	params := make([]interface{}, 0, len(features))
+	for _, f := range features {
+		conditions = append(conditions, "FIND_IN_SET(?, features) > 0")
+		params = append(params, f)
+	}
+
+	if mode == FeatureModeAny {
+		return "(" + strings.Join(conditions, " OR ") + ")", params
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", params
+}
+
 func postEstate(c echo.Context) error {
 	header, err := c.FormFile("estates")
 	if err != nil {
 		c.Logger().Errorf("failed to get form file: %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeMissingCSV, "csv file is required", "estates")
 	}
 	f, err := header.Open()
 	if err != nil {
 		c.Logger().Errorf("failed to open form file: %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newFieldError(http.StatusInternalServerError, ErrCodeCSVRead, "failed to open csv file", "estates")
 	}
 	defer f.Close()
 	records, err := csv.NewReader(f).ReadAll()
 	if err != nil {
 		c.Logger().Errorf("failed to read csv: %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newFieldError(http.StatusInternalServerError, ErrCodeCSVRead, "failed to read csv file", "estates")
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
 		c.Logger().Errorf("failed to begin tx: %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 	defer tx.Rollback()
 	for _, row := range records {
@@ -676,30 +922,29 @@ func postEstate(c echo.Context) error {
 		popularity := rm.NextInt()
 		if err := rm.Err(); err != nil {
 			c.Logger().Errorf("failed to read record: %v", err)
-			return c.NoContent(http.StatusBadRequest)
+			return newFieldError(http.StatusBadRequest, ErrCodeInvalidCSVRecord, "invalid csv record", "estates")
 		}
 		_, err := tx.Exec("INSERT INTO estate(id, name, description, thumbnail, address, latitude, longitude, rent, door_height, door_width, features, popularity) VALUES(?,?,?,?,?,?,?,?,?,?,?,?)", id, name, description, thumbnail, address, latitude, longitude, rent, doorHeight, doorWidth, features, popularity)
 		if err != nil {
 			c.Logger().Errorf("failed to insert estate: %v", err)
-			return c.NoContent(http.StatusInternalServerError)
+			return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 		}
 	}
 	if err := tx.Commit(); err != nil {
 		c.Logger().Errorf("failed to commit tx: %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 	return c.NoContent(http.StatusCreated)
 }
 
-func searchEstates(c echo.Context) error {
+func buildEstateSearchCondition(q url.Values) ([]string, []interface{}, error) {
 	conditions := make([]string, 0)
 	params := make([]interface{}, 0)
 
-	if c.QueryParam("doorHeightRangeId") != "" {
-		doorHeight, err := getRange(estateSearchCondition.DoorHeight, c.QueryParam("doorHeightRangeId"))
+	if q.Get("doorHeightRangeId") != "" {
+		doorHeight, err := getRange(estateSearchCondition.DoorHeight, q.Get("doorHeightRangeId"))
 		if err != nil {
-			c.Echo().Logger.Infof("doorHeightRangeID invalid, %v : %v", c.QueryParam("doorHeightRangeId"), err)
-			return c.NoContent(http.StatusBadRequest)
+			return nil, nil, newFieldError(http.StatusBadRequest, ErrCodeInvalidRangeID, fmt.Sprintf("doorHeightRangeID invalid, %v : %v", q.Get("doorHeightRangeId"), err), "doorHeightRangeId")
 		}
 
 		if doorHeight.Min != -1 {
@@ -712,11 +957,10 @@ func searchEstates(c echo.Context) error {
 		}
 	}
 
-	if c.QueryParam("doorWidthRangeId") != "" {
-		doorWidth, err := getRange(estateSearchCondition.DoorWidth, c.QueryParam("doorWidthRangeId"))
+	if q.Get("doorWidthRangeId") != "" {
+		doorWidth, err := getRange(estateSearchCondition.DoorWidth, q.Get("doorWidthRangeId"))
 		if err != nil {
-			c.Echo().Logger.Infof("doorWidthRangeID invalid, %v : %v", c.QueryParam("doorWidthRangeId"), err)
-			return c.NoContent(http.StatusBadRequest)
+			return nil, nil, newFieldError(http.StatusBadRequest, ErrCodeInvalidRangeID, fmt.Sprintf("doorWidthRangeID invalid, %v : %v", q.Get("doorWidthRangeId"), err), "doorWidthRangeId")
 		}
 
 		if doorWidth.Min != -1 {
@@ -729,11 +973,10 @@ func searchEstates(c echo.Context) error {
 		}
 	}
 
-	if c.QueryParam("rentRangeId") != "" {
-		estateRent, err := getRange(estateSearchCondition.Rent, c.QueryParam("rentRangeId"))
+	if q.Get("rentRangeId") != "" {
+		estateRent, err := getRange(estateSearchCondition.Rent, q.Get("rentRangeId"))
 		if err != nil {
-			c.Echo().Logger.Infof("rentRangeID invalid, %v : %v", c.QueryParam("rentRangeId"), err)
-			return c.NoContent(http.StatusBadRequest)
+			return nil, nil, newFieldError(http.StatusBadRequest, ErrCodeInvalidRangeID, fmt.Sprintf("rentRangeID invalid, %v : %v", q.Get("rentRangeId"), err), "rentRangeId")
 		}
 
 		if estateRent.Min != -1 {
@@ -746,28 +989,41 @@ func searchEstates(c echo.Context) error {
 		}
 	}
 
-	if c.QueryParam("features") != "" {
-		for _, f := range strings.Split(c.QueryParam("features"), ",") {
-			conditions = append(conditions, "features like concat('%', ?, '%')")
-			params = append(params, f)
-		}
+	if !isValidFeatureMode(q.Get("featureMode")) {
+		return nil, nil, newFieldError(http.StatusBadRequest, ErrCodeInvalidFeatureMode, fmt.Sprintf("featureMode invalid, %v", q.Get("featureMode")), "featureMode")
+	}
+
+	if q.Get("features") != "" {
+		featureCondition, featureParams := buildFeatureCondition(strings.Split(q.Get("features"), ","), q.Get("featureMode"))
+		conditions = append(conditions, featureCondition)
+		params = append(params, featureParams...)
+	}
+
+	return conditions, params, nil
+}
+
+func searchEstates(c echo.Context) error {
+	conditions, params, err := buildEstateSearchCondition(c.QueryParams())
+	if err != nil {
+		c.Echo().Logger.Infof("%v", err)
+		return err
 	}
 
 	if len(conditions) == 0 {
 		c.Echo().Logger.Infof("searchEstates search condition not found")
-		return c.NoContent(http.StatusBadRequest)
+		return newAPIError(http.StatusBadRequest, ErrCodeMissingSearchCondition, "at least one search condition is required")
 	}
 
 	page, err := strconv.Atoi(c.QueryParam("page"))
 	if err != nil {
 		c.Logger().Infof("Invalid format page parameter : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidPage, "page must be an integer", "page")
 	}
 
 	perPage, err := strconv.Atoi(c.QueryParam("perPage"))
 	if err != nil {
 		c.Logger().Infof("Invalid format perPage parameter : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidPerPage, "perPage must be an integer", "perPage")
 	}
 
 	searchQuery := "SELECT * FROM estate WHERE "
@@ -779,7 +1035,7 @@ func searchEstates(c echo.Context) error {
 	err = db.Get(&res.Count, countQuery+searchCondition, params...)
 	if err != nil {
 		c.Logger().Errorf("searchEstates DB execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	estates := []Estate{}
@@ -790,7 +1046,7 @@ func searchEstates(c echo.Context) error {
 			return c.JSON(http.StatusOK, EstateSearchResponse{Count: 0, Estates: []Estate{}})
 		}
 		c.Logger().Errorf("searchEstates DB execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	res.Estates = estates
@@ -808,7 +1064,7 @@ func getLowPricedEstate(c echo.Context) error {
 			return c.JSON(http.StatusOK, EstateListResponse{[]Estate{}})
 		}
 		c.Logger().Errorf("getLowPricedEstate DB execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	return c.JSON(http.StatusOK, EstateListResponse{Estates: estates})
@@ -818,7 +1074,7 @@ func searchRecommendedEstateWithChair(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.Logger().Infof("Invalid format searchRecommendedEstateWithChair id : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidID, "id must be an integer", "id")
 	}
 
 	chair := Chair{}
@@ -827,10 +1083,10 @@ func searchRecommendedEstateWithChair(c echo.Context) error {
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.Logger().Infof("Requested chair id \"%v\" not found", id)
-			return c.NoContent(http.StatusBadRequest)
+			return newFieldError(http.StatusBadRequest, ErrCodeChairNotFound, "chair not found", "id")
 		}
 		c.Logger().Errorf("Database execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	var estates []Estate
@@ -844,22 +1100,74 @@ func searchRecommendedEstateWithChair(c echo.Context) error {
 			return c.JSON(http.StatusOK, EstateListResponse{[]Estate{}})
 		}
 		c.Logger().Errorf("Database execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	return c.JSON(http.StatusOK, EstateListResponse{Estates: estates})
 }
 
+func searchRecommendedChairWithEstate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Logger().Infof("Invalid format searchRecommendedChairWithEstate id : %v", err)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidID, "id must be an integer", "id")
+	}
+
+	estate := Estate{}
+	query := `SELECT * FROM estate WHERE id = ?`
+	err = db.Get(&estate, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.Logger().Infof("Requested estate id \"%v\" not found", id)
+			return newFieldError(http.StatusBadRequest, ErrCodeEstateNotFound, "estate not found", "id")
+		}
+		c.Logger().Errorf("Database execution error : %v", err)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
+	}
+
+	w := estate.DoorWidth
+	h := estate.DoorHeight
+	conditions := []string{
+		"stock > 0",
+		"((width <= ? AND height <= ?) OR (width <= ? AND depth <= ?) OR (height <= ? AND width <= ?) OR (height <= ? AND depth <= ?) OR (depth <= ? AND width <= ?) OR (depth <= ? AND height <= ?))",
+	}
+	params := []interface{}{w, h, w, h, w, h, w, h, w, h, w, h}
+
+	if c.QueryParam("maxPrice") != "" {
+		maxPrice, err := strconv.Atoi(c.QueryParam("maxPrice"))
+		if err != nil || maxPrice < 0 {
+			c.Logger().Infof("Invalid format maxPrice parameter : %v", c.QueryParam("maxPrice"))
+			return newFieldError(http.StatusBadRequest, ErrCodeInvalidMaxPrice, "maxPrice must be a non-negative integer", "maxPrice")
+		}
+		conditions = append(conditions, "price <= ?")
+		params = append(params, maxPrice)
+	}
+
+	var chairs []Chair
+	query = `SELECT * FROM chair WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY popularity DESC, id ASC LIMIT ?`
+	params = append(params, Limit)
+	err = db.Select(&chairs, query, params...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusOK, ChairListResponse{[]Chair{}})
+		}
+		c.Logger().Errorf("Database execution error : %v", err)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
+	}
+
+	return c.JSON(http.StatusOK, ChairListResponse{Chairs: chairs})
+}
+
 func searchEstateNazotte(c echo.Context) error {
 	coordinates := Coordinates{}
 	err := c.Bind(&coordinates)
 	if err != nil {
 		c.Echo().Logger.Infof("post search estate nazotte failed : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newAPIError(http.StatusBadRequest, ErrCodeInvalidRequestBody, "failed to parse request body")
 	}
 
 	if len(coordinates.Coordinates) == 0 {
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeMissingCoordinates, "coordinates are required", "coordinates")
 	}
 
 	b := coordinates.getBoundingBox()
@@ -871,7 +1179,7 @@ func searchEstateNazotte(c echo.Context) error {
 		return c.JSON(http.StatusOK, EstateSearchResponse{Count: 0, Estates: []Estate{}})
 	} else if err != nil {
 		c.Echo().Logger.Errorf("database execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	estatesInPolygon := []Estate{}
@@ -886,7 +1194,7 @@ func searchEstateNazotte(c echo.Context) error {
 				continue
 			} else {
 				c.Echo().Logger.Errorf("db access is failed on executing validate if estate is in polygon : %v", err)
-				return c.NoContent(http.StatusInternalServerError)
+				return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 			}
 		} else {
 			estatesInPolygon = append(estatesInPolygon, validatedEstate)
@@ -909,19 +1217,19 @@ func postEstateRequestDocument(c echo.Context) error {
 	m := echo.Map{}
 	if err := c.Bind(&m); err != nil {
 		c.Echo().Logger.Infof("post request document failed : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusBadRequest, ErrCodeInvalidRequestBody, "failed to parse request body")
 	}
 
 	_, ok := m["email"].(string)
 	if !ok {
 		c.Echo().Logger.Info("post request document failed : email not found in request body")
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeMissingEmail, "email is required", "email")
 	}
 
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.Echo().Logger.Infof("post request document failed : %v", err)
-		return c.NoContent(http.StatusBadRequest)
+		return newFieldError(http.StatusBadRequest, ErrCodeInvalidID, "id must be an integer", "id")
 	}
 
 	estate := Estate{}
@@ -929,10 +1237,10 @@ func postEstateRequestDocument(c echo.Context) error {
 	err = db.Get(&estate, query, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.NoContent(http.StatusNotFound)
+			return newAPIError(http.StatusNotFound, ErrCodeEstateNotFound, "estate not found")
 		}
 		c.Logger().Errorf("postEstateRequestDocument DB execution error : %v", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -942,6 +1250,173 @@ func getEstateSearchCondition(c echo.Context) error {
 	return c.JSON(http.StatusOK, estateSearchCondition)
 }
 
+// getEstateSearchFacets 現在の検索条件で各選択肢を選んだときにヒットする物件の件数を返す
+// 件数は searchEstates の count と一致する
+func getEstateSearchFacets(c echo.Context) error {
+	q := c.QueryParams()
+	if _, _, err := buildEstateSearchCondition(q); err != nil {
+		c.Echo().Logger.Infof("%v", err)
+		return err
+	}
+
+	var facets EstateSearchFacets
+	var err error
+
+	rangeFacets := []struct {
+		key    string
+		column string
+		cond   RangeCondition
+		facets *[]RangeFacet
+	}{
+		{"doorHeightRangeId", "door_height", estateSearchCondition.DoorHeight, &facets.DoorHeight},
+		{"doorWidthRangeId", "door_width", estateSearchCondition.DoorWidth, &facets.DoorWidth},
+		{"rentRangeId", "rent", estateSearchCondition.Rent, &facets.Rent},
+	}
+	for _, rf := range rangeFacets {
+		*rf.facets, err = countRangeFacets("estate", estateSearchConditionWithout(q, rf.key), rf.column, rf.cond)
+		if err != nil {
+			c.Logger().Errorf("getEstateSearchFacets DB execution error : %v", err)
+			return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
+		}
+	}
+
+	featureKey, bucket := featureFacetBucket(q)
+	facets.Feature, err = countListFacets("estate", estateSearchConditionWithout(q, featureKey), estateSearchCondition.Feature.List, bucket)
+	if err != nil {
+		c.Logger().Errorf("getEstateSearchFacets DB execution error : %v", err)
+		return newAPIError(http.StatusInternalServerError, ErrCodeDatabase, "database error")
+	}
+
+	return c.JSON(http.StatusOK, facets)
+}
+
+func estateSearchConditionWithout(q url.Values, key string) sqlCondition {
+	without := url.Values{}
+	for k, v := range q {
+		if k != key {
+			without[k] = v
+		}
+	}
+	// 検証済みのクエリなのでエラーにはならない
+	conditions, params, _ := buildEstateSearchCondition(without)
+	return sqlCondition{conditions: conditions, params: params}
+}
+
+type sqlCondition struct {
+	conditions []string
+	params     []interface{}
+}
+
+func (sc sqlCondition) where() string {
+	if len(sc.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(sc.conditions, " AND ")
+}
+
+// countFacets buckets の各条件について、sc に一致するレコードのうち条件も満たす件数を1クエリで数える
+func countFacets(table string, sc sqlCondition, buckets []string, bucketParams []interface{}) ([]int64, error) {
+	counts := make([]int64, len(buckets))
+	if len(buckets) == 0 {
+		return counts, nil
+	}
+
+	columns := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		columns = append(columns, fmt.Sprintf("COUNT(CASE WHEN %s THEN 1 END)", b))
+	}
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM " + table + sc.where()
+
+	dest := make([]interface{}, 0, len(counts))
+	for i := range counts {
+		dest = append(dest, &counts[i])
+	}
+	params := append(append([]interface{}{}, bucketParams...), sc.params...)
+	if err := db.QueryRowx(query, params...).Scan(dest...); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func countRangeFacets(table string, sc sqlCondition, column string, cond RangeCondition) ([]RangeFacet, error) {
+	buckets := make([]string, 0, len(cond.Ranges))
+	bucketParams := make([]interface{}, 0)
+	for _, r := range cond.Ranges {
+		bucket := make([]string, 0, 2)
+		if r.Min != -1 {
+			bucket = append(bucket, column+" >= ?")
+			bucketParams = append(bucketParams, r.Min)
+		}
+		if r.Max != -1 {
+			bucket = append(bucket, column+" < ?")
+			bucketParams = append(bucketParams, r.Max)
+		}
+		if len(bucket) == 0 {
+			bucket = append(bucket, "TRUE")
+		}
+		buckets = append(buckets, strings.Join(bucket, " AND "))
+	}
+
+	counts, err := countFacets(table, sc, buckets, bucketParams)
+	if err != nil {
+		return nil, err
+	}
+
+	facets := make([]RangeFacet, 0, len(cond.Ranges))
+	for i, r := range cond.Ranges {
+		facets = append(facets, RangeFacet{ID: r.ID, Count: counts[i]})
+	}
+	return facets, nil
+}
+
+type facetBucket func(name string) (string, []interface{})
+
+func columnEqualBucket(column string) facetBucket {
+	return func(name string) (string, []interface{}) {
+		return column + " = ?", []interface{}{name}
+	}
+}
+
+// featureFacetBucket 現在の条件に feature を1つ追加したときの件数を数えるための条件を返す
+// all のときは現在の features の条件に AND で足せばよいが、any のときは OR の中に追加する必要があるため
+// 返り値の key の条件を外した上で features の条件をまるごと作り直す
+func featureFacetBucket(q url.Values) (string, facetBucket) {
+	if q.Get("featureMode") != FeatureModeAny || q.Get("features") == "" {
+		return "", func(name string) (string, []interface{}) {
+			return buildFeatureCondition([]string{name}, FeatureModeAll)
+		}
+	}
+
+	current := strings.Split(q.Get("features"), ",")
+	return "features", func(name string) (string, []interface{}) {
+		features := make([]string, 0, len(current)+1)
+		features = append(features, current...)
+		features = append(features, name)
+		return buildFeatureCondition(features, FeatureModeAny)
+	}
+}
+
+func countListFacets(table string, sc sqlCondition, list []string, bucket facetBucket) ([]ListFacet, error) {
+	buckets := make([]string, 0, len(list))
+	bucketParams := make([]interface{}, 0, len(list))
+	for _, name := range list {
+		b, params := bucket(name)
+		buckets = append(buckets, b)
+		bucketParams = append(bucketParams, params...)
+	}
+
+	counts, err := countFacets(table, sc, buckets, bucketParams)
+	if err != nil {
+		return nil, err
+	}
+
+	facets := make([]ListFacet, 0, len(list))
+	for i, name := range list {
+		facets = append(facets, ListFacet{Name: name, Count: counts[i]})
+	}
+	return facets, nil
+}
+
 func (cs Coordinates) getBoundingBox() BoundingBox {
 	coordinates := cs.Coordinates
 	boundingBox := BoundingBox{
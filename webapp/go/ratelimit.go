@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	RateLimitKeyIP        = "ip"
+	RateLimitKeyUserAgent = "user_agent"
+)
+
+// bucketIdleTimeout これ以上アクセスのないバケットは破棄する
+const bucketIdleTimeout = 10 * time.Minute
+
+// RateLimitBudget トークンバケットの設定。Rate が 0 以下なら制限しない
+type RateLimitBudget struct {
+	// Rate 1秒あたりに補充されるトークン数
+	Rate float64 `json:"rate"`
+	// Burst バケットに貯められるトークンの上限
+	Burst int `json:"burst"`
+}
+
+// RateLimitConfig レートリミットの設定。ルートは "POST /api/estate/nazotte" の形式で指定する
+type RateLimitConfig struct {
+	Key     string                     `json:"key"`
+	Default RateLimitBudget            `json:"default"`
+	Routes  map[string]RateLimitBudget `json:"routes"`
+}
+
+type tokenBucket struct {
+	tokens   float64
+	updateAt time.Time
+}
+
+type rateLimiter struct {
+	config  RateLimitConfig
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweptAt time.Time
+}
+
+func loadRateLimitConfig(path string) (*RateLimitConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := RateLimitConfig{Key: RateLimitKeyIP}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+
+	if config.Key != RateLimitKeyIP && config.Key != RateLimitKeyUserAgent {
+		return nil, fmt.Errorf("invalid rate limit key: %s", config.Key)
+	}
+	budgets := []RateLimitBudget{config.Default}
+	for _, budget := range config.Routes {
+		budgets = append(budgets, budget)
+	}
+	for _, budget := range budgets {
+		if budget.Rate > 0 && budget.Burst < 1 {
+			return nil, fmt.Errorf("burst must be greater than 0 when rate is set")
+		}
+	}
+
+	return &config, nil
+}
+
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+		sweptAt: time.Now(),
+	}
+}
+
+func (l *rateLimiter) budget(route string) RateLimitBudget {
+	if budget, ok := l.config.Routes[route]; ok {
+		return budget
+	}
+	return l.config.Default
+}
+
+// take トークンを1つ消費する。消費できなかった場合は次にトークンが補充されるまでの時間を返す
+func (l *rateLimiter) take(key string, budget RateLimitBudget, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.sweptAt) > bucketIdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.updateAt) > bucketIdleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.sweptAt = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(budget.Burst), updateAt: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(budget.Burst), b.tokens+now.Sub(b.updateAt).Seconds()*budget.Rate)
+	b.updateAt = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / budget.Rate * float64(time.Second))
+}
+
+func (l *rateLimiter) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		route := c.Request().Method + " " + c.Path()
+		budget := l.budget(route)
+		if budget.Rate <= 0 {
+			return next(c)
+		}
+
+		client := c.RealIP()
+		if l.config.Key == RateLimitKeyUserAgent {
+			client = c.Request().UserAgent()
+		}
+
+		ok, wait := l.take(route+"\x00"+client, budget, time.Now())
+		if !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			return newAPIError(http.StatusTooManyRequests, ErrCodeRateLimited, fmt.Sprintf("rate limit exceeded, retry after %d seconds", retryAfter))
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	budget := RateLimitBudget{Rate: 2, Burst: 3}
+	steps := []struct {
+		name   string
+		key    string
+		after  time.Duration
+		wantOK bool
+		wait   time.Duration
+	}{
+		{name: "burst 1", key: "a", wantOK: true},
+		{name: "burst 2", key: "a", wantOK: true},
+		{name: "burst 3", key: "a", wantOK: true},
+		{name: "empty", key: "a", wantOK: false, wait: 500 * time.Millisecond},
+		{name: "other key", key: "b", wantOK: true},
+		{name: "half refilled", key: "a", after: 250 * time.Millisecond, wantOK: false, wait: 250 * time.Millisecond},
+		{name: "refilled", key: "a", after: 250 * time.Millisecond, wantOK: true},
+		{name: "empty again", key: "a", wantOK: false, wait: 500 * time.Millisecond},
+		{name: "refill capped at burst 1", key: "a", after: time.Minute, wantOK: true},
+		{name: "refill capped at burst 2", key: "a", wantOK: true},
+		{name: "refill capped at burst 3", key: "a", wantOK: true},
+		{name: "empty after idle", key: "a", wantOK: false, wait: 500 * time.Millisecond},
+	}
+
+	l := newRateLimiter(RateLimitConfig{Key: RateLimitKeyIP})
+	now := time.Now()
+	for _, s := range steps {
+		now = now.Add(s.after)
+		ok, wait := l.take(s.key, budget, now)
+		if ok != s.wantOK || wait != s.wait {
+			t.Errorf("%s: take() = %v, %v, want %v, %v", s.name, ok, wait, s.wantOK, s.wait)
+		}
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	budget := RateLimitBudget{Rate: 1, Burst: 1}
+	l := newRateLimiter(RateLimitConfig{Key: RateLimitKeyIP})
+	now := time.Now()
+	l.take("idle", budget, now)
+	l.take("active", budget, now.Add(bucketIdleTimeout/2))
+	l.take("active", budget, now.Add(bucketIdleTimeout+time.Second))
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket is not swept")
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("active bucket is swept")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	l := newRateLimiter(RateLimitConfig{
+		Key:    RateLimitKeyUserAgent,
+		Routes: map[string]RateLimitBudget{"GET /api/estate/:id": {Rate: 1, Burst: 2}},
+	})
+	e := echo.New()
+	e.HTTPErrorHandler = httpErrorHandler
+	e.Use(l.Middleware)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/api/estate/:id", ok)
+	e.GET("/api/chair/:id", ok)
+
+	requests := []struct {
+		name       string
+		path       string
+		userAgent  string
+		wantStatus int
+	}{
+		{name: "burst 1", path: "/api/estate/1", userAgent: "a", wantStatus: http.StatusOK},
+		{name: "burst 2 with another id", path: "/api/estate/2", userAgent: "a", wantStatus: http.StatusOK},
+		{name: "limited", path: "/api/estate/1", userAgent: "a", wantStatus: http.StatusTooManyRequests},
+		{name: "another client", path: "/api/estate/1", userAgent: "b", wantStatus: http.StatusOK},
+		{name: "unlimited route 1", path: "/api/chair/1", userAgent: "a", wantStatus: http.StatusOK},
+		{name: "unlimited route 2", path: "/api/chair/1", userAgent: "a", wantStatus: http.StatusOK},
+		{name: "unlimited route 3", path: "/api/chair/1", userAgent: "a", wantStatus: http.StatusOK},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(http.MethodGet, r.path, nil)
+		req.Header.Set("User-Agent", r.userAgent)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != r.wantStatus {
+			t.Errorf("%s: status = %d, want %d", r.name, rec.Code, r.wantStatus)
+			continue
+		}
+		if r.wantStatus != http.StatusTooManyRequests {
+			if got := rec.Header().Get("Retry-After"); got != "" {
+				t.Errorf("%s: Retry-After = %q, want none", r.name, got)
+			}
+			continue
+		}
+
+		if got := rec.Header().Get("Retry-After"); got != "1" {
+			t.Errorf("%s: Retry-After = %q, want %q", r.name, got, "1")
+		}
+		var res ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: %v", r.name, err)
+		}
+		if res.Code != ErrCodeRateLimited || res.Message != "rate limit exceeded, retry after 1 seconds" {
+			t.Errorf("%s: body = %+v", r.name, res)
+		}
+	}
+}
+
+func TestLoadRateLimitConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	tests := []struct {
+		name    string
+		content string
+		want    RateLimitConfig
+		wantErr bool
+	}{
+		{
+			name:    "default key",
+			content: `{"default": {"rate": 10, "burst": 20}, "routes": {"POST /api/estate/nazotte": {"rate": 1, "burst": 1}}}`,
+			want: RateLimitConfig{
+				Key:     RateLimitKeyIP,
+				Default: RateLimitBudget{Rate: 10, Burst: 20},
+				Routes:  map[string]RateLimitBudget{"POST /api/estate/nazotte": {Rate: 1, Burst: 1}},
+			},
+		},
+		{
+			name:    "user agent key",
+			content: `{"key": "user_agent", "default": {"rate": 0.5, "burst": 1}}`,
+			want:    RateLimitConfig{Key: RateLimitKeyUserAgent, Default: RateLimitBudget{Rate: 0.5, Burst: 1}},
+		},
+		{
+			name:    "unlimited without burst",
+			content: `{"default": {"rate": 0}}`,
+			want:    RateLimitConfig{Key: RateLimitKeyIP},
+		},
+		{name: "invalid key", content: `{"key": "cookie"}`, wantErr: true},
+		{name: "no default burst", content: `{"default": {"rate": 1}}`, wantErr: true},
+		{name: "no route burst", content: `{"routes": {"GET /api/chair/:id": {"rate": 1, "burst": 0}}}`, wantErr: true},
+		{name: "invalid json", content: `{"default": `, wantErr: true},
+		{name: "invalid type", content: `{"default": {"rate": "fast"}}`, wantErr: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+".json")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadRateLimitConfig(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadRateLimitConfig() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Key != tt.want.Key || got.Default != tt.want.Default || len(got.Routes) != len(tt.want.Routes) {
+				t.Errorf("loadRateLimitConfig() = %+v, want %+v", *got, tt.want)
+			}
+			for route, budget := range tt.want.Routes {
+				if got.Routes[route] != budget {
+					t.Errorf("route %s = %+v, want %+v", route, got.Routes[route], budget)
+				}
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := loadRateLimitConfig(filepath.Join(dir, "missing.json")); err == nil {
+			t.Error("loadRateLimitConfig() returned no error")
+		}
+	})
+}
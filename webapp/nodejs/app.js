@@ -10,6 +10,7 @@ const util = require("util");
 const os = require("os");
 const parse = require("csv-parse/lib/sync");
 const camelcaseKeys = require("camelcase-keys");
+const { loadRateLimitConfig, RateLimiter } = require("./ratelimit");
 const upload = multer();
 const promisify = util.promisify;
 const exec = promisify(cp.exec);
@@ -28,11 +29,43 @@ const dbinfo = {
   connectionLimit: 10,
 };
 
+class APIError extends Error {
+  constructor(status, code, message, field) {
+    super(message);
+    this.status = status;
+    this.code = code;
+    this.field = field;
+  }
+
+  toJSON() {
+    const body = { code: this.code, message: this.message };
+    if (this.field) {
+      body.field = this.field;
+    }
+    return body;
+  }
+}
+
 const app = express();
 const db = mysql.createPool(dbinfo);
 app.set("db", db);
 
 app.use(morgan("combined"));
+if (process.env.RATE_LIMIT_CONFIG) {
+  const limiter = new RateLimiter(
+    loadRateLimitConfig(process.env.RATE_LIMIT_CONFIG)
+  );
+  app.use(
+    limiter.middleware(
+      (retryAfter) =>
+        new APIError(
+          429,
+          "RATE_LIMITED",
+          `rate limit exceeded, retry after ${retryAfter} seconds`
+        )
+    )
+  );
+}
 app.use(express.json());
 app.post("/initialize", async (req, res, next) => {
   try {
@@ -52,7 +85,10 @@ app.post("/initialize", async (req, res, next) => {
       language: "nodejs",
     });
   } catch (e) {
-    next(e);
+    console.error(e);
+    next(
+      new APIError(500, "INITIALIZE_FAILED", "failed to initialize database")
+    );
   }
 });
 
@@ -92,7 +128,88 @@ app.get("/api/chair/low_priced", async (req, res, next) => {
   }
 });
 
-app.get("/api/chair/search", async (req, res, next) => {
+function buildFeatureCondition(features, featureMode) {
+  const joiner = featureMode === "any" ? " OR " : " AND ";
+  const matches = features.map(() => "FIND_IN_SET(?, features) > 0");
+  return [`(${matches.join(joiner)})`, features];
+}
+
+function withoutKey(q, key) {
+  const without = { ...q };
+  delete without[key];
+  return without;
+}
+
+async function countFacets(query, table, condition, buckets, bucketParams) {
+  if (buckets.length === 0) {
+    return [];
+  }
+  const columns = buckets.map(
+    (bucket, i) => `COUNT(CASE WHEN ${bucket} THEN 1 END) AS c${i}`
+  );
+  const where =
+    condition.searchQueries.length > 0
+      ? ` WHERE ${condition.searchQueries.join(" AND ")}`
+      : "";
+  const [row] = await query(
+    `SELECT ${columns.join(", ")} FROM ${table}${where}`,
+    [...bucketParams, ...condition.queryParams]
+  );
+  return buckets.map((_, i) => row[`c${i}`]);
+}
+
+async function countRangeFacets(query, table, condition, column, rangeCondition) {
+  const buckets = [];
+  const bucketParams = [];
+  for (const range of rangeCondition.ranges) {
+    const bucket = [];
+    if (range.min !== -1) {
+      bucket.push(`${column} >= ?`);
+      bucketParams.push(range.min);
+    }
+    if (range.max !== -1) {
+      bucket.push(`${column} < ?`);
+      bucketParams.push(range.max);
+    }
+    buckets.push(bucket.length > 0 ? bucket.join(" AND ") : "TRUE");
+  }
+  const counts = await countFacets(query, table, condition, buckets, bucketParams);
+  return rangeCondition.ranges.map((range, i) => ({
+    id: range.id,
+    count: counts[i],
+  }));
+}
+
+async function countListFacets(query, table, condition, list, bucket) {
+  const buckets = [];
+  const bucketParams = [];
+  for (const name of list) {
+    const [b, params] = bucket(name);
+    buckets.push(b);
+    bucketParams.push(...params);
+  }
+  const counts = await countFacets(query, table, condition, buckets, bucketParams);
+  return list.map((name, i) => ({ name, count: counts[i] }));
+}
+
+function columnEqualBucket(column) {
+  return (name) => [`${column} = ?`, [name]];
+}
+
+// 現在の条件に feature を1つ追加したときの件数を数えるための条件
+// any のときは OR の中に追加する必要があるため、返り値の key の条件を外して features の条件を作り直す
+function featureFacetBucket(q) {
+  if (q.featureMode !== "any" || !q.features) {
+    return ["", (name) => buildFeatureCondition([name], "all")];
+  }
+  const current = q.features.split(",");
+  return [
+    "features",
+    (name) => buildFeatureCondition([...current, name], "any"),
+  ];
+}
+
+function buildChairSearchCondition(q) {
   const searchQueries = [];
   const queryParams = [];
   const {
@@ -103,15 +220,20 @@ app.get("/api/chair/search", async (req, res, next) => {
     kind,
     color,
     features,
-    page,
-    perPage,
-  } = req.query;
+    featureMode,
+  } = q;
 
   if (!!priceRangeId) {
     const chairPrice = chairSearchCondition["price"].ranges[priceRangeId];
     if (chairPrice == null) {
-      res.status(400).send("priceRangeID invalid");
-      return;
+      return {
+        error: new APIError(
+          400,
+          "INVALID_RANGE_ID",
+          "priceRangeID invalid",
+          "priceRangeId"
+        ),
+      };
     }
 
     if (chairPrice.min !== -1) {
@@ -128,8 +250,14 @@ app.get("/api/chair/search", async (req, res, next) => {
   if (!!heightRangeId) {
     const chairHeight = chairSearchCondition["height"].ranges[heightRangeId];
     if (chairHeight == null) {
-      res.status(400).send("heightRangeId invalid");
-      return;
+      return {
+        error: new APIError(
+          400,
+          "INVALID_RANGE_ID",
+          "heightRangeId invalid",
+          "heightRangeId"
+        ),
+      };
     }
 
     if (chairHeight.min !== -1) {
@@ -146,8 +274,14 @@ app.get("/api/chair/search", async (req, res, next) => {
   if (!!widthRangeId) {
     const chairWidth = chairSearchCondition["width"].ranges[widthRangeId];
     if (chairWidth == null) {
-      res.status(400).send("widthRangeId invalid");
-      return;
+      return {
+        error: new APIError(
+          400,
+          "INVALID_RANGE_ID",
+          "widthRangeId invalid",
+          "widthRangeId"
+        ),
+      };
     }
 
     if (chairWidth.min !== -1) {
@@ -164,8 +298,14 @@ app.get("/api/chair/search", async (req, res, next) => {
   if (!!depthRangeId) {
     const chairDepth = chairSearchCondition["depth"].ranges[depthRangeId];
     if (chairDepth == null) {
-      res.status(400).send("depthRangeId invalid");
-      return;
+      return {
+        error: new APIError(
+          400,
+          "INVALID_RANGE_ID",
+          "depthRangeId invalid",
+          "depthRangeId"
+        ),
+      };
     }
 
     if (chairDepth.min !== -1) {
@@ -180,37 +320,77 @@ app.get("/api/chair/search", async (req, res, next) => {
   }
 
   if (!!kind) {
-    searchQueries.push("kind = ? ");
-    queryParams.push(kind);
+    const kinds = kind.split(",");
+    searchQueries.push(`kind IN (${kinds.map(() => "?").join(",")}) `);
+    queryParams.push(...kinds);
   }
 
   if (!!color) {
-    searchQueries.push("color = ? ");
-    queryParams.push(color);
+    const colors = color.split(",");
+    searchQueries.push(`color IN (${colors.map(() => "?").join(",")}) `);
+    queryParams.push(...colors);
+  }
+
+  if (!!featureMode && featureMode !== "all" && featureMode !== "any") {
+    return {
+      error: new APIError(
+        400,
+        "INVALID_FEATURE_MODE",
+        "featureMode invalid",
+        "featureMode"
+      ),
+    };
   }
 
   if (!!features) {
-    const featureConditions = features.split(",");
-    for (const featureCondition of featureConditions) {
-      searchQueries.push("features LIKE CONCAT('%', ?, '%')");
-      queryParams.push(featureCondition);
-    }
+    const [featureQuery, featureParams] = buildFeatureCondition(
+      features.split(","),
+      featureMode
+    );
+    searchQueries.push(featureQuery);
+    queryParams.push(...featureParams);
+  }
+
+  return { searchQueries, queryParams };
+}
+
+app.get("/api/chair/search", async (req, res, next) => {
+  const { error, searchQueries, queryParams } = buildChairSearchCondition(
+    req.query
+  );
+  if (error) {
+    next(error);
+    return;
   }
+  const { page, perPage } = req.query;
 
   if (searchQueries.length === 0) {
-    res.status(400).send("Search condition not found");
+    next(
+      new APIError(
+        400,
+        "MISSING_SEARCH_CONDITION",
+        "at least one search condition is required"
+      )
+    );
     return;
   }
 
   searchQueries.push("stock > 0");
 
   if (!page || page != +page) {
-    res.status(400).send(`page condition invalid ${page}`);
+    next(new APIError(400, "INVALID_PAGE", "page must be an integer", "page"));
     return;
   }
 
   if (!perPage || perPage != +perPage) {
-    res.status(400).send("perPage condition invalid");
+    next(
+      new APIError(
+        400,
+        "INVALID_PER_PAGE",
+        "perPage must be an integer",
+        "perPage"
+      )
+    );
     return;
   }
 
@@ -250,6 +430,62 @@ app.get("/api/chair/search/condition", (req, res, next) => {
   res.json(chairSearchCondition);
 });
 
+app.get("/api/chair/search/facets", async (req, res, next) => {
+  const { error } = buildChairSearchCondition(req.query);
+  if (error) {
+    next(error);
+    return;
+  }
+  const without = (key) => {
+    const condition = buildChairSearchCondition(withoutKey(req.query, key));
+    condition.searchQueries.push("stock > 0");
+    return condition;
+  };
+
+  const getConnection = promisify(db.getConnection.bind(db));
+  const connection = await getConnection();
+  const query = promisify(connection.query.bind(connection));
+  try {
+    const facets = {};
+    for (const [name, key, column] of [
+      ["price", "priceRangeId", "price"],
+      ["height", "heightRangeId", "height"],
+      ["width", "widthRangeId", "width"],
+      ["depth", "depthRangeId", "depth"],
+    ]) {
+      facets[name] = await countRangeFacets(
+        query,
+        "chair",
+        without(key),
+        column,
+        chairSearchCondition[name]
+      );
+    }
+    for (const name of ["kind", "color"]) {
+      facets[name] = await countListFacets(
+        query,
+        "chair",
+        without(name),
+        chairSearchCondition[name].list,
+        columnEqualBucket(name)
+      );
+    }
+    const [featureKey, bucket] = featureFacetBucket(req.query);
+    facets.feature = await countListFacets(
+      query,
+      "chair",
+      without(featureKey),
+      chairSearchCondition["feature"].list,
+      bucket
+    );
+    res.json(facets);
+  } catch (e) {
+    next(e);
+  } finally {
+    await connection.release();
+  }
+});
+
 app.get("/api/chair/:id", async (req, res, next) => {
   const getConnection = promisify(db.getConnection.bind(db));
   const connection = await getConnection();
@@ -257,8 +493,12 @@ app.get("/api/chair/:id", async (req, res, next) => {
   try {
     const id = req.params.id;
     const [chair] = await query("SELECT * FROM chair WHERE id = ?", [id]);
-    if (chair == null || chair.stock <= 0) {
-      res.status(404).send("Not Found");
+    if (chair == null) {
+      next(new APIError(404, "CHAIR_NOT_FOUND", "chair not found"));
+      return;
+    }
+    if (chair.stock <= 0) {
+      next(new APIError(404, "CHAIR_SOLD_OUT", "chair is sold out"));
       return;
     }
     res.json(camelcaseKeys(chair));
@@ -286,7 +526,9 @@ app.post("/api/chair/buy/:id", async (req, res, next) => {
       [id]
     );
     if (chair == null) {
-      res.status(404).send("Not Found");
+      next(
+        new APIError(404, "CHAIR_NOT_FOUND", "chair not found or sold out")
+      );
       await rollback();
       return;
     }
@@ -304,7 +546,7 @@ app.post("/api/chair/buy/:id", async (req, res, next) => {
   }
 });
 
-app.get("/api/estate/search", async (req, res, next) => {
+function buildEstateSearchCondition(q) {
   const searchQueries = [];
   const queryParams = [];
   const {
@@ -312,16 +554,21 @@ app.get("/api/estate/search", async (req, res, next) => {
     doorWidthRangeId,
     rentRangeId,
     features,
-    page,
-    perPage,
-  } = req.query;
+    featureMode,
+  } = q;
 
   if (!!doorHeightRangeId) {
     const doorHeight =
       estateSearchCondition["doorHeight"].ranges[doorHeightRangeId];
     if (doorHeight == null) {
-      res.status(400).send("doorHeightRangeId invalid");
-      return;
+      return {
+        error: new APIError(
+          400,
+          "INVALID_RANGE_ID",
+          "doorHeightRangeId invalid",
+          "doorHeightRangeId"
+        ),
+      };
     }
 
     if (doorHeight.min !== -1) {
@@ -339,8 +586,14 @@ app.get("/api/estate/search", async (req, res, next) => {
     const doorWidth =
       estateSearchCondition["doorWidth"].ranges[doorWidthRangeId];
     if (doorWidth == null) {
-      res.status(400).send("doorWidthRangeId invalid");
-      return;
+      return {
+        error: new APIError(
+          400,
+          "INVALID_RANGE_ID",
+          "doorWidthRangeId invalid",
+          "doorWidthRangeId"
+        ),
+      };
     }
 
     if (doorWidth.min !== -1) {
@@ -357,8 +610,14 @@ app.get("/api/estate/search", async (req, res, next) => {
   if (!!rentRangeId) {
     const rent = estateSearchCondition["rent"].ranges[rentRangeId];
     if (rent == null) {
-      res.status(400).send("rentRangeId invalid");
-      return;
+      return {
+        error: new APIError(
+          400,
+          "INVALID_RANGE_ID",
+          "rentRangeId invalid",
+          "rentRangeId"
+        ),
+      };
     }
 
     if (rent.min !== -1) {
@@ -372,26 +631,64 @@ app.get("/api/estate/search", async (req, res, next) => {
     }
   }
 
+  if (!!featureMode && featureMode !== "all" && featureMode !== "any") {
+    return {
+      error: new APIError(
+        400,
+        "INVALID_FEATURE_MODE",
+        "featureMode invalid",
+        "featureMode"
+      ),
+    };
+  }
+
   if (!!features) {
-    const featureConditions = features.split(",");
-    for (const featureCondition of featureConditions) {
-      searchQueries.push("features LIKE CONCAT('%', ?, '%')");
-      queryParams.push(featureCondition);
-    }
+    const [featureQuery, featureParams] = buildFeatureCondition(
+      features.split(","),
+      featureMode
+    );
+    searchQueries.push(featureQuery);
+    queryParams.push(...featureParams);
   }
 
+  return { searchQueries, queryParams };
+}
+
+app.get("/api/estate/search", async (req, res, next) => {
+  const { error, searchQueries, queryParams } = buildEstateSearchCondition(
+    req.query
+  );
+  if (error) {
+    next(error);
+    return;
+  }
+  const { page, perPage } = req.query;
+
   if (searchQueries.length === 0) {
-    res.status(400).send("Search condition not found");
+    next(
+      new APIError(
+        400,
+        "MISSING_SEARCH_CONDITION",
+        "at least one search condition is required"
+      )
+    );
     return;
   }
 
   if (!page || page != +page) {
-    res.status(400).send(`page condition invalid ${page}`);
+    next(new APIError(400, "INVALID_PAGE", "page must be an integer", "page"));
     return;
   }
 
   if (!perPage || perPage != +perPage) {
-    res.status(400).send("perPage condition invalid");
+    next(
+      new APIError(
+        400,
+        "INVALID_PER_PAGE",
+        "perPage must be an integer",
+        "perPage"
+      )
+    );
     return;
   }
 
@@ -431,6 +728,49 @@ app.get("/api/estate/search/condition", (req, res, next) => {
   res.json(estateSearchCondition);
 });
 
+app.get("/api/estate/search/facets", async (req, res, next) => {
+  const { error } = buildEstateSearchCondition(req.query);
+  if (error) {
+    next(error);
+    return;
+  }
+  const without = (key) =>
+    buildEstateSearchCondition(withoutKey(req.query, key));
+
+  const getConnection = promisify(db.getConnection.bind(db));
+  const connection = await getConnection();
+  const query = promisify(connection.query.bind(connection));
+  try {
+    const facets = {};
+    for (const [name, key, column] of [
+      ["doorHeight", "doorHeightRangeId", "door_height"],
+      ["doorWidth", "doorWidthRangeId", "door_width"],
+      ["rent", "rentRangeId", "rent"],
+    ]) {
+      facets[name] = await countRangeFacets(
+        query,
+        "estate",
+        without(key),
+        column,
+        estateSearchCondition[name]
+      );
+    }
+    const [featureKey, bucket] = featureFacetBucket(req.query);
+    facets.feature = await countListFacets(
+      query,
+      "estate",
+      without(featureKey),
+      estateSearchCondition["feature"].list,
+      bucket
+    );
+    res.json(facets);
+  } catch (e) {
+    next(e);
+  } finally {
+    await connection.release();
+  }
+});
+
 app.post("/api/estate/req_doc/:id", async (req, res, next) => {
   const id = req.params.id;
   const getConnection = promisify(db.getConnection.bind(db));
@@ -440,7 +780,7 @@ app.post("/api/estate/req_doc/:id", async (req, res, next) => {
     const id = req.params.id;
     const [estate] = await query("SELECT * FROM estate WHERE id = ?", [id]);
     if (estate == null) {
-      res.status(404).send("Not Found");
+      next(new APIError(404, "ESTATE_NOT_FOUND", "estate not found"));
       return;
     }
     res.json({ ok: true });
@@ -453,6 +793,17 @@ app.post("/api/estate/req_doc/:id", async (req, res, next) => {
 
 app.post("/api/estate/nazotte", async (req, res, next) => {
   const coordinates = req.body.coordinates;
+  if (!Array.isArray(coordinates) || coordinates.length === 0) {
+    next(
+      new APIError(
+        400,
+        "MISSING_COORDINATES",
+        "coordinates are required",
+        "coordinates"
+      )
+    );
+    return;
+  }
   const longitudes = coordinates.map((c) => c.longitude);
   const latitudes = coordinates.map((c) => c.latitude);
   const boundingbox = {
@@ -532,7 +883,7 @@ app.get("/api/estate/:id", async (req, res, next) => {
     const id = req.params.id;
     const [estate] = await query("SELECT * FROM estate WHERE id = ?", [id]);
     if (estate == null) {
-      res.status(404).send("Not Found");
+      next(new APIError(404, "ESTATE_NOT_FOUND", "estate not found"));
       return;
     }
 
@@ -551,6 +902,10 @@ app.get("/api/recommended_estate/:id", async (req, res, next) => {
   const query = promisify(connection.query.bind(connection));
   try {
     const [chair] = await query("SELECT * FROM chair WHERE id = ?", [id]);
+    if (chair == null) {
+      next(new APIError(400, "CHAIR_NOT_FOUND", "chair not found", "id"));
+      return;
+    }
     const w = chair.width;
     const h = chair.height;
     const d = chair.depth;
@@ -567,7 +922,55 @@ app.get("/api/recommended_estate/:id", async (req, res, next) => {
   }
 });
 
+app.get("/api/recommended_chair/:id", async (req, res, next) => {
+  const id = req.params.id;
+  const { maxPrice } = req.query;
+  if (!!maxPrice && !(/^\d+$/.test(maxPrice))) {
+    next(
+      new APIError(
+        400,
+        "INVALID_MAX_PRICE",
+        "maxPrice must be a non-negative integer",
+        "maxPrice"
+      )
+    );
+    return;
+  }
+  const getConnection = promisify(db.getConnection.bind(db));
+  const connection = await getConnection();
+  const query = promisify(connection.query.bind(connection));
+  try {
+    const [estate] = await query("SELECT * FROM estate WHERE id = ?", [id]);
+    if (estate == null) {
+      next(new APIError(400, "ESTATE_NOT_FOUND", "estate not found", "id"));
+      return;
+    }
+    const w = estate.door_width;
+    const h = estate.door_height;
+    let sql =
+      "SELECT * FROM chair WHERE stock > 0 AND ((width <= ? AND height <= ?) OR (width <= ? AND depth <= ?) OR (height <= ? AND width <= ?) OR (height <= ? AND depth <= ?) OR (depth <= ? AND width <= ?) OR (depth <= ? AND height <= ?))";
+    const params = [w, h, w, h, w, h, w, h, w, h, w, h];
+    if (!!maxPrice) {
+      sql += " AND price <= ?";
+      params.push(Number(maxPrice));
+    }
+    sql += " ORDER BY popularity DESC, id ASC LIMIT ?";
+    params.push(LIMIT);
+    const cs = await query(sql, params);
+    const chairs = cs.map((chair) => camelcaseKeys(chair));
+    res.json({ chairs });
+  } catch (e) {
+    next(e);
+  } finally {
+    await connection.release();
+  }
+});
+
 app.post("/api/chair", upload.single("chairs"), async (req, res, next) => {
+  if (req.file == null) {
+    next(new APIError(400, "MISSING_CSV", "csv file is required", "chairs"));
+    return;
+  }
   const getConnection = promisify(db.getConnection.bind(db));
   const connection = await getConnection();
   const beginTransaction = promisify(connection.beginTransaction.bind(connection));
@@ -596,6 +999,10 @@ app.post("/api/chair", upload.single("chairs"), async (req, res, next) => {
 });
 
 app.post("/api/estate", upload.single("estates"), async (req, res, next) => {
+  if (req.file == null) {
+    next(new APIError(400, "MISSING_CSV", "csv file is required", "estates"));
+    return;
+  }
   const getConnection = promisify(db.getConnection.bind(db));
   const connection = await getConnection();
   const beginTransaction = promisify(connection.beginTransaction.bind(connection));
@@ -623,6 +1030,43 @@ app.post("/api/estate", upload.single("estates"), async (req, res, next) => {
   }
 });
 
+app.use((req, res, next) => {
+  next(new APIError(404, "ROUTE_NOT_FOUND", "Not Found"));
+});
+
+// すべてのエラーを { code, message, field } の形式で返す
+app.use((err, req, res, next) => {
+  if (res.headersSent) {
+    next(err);
+    return;
+  }
+  let apiError = err;
+  if (!(err instanceof APIError)) {
+    if (err.type === "entity.parse.failed") {
+      apiError = new APIError(
+        400,
+        "INVALID_REQUEST_BODY",
+        "failed to parse request body"
+      );
+    } else if (typeof err.fatal === "boolean") {
+      console.error(err);
+      apiError = new APIError(500, "DATABASE_ERROR", "database error");
+    } else {
+      console.error(err);
+      apiError = new APIError(
+        500,
+        "INTERNAL_SERVER_ERROR",
+        "Internal Server Error"
+      );
+    }
+  }
+  if (req.method === "HEAD") {
+    res.status(apiError.status).end();
+    return;
+  }
+  res.status(apiError.status).json(apiError);
+});
+
 app.listen(PORT, () => {
   console.log(`Listening ${PORT}`);
 });
@@ -0,0 +1,118 @@
+"use strict";
+
+const fs = require("fs");
+
+const RATE_LIMIT_KEY_IP = "ip";
+const RATE_LIMIT_KEY_USER_AGENT = "user_agent";
+
+// これ以上アクセスのないバケットは破棄する
+const BUCKET_IDLE_TIMEOUT = 10 * 60 * 1000;
+
+// Go 実装と同じ形式の設定を読み込む。ルートは "POST /api/estate/nazotte" の形式で指定する
+function loadRateLimitConfig(path) {
+  const config = {
+    key: RATE_LIMIT_KEY_IP,
+    default: { rate: 0, burst: 0 },
+    routes: {},
+    ...JSON.parse(fs.readFileSync(path, "utf8")),
+  };
+
+  if (
+    config.key !== RATE_LIMIT_KEY_IP &&
+    config.key !== RATE_LIMIT_KEY_USER_AGENT
+  ) {
+    throw new Error(`invalid rate limit key: ${config.key}`);
+  }
+  for (const budget of [config.default, ...Object.values(config.routes)]) {
+    if (budget.rate > 0 && !(budget.burst >= 1)) {
+      throw new Error("burst must be greater than 0 when rate is set");
+    }
+  }
+
+  return config;
+}
+
+// routeOf Go 実装のルートに合わせて、数字のパスパラメータを :id に置き換える
+function routeOf(req) {
+  return `${req.method} ${req.path.replace(/\/\d+(?=\/|$)/g, "/:id")}`;
+}
+
+// clientOf echo の RealIP と同じ順でクライアントの IP を決める
+function clientOf(req, key) {
+  if (key === RATE_LIMIT_KEY_USER_AGENT) {
+    return req.get("User-Agent") ?? "";
+  }
+  const forwardedFor = req.get("X-Forwarded-For");
+  if (forwardedFor) {
+    return forwardedFor.split(", ")[0];
+  }
+  return req.get("X-Real-IP") ?? req.socket.remoteAddress;
+}
+
+class RateLimiter {
+  constructor(config) {
+    this.config = config;
+    this.buckets = new Map();
+    this.sweptAt = Date.now();
+  }
+
+  budget(route) {
+    return this.config.routes[route] ?? this.config.default;
+  }
+
+  // トークンを1つ消費する。消費できなかった場合は次にトークンが補充されるまでのミリ秒を返す
+  take(key, budget, now) {
+    if (now - this.sweptAt > BUCKET_IDLE_TIMEOUT) {
+      for (const [k, b] of this.buckets) {
+        if (now - b.updateAt > BUCKET_IDLE_TIMEOUT) {
+          this.buckets.delete(k);
+        }
+      }
+      this.sweptAt = now;
+    }
+
+    let b = this.buckets.get(key);
+    if (b == null) {
+      b = { tokens: budget.burst, updateAt: now };
+      this.buckets.set(key, b);
+    }
+
+    b.tokens = Math.min(
+      budget.burst,
+      b.tokens + ((now - b.updateAt) / 1000) * budget.rate
+    );
+    b.updateAt = now;
+
+    if (b.tokens >= 1) {
+      b.tokens--;
+      return [true, 0];
+    }
+
+    return [false, ((1 - b.tokens) / budget.rate) * 1000];
+  }
+
+  // 制限したリクエストは newLimitedError(Retry-After の秒数) をエラーとして次に渡す
+  middleware(newLimitedError) {
+    return (req, res, next) => {
+      const route = routeOf(req);
+      const budget = this.budget(route);
+      if (!(budget.rate > 0)) {
+        next();
+        return;
+      }
+
+      const client = clientOf(req, this.config.key);
+      const [ok, wait] = this.take(`${route}\x00${client}`, budget, Date.now());
+      if (!ok) {
+        const retryAfter = Math.ceil(wait / 1000);
+        res.set("Retry-After", String(retryAfter));
+        next(newLimitedError(retryAfter));
+        return;
+      }
+
+      next();
+    };
+  }
+}
+
+module.exports = { loadRateLimitConfig, RateLimiter };
@@ -0,0 +1,113 @@
+package Isuumo::RateLimit;
+use v5.32;
+use warnings;
+use utf8;
+
+use Fcntl qw/:flock O_RDWR O_CREAT/;
+use File::Spec;
+use JSON::MaybeXS qw/decode_json encode_json/;
+use POSIX qw/ceil/;
+
+use constant RATE_LIMIT_KEY_IP         => 'ip';
+use constant RATE_LIMIT_KEY_USER_AGENT => 'user_agent';
+
+# これ以上アクセスのないバケットは破棄する
+use constant BUCKET_IDLE_TIMEOUT => 10 * 60;
+
+# Starlet のワーカー間でバケットを共有するため、ファイルに保存してロックを取って更新する
+my $STORE_PATH = File::Spec->catfile(File::Spec->tmpdir, 'isuumo-ratelimit.json');
+
+# Go 実装と同じ形式の設定を読み込む。ルートは "POST /api/estate/nazotte" の形式で指定する
+sub load_config {
+    my ($class, $path) = @_;
+    open my $fh, '<', $path or die "failed to open $path: $!";
+    my $config = {
+        key     => RATE_LIMIT_KEY_IP,
+        default => { rate => 0, burst => 0 },
+        routes  => {},
+        decode_json(do { local $/; <$fh> })->%*,
+    };
+    close $fh;
+
+    if ($config->{key} ne RATE_LIMIT_KEY_IP && $config->{key} ne RATE_LIMIT_KEY_USER_AGENT) {
+        die "invalid rate limit key: $config->{key}\n";
+    }
+    for my $budget ($config->{default}, values $config->{routes}->%*) {
+        if (($budget->{rate} // 0) > 0 && ($budget->{burst} // 0) < 1) {
+            die "burst must be greater than 0 when rate is set\n";
+        }
+    }
+
+    return $config;
+}
+
+sub new {
+    my ($class, $config, $store_path) = @_;
+    return bless { config => $config, store_path => $store_path // $STORE_PATH }, $class;
+}
+
+sub budget {
+    my ($self, $route) = @_;
+    return $self->{config}{routes}{$route} // $self->{config}{default};
+}
+
+# トークンを1つ消費する。消費できなかった場合は次にトークンが補充されるまでの秒数を返す
+sub take {
+    my ($self, $key, $budget, $now) = @_;
+
+    sysopen my $fh, $self->{store_path}, O_RDWR | O_CREAT, 0644 or die "failed to open $self->{store_path}: $!";
+    flock $fh, LOCK_EX or die "failed to lock $self->{store_path}: $!";
+    my $content = do { local $/; <$fh> };
+    my $store = eval { decode_json($content) };
+    $store = {} unless ref $store eq 'HASH';
+    my $buckets = $store->{buckets} // {};
+
+    $store->{swept_at} //= $now;
+    if ($now - $store->{swept_at} > BUCKET_IDLE_TIMEOUT) {
+        for my $k (keys $buckets->%*) {
+            delete $buckets->{$k} if $now - $buckets->{$k}{update_at} > BUCKET_IDLE_TIMEOUT;
+        }
+        $store->{swept_at} = $now;
+    }
+
+    my $bucket = $buckets->{$key} //= { tokens => $budget->{burst}, update_at => $now };
+    my $tokens = $bucket->{tokens} + ($now - $bucket->{update_at}) * $budget->{rate};
+    $bucket->{tokens} = $tokens < $budget->{burst} ? $tokens : $budget->{burst};
+    $bucket->{update_at} = $now;
+
+    my $ok = $bucket->{tokens} >= 1;
+    $bucket->{tokens} -= 1 if $ok;
+
+    $store->{buckets} = $buckets;
+    seek $fh, 0, 0;
+    print $fh encode_json($store);
+    $fh->flush;
+    truncate $fh, tell $fh;
+    close $fh;
+
+    return $ok ? (1, 0) : (0, (1 - $bucket->{tokens}) / $budget->{rate});
+}
+
+# 制限するリクエストなら Retry-After の秒数を、そうでなければ undef を返す
+sub check {
+    my ($self, $env, $now) = @_;
+    my $route = sprintf '%s %s', $env->{REQUEST_METHOD}, $env->{PATH_INFO} =~ s{/\d+(?=/|$)}{/:id}gr;
+    my $budget = $self->budget($route);
+    return undef unless ($budget->{rate} // 0) > 0;
+
+    my ($ok, $wait) = $self->take("$route\0" . $self->client_of($env), $budget, $now);
+    return $ok ? undef : ceil($wait);
+}
+
+# echo の RealIP と同じ順でクライアントの IP を決める
+sub client_of {
+    my ($self, $env) = @_;
+    return $env->{HTTP_USER_AGENT} // '' if $self->{config}{key} eq RATE_LIMIT_KEY_USER_AGENT;
+
+    if (my $forwarded_for = $env->{HTTP_X_FORWARDED_FOR}) {
+        return (split /, /, $forwarded_for)[0];
+    }
+    return $env->{HTTP_X_REAL_IP} // $env->{REMOTE_ADDR};
+}
+
+1;
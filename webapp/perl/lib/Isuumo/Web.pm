@@ -128,6 +128,39 @@ use constant ChairSearchCondition => {
     kind    => ListCondition,
 };
 
+use constant ErrorResponse => {
+    code    => JSON_TYPE_STRING,
+    message => JSON_TYPE_STRING,
+    field   => JSON_TYPE_STRING,
+};
+
+use constant RangeFacet => {
+    id    => JSON_TYPE_INT,
+    count => JSON_TYPE_INT,
+};
+
+use constant ListFacet => {
+    name  => JSON_TYPE_STRING,
+    count => JSON_TYPE_INT,
+};
+
+use constant EstateSearchFacets => {
+    doorWidth  => json_type_arrayof(RangeFacet),
+    doorHeight => json_type_arrayof(RangeFacet),
+    rent       => json_type_arrayof(RangeFacet),
+    feature    => json_type_arrayof(ListFacet),
+};
+
+use constant ChairSearchFacets => {
+    width   => json_type_arrayof(RangeFacet),
+    height  => json_type_arrayof(RangeFacet),
+    depth   => json_type_arrayof(RangeFacet),
+    price   => json_type_arrayof(RangeFacet),
+    color   => json_type_arrayof(ListFacet),
+    feature => json_type_arrayof(ListFacet),
+    kind    => json_type_arrayof(ListFacet),
+};
+
 my $_JSON = JSON::MaybeXS->new()->allow_blessed(1)->convert_blessed(1)->ascii(1);
 
 $CHAIR_SEARCH_CONDITION = do {
@@ -155,6 +188,7 @@ post '/api/chair'                  => \&post_chair;
 get  '/api/chair/search'           => \&search_chairs;
 get  '/api/chair/low_priced'       => \&get_low_priced_chair;
 get  '/api/chair/search/condition' => \&get_chair_search_condition;
+get  '/api/chair/search/facets'    => \&get_chair_search_facets;
 post '/api/chair/buy/{id:\d+}'     => [qw/allow_json_request/] => \&buy_chair;
 
 # Estate Handler
@@ -165,7 +199,9 @@ get  '/api/estate/low_priced'           => \&get_low_priced_estate;
 post '/api/estate/req_doc/{id:\d+}'     => [qw/allow_json_request/] => \&post_estate_request_document;
 post '/api/estate/nazotte'              => [qw/allow_json_request/] => \&search_estate_nazotte;
 get  '/api/estate/search/condition'     => \&get_estate_search_condition;
+get  '/api/estate/search/facets'        => \&get_estate_search_facets;
 get  '/api/recommended_estate/{id:\d+}' => \&search_recommended_estate_with_chair;
+get  '/api/recommended_chair/{id:\d+}'  => \&search_recommended_chair_with_estate;
 
 
 
@@ -190,7 +226,7 @@ sub initialize {
         );
         if (my $e = system($cmd)) {
             infof('Initialize script error : %s , %s', $e, $!);
-            return $self->res_no_content($c, HTTP_INTERNAL_SERVER_ERROR);
+            return $self->res_error($c, HTTP_INTERNAL_SERVER_ERROR, "INITIALIZE_FAILED", "failed to initialize database");
         }
     }
 
@@ -208,12 +244,12 @@ sub get_chair_detail {
 
     if (!$chair) {
         infof("requested id's chair not found : %s", $chair_id);
-        return $self->res_no_content($c, HTTP_NOT_FOUND)
+        return $self->res_error($c, HTTP_NOT_FOUND, "CHAIR_NOT_FOUND", "chair not found");
     }
 
     if ($chair->{stock} <= 0) {
         infof("requested id's chair is sold out : %s", $chair_id);
-        return $self->res_no_content($c, HTTP_NOT_FOUND)
+        return $self->res_error($c, HTTP_NOT_FOUND, "CHAIR_SOLD_OUT", "chair is sold out");
     }
 
     return $self->res_json($c, {
@@ -237,13 +273,13 @@ sub post_chair {
     my $file = $c->req->uploads->{'chairs'};
     if (!$file) {
         critf("failed to get form file");
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "MISSING_CSV", "csv file is required", "chairs");
     }
 
     my $fh;
     if (!open $fh, "<:encoding(utf8)", $file->path) {
         critf("failed to open form file %s. %s", $file->path, $!);
-        return $self->res_no_content($c, HTTP_INTERNAL_SERVER_ERROR);
+        return $self->res_error($c, HTTP_INTERNAL_SERVER_ERROR, "CSV_READ_FAILED", "failed to open csv file", "chairs");
     }
 
     my $csv = Text::CSV_XS->new({binary => 1});
@@ -263,25 +299,24 @@ sub post_chair {
     if ($@) {
         $txn->rollback;
         critf("failed to commit txn: %s", $@);
-        return $self->res_no_content($c, HTTP_INTERNAL_SERVER_ERROR);
+        return $self->res_error($c, HTTP_INTERNAL_SERVER_ERROR, "DATABASE_ERROR", "database error");
     }
 
     $fh->close;
     return $self->res_no_content($c, HTTP_CREATED);
 };
 
-sub search_chairs {
-    my ($self, $c)  = @_;
+sub build_chair_search_condition {
+    my ($parameters) = @_;
 
     my @conditions;
     my @params;
 
-    if (exists $c->req->parameters->{priceRangeId}) {
-        my $price_range_id = $c->req->parameters->{priceRangeId};
+    if (exists $parameters->{priceRangeId}) {
+        my $price_range_id = $parameters->{priceRangeId};
         my ($chair_price, $err) = get_range($CHAIR_SEARCH_CONDITION->{price}, $price_range_id);
         if ($err) {
-            infof("priceRangeID invalid, %s : %s", $price_range_id, $err);
-            return $self->res_no_content($c, HTTP_BAD_REQUEST);
+            return undef, undef, search_condition_error("INVALID_RANGE_ID", sprintf("priceRangeID invalid, %s : %s", $price_range_id, $err), "priceRangeId");
         }
         if ($chair_price->{min} != -1) {
             push @conditions => "price >= ?";
@@ -293,12 +328,11 @@ sub search_chairs {
         }
     }
 
-    if (exists $c->req->parameters->{heightRangeId}) {
-        my $height_range_id = $c->req->parameters->{heightRangeId};
+    if (exists $parameters->{heightRangeId}) {
+        my $height_range_id = $parameters->{heightRangeId};
         my ($chair_height, $err) = get_range($CHAIR_SEARCH_CONDITION->{height}, $height_range_id);
         if ($err) {
-            infof("heightRangeID invalid, %s : %s", $height_range_id, $err);
-            return $self->res_no_content($c, HTTP_BAD_REQUEST);
+            return undef, undef, search_condition_error("INVALID_RANGE_ID", sprintf("heightRangeID invalid, %s : %s", $height_range_id, $err), "heightRangeId");
         }
         if ($chair_height->{min} != -1) {
             push @conditions => "height >= ?";
@@ -310,12 +344,11 @@ sub search_chairs {
         }
     }
 
-    if (exists $c->req->parameters->{widthRangeId}) {
-        my $width_range_id = $c->req->parameters->{widthRangeId};
+    if (exists $parameters->{widthRangeId}) {
+        my $width_range_id = $parameters->{widthRangeId};
         my ($chair_width, $err) = get_range($CHAIR_SEARCH_CONDITION->{width}, $width_range_id);
         if ($err) {
-            infof("widthRangeID invalid, %s : %s", $width_range_id, $err);
-            return $self->res_no_content($c, HTTP_BAD_REQUEST);
+            return undef, undef, search_condition_error("INVALID_RANGE_ID", sprintf("widthRangeID invalid, %s : %s", $width_range_id, $err), "widthRangeId");
         }
         if ($chair_width->{min} != -1) {
             push @conditions => "width >= ?";
@@ -327,12 +360,11 @@ sub search_chairs {
         }
     }
 
-    if (exists $c->req->parameters->{depthRangeId}) {
-        my $depth_range_id = $c->req->parameters->{depthRangeId};
+    if (exists $parameters->{depthRangeId}) {
+        my $depth_range_id = $parameters->{depthRangeId};
         my ($chair_depth, $err) = get_range($CHAIR_SEARCH_CONDITION->{depth}, $depth_range_id);
         if ($err) {
-            infof("depthRangeID invalid, %s : %s", $depth_range_id, $err);
-            return $self->res_no_content($c, HTTP_BAD_REQUEST);
+            return undef, undef, search_condition_error("INVALID_RANGE_ID", sprintf("depthRangeID invalid, %s : %s", $depth_range_id, $err), "depthRangeId");
         }
         if ($chair_depth->{min} != -1) {
             push @conditions => "depth >= ?";
@@ -344,26 +376,46 @@ sub search_chairs {
         }
     }
 
-    if (my $kind = $c->req->parameters->get('kind')) {
-        push @conditions => "kind = ?";
-        push @params => $kind;
+    if (my $kind = $parameters->get('kind')) {
+        my @kinds = split /,/, $kind;
+        push @conditions => sprintf("kind IN (%s)", join(",", ("?") x @kinds));
+        push @params => @kinds;
     }
 
-    if (my $color = $c->req->parameters->get('color')) {
-        push @conditions => "color = ?";
-        push @params => $color;
+    if (my $color = $parameters->get('color')) {
+        my @colors = split /,/, $color;
+        push @conditions => sprintf("color IN (%s)", join(",", ("?") x @colors));
+        push @params => @colors;
     }
 
-    if (my $features = $c->req->parameters->get('features')) {
-        for my $f (split /,/, $features) {
-            push @conditions => "features LIKE CONCAT('%', ?, '%')";
-            push @params => $f;
-        }
+    my $feature_mode = $parameters->get('featureMode') // "";
+    if ($feature_mode ne "" && $feature_mode ne "all" && $feature_mode ne "any") {
+        return undef, undef, search_condition_error("INVALID_FEATURE_MODE", sprintf("featureMode invalid : %s", $feature_mode), "featureMode");
+    }
+
+    if (my $features = $parameters->get('features')) {
+        my ($feature_condition, $feature_params) = build_feature_condition([split /,/, $features], $feature_mode);
+        push @conditions => $feature_condition;
+        push @params => $feature_params->@*;
     }
 
+    return \@conditions, \@params, undef;
+}
+
+sub search_chairs {
+    my ($self, $c)  = @_;
+
+    my ($conditions, $params, $err) = build_chair_search_condition($c->req->parameters);
+    if ($err) {
+        infof("%s", $err->{message});
+        return $self->res_error($c, HTTP_BAD_REQUEST, $err->@{qw/code message field/});
+    }
+    my @conditions = $conditions->@*;
+    my @params = $params->@*;
+
     if (@conditions == 0) {
         infof("Search condition not found");
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "MISSING_SEARCH_CONDITION", "at least one search condition is required");
     }
 
     push @conditions => "stock > 0";
@@ -371,13 +423,13 @@ sub search_chairs {
     my $page = $c->req->parameters->get('page');
     if ($page !~ /^\d+$/) {
         infof("Invalid format page parameter : %s", $page);
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "INVALID_PAGE", "page must be an integer", "page");
     }
 
     my $per_page = $c->req->parameters->get('perPage');
     if ($per_page !~ /^\d+$/) {
         infof("Invalid format per_page parameter : %s", $per_page);
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "INVALID_PER_PAGE", "perPage must be an integer", "perPage");
     }
 
     my $search_query = "SELECT * FROM chair WHERE ";
@@ -418,7 +470,7 @@ sub buy_chair {
     my $email = $c->req->body_parameters->{email};
     if (!$email) {
         infof("post buy chair failed : email not found in request body");
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "MISSING_EMAIL", "email is required", "email");
     }
 
     my $chair_id = $c->args->{id};
@@ -429,7 +481,7 @@ sub buy_chair {
         my $chair = $dbh->select_row("SELECT * FROM chair WHERE id = ? AND stock > 0 FOR UPDATE", $chair_id);
         if (!$chair) {
             infof("buyChair chair id \"%s\" not found", $chair_id);
-            die $self->res_no_content($c, HTTP_NOT_FOUND);
+            die $self->res_error($c, HTTP_NOT_FOUND, "CHAIR_NOT_FOUND", "chair not found or sold out");
         }
         $dbh->query("UPDATE chair SET stock = stock - 1 WHERE id = ?", $chair_id);
         $txn->commit;
@@ -439,7 +491,7 @@ sub buy_chair {
         return $@ if $@ isa Plack::Response;
 
         critf("transaction commit error : %s", $@);
-        return $self->res_no_content($c, HTTP_INTERNAL_SERVER_ERROR);
+        return $self->res_error($c, HTTP_INTERNAL_SERVER_ERROR, "DATABASE_ERROR", "database error");
     }
 
     return $self->res_no_content($c, HTTP_OK);
@@ -450,6 +502,37 @@ sub get_chair_search_condition {
     return $self->res_json($c, $CHAIR_SEARCH_CONDITION, ChairSearchCondition);
 };
 
+sub get_chair_search_facets {
+    my ($self, $c) = @_;
+
+    my $parameters = $c->req->parameters;
+    my (undef, undef, $err) = build_chair_search_condition($parameters);
+    if ($err) {
+        infof("%s", $err->{message});
+        return $self->res_error($c, HTTP_BAD_REQUEST, $err->@{qw/code message field/});
+    }
+    my $without = sub {
+        my ($key) = @_;
+        my ($conditions, $params) = build_chair_search_condition(without_key($parameters, $key));
+        push $conditions->@* => "stock > 0";
+        return [$conditions, $params];
+    };
+
+    my $dbh = $self->dbh;
+    my $facets = {};
+    for my $facet (["price", "priceRangeId", "price"], ["height", "heightRangeId", "height"], ["width", "widthRangeId", "width"], ["depth", "depthRangeId", "depth"]) {
+        my ($name, $key, $column) = $facet->@*;
+        $facets->{$name} = count_range_facets($dbh, "chair", $without->($key), $column, $CHAIR_SEARCH_CONDITION->{$name});
+    }
+    for my $name ("kind", "color") {
+        $facets->{$name} = count_list_facets($dbh, "chair", $without->($name), $CHAIR_SEARCH_CONDITION->{$name}{list}, column_equal_bucket($name));
+    }
+    my ($feature_key, $bucket) = feature_facet_bucket($parameters);
+    $facets->{feature} = count_list_facets($dbh, "chair", $without->($feature_key), $CHAIR_SEARCH_CONDITION->{feature}{list}, $bucket);
+
+    return $self->res_json($c, $facets, ChairSearchFacets);
+};
+
 sub get_low_priced_chair {
     my ($self, $c) = @_;
 
@@ -487,7 +570,7 @@ sub get_estate_detail {
 
     if (!$estate) {
         infof("getEstateDetail estate id not found : %s", $estate_id);
-        return $self->res_no_content($c, HTTP_NOT_FOUND)
+        return $self->res_error($c, HTTP_NOT_FOUND, "ESTATE_NOT_FOUND", "estate not found");
     }
 
     return $self->res_json($c, {
@@ -511,13 +594,13 @@ sub post_estate {
     my $file = $c->req->uploads->{'estates'};
     if (!$file) {
         critf("failed to get form file");
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "MISSING_CSV", "csv file is required", "estates");
     }
 
     my $fh;
     if (!open $fh, "<:encoding(utf8)", $file->path) {
         critf("failed to open form file %s. %s", $file->path, $!);
-        return $self->res_no_content($c, HTTP_INTERNAL_SERVER_ERROR);
+        return $self->res_error($c, HTTP_INTERNAL_SERVER_ERROR, "CSV_READ_FAILED", "failed to open csv file", "estates");
     }
 
     my $csv = Text::CSV_XS->new({binary => 1});
@@ -537,25 +620,24 @@ sub post_estate {
     if ($@) {
         $txn->rollback;
         critf("failed to commit txn: %s", $@);
-        return $self->res_no_content($c, HTTP_INTERNAL_SERVER_ERROR);
+        return $self->res_error($c, HTTP_INTERNAL_SERVER_ERROR, "DATABASE_ERROR", "database error");
     }
 
     $fh->close;
     return $self->res_no_content($c, HTTP_CREATED);
 };
 
-sub search_estates {
-    my ($self, $c)  = @_;
+sub build_estate_search_condition {
+    my ($parameters) = @_;
 
     my @conditions;
     my @params;
 
-    if (exists $c->req->parameters->{doorHeightRangeId}) {
-        my $door_height_range_id = $c->req->parameters->{doorHeightRangeId};
+    if (exists $parameters->{doorHeightRangeId}) {
+        my $door_height_range_id = $parameters->{doorHeightRangeId};
         my ($door_height, $err) = get_range($ESTATE_SEARCH_CONDITION->{doorHeight}, $door_height_range_id);
         if ($err) {
-            infof("doorHeightRangeID invalid, %s : %s", $door_height_range_id, $err);
-            return $self->res_no_content($c, HTTP_BAD_REQUEST);
+            return undef, undef, search_condition_error("INVALID_RANGE_ID", sprintf("doorHeightRangeID invalid, %s : %s", $door_height_range_id, $err), "doorHeightRangeId");
         }
         if ($door_height->{min} != -1) {
             push @conditions => "door_height >= ?";
@@ -567,12 +649,11 @@ sub search_estates {
         }
     }
 
-    if (exists $c->req->parameters->{doorWidthRangeId}) {
-        my $door_width_range_id = $c->req->parameters->{doorWidthRangeId};
+    if (exists $parameters->{doorWidthRangeId}) {
+        my $door_width_range_id = $parameters->{doorWidthRangeId};
         my ($door_width, $err) = get_range($ESTATE_SEARCH_CONDITION->{doorWidth}, $door_width_range_id);
         if ($err) {
-            infof("doorWidthRangeID invalid, %s : %s", $door_width_range_id, $err);
-            return $self->res_no_content($c, HTTP_BAD_REQUEST);
+            return undef, undef, search_condition_error("INVALID_RANGE_ID", sprintf("doorWidthRangeID invalid, %s : %s", $door_width_range_id, $err), "doorWidthRangeId");
         }
         if ($door_width->{min} != -1) {
             push @conditions => "door_width >= ?";
@@ -584,12 +665,11 @@ sub search_estates {
         }
     }
 
-    if (exists $c->req->parameters->{rentRangeId}) {
-        my $rent_range_id = $c->req->parameters->{rentRangeId};
+    if (exists $parameters->{rentRangeId}) {
+        my $rent_range_id = $parameters->{rentRangeId};
         my ($estate_rent, $err) = get_range($ESTATE_SEARCH_CONDITION->{rent}, $rent_range_id);
         if ($err) {
-            infof("rentRangeID invalid, %s : %s", $rent_range_id, $err);
-            return $self->res_no_content($c, HTTP_BAD_REQUEST);
+            return undef, undef, search_condition_error("INVALID_RANGE_ID", sprintf("rentRangeID invalid, %s : %s", $rent_range_id, $err), "rentRangeId");
         }
         if ($estate_rent->{min} != -1) {
             push @conditions => "rent >= ?";
@@ -601,28 +681,46 @@ sub search_estates {
         }
     }
 
-    if (my $features = $c->req->parameters->get('features')) {
-        for my $f (split /,/, $features) {
-            push @conditions => "features LIKE CONCAT('%', ?, '%')";
-            push @params => $f;
-        }
+    my $feature_mode = $parameters->get('featureMode') // "";
+    if ($feature_mode ne "" && $feature_mode ne "all" && $feature_mode ne "any") {
+        return undef, undef, search_condition_error("INVALID_FEATURE_MODE", sprintf("featureMode invalid : %s", $feature_mode), "featureMode");
+    }
+
+    if (my $features = $parameters->get('features')) {
+        my ($feature_condition, $feature_params) = build_feature_condition([split /,/, $features], $feature_mode);
+        push @conditions => $feature_condition;
+        push @params => $feature_params->@*;
+    }
+
+    return \@conditions, \@params, undef;
+}
+
+sub search_estates {
+    my ($self, $c)  = @_;
+
+    my ($conditions, $params, $err) = build_estate_search_condition($c->req->parameters);
+    if ($err) {
+        infof("%s", $err->{message});
+        return $self->res_error($c, HTTP_BAD_REQUEST, $err->@{qw/code message field/});
     }
+    my @conditions = $conditions->@*;
+    my @params = $params->@*;
 
     if (@conditions == 0) {
         infof("searchEstates search condition not found");
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "MISSING_SEARCH_CONDITION", "at least one search condition is required");
     }
 
     my $page = $c->req->parameters->get('page');
     if ($page !~ /^\d+$/) {
         infof("Invalid format page parameter : %s", $page);
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "INVALID_PAGE", "page must be an integer", "page");
     }
 
     my $per_page = $c->req->parameters->get('perPage');
     if ($per_page !~ /^\d+$/) {
         infof("Invalid format per_page parameter : %s", $per_page);
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "INVALID_PER_PAGE", "perPage must be an integer", "perPage");
     }
 
     my $search_query = "SELECT * FROM estate WHERE ";
@@ -693,7 +791,7 @@ sub search_recommended_estate_with_chair {
     my $chair = $self->dbh->select_row($chair_query, $chair_id);
     if (!$chair) {
         infof("Requested chair id \"%v\" not found", $chair_id);
-        return $self->res_no_content(HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "CHAIR_NOT_FOUND", "chair not found", "id");
     }
 
     my $w = $chair->{width};
@@ -723,12 +821,63 @@ sub search_recommended_estate_with_chair {
     }, EstateListResponse);
 };
 
+sub search_recommended_chair_with_estate {
+    my ($self, $c) = @_;
+
+    my $estate_id = $c->args->{id};
+    my $estate_query = "SELECT * FROM estate WHERE id = ?";
+    my $estate = $self->dbh->select_row($estate_query, $estate_id);
+    if (!$estate) {
+        infof("Requested estate id \"%s\" not found", $estate_id);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "ESTATE_NOT_FOUND", "estate not found", "id");
+    }
+
+    my $w = $estate->{door_width};
+    my $h = $estate->{door_height};
+    my @conditions = (
+        "stock > 0",
+        "((width <= ? AND height <= ?) OR (width <= ? AND depth <= ?) OR (height <= ? AND width <= ?) OR (height <= ? AND depth <= ?) OR (depth <= ? AND width <= ?) OR (depth <= ? AND height <= ?))",
+    );
+    my @params = ($w, $h, $w, $h, $w, $h, $w, $h, $w, $h, $w, $h);
+
+    if (length($c->req->parameters->{maxPrice} // "")) {
+        my $max_price = $c->req->parameters->{maxPrice};
+        if ($max_price !~ /\A\d+\z/) {
+            infof("Invalid format maxPrice parameter : %s", $max_price);
+            return $self->res_error($c, HTTP_BAD_REQUEST, "INVALID_MAX_PRICE", "maxPrice must be a non-negative integer", "maxPrice");
+        }
+        push @conditions => "price <= ?";
+        push @params => $max_price;
+    }
+
+    my $query = sprintf("SELECT * FROM chair WHERE %s ORDER BY popularity DESC, id ASC LIMIT ?", join(" AND ", @conditions));
+    my $chairs = $self->dbh->select_all($query, @params, LIMIT);
+
+    return $self->res_json($c, {
+        chairs => [map {
+            +{
+                id          => $_->{id},
+                name        => $_->{name},
+                description => $_->{description},
+                thumbnail   => $_->{thumbnail},
+                price       => $_->{price},
+                height      => $_->{height},
+                width       => $_->{width},
+                depth       => $_->{depth},
+                color       => $_->{color},
+                features    => $_->{features},
+                kind        => $_->{kind},
+            }
+        } $chairs->@* ],
+    }, ChairListResponse);
+};
+
 sub search_estate_nazotte {
     my ($self, $c) = @_;
 
     my $coordinates = $c->req->body_parameters_raw->{coordinates};
-    if (!$coordinates->@*) {
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+    if (ref $coordinates ne 'ARRAY' || !$coordinates->@*) {
+        return $self->res_error($c, HTTP_BAD_REQUEST, "MISSING_COORDINATES", "coordinates are required", "coordinates");
     }
 
     my $box = get_bounding_box($coordinates);
@@ -787,14 +936,14 @@ sub post_estate_request_document {
     my $email = $c->req->body_parameters->{email};
     if (!$email) {
         infof("post request document failed : email not found in request body");
-        return $self->res_no_content($c, HTTP_BAD_REQUEST);
+        return $self->res_error($c, HTTP_BAD_REQUEST, "MISSING_EMAIL", "email is required", "email");
     }
 
     my $estate_id = $c->args->{id};
     my $query = 'SELECT * FROM estate WHERE id = ?';
     my $estate = $self->dbh->select_row($query, $estate_id);
     if (!$estate) {
-        return $self->res_no_content($c, HTTP_NOT_FOUND);
+        return $self->res_error($c, HTTP_NOT_FOUND, "ESTATE_NOT_FOUND", "estate not found");
     }
 
     return $self->res_no_content($c, HTTP_OK);
@@ -805,6 +954,33 @@ sub get_estate_search_condition {
     return $self->res_json($c, $ESTATE_SEARCH_CONDITION, EstateSearchCondition);
 };
 
+sub get_estate_search_facets {
+    my ($self, $c) = @_;
+
+    my $parameters = $c->req->parameters;
+    my (undef, undef, $err) = build_estate_search_condition($parameters);
+    if ($err) {
+        infof("%s", $err->{message});
+        return $self->res_error($c, HTTP_BAD_REQUEST, $err->@{qw/code message field/});
+    }
+    my $without = sub {
+        my ($key) = @_;
+        my ($conditions, $params) = build_estate_search_condition(without_key($parameters, $key));
+        return [$conditions, $params];
+    };
+
+    my $dbh = $self->dbh;
+    my $facets = {};
+    for my $facet (["doorHeight", "doorHeightRangeId", "door_height"], ["doorWidth", "doorWidthRangeId", "door_width"], ["rent", "rentRangeId", "rent"]) {
+        my ($name, $key, $column) = $facet->@*;
+        $facets->{$name} = count_range_facets($dbh, "estate", $without->($key), $column, $ESTATE_SEARCH_CONDITION->{$name});
+    }
+    my ($feature_key, $bucket) = feature_facet_bucket($parameters);
+    $facets->{feature} = count_list_facets($dbh, "estate", $without->($feature_key), $ESTATE_SEARCH_CONDITION->{feature}{list}, $bucket);
+
+    return $self->res_json($c, $facets, EstateSearchFacets);
+};
+
 
 
 
@@ -860,6 +1036,93 @@ sub get_range {
     return $ranges->[$range_id], undef
 }
 
+sub search_condition_error {
+    my ($code, $message, $field) = @_;
+    return { code => $code, message => $message, field => $field };
+}
+
+sub build_feature_condition {
+    my ($features, $feature_mode) = @_;
+
+    my $joiner = $feature_mode eq "any" ? " OR " : " AND ";
+    return sprintf("(%s)", join($joiner, ("FIND_IN_SET(?, features) > 0") x $features->@*)), $features;
+}
+
+sub without_key {
+    my ($parameters, $key) = @_;
+
+    my $without = $parameters->clone;
+    $without->remove($key);
+    return $without;
+}
+
+sub count_facets {
+    my ($dbh, $table, $condition, $buckets, $bucket_params) = @_;
+
+    return [] if $buckets->@* == 0;
+
+    my ($conditions, $params) = $condition->@*;
+    my @columns = map { sprintf("COUNT(CASE WHEN %s THEN 1 END) AS c%d", $buckets->[$_], $_) } 0 .. $buckets->$#*;
+    my $where = $conditions->@* ? " WHERE " . join(" AND ", $conditions->@*) : "";
+    my $row = $dbh->select_row(sprintf("SELECT %s FROM %s%s", join(", ", @columns), $table, $where), $bucket_params->@*, $params->@*);
+    return [map { $row->{"c$_"} } 0 .. $buckets->$#*];
+}
+
+sub count_range_facets {
+    my ($dbh, $table, $condition, $column, $range_condition) = @_;
+
+    my @buckets;
+    my @bucket_params;
+    for my $range ($range_condition->{ranges}->@*) {
+        my @bucket;
+        if ($range->{min} != -1) {
+            push @bucket => "$column >= ?";
+            push @bucket_params => $range->{min};
+        }
+        if ($range->{max} != -1) {
+            push @bucket => "$column < ?";
+            push @bucket_params => $range->{max};
+        }
+        push @buckets => @bucket ? join(" AND ", @bucket) : "TRUE";
+    }
+    my $counts = count_facets($dbh, $table, $condition, \@buckets, \@bucket_params);
+    my $ranges = $range_condition->{ranges};
+    return [map { +{ id => $ranges->[$_]{id}, count => $counts->[$_] } } 0 .. $ranges->$#*];
+}
+
+sub count_list_facets {
+    my ($dbh, $table, $condition, $list, $bucket) = @_;
+
+    my @buckets;
+    my @bucket_params;
+    for my $name ($list->@*) {
+        my ($b, $params) = $bucket->($name);
+        push @buckets => $b;
+        push @bucket_params => $params->@*;
+    }
+    my $counts = count_facets($dbh, $table, $condition, \@buckets, \@bucket_params);
+    return [map { +{ name => $list->[$_], count => $counts->[$_] } } 0 .. $list->$#*];
+}
+
+sub column_equal_bucket {
+    my ($column) = @_;
+    return sub { ("$column = ?", [$_[0]]) };
+}
+
+# 現在の条件に feature を1つ追加したときの件数を数えるための条件
+# any のときは OR の中に追加する必要があるため、返り値の key の条件を外して features の条件を作り直す
+sub feature_facet_bucket {
+    my ($parameters) = @_;
+
+    my $features = $parameters->get('features');
+    my $feature_mode = $parameters->get('featureMode') // "";
+    if ($feature_mode ne "any" || !$features) {
+        return "", sub { build_feature_condition([$_[0]], "all") };
+    }
+    my @current = split /,/, $features;
+    return "features", sub { build_feature_condition([@current, $_[0]], "any") };
+}
+
 
 filter 'allow_json_request' => sub {
     my $app = shift;
@@ -917,4 +1180,16 @@ sub res_json {
     $c->res;
 }
 
+# send error response with the same body as the go implementation
+sub res_error {
+    my ($self, $c, $status, $code, $message, $field) = @_;
+
+    my $error = { code => $code, message => $message };
+    $error->{field} = $field if defined $field;
+
+    $self->res_json($c, $error, ErrorResponse);
+    $c->res->status($status);
+    $c->res;
+}
+
 1;
@@ -3,10 +3,15 @@ declare(strict_types=1);
 
 use App\Application\Middleware\SessionMiddleware;
 use App\Application\Middleware\LoggerMiddleware;
+use App\Application\Middleware\RateLimitMiddleware;
 use Slim\App;
 
 return function (App $app) {
     $container = $app->getContainer();
     $app->add(SessionMiddleware::class);
+    $rateLimitConfig = getenv('RATE_LIMIT_CONFIG');
+    if ($rateLimitConfig) {
+        $app->add(new RateLimitMiddleware($app->getResponseFactory(), RateLimitMiddleware::loadConfig($rateLimitConfig)));
+    }
     $app->add(new LoggerMiddleware($container->get('logger')));
 };
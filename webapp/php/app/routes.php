@@ -32,6 +32,283 @@ function getRange(RangeCondition $condition, string $rangeId): ?Range
     return null;
 }
 
+function buildChairSearchCondition(ChairSearchCondition $chairSearchCondition, array $queryParams): array
+{
+    $conditions = [];
+    $params = [];
+
+    $priceRangeId = $queryParams['priceRangeId'] ?? null;
+    if (is_numeric($priceRangeId)) {
+        if (!$chairPrice = getRange($chairSearchCondition->price, $priceRangeId)) {
+            return [null, null, searchConditionError('INVALID_RANGE_ID', sprintf('priceRangeId invalid, %s', $priceRangeId), 'priceRangeId')];
+        }
+        if ($chairPrice->min != -1) {
+            $conditions[] = 'price >= :minPrice';
+            $params[':minPrice'] = [$chairPrice->min, PDO::PARAM_INT];
+        }
+        if ($chairPrice->max != -1) {
+            $conditions[] = 'price < :maxPrice';
+            $params[':maxPrice'] = [$chairPrice->max, PDO::PARAM_INT];
+        }
+    }
+    $heightRangeId = $queryParams['heightRangeId'] ?? null;
+    if (is_numeric($heightRangeId)) {
+        if (!$chairHeight = getRange($chairSearchCondition->height, $heightRangeId)) {
+            return [null, null, searchConditionError('INVALID_RANGE_ID', sprintf('heightRangeId invalid, %s', $heightRangeId), 'heightRangeId')];
+        }
+        if ($chairHeight->min != -1) {
+            $conditions[] = 'height >= :minHeight';
+            $params[':minHeight'] = [$chairHeight->min, PDO::PARAM_INT];
+        }
+        if ($chairHeight->max != -1) {
+            $conditions[] = 'height < :maxHeight';
+            $params[':maxHeight'] = [$chairHeight->max, PDO::PARAM_INT];
+        }
+    }
+    $widthRangeId = $queryParams['widthRangeId'] ?? null;
+    if (is_numeric($widthRangeId)) {
+        if (!$chairWidth = getRange($chairSearchCondition->width, $widthRangeId)) {
+            return [null, null, searchConditionError('INVALID_RANGE_ID', sprintf('widthRangeId invalid, %s', $widthRangeId), 'widthRangeId')];
+        }
+        if ($chairWidth->min != -1) {
+            $conditions[] = 'width >= :minWidth';
+            $params[':minWidth'] = [$chairWidth->min, PDO::PARAM_INT];
+        }
+        if ($chairWidth->max != -1) {
+            $conditions[] = 'width < :maxWidth';
+            $params[':maxWidth'] = [$chairWidth->max, PDO::PARAM_INT];
+        }
+    }
+    $depthRangeId = $queryParams['depthRangeId'] ?? null;
+    if (is_numeric($depthRangeId)) {
+        if (!$chairDepth = getRange($chairSearchCondition->depth, $depthRangeId)) {
+            return [null, null, searchConditionError('INVALID_RANGE_ID', sprintf('depthRangeId invalid, %s', $depthRangeId), 'depthRangeId')];
+        }
+        if ($chairDepth->min != -1) {
+            $conditions[] = 'depth >= :minDepth';
+            $params[':minDepth'] = [$chairDepth->min, PDO::PARAM_INT];
+        }
+        if ($chairDepth->max != -1) {
+            $conditions[] = 'depth < :maxDepth';
+            $params[':maxDepth'] = [$chairDepth->max, PDO::PARAM_INT];
+        }
+    }
+    if ($kind = $queryParams['kind'] ?? null) {
+        $names = [];
+        foreach (explode(',', $kind) as $key => $k) {
+            $name = sprintf(':kind_%s', $key);
+            $names[] = $name;
+            $params[$name] = [$k, PDO::PARAM_STR];
+        }
+        $conditions[] = sprintf('kind IN (%s)', implode(',', $names));
+    }
+    if ($color = $queryParams['color'] ?? null) {
+        $names = [];
+        foreach (explode(',', $color) as $key => $c) {
+            $name = sprintf(':color_%s', $key);
+            $names[] = $name;
+            $params[$name] = [$c, PDO::PARAM_STR];
+        }
+        $conditions[] = sprintf('color IN (%s)', implode(',', $names));
+    }
+    $featureMode = $queryParams['featureMode'] ?? '';
+    if (!in_array($featureMode, ['', 'all', 'any'], true)) {
+        return [null, null, searchConditionError('INVALID_FEATURE_MODE', sprintf('featureMode invalid, %s', $featureMode), 'featureMode')];
+    }
+    if ($features = $queryParams['features'] ?? null) {
+        list($featureCondition, $featureParams) = buildFeatureCondition(explode(',', $features), $featureMode, ':feature');
+        $conditions[] = $featureCondition;
+        $params += $featureParams;
+    }
+
+    return [$conditions, $params, null];
+}
+
+function buildEstateSearchCondition(EstateSearchCondition $estateSearchCondition, array $queryParams): array
+{
+    $conditions = [];
+    $params = [];
+
+    $doorHeightRangeId = $queryParams['doorHeightRangeId'] ?? null;
+    if (is_numeric($doorHeightRangeId)) {
+        if (!$doorHeight = getRange($estateSearchCondition->doorHeight, $doorHeightRangeId)) {
+            return [null, null, searchConditionError('INVALID_RANGE_ID', sprintf('doorHeightRangeId invalid, %s', $doorHeightRangeId), 'doorHeightRangeId')];
+        }
+        if ($doorHeight->min != -1) {
+            $conditions[] = 'door_height >= :minDoorHeight';
+            $params[':minDoorHeight'] = [$doorHeight->min, PDO::PARAM_INT];
+        }
+        if ($doorHeight->max != -1) {
+            $conditions[] = 'door_height < :maxDoorHeight';
+            $params[':maxDoorHeight'] = [$doorHeight->max, PDO::PARAM_INT];
+        }
+    }
+    $doorWidthRangeId = $queryParams['doorWidthRangeId'] ?? null;
+    if (is_numeric($doorWidthRangeId)) {
+        if (!$doorWidth = getRange($estateSearchCondition->doorWidth, $doorWidthRangeId)) {
+            return [null, null, searchConditionError('INVALID_RANGE_ID', sprintf('doorWidthRangeId invalid, %s', $doorWidthRangeId), 'doorWidthRangeId')];
+        }
+        if ($doorWidth->min != -1) {
+            $conditions[] = 'door_width >= :minDoorWidth';
+            $params[':minDoorWidth'] = [$doorWidth->min, PDO::PARAM_INT];
+        }
+        if ($doorWidth->max != -1) {
+            $conditions[] = 'door_width < :maxDoorWidth';
+            $params[':maxDoorWidth'] = [$doorWidth->max, PDO::PARAM_INT];
+        }
+    }
+    $rentRangeId = $queryParams['rentRangeId'] ?? null;
+    if (is_numeric($rentRangeId)) {
+        if (!$estateRent = getRange($estateSearchCondition->rent, $rentRangeId)) {
+            return [null, null, searchConditionError('INVALID_RANGE_ID', sprintf('rentRangeId invalid, %s', $rentRangeId), 'rentRangeId')];
+        }
+        if ($estateRent->min != -1) {
+            $conditions[] = 'rent >= :minEstateRent';
+            $params[':minEstateRent'] = [$estateRent->min, PDO::PARAM_INT];
+        }
+        if ($estateRent->max != -1) {
+            $conditions[] = 'rent < :maxEstateRent';
+            $params[':maxEstateRent'] = [$estateRent->max, PDO::PARAM_INT];
+        }
+    }
+
+    $featureMode = $queryParams['featureMode'] ?? '';
+    if (!in_array($featureMode, ['', 'all', 'any'], true)) {
+        return [null, null, searchConditionError('INVALID_FEATURE_MODE', sprintf('featureMode invalid, %s', $featureMode), 'featureMode')];
+    }
+    if ($features = $queryParams['features'] ?? null) {
+        list($featureCondition, $featureParams) = buildFeatureCondition(explode(',', $features), $featureMode, ':feature');
+        $conditions[] = $featureCondition;
+        $params += $featureParams;
+    }
+
+    return [$conditions, $params, null];
+}
+
+function searchConditionError(string $code, string $message, string $field): array
+{
+    return ['code' => $code, 'message' => $message, 'field' => $field];
+}
+
+function errorResponse(Response $response, int $status, string $code, string $message, ?string $field = null): Response
+{
+    $error = ['code' => $code, 'message' => $message];
+    if (!is_null($field)) {
+        $error['field'] = $field;
+    }
+    $response->getBody()->write(json_encode($error));
+    return $response->withStatus($status)->withHeader('Content-Type', 'application/json');
+}
+
+function buildFeatureCondition(array $features, string $featureMode, string $prefix): array
+{
+    $matches = [];
+    $params = [];
+    foreach ($features as $key => $feature) {
+        $name = sprintf('%s_%s', $prefix, $key);
+        $matches[] = sprintf('FIND_IN_SET(%s, features) > 0', $name);
+        $params[$name] = [$feature, PDO::PARAM_STR];
+    }
+    return [sprintf('(%s)', implode($featureMode === 'any' ? ' OR ' : ' AND ', $matches)), $params];
+}
+
+function withoutKey(array $queryParams, string $key): array
+{
+    unset($queryParams[$key]);
+    return $queryParams;
+}
+
+function countFacets(PDO $pdo, string $table, array $condition, array $buckets, array $bucketParams): array
+{
+    if (count($buckets) === 0) {
+        return [];
+    }
+
+    list($conditions, $params) = $condition;
+    $columns = [];
+    foreach ($buckets as $i => $bucket) {
+        $columns[] = sprintf('COUNT(CASE WHEN %s THEN 1 END) AS c%d', $bucket, $i);
+    }
+    $where = count($conditions) > 0 ? ' WHERE ' . implode(' AND ', $conditions) : '';
+
+    $stmt = $pdo->prepare(sprintf('SELECT %s FROM %s%s', implode(', ', $columns), $table, $where));
+    foreach ($bucketParams + $params as $key => $bind) {
+        list($value, $type) = $bind;
+        $stmt->bindValue($key, $value, $type);
+    }
+    $stmt->execute();
+    return array_map('intval', $stmt->fetch(PDO::FETCH_NUM));
+}
+
+function countRangeFacets(PDO $pdo, string $table, array $condition, string $column, RangeCondition $rangeCondition): array
+{
+    $buckets = [];
+    $bucketParams = [];
+    foreach ($rangeCondition->ranges as $i => $range) {
+        $bucket = [];
+        if ($range->min != -1) {
+            $name = sprintf(':bucket_%d_min', $i);
+            $bucket[] = sprintf('%s >= %s', $column, $name);
+            $bucketParams[$name] = [$range->min, PDO::PARAM_INT];
+        }
+        if ($range->max != -1) {
+            $name = sprintf(':bucket_%d_max', $i);
+            $bucket[] = sprintf('%s < %s', $column, $name);
+            $bucketParams[$name] = [$range->max, PDO::PARAM_INT];
+        }
+        $buckets[] = count($bucket) > 0 ? implode(' AND ', $bucket) : 'TRUE';
+    }
+    $counts = countFacets($pdo, $table, $condition, $buckets, $bucketParams);
+
+    $facets = [];
+    foreach ($rangeCondition->ranges as $i => $range) {
+        $facets[] = ['id' => $range->id, 'count' => $counts[$i]];
+    }
+    return $facets;
+}
+
+function countListFacets(PDO $pdo, string $table, array $condition, array $list, callable $bucket): array
+{
+    $buckets = [];
+    $bucketParams = [];
+    foreach ($list as $i => $name) {
+        list($b, $params) = $bucket($name, sprintf(':bucket_%d', $i));
+        $buckets[] = $b;
+        $bucketParams += $params;
+    }
+    $counts = countFacets($pdo, $table, $condition, $buckets, $bucketParams);
+
+    $facets = [];
+    foreach ($list as $i => $name) {
+        $facets[] = ['name' => $name, 'count' => $counts[$i]];
+    }
+    return $facets;
+}
+
+function columnEqualBucket(string $column): callable
+{
+    return function (string $name, string $prefix) use ($column): array {
+        return [sprintf('%s = %s', $column, $prefix), [$prefix => [$name, PDO::PARAM_STR]]];
+    };
+}
+
+// 現在の条件に feature を1つ追加したときの件数を数えるための条件
+// any のときは OR の中に追加する必要があるため、返り値の key の条件を外して features の条件を作り直す
+function featureFacetBucket(array $queryParams): array
+{
+    $features = $queryParams['features'] ?? null;
+    $featureMode = $queryParams['featureMode'] ?? '';
+    if ($featureMode !== 'any' || !$features) {
+        return ['', function (string $name, string $prefix): array {
+            return buildFeatureCondition([$name], 'all', $prefix);
+        }];
+    }
+    $current = explode(',', $features);
+    return ['features', function (string $name, string $prefix) use ($current): array {
+        return buildFeatureCondition(array_merge($current, [$name]), 'any', $prefix);
+    }];
+}
+
 return function (App $app) {
     $app->options('/{routes:.*}', function (Request $request, Response $response) {
         // CORS Pre-Flight OPTIONS Request Handler
@@ -61,7 +338,7 @@ return function (App $app) {
             system("bash -c \"$cmdStr\"", $result);
             if ($result !== EXEC_SUCCESS) {
                 $this->get('logger')->error('Initialize script error');
-                return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+                return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'INITIALIZE_FAILED', 'failed to initialize database');
             }
         }
 
@@ -73,102 +350,29 @@ return function (App $app) {
     });
 
     $app->get('/api/chair/search', function(Request $request, Response $response) {
-        $conditions = [];
-        $params = [];
-
         /** @var ChairSearchCondition */
         $chairSearchCondition = $this->get(ChairSearchCondition::class);
 
-        $priceRangeId = $request->getQueryParams()['priceRangeId'] ?? null;
-        if (is_numeric($priceRangeId)) {
-            if (!$chairPrice = getRange($chairSearchCondition->price, $priceRangeId)) {
-                $this->get('logger')->info(sprintf('priceRangeId invalid, %s', $priceRangeId));
-                return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
-            }
-            if ($chairPrice->min != -1) {
-                $conditions[] = 'price >= :minPrice';
-                $params[':minPrice'] = [$chairPrice->min, PDO::PARAM_INT];
-            }
-            if ($chairPrice->max != -1) {
-                $conditions[] = 'price < :maxPrice';
-                $params[':maxPrice'] = [$chairPrice->max, PDO::PARAM_INT];
-            }
-        }
-        $heightRangeId = $request->getQueryParams()['heightRangeId'] ?? null;
-        if (is_numeric($heightRangeId)) {
-            if (!$chairHeight = getRange($chairSearchCondition->height, $heightRangeId)) {
-                $this->get('logger')->info(sprintf('heightRangeId invalid, %s', $heightRangeId));
-                return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
-            }
-            if ($chairHeight->min != -1) {
-                $conditions[] = 'height >= :minHeight';
-                $params[':minHeight'] = [$chairHeight->min, PDO::PARAM_INT];
-            }
-            if ($chairHeight->max != -1) {
-                $conditions[] = 'height < :maxHeight';
-                $params[':maxHeight'] = [$chairHeight->max, PDO::PARAM_INT];
-            }
-        }
-        $widthRangeId = $request->getQueryParams()['widthRangeId'] ?? null;
-        if (is_numeric($widthRangeId)) {
-            if (!$chairWidth = getRange($chairSearchCondition->width, $widthRangeId)) {
-                $this->get('logger')->info(sprintf('widthRangeId invalid, %s', $widthRangeId));
-                return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
-            }
-            if ($chairWidth->min != -1) {
-                $conditions[] = 'width >= :minWidth';
-                $params[':minWidth'] = [$chairWidth->min, PDO::PARAM_INT];
-            }
-            if ($chairWidth->max != -1) {
-                $conditions[] = 'width < :maxWidth';
-                $params[':maxWidth'] = [$chairWidth->max, PDO::PARAM_INT];
-            }
-        }
-        $depthRangeId = $request->getQueryParams()['depthRangeId'] ?? null;
-        if (is_numeric($depthRangeId)) {
-            if (!$chairDepth = getRange($chairSearchCondition->depth, $depthRangeId)) {
-                $this->get('logger')->info(sprintf('depthRangeId invalid, %s', $depthRangeId));
-                return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
-            }
-            if ($chairDepth->min != -1) {
-                $conditions[] = 'depth >= :minDepth';
-                $params[':minDepth'] = [$chairDepth->min, PDO::PARAM_INT];
-            }
-            if ($chairDepth->max != -1) {
-                $conditions[] = 'depth < :maxDepth';
-                $params[':maxDepth'] = [$chairDepth->max, PDO::PARAM_INT];
-            }
-        }
-        if ($kind = $request->getQueryParams()['kind'] ?? null) {
-            $conditions[] = 'kind = :kind';
-            $params[':kind'] = [$kind, PDO::PARAM_STR];
-        }
-        if ($color = $request->getQueryParams()['color'] ?? null) {
-            $conditions[] = 'color = :color';
-            $params[':color'] = [$color, PDO::PARAM_STR];
-        }
-        if ($features = $request->getQueryParams()['features'] ?? null) {
-            foreach (explode(',', $features) as $key => $feature) {
-                $name = sprintf(':feature_%s', $key);
-                $conditions[] = sprintf("features LIKE CONCAT('%%', %s, '%%')", $name);
-                $params[$name] = [$feature, PDO::PARAM_STR];
-            }
+        list($conditions, $params, $error) = buildChairSearchCondition($chairSearchCondition, $request->getQueryParams());
+        if (!is_null($error)) {
+            $this->get('logger')->info($error['message']);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, $error['code'], $error['message'], $error['field']);
         }
 
         if (count($conditions) === 0) {
             $this->get('logger')->info('Search condition not found');
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'MISSING_SEARCH_CONDITION', 'at least one search condition is required');
         }
 
         $conditions[] = 'stock > 0';
 
         if (is_null($page = $request->getQueryParams()['page'] ?? null)) {
             $this->get('logger')->info(sprintf('Invalid format page parameter: %s', $page));
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_PAGE', 'page must be an integer', 'page');
         }
         if (is_null($perPage = $request->getQueryParams()['perPage'] ?? null)) {
             $this->get('logger')->info(sprintf('Invalid format perPage parameter: %s', $perPage));
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_PER_PAGE', 'perPage must be an integer', 'perPage');
         }
 
         $searchQuery = 'SELECT * FROM chair WHERE ';
@@ -241,11 +445,42 @@ return function (App $app) {
         return $response->withHeader('Content-Type', 'application/json');
     });
 
+    $app->get('/api/chair/search/facets', function(Request $request, Response $response) {
+        /** @var ChairSearchCondition */
+        $chairSearchCondition = $this->get(ChairSearchCondition::class);
+
+        $queryParams = $request->getQueryParams();
+        list(, , $error) = buildChairSearchCondition($chairSearchCondition, $queryParams);
+        if (!is_null($error)) {
+            $this->get('logger')->info($error['message']);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, $error['code'], $error['message'], $error['field']);
+        }
+        $without = function (string $key) use ($chairSearchCondition, $queryParams): array {
+            list($conditions, $params) = buildChairSearchCondition($chairSearchCondition, withoutKey($queryParams, $key));
+            $conditions[] = 'stock > 0';
+            return [$conditions, $params];
+        };
+
+        $pdo = $this->get(PDO::class);
+        $facets = [];
+        foreach ([['price', 'priceRangeId', 'price'], ['height', 'heightRangeId', 'height'], ['width', 'widthRangeId', 'width'], ['depth', 'depthRangeId', 'depth']] as list($name, $key, $column)) {
+            $facets[$name] = countRangeFacets($pdo, 'chair', $without($key), $column, $chairSearchCondition->$name);
+        }
+        foreach (['kind', 'color'] as $name) {
+            $facets[$name] = countListFacets($pdo, 'chair', $without($name), $chairSearchCondition->$name->list, columnEqualBucket($name));
+        }
+        list($featureKey, $bucket) = featureFacetBucket($queryParams);
+        $facets['feature'] = countListFacets($pdo, 'chair', $without($featureKey), $chairSearchCondition->feature->list, $bucket);
+
+        $response->getBody()->write(json_encode($facets));
+        return $response->withHeader('Content-Type', 'application/json');
+    });
+
     $app->post('/api/chair/buy/{id}', function(Request $request, Response $response, array $args) {
         $id = $args['id'] ?? null;
         if (empty($id) || !is_numeric($id)) {
             $this->get('logger')->info('post request document failed');
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_ID', 'id must be an integer', 'id');
         }
 
         $pdo = $this->get(PDO::class);
@@ -260,7 +495,7 @@ return function (App $app) {
             if (!$chair) {
                 $pdo->rollBack();
                 $this->get('logger')->info(sprintf('buyChair chair id "%s" not found', $id));
-                return $response->withStatus(StatusCodeInterface::STATUS_NOT_FOUND);
+                return errorResponse($response, StatusCodeInterface::STATUS_NOT_FOUND, 'CHAIR_NOT_FOUND', 'chair not found or sold out');
             }
 
             $stmt = $pdo->prepare('UPDATE chair SET stock = stock - 1 WHERE id = :id');
@@ -268,14 +503,14 @@ return function (App $app) {
             if (!$stmt->execute()) {
                 $pdo->rollBack();
                 $this->get('logger')->error('chair stock update failed');
-                return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+                return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'DATABASE_ERROR', 'database error');
             }
 
             $pdo->commit();
         } catch (PDOException $e) {
             $pdo->rollBack();
             $this->get('logger')->error(sprintf('DB Execution Error: on getting a chair by id : %s', $id));
-            return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+            return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'DATABASE_ERROR', 'database error');
         }
 
         return $response->withHeader('Content-Type', 'application/json');
@@ -285,7 +520,7 @@ return function (App $app) {
         $id = $args['id'] ?? null;
         if (empty($id) || !is_numeric($id)) {
             $this->get('logger')->error(sprintf('Request parameter \"id\" parse error : %s', $id));
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_ID', 'id must be an integer', 'id');
         }
 
         $query = 'SELECT * FROM chair WHERE id = :id';
@@ -295,13 +530,13 @@ return function (App $app) {
 
         if (!$chair) {
             $this->get('logger')->error(sprintf('requested id\'s chair not found : %s', $id));
-            return $response->withStatus(StatusCodeInterface::STATUS_NOT_FOUND);
+            return errorResponse($response, StatusCodeInterface::STATUS_NOT_FOUND, 'CHAIR_NOT_FOUND', 'chair not found');
         } elseif (!$chair instanceof Chair) {
             $this->get('logger')->error(sprintf('Failed to get the chair from id : %s', $id));
-            return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+            return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'INTERNAL_SERVER_ERROR', 'Internal Server Error');
         } elseif ($chair->getStock() <= 0) {
             $this->get('logger')->error(sprintf('requested id\'s chair is sold out : %s', $id));
-            return $response->withStatus(StatusCodeInterface::STATUS_NOT_FOUND);
+            return errorResponse($response, StatusCodeInterface::STATUS_NOT_FOUND, 'CHAIR_SOLD_OUT', 'chair is sold out');
         }
 
         $response->getBody()->write(json_encode($chair->toArray()));
@@ -312,15 +547,15 @@ return function (App $app) {
     $app->post('/api/chair', function (Request $request, Response $response) {
         if (!$file = $request->getUploadedFiles()['chairs'] ?? null) {
             $this->get('logger')->error('failed to get form file');
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'MISSING_CSV', 'csv file is required', 'chairs');
         } elseif (!$file instanceof Slim\Psr7\UploadedFile || $file->getError() !== UPLOAD_ERR_OK) {
             $this->get('logger')->error('failed to get form file');
-            return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+            return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'CSV_READ_FAILED', 'failed to open csv file', 'chairs');
         }
 
         if (!$records = Reader::createFromPath($file->getFilePath())) {
             $this->get('logger')->error('failed to read csv');
-            return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+            return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'CSV_READ_FAILED', 'failed to read csv file', 'chairs');
         }
 
         $pdo = $this->get(PDO::class);
@@ -352,7 +587,7 @@ return function (App $app) {
         } catch (PDOException $e) {
             $pdo->rollBack();
             $this->get('logger')->error(sprintf('failed to insert chair: %s', $e->getMessage()));
-            return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+            return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'DATABASE_ERROR', 'database error');
         }
 
         return $response->withStatus(StatusCodeInterface::STATUS_CREATED);
@@ -362,15 +597,15 @@ return function (App $app) {
     $app->post('/api/estate', function(Request $request, Response $response) {
         if (!$file = $request->getUploadedFiles()['estates'] ?? null) {
             $this->get('logger')->error('failed to get form file');
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'MISSING_CSV', 'csv file is required', 'estates');
         } elseif (!$file instanceof Slim\Psr7\UploadedFile || $file->getError() !== UPLOAD_ERR_OK) {
             $this->get('logger')->error('failed to get form file');
-            return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+            return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'CSV_READ_FAILED', 'failed to open csv file', 'estates');
         }
 
         if (!$records = Reader::createFromPath($file->getFilePath())) {
             $this->get('logger')->error('failed to read csv');
-            return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+            return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'CSV_READ_FAILED', 'failed to read csv file', 'estates');
         }
 
         $pdo = $this->get(PDO::class);
@@ -401,85 +636,34 @@ return function (App $app) {
         } catch (PDOException $e) {
             $pdo->rollBack();
             $this->get('logger')->error(sprintf('failed to insert estate: %s', $e->getMessage()));
-            return $response->withStatus(StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR);
+            return errorResponse($response, StatusCodeInterface::STATUS_INTERNAL_SERVER_ERROR, 'DATABASE_ERROR', 'database error');
         }
 
         return $response->withStatus(StatusCodeInterface::STATUS_CREATED);
     });
 
     $app->get('/api/estate/search', function(Request $request, Response $response) {
-        $conditions = [];
-        $params = [];
-
         /** @var EstateSearchCondition */
         $estateSearchCondition = $this->get(EstateSearchCondition::class);
 
-        $doorHeightRangeId = $request->getQueryParams()['doorHeightRangeId'] ?? null;
-        if (is_numeric($doorHeightRangeId)) {
-            if (!$doorHeight = getRange($estateSearchCondition->doorHeight, $doorHeightRangeId)) {
-                $this->get('logger')->info(sprintf('doorHeightRangeId invalid, %s', $doorHeightRangeId));
-                return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
-            }
-            if ($doorHeight->min != -1) {
-                $conditions[] = 'door_height >= :minDoorHeight';
-                $params[':minDoorHeight'] = [$doorHeight->min, PDO::PARAM_INT];
-            }
-            if ($doorHeight->max != -1) {
-                $conditions[] = 'door_height < :maxDoorHeight';
-                $params[':maxDoorHeight'] = [$doorHeight->max, PDO::PARAM_INT];
-            }
-        }
-        $doorWidthRangeId = $request->getQueryParams()['doorWidthRangeId'] ?? null;
-        if (is_numeric($doorWidthRangeId)) {
-            if (!$doorWidth = getRange($estateSearchCondition->doorWidth, $doorWidthRangeId)) {
-                $this->get('logger')->info(sprintf('doorWidthRangeId invalid, %s', $doorWidthRangeId));
-                return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
-            }
-            if ($doorWidth->min != -1) {
-                $conditions[] = 'door_width >= :minDoorWidth';
-                $params[':minDoorWidth'] = [$doorWidth->min, PDO::PARAM_INT];
-            }
-            if ($doorWidth->max != -1) {
-                $conditions[] = 'door_width < :maxDoorWidth';
-                $params[':maxDoorWidth'] = [$doorWidth->max, PDO::PARAM_INT];
-            }
-        }
-        $rentRangeId = $request->getQueryParams()['rentRangeId'] ?? null;
-        if (is_numeric($rentRangeId)) {
-            if (!$estateRent = getRange($estateSearchCondition->rent, $rentRangeId)) {
-                $this->get('logger')->info(sprintf('rentRangeId invalid, %s', $rentRangeId));
-                return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
-            }
-            if ($estateRent->min != -1) {
-                $conditions[] = 'rent >= :minEstateRent';
-                $params[':minEstateRent'] = [$estateRent->min, PDO::PARAM_INT];
-            }
-            if ($estateRent->max != -1) {
-                $conditions[] = 'rent < :maxEstateRent';
-                $params[':maxEstateRent'] = [$estateRent->max, PDO::PARAM_INT];
-            }
-        }
-
-        if ($features = $request->getQueryParams()['features'] ?? null) {
-            foreach (explode(',', $features) as $key => $feature) {
-                $name = sprintf(':feature_%s', $key);
-                $conditions[] = sprintf("features LIKE CONCAT('%%', %s, '%%')", $name);
-                $params[$name] = [$feature, PDO::PARAM_STR];
-            }
+        list($conditions, $params, $error) = buildEstateSearchCondition($estateSearchCondition, $request->getQueryParams());
+        if (!is_null($error)) {
+            $this->get('logger')->info($error['message']);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, $error['code'], $error['message'], $error['field']);
         }
 
         if (count($conditions) === 0) {
             $this->get('logger')->info('Search condition not found');
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'MISSING_SEARCH_CONDITION', 'at least one search condition is required');
         }
 
         if (is_null($page = $request->getQueryParams()['page'] ?? null)) {
             $this->get('logger')->info(sprintf('Invalid format page parameter: %s', $page));
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_PAGE', 'page must be an integer', 'page');
         }
         if (is_null($perPage = $request->getQueryParams()['perPage'] ?? null)) {
             $this->get('logger')->info(sprintf('Invalid format perPage parameter: %s', $perPage));
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_PER_PAGE', 'perPage must be an integer', 'perPage');
         }
 
         $searchQuery = 'SELECT * FROM estate WHERE ';
@@ -550,7 +734,7 @@ return function (App $app) {
         $id = $args['id'] ?? null;
         if (empty($id) || !is_numeric($id)) {
             $this->get('logger')->error(sprintf('Request parameter "id" parse error : %s', $id));
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_ID', 'id must be an integer', 'id');
         }
 
         $query = 'SELECT * FROM estate WHERE id = :id';
@@ -560,7 +744,7 @@ return function (App $app) {
 
         if (!$estate) {
             $this->get('logger')->error(sprintf('requested id\'s estate not found : %s', $id));
-            return $response->withStatus(StatusCodeInterface::STATUS_NOT_FOUND);
+            return errorResponse($response, StatusCodeInterface::STATUS_NOT_FOUND, 'ESTATE_NOT_FOUND', 'estate not found');
         }
 
         return $response->withStatus(StatusCodeInterface::STATUS_OK);
@@ -568,13 +752,16 @@ return function (App $app) {
 
     $app->post('/api/estate/nazotte', function(request $request, Response $response) {
         $json = json_decode($request->getBody()->getContents(), true);
+        if (!is_array($json)) {
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_REQUEST_BODY', 'failed to parse request body');
+        }
+        if (!is_array($json['coordinates'] ?? null) || count($json['coordinates']) === 0) {
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'MISSING_COORDINATES', 'coordinates are required', 'coordinates');
+        }
         $coordinates = array_map(
             Coordinate::class . '::createFromJson',
             $json['coordinates']
         );
-        if (count($coordinates) === 0) {
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
-        }
 
         $boundingBox = BoundingBox::createFromCordinates($coordinates);
 
@@ -623,11 +810,38 @@ return function (App $app) {
         return $response->withHeader('Content-Type', 'application/json');
     });
 
+    $app->get('/api/estate/search/facets', function(Request $request, Response $response) {
+        /** @var EstateSearchCondition */
+        $estateSearchCondition = $this->get(EstateSearchCondition::class);
+
+        $queryParams = $request->getQueryParams();
+        list(, , $error) = buildEstateSearchCondition($estateSearchCondition, $queryParams);
+        if (!is_null($error)) {
+            $this->get('logger')->info($error['message']);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, $error['code'], $error['message'], $error['field']);
+        }
+        $without = function (string $key) use ($estateSearchCondition, $queryParams): array {
+            list($conditions, $params) = buildEstateSearchCondition($estateSearchCondition, withoutKey($queryParams, $key));
+            return [$conditions, $params];
+        };
+
+        $pdo = $this->get(PDO::class);
+        $facets = [];
+        foreach ([['doorHeight', 'doorHeightRangeId', 'door_height'], ['doorWidth', 'doorWidthRangeId', 'door_width'], ['rent', 'rentRangeId', 'rent']] as list($name, $key, $column)) {
+            $facets[$name] = countRangeFacets($pdo, 'estate', $without($key), $column, $estateSearchCondition->$name);
+        }
+        list($featureKey, $bucket) = featureFacetBucket($queryParams);
+        $facets['feature'] = countListFacets($pdo, 'estate', $without($featureKey), $estateSearchCondition->feature->list, $bucket);
+
+        $response->getBody()->write(json_encode($facets));
+        return $response->withHeader('Content-Type', 'application/json');
+    });
+
     $app->get('/api/recommended_estate/{id}', function(Request $request, Response $response, array $args) {
         $id = $args['id'] ?? null;
         if (empty($id) || !is_numeric($id)) {
             $this->get('logger')->info('post request document failed');
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_ID', 'id must be an integer', 'id');
         }
 
         $query = 'SELECT * FROM chair WHERE id = ?';
@@ -637,7 +851,7 @@ return function (App $app) {
 
         if (!$chair) {
             $this->get('logger')->info(sprintf('Requested chair id "%s" not found', $id));
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'CHAIR_NOT_FOUND', 'chair not found', 'id');
         }
 
         $query = 'SELECT * FROM estate WHERE (door_width >= :w AND door_height >= :h) OR (door_width >= :w AND door_height >= :d) OR (door_width >= :h AND door_height >= :w) OR (door_width >= :h AND door_height >= :d) OR (door_width >= :d AND door_height >= :w) OR (door_width >= :d AND door_height >= :h) ORDER BY popularity DESC, id ASC LIMIT :limit';
@@ -661,11 +875,61 @@ return function (App $app) {
         return $response->withHeader('Content-Type', 'application/json');
     });
 
+    $app->get('/api/recommended_chair/{id}', function(Request $request, Response $response, array $args) {
+        $id = $args['id'] ?? null;
+        if (empty($id) || !is_numeric($id)) {
+            $this->get('logger')->info('Request parameter "id" parse error');
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_ID', 'id must be an integer', 'id');
+        }
+
+        $maxPrice = $request->getQueryParams()['maxPrice'] ?? '';
+        if ($maxPrice !== '' && !ctype_digit($maxPrice)) {
+            $this->get('logger')->info(sprintf('Invalid format maxPrice parameter : %s', $maxPrice));
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_MAX_PRICE', 'maxPrice must be a non-negative integer', 'maxPrice');
+        }
+
+        $query = 'SELECT * FROM estate WHERE id = ?';
+        $stmt = $this->get(PDO::class)->prepare($query);
+        $stmt->execute([$id]);
+        $estate = $stmt->fetchObject(Estate::class);
+
+        if (!$estate) {
+            $this->get('logger')->info(sprintf('Requested estate id "%s" not found', $id));
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'ESTATE_NOT_FOUND', 'estate not found', 'id');
+        }
+
+        $query = 'SELECT * FROM chair WHERE stock > 0 AND ((width <= :w AND height <= :h) OR (width <= :w AND depth <= :h) OR (height <= :w AND width <= :h) OR (height <= :w AND depth <= :h) OR (depth <= :w AND width <= :h) OR (depth <= :w AND height <= :h))';
+        if ($maxPrice !== '') {
+            $query .= ' AND price <= :maxPrice';
+        }
+        $query .= ' ORDER BY popularity DESC, id ASC LIMIT :limit';
+        $stmt = $this->get(PDO::class)->prepare($query);
+        $stmt->bindValue(':w', $estate->getDoorWidth(), PDO::PARAM_INT);
+        $stmt->bindValue(':h', $estate->getDoorHeight(), PDO::PARAM_INT);
+        if ($maxPrice !== '') {
+            $stmt->bindValue(':maxPrice', (int)$maxPrice, PDO::PARAM_INT);
+        }
+        $stmt->bindValue(':limit', NUM_LIMIT, PDO::PARAM_INT);
+        $stmt->execute();
+        $chairs = $stmt->fetchAll(PDO::FETCH_CLASS, Chair::class);
+
+        $response->getBody()->write(json_encode([
+            'chairs' => array_map(
+                function(Chair $chair) {
+                    return $chair->toArray();
+                },
+                $chairs
+            ),
+        ]));
+
+        return $response->withHeader('Content-Type', 'application/json');
+    });
+
     $app->get('/api/estate/{id}', function(Request $request, Response $response, array $args) {
         $id = $args['id'] ?? null;
         if (empty($id) || !is_numeric($id)) {
             $this->get('logger')->info('Request parameter "id" parse error');
-            return $response->withStatus(StatusCodeInterface::STATUS_BAD_REQUEST);
+            return errorResponse($response, StatusCodeInterface::STATUS_BAD_REQUEST, 'INVALID_ID', 'id must be an integer', 'id');
         }
 
         $stmt = $this->get(PDO::class)->prepare('SELECT * FROM estate WHERE id = :id');
@@ -674,6 +938,11 @@ return function (App $app) {
 
         $estate = $stmt->fetchObject(Estate::class);
 
+        if (!$estate) {
+            $this->get('logger')->info(sprintf('requested id\'s estate not found : %s', $id));
+            return errorResponse($response, StatusCodeInterface::STATUS_NOT_FOUND, 'ESTATE_NOT_FOUND', 'estate not found');
+        }
+
         $response->getBody()->write(json_encode($estate->toArray()));
 
         return $response->withHeader('Content-Type', 'application/json');
@@ -3,51 +3,47 @@ declare(strict_types=1);
 
 namespace App\Application\Handlers;
 
-use App\Application\Actions\ActionError;
-use App\Application\Actions\ActionPayload;
-use Exception;
+use PDOException;
 use Psr\Http\Message\ResponseInterface as Response;
-use Slim\Exception\HttpBadRequestException;
 use Slim\Exception\HttpException;
-use Slim\Exception\HttpForbiddenException;
 use Slim\Exception\HttpMethodNotAllowedException;
 use Slim\Exception\HttpNotFoundException;
-use Slim\Exception\HttpNotImplementedException;
-use Slim\Exception\HttpUnauthorizedException;
 use Slim\Handlers\ErrorHandler as SlimErrorHandler;
 use Throwable;
 
 class HttpErrorHandler extends SlimErrorHandler
 {
     /**
+     * Responds with the same error body as the go implementation
+     *
      * @inheritdoc
      */
     protected function respond(): Response
     {
         $exception = $this->exception;
         $statusCode = 500;
-        $error = new ActionError(
-            ActionError::SERVER_ERROR,
-            'An internal error has occurred while processing your request.'
-        );
+        $error = [
+            'code' => 'INTERNAL_SERVER_ERROR',
+            'message' => 'Internal Server Error',
+        ];
 
         if ($exception instanceof HttpException) {
             $statusCode = $exception->getCode();
-            $error->setDescription($exception->getMessage());
+            $reasonPhrase = $this->responseFactory->createResponse($statusCode)->getReasonPhrase();
+            $error['message'] = $reasonPhrase;
 
             if ($exception instanceof HttpNotFoundException) {
-                $error->setType(ActionError::RESOURCE_NOT_FOUND);
+                $error['code'] = 'ROUTE_NOT_FOUND';
             } elseif ($exception instanceof HttpMethodNotAllowedException) {
-                $error->setType(ActionError::NOT_ALLOWED);
-            } elseif ($exception instanceof HttpUnauthorizedException) {
-                $error->setType(ActionError::UNAUTHENTICATED);
-            } elseif ($exception instanceof HttpForbiddenException) {
-                $error->setType(ActionError::INSUFFICIENT_PRIVILEGES);
-            } elseif ($exception instanceof HttpBadRequestException) {
-                $error->setType(ActionError::BAD_REQUEST);
-            } elseif ($exception instanceof HttpNotImplementedException) {
-                $error->setType(ActionError::NOT_IMPLEMENTED);
+                $error['code'] = 'METHOD_NOT_ALLOWED';
+            } elseif ($statusCode !== 500) {
+                $error['code'] = strtoupper(str_replace(' ', '_', $reasonPhrase));
             }
+        } elseif ($exception instanceof PDOException) {
+            $error = [
+                'code' => 'DATABASE_ERROR',
+                'message' => 'database error',
+            ];
         }
 
         if (
@@ -55,14 +51,11 @@ class HttpErrorHandler extends SlimErrorHandler
             && $exception instanceof Throwable
             && $this->displayErrorDetails
         ) {
-            $error->setDescription($exception->getMessage());
+            $error['message'] = $exception->getMessage();
         }
 
-        $payload = new ActionPayload($statusCode, null, $error);
-        $encodedPayload = json_encode($payload, JSON_PRETTY_PRINT);
-
         $response = $this->responseFactory->createResponse($statusCode);
-        $response->getBody()->write($encodedPayload);
+        $response->getBody()->write(json_encode($error));
 
         return $response->withHeader('Content-Type', 'application/json');
     }
@@ -0,0 +1,161 @@
+<?php
+declare(strict_types=1);
+
+namespace App\Application\Middleware;
+
+use Psr\Http\Message\ResponseFactoryInterface;
+use Psr\Http\Message\ResponseInterface as Response;
+use Psr\Http\Message\ServerRequestInterface as Request;
+use Psr\Http\Server\MiddlewareInterface as Middleware;
+use Psr\Http\Server\RequestHandlerInterface as RequestHandler;
+use RuntimeException;
+
+/**
+ * Limits requests with the same token buckets as the go implementation.
+ * Buckets are kept in a locked file so that every php-fpm worker shares them.
+ */
+class RateLimitMiddleware implements Middleware
+{
+    const KEY_IP = 'ip';
+    const KEY_USER_AGENT = 'user_agent';
+
+    // Buckets idle for longer than this are dropped
+    const BUCKET_IDLE_TIMEOUT = 10 * 60;
+
+    private ResponseFactoryInterface $responseFactory;
+    private array $config;
+    private string $storePath;
+
+    public function __construct(ResponseFactoryInterface $responseFactory, array $config, ?string $storePath = null)
+    {
+        $this->responseFactory = $responseFactory;
+        $this->config = $config;
+        $this->storePath = $storePath ?? sys_get_temp_dir() . '/isuumo-ratelimit.json';
+    }
+
+    /**
+     * Loads the config in the same format as the go implementation.
+     * Routes are written like "POST /api/estate/nazotte".
+     */
+    public static function loadConfig(string $path): array
+    {
+        $content = @file_get_contents($path);
+        if ($content === false) {
+            throw new RuntimeException("failed to read {$path}");
+        }
+        $decoded = json_decode($content, true);
+        if (!is_array($decoded)) {
+            throw new RuntimeException("invalid rate limit config: {$path}");
+        }
+        $config = array_merge([
+            'key' => self::KEY_IP,
+            'default' => ['rate' => 0, 'burst' => 0],
+            'routes' => [],
+        ], $decoded);
+
+        if ($config['key'] !== self::KEY_IP && $config['key'] !== self::KEY_USER_AGENT) {
+            throw new RuntimeException("invalid rate limit key: {$config['key']}");
+        }
+        foreach (array_merge([$config['default']], array_values($config['routes'])) as $budget) {
+            if (($budget['rate'] ?? 0) > 0 && ($budget['burst'] ?? 0) < 1) {
+                throw new RuntimeException('burst must be greater than 0 when rate is set');
+            }
+        }
+
+        return $config;
+    }
+
+    /**
+     * {@inheritdoc}
+     */
+    public function process(Request $request, RequestHandler $handler): Response
+    {
+        // Replace numeric path params with :id to match the routes of the go implementation
+        $route = $request->getMethod() . ' ' . preg_replace('#/\d+(?=/|$)#', '/:id', $request->getUri()->getPath());
+        $budget = $this->config['routes'][$route] ?? $this->config['default'];
+        if (($budget['rate'] ?? 0) <= 0) {
+            return $handler->handle($request);
+        }
+
+        [$ok, $wait] = $this->take($route . "\0" . $this->clientOf($request), $budget, microtime(true));
+        if ($ok) {
+            return $handler->handle($request);
+        }
+
+        $retryAfter = (int)ceil($wait);
+        $response = $this->responseFactory->createResponse(429);
+        $response->getBody()->write(json_encode([
+            'code' => 'RATE_LIMITED',
+            'message' => "rate limit exceeded, retry after {$retryAfter} seconds",
+        ]));
+
+        return $response
+            ->withHeader('Content-Type', 'application/json')
+            ->withHeader('Retry-After', (string)$retryAfter);
+    }
+
+    /**
+     * Takes a token and returns the seconds until the next one when there is none left.
+     */
+    public function take(string $key, array $budget, float $now): array
+    {
+        $fp = fopen($this->storePath, 'c+');
+        if ($fp === false) {
+            throw new RuntimeException("failed to open {$this->storePath}");
+        }
+        flock($fp, LOCK_EX);
+        $store = json_decode(stream_get_contents($fp), true);
+        if (!is_array($store)) {
+            $store = [];
+        }
+        $buckets = $store['buckets'] ?? [];
+
+        $store['swept_at'] = $store['swept_at'] ?? $now;
+        if ($now - $store['swept_at'] > self::BUCKET_IDLE_TIMEOUT) {
+            $buckets = array_filter($buckets, function (array $bucket) use ($now) {
+                return $now - $bucket['update_at'] <= self::BUCKET_IDLE_TIMEOUT;
+            });
+            $store['swept_at'] = $now;
+        }
+
+        $bucket = $buckets[$key] ?? ['tokens' => $budget['burst'], 'update_at' => $now];
+        $bucket['tokens'] = min($budget['burst'], $bucket['tokens'] + ($now - $bucket['update_at']) * $budget['rate']);
+        $bucket['update_at'] = $now;
+
+        $ok = $bucket['tokens'] >= 1;
+        if ($ok) {
+            $bucket['tokens'] -= 1;
+        }
+        $buckets[$key] = $bucket;
+
+        $store['buckets'] = $buckets;
+        ftruncate($fp, 0);
+        rewind($fp);
+        fwrite($fp, json_encode($store));
+        fflush($fp);
+        flock($fp, LOCK_UN);
+        fclose($fp);
+
+        return $ok ? [true, 0] : [false, (1 - $bucket['tokens']) / $budget['rate']];
+    }
+
+    /**
+     * Picks the client in the same order as echo's RealIP.
+     */
+    private function clientOf(Request $request): string
+    {
+        if ($this->config['key'] === self::KEY_USER_AGENT) {
+            return $request->getHeaderLine('User-Agent');
+        }
+        $forwardedFor = $request->getHeaderLine('X-Forwarded-For');
+        if ($forwardedFor !== '') {
+            return explode(', ', $forwardedFor)[0];
+        }
+        $realIp = $request->getHeaderLine('X-Real-IP');
+        if ($realIp !== '') {
+            return $realIp;
+        }
+
+        return $request->getServerParams()['REMOTE_ADDR'] ?? '';
+    }
+}
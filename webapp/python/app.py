@@ -3,11 +3,13 @@ import json
 import subprocess
 from io import StringIO
 import csv
+import time
 import flask
-from werkzeug.exceptions import BadRequest, NotFound
+from werkzeug.exceptions import HTTPException
 import mysql.connector
 from sqlalchemy.pool import QueuePool
 from humps import camelize
+from ratelimit import load_rate_limit_config, RateLimiter
 
 LIMIT = 20
 NAZOTTE_LIMIT = 50
@@ -28,6 +30,53 @@ mysql_connection_env = {
 cnxpool = QueuePool(lambda: mysql.connector.connect(**mysql_connection_env), pool_size=10)
 
 
+class APIError(Exception):
+    def __init__(self, status, code, message, field=None):
+        super().__init__(message)
+        self.status = status
+        self.code = code
+        self.message = message
+        self.field = field
+
+
+def error_response(status, code, message, field=None):
+    body = {"code": code, "message": message}
+    if field:
+        body["field"] = field
+    return body, status
+
+
+# すべてのエラーを {code, message, field} の形式で返す
+@app.errorhandler(APIError)
+def handle_api_error(e):
+    return error_response(e.status, e.code, e.message, e.field)
+
+
+@app.errorhandler(mysql.connector.Error)
+def handle_database_error(e):
+    app.logger.exception(e)
+    return error_response(500, "DATABASE_ERROR", "database error")
+
+
+@app.errorhandler(HTTPException)
+def handle_http_exception(e):
+    codes = {404: "ROUTE_NOT_FOUND", 405: "METHOD_NOT_ALLOWED", 500: "INTERNAL_SERVER_ERROR"}
+    return error_response(e.code, codes.get(e.code, e.name.upper().replace(" ", "_")), e.name)
+
+
+if getenv("RATE_LIMIT_CONFIG"):
+    limiter = RateLimiter(load_rate_limit_config(getenv("RATE_LIMIT_CONFIG")))
+
+    @app.before_request
+    def limit_rate():
+        retry_after = limiter.check(flask.request, time.time())
+        if retry_after is not None:
+            body, status = error_response(
+                429, "RATE_LIMITED", f"rate limit exceeded, retry after {retry_after} seconds"
+            )
+            return body, status, {"Retry-After": str(retry_after)}
+
+
 def select_all(query, *args, dictionary=True):
     cnx = cnxpool.connect()
     try:
@@ -54,7 +103,8 @@ def post_initialize():
 
     for sql_file in sql_files:
         command = f"mysql -h {mysql_connection_env['host']} -u {mysql_connection_env['user']} -p{mysql_connection_env['password']} -P {mysql_connection_env['port']} {mysql_connection_env['database']} < {path.join(sql_dir, sql_file)}"
-        subprocess.run(["bash", "-c", command])
+        if subprocess.run(["bash", "-c", command]).returncode != 0:
+            raise APIError(500, "INITIALIZE_FAILED", "failed to initialize database")
 
     return {"language": "python"}
 
@@ -71,10 +121,13 @@ def get_chair_low_priced():
     return {"chairs": camelize(rows)}
 
 
-@app.route("/api/chair/search", methods=["GET"])
-def get_chair_search():
-    args = flask.request.args
+def build_feature_condition(features, feature_mode):
+    joiner = " OR " if feature_mode == "any" else " AND "
+    matches = ["FIND_IN_SET(%s, features) > 0"] * len(features)
+    return f"({joiner.join(matches)})", list(features)
+
 
+def build_chair_search_condition(args):
     conditions = []
     params = []
 
@@ -84,7 +137,7 @@ def get_chair_search():
                 price = _range
                 break
         else:
-            raise BadRequest("priceRangeID invalid")
+            raise APIError(400, "INVALID_RANGE_ID", "priceRangeID invalid", "priceRangeId")
         if price["min"] != -1:
             conditions.append("price >= %s")
             params.append(price["min"])
@@ -98,7 +151,7 @@ def get_chair_search():
                 height = _range
                 break
         else:
-            raise BadRequest("heightRangeId invalid")
+            raise APIError(400, "INVALID_RANGE_ID", "heightRangeId invalid", "heightRangeId")
         if height["min"] != -1:
             conditions.append("height >= %s")
             params.append(height["min"])
@@ -112,7 +165,7 @@ def get_chair_search():
                 width = _range
                 break
         else:
-            raise BadRequest("widthRangeId invalid")
+            raise APIError(400, "INVALID_RANGE_ID", "widthRangeId invalid", "widthRangeId")
         if width["min"] != -1:
             conditions.append("width >= %s")
             params.append(width["min"])
@@ -126,7 +179,7 @@ def get_chair_search():
                 depth = _range
                 break
         else:
-            raise BadRequest("depthRangeId invalid")
+            raise APIError(400, "INVALID_RANGE_ID", "depthRangeId invalid", "depthRangeId")
         if depth["min"] != -1:
             conditions.append("depth >= %s")
             params.append(depth["min"])
@@ -135,32 +188,45 @@ def get_chair_search():
             params.append(depth["max"])
 
     if args.get("kind"):
-        conditions.append("kind = %s")
-        params.append(args.get("kind"))
+        kinds = args.get("kind").split(",")
+        conditions.append(f"kind IN ({','.join(['%s'] * len(kinds))})")
+        params.extend(kinds)
 
     if args.get("color"):
-        conditions.append("color = %s")
-        params.append(args.get("color"))
+        colors = args.get("color").split(",")
+        conditions.append(f"color IN ({','.join(['%s'] * len(colors))})")
+        params.extend(colors)
+
+    if args.get("featureMode") not in (None, "", "all", "any"):
+        raise APIError(400, "INVALID_FEATURE_MODE", "featureMode invalid", "featureMode")
 
     if args.get("features"):
-        for feature_confition in args.get("features").split(","):
-            conditions.append("features LIKE CONCAT('%', %s, '%')")
-            params.append(feature_confition)
+        feature_condition, feature_params = build_feature_condition(args.get("features").split(","), args.get("featureMode"))
+        conditions.append(feature_condition)
+        params.extend(feature_params)
+
+    return conditions, params
+
+
+@app.route("/api/chair/search", methods=["GET"])
+def get_chair_search():
+    args = flask.request.args
+    conditions, params = build_chair_search_condition(args)
 
     if len(conditions) == 0:
-        raise BadRequest("Search condition not found")
+        raise APIError(400, "MISSING_SEARCH_CONDITION", "at least one search condition is required")
 
     conditions.append("stock > 0")
 
     try:
         page = int(args.get("page"))
     except (TypeError, ValueError):
-        raise BadRequest("Invalid format page parameter")
+        raise APIError(400, "INVALID_PAGE", "page must be an integer", "page")
 
     try:
         per_page = int(args.get("perPage"))
     except (TypeError, ValueError):
-        raise BadRequest("Invalid format perPage parameter")
+        raise APIError(400, "INVALID_PER_PAGE", "perPage must be an integer", "perPage")
 
     search_condition = " AND ".join(conditions)
 
@@ -178,11 +244,42 @@ def get_chair_search_condition():
     return chair_search_condition
 
 
+@app.route("/api/chair/search/facets", methods=["GET"])
+def get_chair_search_facets():
+    args = flask.request.args
+    build_chair_search_condition(args)
+
+    def without(key):
+        conditions, params = build_chair_search_condition(without_key(args, key))
+        conditions.append("stock > 0")
+        return conditions, params
+
+    facets = {}
+    for name, key, column in [
+        ("price", "priceRangeId", "price"),
+        ("height", "heightRangeId", "height"),
+        ("width", "widthRangeId", "width"),
+        ("depth", "depthRangeId", "depth"),
+    ]:
+        facets[name] = count_range_facets("chair", without(key), column, chair_search_condition[name])
+    for name in ["kind", "color"]:
+        facets[name] = count_list_facets(
+            "chair", without(name), chair_search_condition[name]["list"], column_equal_bucket(name)
+        )
+    feature_key, bucket = feature_facet_bucket(args)
+    facets["feature"] = count_list_facets(
+        "chair", without(feature_key), chair_search_condition["feature"]["list"], bucket
+    )
+    return facets
+
+
 @app.route("/api/chair/<int:chair_id>", methods=["GET"])
 def get_chair(chair_id):
     chair = select_row("SELECT * FROM chair WHERE id = %s", (chair_id,))
-    if chair is None or chair["stock"] <= 0:
-        raise NotFound()
+    if chair is None:
+        raise APIError(404, "CHAIR_NOT_FOUND", "chair not found")
+    if chair["stock"] <= 0:
+        raise APIError(404, "CHAIR_SOLD_OUT", "chair is sold out")
     return camelize(chair)
 
 
@@ -195,7 +292,7 @@ def post_chair_buy(chair_id):
         cur.execute("SELECT * FROM chair WHERE id = %s AND stock > 0 FOR UPDATE", (chair_id,))
         chair = cur.fetchone()
         if chair is None:
-            raise NotFound()
+            raise APIError(404, "CHAIR_NOT_FOUND", "chair not found or sold out")
         cur.execute("UPDATE chair SET stock = stock - 1 WHERE id = %s", (chair_id,))
         cnx.commit()
         return {"ok": True}
@@ -206,10 +303,7 @@ def post_chair_buy(chair_id):
         cnx.close()
 
 
-@app.route("/api/estate/search", methods=["GET"])
-def get_estate_search():
-    args = flask.request.args
-
+def build_estate_search_condition(args):
     conditions = []
     params = []
 
@@ -219,7 +313,7 @@ def get_estate_search():
                 door_height = _range
                 break
         else:
-            raise BadRequest("doorHeightRangeId invalid")
+            raise APIError(400, "INVALID_RANGE_ID", "doorHeightRangeId invalid", "doorHeightRangeId")
         if door_height["min"] != -1:
             conditions.append("door_height >= %s")
             params.append(door_height["min"])
@@ -233,7 +327,7 @@ def get_estate_search():
                 door_width = _range
                 break
         else:
-            raise BadRequest("doorWidthRangeId invalid")
+            raise APIError(400, "INVALID_RANGE_ID", "doorWidthRangeId invalid", "doorWidthRangeId")
         if door_width["min"] != -1:
             conditions.append("door_width >= %s")
             params.append(door_width["min"])
@@ -247,7 +341,7 @@ def get_estate_search():
                 rent = _range
                 break
         else:
-            raise BadRequest("rentRangeId invalid")
+            raise APIError(400, "INVALID_RANGE_ID", "rentRangeId invalid", "rentRangeId")
         if rent["min"] != -1:
             conditions.append("rent >= %s")
             params.append(rent["min"])
@@ -255,23 +349,34 @@ def get_estate_search():
             conditions.append("rent < %s")
             params.append(rent["max"])
 
+    if args.get("featureMode") not in (None, "", "all", "any"):
+        raise APIError(400, "INVALID_FEATURE_MODE", "featureMode invalid", "featureMode")
+
     if args.get("features"):
-        for feature_confition in args.get("features").split(","):
-            conditions.append("features LIKE CONCAT('%', %s, '%')")
-            params.append(feature_confition)
+        feature_condition, feature_params = build_feature_condition(args.get("features").split(","), args.get("featureMode"))
+        conditions.append(feature_condition)
+        params.extend(feature_params)
+
+    return conditions, params
+
+
+@app.route("/api/estate/search", methods=["GET"])
+def get_estate_search():
+    args = flask.request.args
+    conditions, params = build_estate_search_condition(args)
 
     if len(conditions) == 0:
-        raise BadRequest("Search condition not found")
+        raise APIError(400, "MISSING_SEARCH_CONDITION", "at least one search condition is required")
 
     try:
         page = int(args.get("page"))
     except (TypeError, ValueError):
-        raise BadRequest("Invalid format page parameter")
+        raise APIError(400, "INVALID_PAGE", "page must be an integer", "page")
 
     try:
         per_page = int(args.get("perPage"))
     except (TypeError, ValueError):
-        raise BadRequest("Invalid format perPage parameter")
+        raise APIError(400, "INVALID_PER_PAGE", "perPage must be an integer", "perPage")
 
     search_condition = " AND ".join(conditions)
 
@@ -289,21 +394,98 @@ def get_estate_search_condition():
     return estate_search_condition
 
 
+@app.route("/api/estate/search/facets", methods=["GET"])
+def get_estate_search_facets():
+    args = flask.request.args
+    build_estate_search_condition(args)
+
+    def without(key):
+        return build_estate_search_condition(without_key(args, key))
+
+    facets = {}
+    for name, key, column in [
+        ("doorHeight", "doorHeightRangeId", "door_height"),
+        ("doorWidth", "doorWidthRangeId", "door_width"),
+        ("rent", "rentRangeId", "rent"),
+    ]:
+        facets[name] = count_range_facets("estate", without(key), column, estate_search_condition[name])
+    feature_key, bucket = feature_facet_bucket(args)
+    facets["feature"] = count_list_facets(
+        "estate", without(feature_key), estate_search_condition["feature"]["list"], bucket
+    )
+    return facets
+
+
+def without_key(args, key):
+    return {k: v for k, v in args.items() if k != key}
+
+
+def count_facets(table, condition, buckets, bucket_params):
+    if len(buckets) == 0:
+        return []
+    conditions, params = condition
+    columns = ", ".join(f"COUNT(CASE WHEN {bucket} THEN 1 END)" for bucket in buckets)
+    where = f" WHERE {' AND '.join(conditions)}" if len(conditions) > 0 else ""
+    row = select_row(f"SELECT {columns} FROM {table}{where}", bucket_params + params, dictionary=False)
+    return list(row)
+
+
+def count_range_facets(table, condition, column, range_condition):
+    buckets = []
+    bucket_params = []
+    for _range in range_condition["ranges"]:
+        bucket = []
+        if _range["min"] != -1:
+            bucket.append(f"{column} >= %s")
+            bucket_params.append(_range["min"])
+        if _range["max"] != -1:
+            bucket.append(f"{column} < %s")
+            bucket_params.append(_range["max"])
+        buckets.append(" AND ".join(bucket) if len(bucket) > 0 else "TRUE")
+    counts = count_facets(table, condition, buckets, bucket_params)
+    return [{"id": _range["id"], "count": count} for _range, count in zip(range_condition["ranges"], counts)]
+
+
+def count_list_facets(table, condition, names, bucket):
+    buckets = []
+    bucket_params = []
+    for name in names:
+        b, params = bucket(name)
+        buckets.append(b)
+        bucket_params.extend(params)
+    counts = count_facets(table, condition, buckets, bucket_params)
+    return [{"name": name, "count": count} for name, count in zip(names, counts)]
+
+
+def column_equal_bucket(column):
+    return lambda name: (f"{column} = %s", [name])
+
+
+# 現在の条件に feature を1つ追加したときの件数を数えるための条件
+# any のときは OR の中に追加する必要があるため、返り値の key の条件を外して features の条件を作り直す
+def feature_facet_bucket(args):
+    if args.get("featureMode") != "any" or not args.get("features"):
+        return "", lambda name: build_feature_condition([name], "all")
+    current = args.get("features").split(",")
+    return "features", lambda name: build_feature_condition(current + [name], "any")
+
+
 @app.route("/api/estate/req_doc/<int:estate_id>", methods=["POST"])
 def post_estate_req_doc(estate_id):
     estate = select_row("SELECT * FROM estate WHERE id = %s", (estate_id,))
     if estate is None:
-        raise NotFound()
+        raise APIError(404, "ESTATE_NOT_FOUND", "estate not found")
     return {"ok": True}
 
 
 @app.route("/api/estate/nazotte", methods=["POST"])
 def post_estate_nazotte():
-    if "coordinates" not in flask.request.json:
-        raise BadRequest()
-    coordinates = flask.request.json["coordinates"]
-    if len(coordinates) == 0:
-        raise BadRequest()
+    body = flask.request.get_json(silent=True)
+    if not isinstance(body, dict):
+        raise APIError(400, "INVALID_REQUEST_BODY", "failed to parse request body")
+    coordinates = body.get("coordinates")
+    if not coordinates:
+        raise APIError(400, "MISSING_COORDINATES", "coordinates are required", "coordinates")
     longitudes = [c["longitude"] for c in coordinates]
     latitudes = [c["latitude"] for c in coordinates]
     bounding_box = {
@@ -354,7 +536,7 @@ def post_estate_nazotte():
 def get_estate(estate_id):
     estate = select_row("SELECT * FROM estate WHERE id = %s", (estate_id,))
     if estate is None:
-        raise NotFound()
+        raise APIError(404, "ESTATE_NOT_FOUND", "estate not found")
     return camelize(estate)
 
 
@@ -362,7 +544,7 @@ def get_estate(estate_id):
 def get_recommended_estate(chair_id):
     chair = select_row("SELECT * FROM chair WHERE id = %s", (chair_id,))
     if chair is None:
-        raise BadRequest(f"Invalid format searchRecommendedEstateWithChair id : {chair_id}")
+        raise APIError(400, "CHAIR_NOT_FOUND", "chair not found", "id")
     w, h, d = chair["width"], chair["height"], chair["depth"]
     query = (
         "SELECT * FROM estate"
@@ -379,10 +561,44 @@ def get_recommended_estate(chair_id):
     return {"estates": camelize(estates)}
 
 
+@app.route("/api/recommended_chair/<int:estate_id>", methods=["GET"])
+def get_recommended_chair(estate_id):
+    max_price = flask.request.args.get("maxPrice")
+    if max_price:
+        try:
+            max_price = int(max_price)
+        except ValueError:
+            raise APIError(400, "INVALID_MAX_PRICE", "maxPrice must be a non-negative integer", "maxPrice")
+        if max_price < 0:
+            raise APIError(400, "INVALID_MAX_PRICE", "maxPrice must be a non-negative integer", "maxPrice")
+    estate = select_row("SELECT * FROM estate WHERE id = %s", (estate_id,))
+    if estate is None:
+        raise APIError(400, "ESTATE_NOT_FOUND", "estate not found", "id")
+    w, h = estate["door_width"], estate["door_height"]
+    query = (
+        "SELECT * FROM chair"
+        " WHERE stock > 0"
+        "   AND ((width <= %s AND height <= %s)"
+        "     OR (width <= %s AND depth <= %s)"
+        "     OR (height <= %s AND width <= %s)"
+        "     OR (height <= %s AND depth <= %s)"
+        "     OR (depth <= %s AND width <= %s)"
+        "     OR (depth <= %s AND height <= %s))"
+    )
+    params = [w, h, w, h, w, h, w, h, w, h, w, h]
+    if max_price:
+        query += " AND price <= %s"
+        params.append(max_price)
+    query += " ORDER BY popularity DESC, id ASC LIMIT %s"
+    params.append(LIMIT)
+    chairs = select_all(query, params)
+    return {"chairs": camelize(chairs)}
+
+
 @app.route("/api/chair", methods=["POST"])
 def post_chair():
     if "chairs" not in flask.request.files:
-        raise BadRequest()
+        raise APIError(400, "MISSING_CSV", "csv file is required", "chairs")
     records = csv.reader(StringIO(flask.request.files["chairs"].read().decode()))
     cnx = cnxpool.connect()
     try:
@@ -403,7 +619,7 @@ def post_chair():
 @app.route("/api/estate", methods=["POST"])
 def post_estate():
     if "estates" not in flask.request.files:
-        raise BadRequest()
+        raise APIError(400, "MISSING_CSV", "csv file is required", "estates")
     records = csv.reader(StringIO(flask.request.files["estates"].read().decode()))
     cnx = cnxpool.connect()
     try:
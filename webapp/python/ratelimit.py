@@ -0,0 +1,82 @@
+import json
+import math
+import re
+import threading
+import time
+
+RATE_LIMIT_KEY_IP = "ip"
+RATE_LIMIT_KEY_USER_AGENT = "user_agent"
+
+# これ以上アクセスのないバケットは破棄する
+BUCKET_IDLE_TIMEOUT = 10 * 60
+
+NUMERIC_PATH_PARAM = re.compile(r"/\d+(?=/|$)")
+
+
+# Go 実装と同じ形式の設定を読み込む。ルートは "POST /api/estate/nazotte" の形式で指定する
+def load_rate_limit_config(config_path):
+    with open(config_path, "r") as f:
+        config = {"key": RATE_LIMIT_KEY_IP, "default": {"rate": 0, "burst": 0}, "routes": {}, **json.load(f)}
+
+    if config["key"] not in (RATE_LIMIT_KEY_IP, RATE_LIMIT_KEY_USER_AGENT):
+        raise ValueError(f"invalid rate limit key: {config['key']}")
+    for budget in [config["default"], *config["routes"].values()]:
+        if budget.get("rate", 0) > 0 and budget.get("burst", 0) < 1:
+            raise ValueError("burst must be greater than 0 when rate is set")
+
+    return config
+
+
+# Go 実装のルートに合わせて、数字のパスパラメータを :id に置き換える
+def route_of(request):
+    return f"{request.method} {NUMERIC_PATH_PARAM.sub('/:id', request.path)}"
+
+
+# echo の RealIP と同じ順でクライアントの IP を決める
+def client_of(request, key):
+    if key == RATE_LIMIT_KEY_USER_AGENT:
+        return request.headers.get("User-Agent", "")
+    forwarded_for = request.headers.get("X-Forwarded-For")
+    if forwarded_for:
+        return forwarded_for.split(", ")[0]
+    return request.headers.get("X-Real-IP", request.remote_addr)
+
+
+class RateLimiter:
+    def __init__(self, config):
+        self.config = config
+        self.buckets = {}
+        self.swept_at = time.time()
+        self.lock = threading.Lock()
+
+    def budget(self, route):
+        return self.config["routes"].get(route, self.config["default"])
+
+    # トークンを1つ消費する。消費できなかった場合は次にトークンが補充されるまでの秒数を返す
+    def take(self, key, budget, now):
+        with self.lock:
+            if now - self.swept_at > BUCKET_IDLE_TIMEOUT:
+                self.buckets = {k: b for k, b in self.buckets.items() if now - b["update_at"] <= BUCKET_IDLE_TIMEOUT}
+                self.swept_at = now
+
+            b = self.buckets.setdefault(key, {"tokens": budget["burst"], "update_at": now})
+            b["tokens"] = min(budget["burst"], b["tokens"] + (now - b["update_at"]) * budget["rate"])
+            b["update_at"] = now
+
+            if b["tokens"] >= 1:
+                b["tokens"] -= 1
+                return True, 0
+
+            return False, (1 - b["tokens"]) / budget["rate"]
+
+    # 制限するリクエストなら Retry-After の秒数を、そうでなければ None を返す
+    def check(self, request, now):
+        route = route_of(request)
+        budget = self.budget(route)
+        if budget.get("rate", 0) <= 0:
+            return None
+
+        ok, wait = self.take(f"{route}\x00{client_of(request, self.config['key'])}", budget, now)
+        if ok:
+            return None
+        return math.ceil(wait)
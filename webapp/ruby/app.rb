@@ -2,12 +2,14 @@ require 'sinatra'
 require 'mysql2'
 require 'mysql2-cs-bind'
 require 'csv'
+require_relative 'ratelimit'
 
 class App < Sinatra::Base
   LIMIT = 20
   NAZOTTE_LIMIT = 50
   CHAIR_SEARCH_CONDITION = JSON.parse(File.read('../fixture/chair_condition.json'), symbolize_names: true)
   ESTATE_SEARCH_CONDITION = JSON.parse(File.read('../fixture/estate_condition.json'), symbolize_names: true)
+  RATE_LIMITER = ENV['RATE_LIMIT_CONFIG'] && RateLimiter.new(RateLimiter.load_config(ENV['RATE_LIMIT_CONFIG']))
 
   configure :development do
     require 'sinatra/reloader'
@@ -96,126 +98,304 @@ class App < Sinatra::Base
       @body_json_params ||= JSON.parse(request.body.tap(&:rewind).read, symbolize_names: true)
     rescue JSON::ParserError => e
       logger.error "Failed to parse body: #{e.inspect}"
-      halt 400
+      halt_error 400, 'INVALID_REQUEST_BODY', 'failed to parse request body'
     end
-  end
 
-  post '/initialize' do
-    sql_dir = Pathname.new('../mysql/db')
-    %w[0_Schema.sql 1_DummyEstateData.sql 2_DummyChairData.sql].each do |sql|
-      sql_path = sql_dir.join(sql)
-      cmd = ['mysql', '-h', db_info[:host], '-u', db_info[:username], "-p#{db_info[:password]}", '-P', db_info[:port], db_info[:database]]
-      IO.popen(cmd, 'w') do |io|
-        io.puts File.read(sql_path)
-        io.close
-      end
+    def halt_error(status, code, message, field = nil)
+      body = { code: code, message: message }
+      body[:field] = field if field
+      halt status, { 'Content-Type' => 'application/json' }, body.to_json
     end
 
-    { language: 'ruby' }.to_json
-  end
+    def feature_condition(features, feature_mode)
+      joiner = feature_mode == 'any' ? ' OR ' : ' AND '
+      ["(#{(['FIND_IN_SET(?, features) > 0'] * features.size).join(joiner)})", features]
+    end
 
-  get '/api/chair/low_priced' do
-    sql = "SELECT * FROM chair WHERE stock > 0 ORDER BY price ASC, id ASC LIMIT #{LIMIT}" # XXX:
-    chairs = db.query(sql).to_a
-    { chairs: chairs }.to_json
-  end
+    def chair_search_condition(q)
+      search_queries = []
+      query_params = []
 
-  get '/api/chair/search' do
-    search_queries = []
-    query_params = []
+      if q[:priceRangeId] && q[:priceRangeId].size > 0
+        chair_price = CHAIR_SEARCH_CONDITION[:price][:ranges][q[:priceRangeId].to_i]
+        unless chair_price
+          logger.error "priceRangeID invalid: #{q[:priceRangeId]}"
+          halt_error 400, 'INVALID_RANGE_ID', 'priceRangeID invalid', 'priceRangeId'
+        end
+
+        if chair_price[:min] != -1
+          search_queries << 'price >= ?'
+          query_params << chair_price[:min]
+        end
 
-    if params[:priceRangeId] && params[:priceRangeId].size > 0
-      chair_price = CHAIR_SEARCH_CONDITION[:price][:ranges][params[:priceRangeId].to_i]
-      unless chair_price
-        logger.error "priceRangeID invalid: #{params[:priceRangeId]}"
-        halt 400
+        if chair_price[:max] != -1
+          search_queries << 'price < ?'
+          query_params << chair_price[:max]
+        end
       end
 
-      if chair_price[:min] != -1
-        search_queries << 'price >= ?'
-        query_params << chair_price[:min]
+      if q[:heightRangeId] && q[:heightRangeId].size > 0
+        chair_height = CHAIR_SEARCH_CONDITION[:height][:ranges][q[:heightRangeId].to_i]
+        unless chair_height
+          logger.error "heightRangeId invalid: #{q[:heightRangeId]}"
+          halt_error 400, 'INVALID_RANGE_ID', 'heightRangeId invalid', 'heightRangeId'
+        end
+
+        if chair_height[:min] != -1
+          search_queries << 'height >= ?'
+          query_params << chair_height[:min]
+        end
+
+        if chair_height[:max] != -1
+          search_queries << 'height < ?'
+          query_params << chair_height[:max]
+        end
       end
 
-      if chair_price[:max] != -1
-        search_queries << 'price < ?'
-        query_params << chair_price[:max]
+      if q[:widthRangeId] && q[:widthRangeId].size > 0
+        chair_width = CHAIR_SEARCH_CONDITION[:width][:ranges][q[:widthRangeId].to_i]
+        unless chair_width
+          logger.error "widthRangeId invalid: #{q[:widthRangeId]}"
+          halt_error 400, 'INVALID_RANGE_ID', 'widthRangeId invalid', 'widthRangeId'
+        end
+
+        if chair_width[:min] != -1
+          search_queries << 'width >= ?'
+          query_params << chair_width[:min]
+        end
+
+        if chair_width[:max] != -1
+          search_queries << 'width < ?'
+          query_params << chair_width[:max]
+        end
       end
-    end
 
-    if params[:heightRangeId] && params[:heightRangeId].size > 0
-      chair_height = CHAIR_SEARCH_CONDITION[:height][:ranges][params[:heightRangeId].to_i]
-      unless chair_height
-        logger.error "heightRangeId invalid: #{params[:heightRangeId]}"
-        halt 400
+      if q[:depthRangeId] && q[:depthRangeId].size > 0
+        chair_depth = CHAIR_SEARCH_CONDITION[:depth][:ranges][q[:depthRangeId].to_i]
+        unless chair_depth
+          logger.error "depthRangeId invalid: #{q[:depthRangeId]}"
+          halt_error 400, 'INVALID_RANGE_ID', 'depthRangeId invalid', 'depthRangeId'
+        end
+
+        if chair_depth[:min] != -1
+          search_queries << 'depth >= ?'
+          query_params << chair_depth[:min]
+        end
+
+        if chair_depth[:max] != -1
+          search_queries << 'depth < ?'
+          query_params << chair_depth[:max]
+        end
       end
 
-      if chair_height[:min] != -1
-        search_queries << 'height >= ?'
-        query_params << chair_height[:min]
+      if q[:kind] && q[:kind].size > 0
+        kinds = q[:kind].split(',')
+        search_queries << "kind IN (#{(['?'] * kinds.size).join(',')})"
+        query_params.concat(kinds)
       end
 
-      if chair_height[:max] != -1
-        search_queries << 'height < ?'
-        query_params << chair_height[:max]
+      if q[:color] && q[:color].size > 0
+        colors = q[:color].split(',')
+        search_queries << "color IN (#{(['?'] * colors.size).join(',')})"
+        query_params.concat(colors)
       end
+
+      if q[:featureMode] && q[:featureMode].size > 0 && !%w[all any].include?(q[:featureMode])
+        logger.error "featureMode invalid: #{q[:featureMode]}"
+        halt_error 400, 'INVALID_FEATURE_MODE', 'featureMode invalid', 'featureMode'
+      end
+
+      if q[:features] && q[:features].size > 0
+        feature_query, feature_params = feature_condition(q[:features].split(','), q[:featureMode])
+        search_queries << feature_query
+        query_params.concat(feature_params)
+      end
+
+      [search_queries, query_params]
     end
 
-    if params[:widthRangeId] && params[:widthRangeId].size > 0
-      chair_width = CHAIR_SEARCH_CONDITION[:width][:ranges][params[:widthRangeId].to_i]
-      unless chair_width
-        logger.error "widthRangeId invalid: #{params[:widthRangeId]}"
-        halt 400
+    def estate_search_condition(q)
+      search_queries = []
+      query_params = []
+
+      if q[:doorHeightRangeId] && q[:doorHeightRangeId].size > 0
+        door_height = ESTATE_SEARCH_CONDITION[:doorHeight][:ranges][q[:doorHeightRangeId].to_i]
+        unless door_height
+          logger.error "doorHeightRangeId invalid: #{q[:doorHeightRangeId]}"
+          halt_error 400, 'INVALID_RANGE_ID', 'doorHeightRangeId invalid', 'doorHeightRangeId'
+        end
+
+        if door_height[:min] != -1
+          search_queries << 'door_height >= ?'
+          query_params << door_height[:min]
+        end
+
+        if door_height[:max] != -1
+          search_queries << 'door_height < ?'
+          query_params << door_height[:max]
+        end
       end
 
-      if chair_width[:min] != -1
-        search_queries << 'width >= ?'
-        query_params << chair_width[:min]
+      if q[:doorWidthRangeId] && q[:doorWidthRangeId].size > 0
+        door_width = ESTATE_SEARCH_CONDITION[:doorWidth][:ranges][q[:doorWidthRangeId].to_i]
+        unless door_width
+          logger.error "doorWidthRangeId invalid: #{q[:doorWidthRangeId]}"
+          halt_error 400, 'INVALID_RANGE_ID', 'doorWidthRangeId invalid', 'doorWidthRangeId'
+        end
+
+        if door_width[:min] != -1
+          search_queries << 'door_width >= ?'
+          query_params << door_width[:min]
+        end
+
+        if door_width[:max] != -1
+          search_queries << 'door_width < ?'
+          query_params << door_width[:max]
+        end
       end
 
-      if chair_width[:max] != -1
-        search_queries << 'width < ?'
-        query_params << chair_width[:max]
+      if q[:rentRangeId] && q[:rentRangeId].size > 0
+        rent = ESTATE_SEARCH_CONDITION[:rent][:ranges][q[:rentRangeId].to_i]
+        unless rent
+          logger.error "rentRangeId invalid: #{q[:rentRangeId]}"
+          halt_error 400, 'INVALID_RANGE_ID', 'rentRangeId invalid', 'rentRangeId'
+        end
+
+        if rent[:min] != -1
+          search_queries << 'rent >= ?'
+          query_params << rent[:min]
+        end
+
+        if rent[:max] != -1
+          search_queries << 'rent < ?'
+          query_params << rent[:max]
+        end
       end
-    end
 
-    if params[:depthRangeId] && params[:depthRangeId].size > 0
-      chair_depth = CHAIR_SEARCH_CONDITION[:depth][:ranges][params[:depthRangeId].to_i]
-      unless chair_depth
-        logger.error "depthRangeId invalid: #{params[:depthRangeId]}"
-        halt 400
+      if q[:featureMode] && q[:featureMode].size > 0 && !%w[all any].include?(q[:featureMode])
+        logger.error "featureMode invalid: #{q[:featureMode]}"
+        halt_error 400, 'INVALID_FEATURE_MODE', 'featureMode invalid', 'featureMode'
       end
 
-      if chair_depth[:min] != -1
-        search_queries << 'depth >= ?'
-        query_params << chair_depth[:min]
+      if q[:features] && q[:features].size > 0
+        feature_query, feature_params = feature_condition(q[:features].split(','), q[:featureMode])
+        search_queries << feature_query
+        query_params.concat(feature_params)
       end
 
-      if chair_depth[:max] != -1
-        search_queries << 'depth < ?'
-        query_params << chair_depth[:max]
+      [search_queries, query_params]
+    end
+
+    def without_key(q, key)
+      q.dup.tap { |h| h.delete(key) }
+    end
+
+    def count_facets(table, condition, buckets, bucket_params)
+      return [] if buckets.empty?
+
+      search_queries, query_params = condition
+      columns = buckets.map.with_index { |bucket, i| "COUNT(CASE WHEN #{bucket} THEN 1 END) AS c#{i}" }
+      where = search_queries.empty? ? '' : " WHERE #{search_queries.join(' AND ')}"
+      row = db.xquery("SELECT #{columns.join(', ')} FROM #{table}#{where}", bucket_params + query_params).first
+      buckets.size.times.map { |i| row[:"c#{i}"] }
+    end
+
+    def count_range_facets(table, condition, column, range_condition)
+      buckets = []
+      bucket_params = []
+      range_condition[:ranges].each do |range|
+        bucket = []
+        if range[:min] != -1
+          bucket << "#{column} >= ?"
+          bucket_params << range[:min]
+        end
+        if range[:max] != -1
+          bucket << "#{column} < ?"
+          bucket_params << range[:max]
+        end
+        buckets << (bucket.empty? ? 'TRUE' : bucket.join(' AND '))
+      end
+      counts = count_facets(table, condition, buckets, bucket_params)
+      range_condition[:ranges].zip(counts).map { |range, count| { id: range[:id], count: count } }
+    end
+
+    def count_list_facets(table, condition, names, bucket)
+      buckets = []
+      bucket_params = []
+      names.each do |name|
+        b, ps = bucket.call(name)
+        buckets << b
+        bucket_params.concat(ps)
       end
+      counts = count_facets(table, condition, buckets, bucket_params)
+      names.zip(counts).map { |name, count| { name: name, count: count } }
+    end
+
+    def column_equal_bucket(column)
+      ->(name) { ["#{column} = ?", [name]] }
     end
 
-    if params[:kind] && params[:kind].size > 0
-      search_queries << 'kind = ?'
-      query_params << params[:kind]
+    # 現在の条件に feature を1つ追加したときの件数を数えるための条件
+    # any のときは OR の中に追加する必要があるため、返り値の key の条件を外して features の条件を作り直す
+    def feature_facet_bucket(q)
+      if q[:featureMode] != 'any' || !q[:features] || q[:features].empty?
+        return ['', ->(name) { feature_condition([name], 'all') }]
+      end
+
+      current = q[:features].split(',')
+      ['features', ->(name) { feature_condition(current + [name], 'any') }]
     end
+  end
 
-    if params[:color] && params[:color].size > 0
-      search_queries << 'color = ?'
-      query_params << params[:color]
+  before do
+    retry_after = RATE_LIMITER&.check(request, Time.now.to_f)
+    if retry_after
+      headers 'Retry-After' => retry_after.to_s
+      halt_error 429, 'RATE_LIMITED', "rate limit exceeded, retry after #{retry_after} seconds"
     end
+  end
 
-    if params[:features] && params[:features].size > 0
-      params[:features].split(',').each do |feature_condition|
-        search_queries << "features LIKE CONCAT('%', ?, '%')"
-        query_params.push(feature_condition)
+  # ハンドラで返していないエラーも Go 実装と同じ形の JSON で返す
+  error Sinatra::NotFound do
+    halt_error 404, 'ROUTE_NOT_FOUND', 'Not Found'
+  end
+
+  error Mysql2::Error do
+    logger.error "Database error: #{env['sinatra.error'].inspect}"
+    halt_error 500, 'DATABASE_ERROR', 'database error'
+  end
+
+  error do
+    logger.error "Unexpected error: #{env['sinatra.error'].inspect}"
+    halt_error 500, 'INTERNAL_SERVER_ERROR', 'Internal Server Error'
+  end
+
+  post '/initialize' do
+    sql_dir = Pathname.new('../mysql/db')
+    %w[0_Schema.sql 1_DummyEstateData.sql 2_DummyChairData.sql].each do |sql|
+      sql_path = sql_dir.join(sql)
+      cmd = ['mysql', '-h', db_info[:host], '-u', db_info[:username], "-p#{db_info[:password]}", '-P', db_info[:port], db_info[:database]]
+      IO.popen(cmd, 'w') do |io|
+        io.puts File.read(sql_path)
+        io.close
       end
     end
 
+    { language: 'ruby' }.to_json
+  end
+
+  get '/api/chair/low_priced' do
+    sql = "SELECT * FROM chair WHERE stock > 0 ORDER BY price ASC, id ASC LIMIT #{LIMIT}" # XXX:
+    chairs = db.query(sql).to_a
+    { chairs: chairs }.to_json
+  end
+
+  get '/api/chair/search' do
+    search_queries, query_params = chair_search_condition(params)
+
     if search_queries.size == 0
       logger.error "Search condition not found"
-      halt 400
+      halt_error 400, 'MISSING_SEARCH_CONDITION', 'at least one search condition is required'
     end
 
     search_queries.push('stock > 0')
@@ -225,7 +405,7 @@ class App < Sinatra::Base
         Integer(params[:page], 10)
       rescue ArgumentError => e
         logger.error "Invalid format page parameter: #{e.inspect}"
-        halt 400
+        halt_error 400, 'INVALID_PAGE', 'page must be an integer', 'page'
       end
 
     per_page =
@@ -233,7 +413,7 @@ class App < Sinatra::Base
         Integer(params[:perPage], 10)
       rescue ArgumentError => e
         logger.error "Invalid format perPage parameter: #{e.inspect}"
-        halt 400
+        halt_error 400, 'INVALID_PER_PAGE', 'perPage must be an integer', 'perPage'
       end
 
     sqlprefix = 'SELECT * FROM chair WHERE '
@@ -253,18 +433,18 @@ class App < Sinatra::Base
         Integer(params[:id], 10)
       rescue ArgumentError => e
         logger.error "Request parameter \"id\" parse error: #{e.inspect}"
-        halt 400
+        halt_error 400, 'INVALID_ID', 'id must be an integer', 'id'
       end
 
     chair = db.xquery('SELECT * FROM chair WHERE id = ?', id).first
     unless chair
       logger.info "Requested id's chair not found: #{id}"
-      halt 404
+      halt_error 404, 'CHAIR_NOT_FOUND', 'chair not found'
     end
 
     if chair[:stock] <= 0
       logger.info "Requested id's chair is sold out: #{id}"
-      halt 404
+      halt_error 404, 'CHAIR_SOLD_OUT', 'chair is sold out'
     end
 
     chair.to_json
@@ -273,7 +453,7 @@ class App < Sinatra::Base
   post '/api/chair' do
     if !params[:chairs] || !params[:chairs].respond_to?(:key) || !params[:chairs].key?(:tempfile)
       logger.error 'Failed to get form file'
-      halt 400
+      halt_error 400, 'MISSING_CSV', 'csv file is required', 'chairs'
     end
 
     transaction('post_api_chair') do
@@ -289,7 +469,7 @@ class App < Sinatra::Base
   post '/api/chair/buy/:id' do
     unless body_json_params[:email]
       logger.error 'post buy chair failed: email not found in request body'
-      halt 400
+      halt_error 400, 'MISSING_EMAIL', 'email is required', 'email'
     end
 
     id =
@@ -297,14 +477,14 @@ class App < Sinatra::Base
         Integer(params[:id], 10)
       rescue ArgumentError => e
         logger.error "post buy chair failed: #{e.inspect}"
-        halt 400
+        halt_error 400, 'INVALID_ID', 'id must be an integer', 'id'
       end
 
     transaction('post_api_chair_buy') do |tx_name|
       chair = db.xquery('SELECT * FROM chair WHERE id = ? AND stock > 0 FOR UPDATE', id).first
       unless chair
         rollback_transaction(tx_name) if in_transaction?(tx_name)
-        halt 404
+        halt_error 404, 'CHAIR_NOT_FOUND', 'chair not found or sold out'
       end
       db.xquery('UPDATE chair SET stock = stock - 1 WHERE id = ?', id)
     end
@@ -316,6 +496,26 @@ class App < Sinatra::Base
     CHAIR_SEARCH_CONDITION.to_json
   end
 
+  get '/api/chair/search/facets' do
+    chair_search_condition(params)
+    without = lambda do |key|
+      search_queries, query_params = chair_search_condition(without_key(params, key))
+      [search_queries + ['stock > 0'], query_params]
+    end
+
+    facets = {}
+    [[:price, 'priceRangeId', 'price'], [:height, 'heightRangeId', 'height'], [:width, 'widthRangeId', 'width'], [:depth, 'depthRangeId', 'depth']].each do |name, key, column|
+      facets[name] = count_range_facets('chair', without.call(key), column, CHAIR_SEARCH_CONDITION[name])
+    end
+    %i[kind color].each do |name|
+      facets[name] = count_list_facets('chair', without.call(name.to_s), CHAIR_SEARCH_CONDITION[name][:list], column_equal_bucket(name))
+    end
+    feature_key, bucket = feature_facet_bucket(params)
+    facets[:feature] = count_list_facets('chair', without.call(feature_key), CHAIR_SEARCH_CONDITION[:feature][:list], bucket)
+
+    facets.to_json
+  end
+
   get '/api/estate/low_priced' do
     sql = "SELECT * FROM estate ORDER BY rent ASC, id ASC LIMIT #{LIMIT}" # XXX:
     estates = db.xquery(sql).to_a
@@ -323,73 +523,11 @@ class App < Sinatra::Base
   end
 
   get '/api/estate/search' do
-    search_queries = []
-    query_params = []
-
-    if params[:doorHeightRangeId] && params[:doorHeightRangeId].size > 0
-      door_height = ESTATE_SEARCH_CONDITION[:doorHeight][:ranges][params[:doorHeightRangeId].to_i]
-      unless door_height
-        logger.error "doorHeightRangeId invalid: #{params[:doorHeightRangeId]}"
-        halt 400
-      end
-
-      if door_height[:min] != -1
-        search_queries << 'door_height >= ?'
-        query_params << door_height[:min]
-      end
-
-      if door_height[:max] != -1
-        search_queries << 'door_height < ?'
-        query_params << door_height[:max]
-      end
-    end
-
-    if params[:doorWidthRangeId] && params[:doorWidthRangeId].size > 0
-      door_width = ESTATE_SEARCH_CONDITION[:doorWidth][:ranges][params[:doorWidthRangeId].to_i]
-      unless door_width
-        logger.error "doorWidthRangeId invalid: #{params[:doorWidthRangeId]}"
-        halt 400
-      end
-
-      if door_width[:min] != -1
-        search_queries << 'door_width >= ?'
-        query_params << door_width[:min]
-      end
-
-      if door_width[:max] != -1
-        search_queries << 'door_width < ?'
-        query_params << door_width[:max]
-      end
-    end
-
-    if params[:rentRangeId] && params[:rentRangeId].size > 0
-      rent = ESTATE_SEARCH_CONDITION[:rent][:ranges][params[:rentRangeId].to_i]
-      unless rent
-        logger.error "rentRangeId invalid: #{params[:rentRangeId]}"
-        halt 400
-      end
-
-      if rent[:min] != -1
-        search_queries << 'rent >= ?'
-        query_params << rent[:min]
-      end
-
-      if rent[:max] != -1
-        search_queries << 'rent < ?'
-        query_params << rent[:max]
-      end
-    end
-
-    if params[:features] && params[:features].size > 0
-      params[:features].split(',').each do |feature_condition|
-        search_queries << "features LIKE CONCAT('%', ?, '%')"
-        query_params.push(feature_condition)
-      end
-    end
+    search_queries, query_params = estate_search_condition(params)
 
     if search_queries.size == 0
       logger.error "Search condition not found"
-      halt 400
+      halt_error 400, 'MISSING_SEARCH_CONDITION', 'at least one search condition is required'
     end
 
     page =
@@ -397,7 +535,7 @@ class App < Sinatra::Base
         Integer(params[:page], 10)
       rescue ArgumentError => e
         logger.error "Invalid format page parameter: #{e.inspect}"
-        halt 400
+        halt_error 400, 'INVALID_PAGE', 'page must be an integer', 'page'
       end
 
     per_page =
@@ -405,7 +543,7 @@ class App < Sinatra::Base
         Integer(params[:perPage], 10)
       rescue ArgumentError => e
         logger.error "Invalid format perPage parameter: #{e.inspect}"
-        halt 400
+        halt_error 400, 'INVALID_PER_PAGE', 'perPage must be an integer', 'perPage'
       end
 
     sqlprefix = 'SELECT * FROM estate WHERE '
@@ -424,12 +562,12 @@ class App < Sinatra::Base
 
     unless coordinates
       logger.error "post search estate nazotte failed: coordinates not found"
-      halt 400
+      halt_error 400, 'MISSING_COORDINATES', 'coordinates are required', 'coordinates'
     end
 
     if !coordinates.is_a?(Array) || coordinates.empty?
       logger.error "post search estate nazotte failed: coordinates are empty"
-      halt 400
+      halt_error 400, 'MISSING_COORDINATES', 'coordinates are required', 'coordinates'
     end
 
     longitudes = coordinates.map { |c| c[:longitude] }
@@ -472,13 +610,13 @@ class App < Sinatra::Base
         Integer(params[:id], 10)
       rescue ArgumentError => e
         logger.error "Request parameter \"id\" parse error: #{e.inspect}"
-        halt 400
+        halt_error 400, 'INVALID_ID', 'id must be an integer', 'id'
       end
 
     estate = db.xquery('SELECT * FROM estate WHERE id = ?', id).first
     unless estate
       logger.info "Requested id's estate not found: #{id}"
-      halt 404
+      halt_error 404, 'ESTATE_NOT_FOUND', 'estate not found'
     end
 
     camelize_keys_for_estate(estate).to_json
@@ -487,7 +625,7 @@ class App < Sinatra::Base
   post '/api/estate' do
     unless params[:estates]
       logger.error 'Failed to get form file'
-      halt 400
+      halt_error 400, 'MISSING_CSV', 'csv file is required', 'estates'
     end
 
     transaction('post_api_estate') do
@@ -503,7 +641,7 @@ class App < Sinatra::Base
   post '/api/estate/req_doc/:id' do
     unless body_json_params[:email]
       logger.error 'post request document failed: email not found in request body'
-      halt 400
+      halt_error 400, 'MISSING_EMAIL', 'email is required', 'email'
     end
 
     id =
@@ -511,13 +649,13 @@ class App < Sinatra::Base
         Integer(params[:id], 10)
       rescue ArgumentError => e
         logger.error "post request document failed: #{e.inspect}"
-        halt 400
+        halt_error 400, 'INVALID_ID', 'id must be an integer', 'id'
       end
 
     estate = db.xquery('SELECT * FROM estate WHERE id = ?', id).first
     unless estate
       logger.error "Requested id's estate not found: #{id}"
-      halt 404
+      halt_error 404, 'ESTATE_NOT_FOUND', 'estate not found'
     end
 
     status 200
@@ -527,19 +665,33 @@ class App < Sinatra::Base
     ESTATE_SEARCH_CONDITION.to_json
   end
 
+  get '/api/estate/search/facets' do
+    estate_search_condition(params)
+    without = ->(key) { estate_search_condition(without_key(params, key)) }
+
+    facets = {}
+    [[:doorHeight, 'doorHeightRangeId', 'door_height'], [:doorWidth, 'doorWidthRangeId', 'door_width'], [:rent, 'rentRangeId', 'rent']].each do |name, key, column|
+      facets[name] = count_range_facets('estate', without.call(key), column, ESTATE_SEARCH_CONDITION[name])
+    end
+    feature_key, bucket = feature_facet_bucket(params)
+    facets[:feature] = count_list_facets('estate', without.call(feature_key), ESTATE_SEARCH_CONDITION[:feature][:list], bucket)
+
+    facets.to_json
+  end
+
   get '/api/recommended_estate/:id' do
     id =
       begin
         Integer(params[:id], 10)
       rescue ArgumentError => e
         logger.error "Request parameter \"id\" parse error: #{e.inspect}"
-        halt 400
+        halt_error 400, 'INVALID_ID', 'id must be an integer', 'id'
       end
 
     chair = db.xquery('SELECT * FROM chair WHERE id = ?', id).first
     unless chair
       logger.error "Requested id's chair not found: #{id}"
-      halt 404
+      halt_error 400, 'CHAIR_NOT_FOUND', 'chair not found', 'id'
     end
 
     w = chair[:width]
@@ -551,4 +703,45 @@ class App < Sinatra::Base
 
     { estates: estates.map { |e| camelize_keys_for_estate(e) } }.to_json
   end
+
+  get '/api/recommended_chair/:id' do
+    id =
+      begin
+        Integer(params[:id], 10)
+      rescue ArgumentError => e
+        logger.error "Request parameter \"id\" parse error: #{e.inspect}"
+        halt_error 400, 'INVALID_ID', 'id must be an integer', 'id'
+      end
+
+    estate = db.xquery('SELECT * FROM estate WHERE id = ?', id).first
+    unless estate
+      logger.error "Requested id's estate not found: #{id}"
+      halt_error 400, 'ESTATE_NOT_FOUND', 'estate not found', 'id'
+    end
+
+    w = estate[:door_width]
+    h = estate[:door_height]
+
+    search_queries = ['stock > 0', '((width <= ? AND height <= ?) OR (width <= ? AND depth <= ?) OR (height <= ? AND width <= ?) OR (height <= ? AND depth <= ?) OR (depth <= ? AND width <= ?) OR (depth <= ? AND height <= ?))']
+    query_params = [w, h, w, h, w, h, w, h, w, h, w, h]
+
+    if params[:maxPrice] && params[:maxPrice].size > 0
+      max_price =
+        begin
+          Integer(params[:maxPrice], 10)
+        rescue ArgumentError => e
+          logger.error "Request parameter \"maxPrice\" parse error: #{e.inspect}"
+          halt_error 400, 'INVALID_MAX_PRICE', 'maxPrice must be a non-negative integer', 'maxPrice'
+        end
+      halt_error 400, 'INVALID_MAX_PRICE', 'maxPrice must be a non-negative integer', 'maxPrice' if max_price < 0
+
+      search_queries << 'price <= ?'
+      query_params << max_price
+    end
+
+    sql = "SELECT * FROM chair WHERE #{search_queries.join(' AND ')} ORDER BY popularity DESC, id ASC LIMIT #{LIMIT}" # XXX:
+    chairs = db.xquery(sql, *query_params).to_a
+
+    { chairs: chairs }.to_json
+  end
 end
@@ -0,0 +1,95 @@
+require 'json'
+require 'tmpdir'
+
+# unicorn のワーカー間でバケットを共有するため、ファイルに保存してロックを取って更新する
+class RateLimiter
+  KEY_IP = 'ip'
+  KEY_USER_AGENT = 'user_agent'
+
+  # これ以上アクセスのないバケットは破棄する
+  BUCKET_IDLE_TIMEOUT = 10 * 60
+
+  STORE_PATH = File.join(Dir.tmpdir, 'isuumo-ratelimit.json')
+
+  # Go 実装と同じ形式の設定を読み込む。ルートは "POST /api/estate/nazotte" の形式で指定する
+  def self.load_config(path)
+    config = { key: KEY_IP, default: { rate: 0, burst: 0 }, routes: {} }
+    config.merge!(JSON.parse(File.read(path), symbolize_names: true))
+
+    unless [KEY_IP, KEY_USER_AGENT].include?(config[:key])
+      raise ArgumentError, "invalid rate limit key: #{config[:key]}"
+    end
+    [config[:default], *config[:routes].values].each do |budget|
+      if budget.fetch(:rate, 0) > 0 && budget.fetch(:burst, 0) < 1
+        raise ArgumentError, 'burst must be greater than 0 when rate is set'
+      end
+    end
+
+    config
+  end
+
+  def initialize(config, store_path = STORE_PATH)
+    @config = config
+    @store_path = store_path
+  end
+
+  def budget(route)
+    @config[:routes].fetch(route.to_sym, @config[:default])
+  end
+
+  # トークンを1つ消費する。消費できなかった場合は次にトークンが補充されるまでの秒数を返す
+  def take(key, budget, now)
+    File.open(@store_path, File::RDWR | File::CREAT, 0644) do |f|
+      f.flock(File::LOCK_EX)
+      store = begin
+        JSON.parse(f.read)
+      rescue JSON::ParserError
+        {}
+      end
+      buckets = store.fetch('buckets', {})
+
+      if now - store.fetch('swept_at', now) > BUCKET_IDLE_TIMEOUT
+        buckets.reject! { |_, b| now - b['update_at'] > BUCKET_IDLE_TIMEOUT }
+        store['swept_at'] = now
+      end
+      store['swept_at'] ||= now
+
+      b = buckets[key] ||= { 'tokens' => budget[:burst], 'update_at' => now }
+      b['tokens'] = [budget[:burst], b['tokens'] + (now - b['update_at']) * budget[:rate]].min
+      b['update_at'] = now
+
+      ok = b['tokens'] >= 1
+      b['tokens'] -= 1 if ok
+
+      store['buckets'] = buckets
+      f.rewind
+      f.write(store.to_json)
+      f.flush
+      f.truncate(f.pos)
+
+      ok ? [true, 0] : [false, (1 - b['tokens']) / budget[:rate]]
+    end
+  end
+
+  # 制限するリクエストなら Retry-After の秒数を、そうでなければ nil を返す
+  def check(request, now)
+    route = "#{request.request_method} #{request.path_info.gsub(%r{/\d+(?=/|$)}, '/:id')}"
+    budget = budget(route)
+    return nil unless budget.fetch(:rate, 0) > 0
+
+    ok, wait = take("#{route}\0#{client_of(request)}", budget, now)
+    ok ? nil : wait.ceil
+  end
+
+  private
+
+  # echo の RealIP と同じ順でクライアントの IP を決める
+  def client_of(request)
+    return request.user_agent.to_s if @config[:key] == KEY_USER_AGENT
+
+    forwarded_for = request.env['HTTP_X_FORWARDED_FOR']
+    return forwarded_for.split(', ').first if forwarded_for && !forwarded_for.empty?
+
+    request.env['HTTP_X_REAL_IP'] || request.env['REMOTE_ADDR']
+  end
+end
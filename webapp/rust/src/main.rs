@@ -1,6 +1,9 @@
 use actix_multipart::Multipart;
+use actix_web::dev::Service;
+use actix_web::error::InternalError;
 use actix_web::{middleware, web, App, Error as AWError, HttpResponse, HttpServer};
 use bytes::BytesMut;
+use futures::future::{self, Either};
 use futures::TryStreamExt;
 use listenfd::ListenFd;
 use mysql::prelude::*;
@@ -9,6 +12,10 @@ use std::env;
 use std::fs::File;
 use std::sync::Arc;
 
+mod ratelimit;
+
+use ratelimit::{load_rate_limit_config, RateLimiter};
+
 type Pool = r2d2::Pool<r2d2_mysql::MysqlConnectionManager>;
 type BlockingDBError = actix_web::error::BlockingError<mysql::Error>;
 
@@ -71,14 +78,55 @@ async fn main() -> std::io::Result<()> {
         .build(manager)
         .expect("Failed to create connection pool");
 
+    // RATE_LIMIT_CONFIG を指定したときだけ Go 実装と同じ設定でリクエストを制限する
+    let rate_limiter = match env::var("RATE_LIMIT_CONFIG") {
+        Ok(path) => Some(Arc::new(RateLimiter::new(load_rate_limit_config(&path)?))),
+        Err(_) => None,
+    };
+
     let mut listenfd = ListenFd::from_env();
     let server = HttpServer::new(move || {
+        let rate_limiter = rate_limiter.clone();
         App::new()
             .data(pool.clone())
             .data(mysql_connection_env.clone())
             .data(chair_search_condition.clone())
             .data(estate_search_condition.clone())
+            .wrap_fn(move |req, srv| {
+                match rate_limiter
+                    .as_ref()
+                    .and_then(|limiter| limiter.check(&req))
+                {
+                    Some(retry_after) => {
+                        let res = HttpResponse::TooManyRequests()
+                            .header("Retry-After", retry_after.to_string())
+                            .json(ErrorResponse::new(
+                                "RATE_LIMITED",
+                                format!("rate limit exceeded, retry after {} seconds", retry_after),
+                            ));
+                        Either::Left(future::ok(req.into_response(res)))
+                    }
+                    None => Either::Right(srv.call(req)),
+                }
+            })
             .wrap(middleware::Logger::default())
+            // 抽出に失敗したときやルートがないときも Go 実装と同じ形の JSON で返す
+            .app_data(web::JsonConfig::default().error_handler(|err, _| {
+                let res = HttpResponse::BadRequest().json(ErrorResponse::new(
+                    "INVALID_REQUEST_BODY",
+                    "failed to parse request body",
+                ));
+                InternalError::from_response(err, res).into()
+            }))
+            .app_data(web::PathConfig::default().error_handler(|err, _| {
+                let res = HttpResponse::BadRequest().json(ErrorResponse::with_field(
+                    "INVALID_ID",
+                    "id must be an integer",
+                    "id",
+                ));
+                InternalError::from_response(err, res).into()
+            }))
+            .default_service(web::route().to(route_not_found))
             .route("/initialize", web::post().to(initialize))
             .service(
                 web::scope("/api")
@@ -90,6 +138,7 @@ async fn main() -> std::io::Result<()> {
                                 "/search/condition",
                                 web::get().to(get_chair_search_condition),
                             )
+                            .route("/search/facets", web::get().to(get_chair_search_facets))
                             .route("/buy/{id}", web::post().to(buy_chair))
                             .route("/{id}", web::get().to(get_chair_detail))
                             .route("", web::post().to(post_chair)),
@@ -107,12 +156,17 @@ async fn main() -> std::io::Result<()> {
                                 "/search/condition",
                                 web::get().to(get_estate_search_condition),
                             )
+                            .route("/search/facets", web::get().to(get_estate_search_facets))
                             .route("/{id}", web::get().to(get_estate_detail))
                             .route("", web::post().to(post_estate)),
                     )
                     .route(
                         "/recommended_estate/{id}",
                         web::get().to(search_recommended_estate_with_chair),
+                    )
+                    .route(
+                        "/recommended_chair/{id}",
+                        web::get().to(search_recommended_chair_with_estate),
                     ),
             )
     });
@@ -169,6 +223,54 @@ struct EstateSearchCondition {
     feature: ListCondition,
 }
 
+#[derive(Debug, Serialize)]
+struct ErrorResponse {
+    code: &'static str,
+    message: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    field: Option<&'static str>,
+}
+
+impl ErrorResponse {
+    fn new(code: &'static str, message: impl Into<String>) -> Self {
+        Self {
+            code,
+            message: message.into(),
+            field: None,
+        }
+    }
+
+    fn with_field(code: &'static str, message: impl Into<String>, field: &'static str) -> Self {
+        Self {
+            field: Some(field),
+            ..Self::new(code, message)
+        }
+    }
+}
+
+fn database_error() -> HttpResponse {
+    HttpResponse::InternalServerError().json(ErrorResponse::new("DATABASE_ERROR", "database error"))
+}
+
+fn initialize_error() -> HttpResponse {
+    HttpResponse::InternalServerError().json(ErrorResponse::new(
+        "INITIALIZE_FAILED",
+        "failed to initialize database",
+    ))
+}
+
+fn missing_email() -> HttpResponse {
+    HttpResponse::BadRequest().json(ErrorResponse::with_field(
+        "MISSING_EMAIL",
+        "email is required",
+        "email",
+    ))
+}
+
+async fn route_not_found() -> HttpResponse {
+    HttpResponse::NotFound().json(ErrorResponse::new("ROUTE_NOT_FOUND", "Not Found"))
+}
+
 #[derive(Debug, Serialize)]
 struct InitializeResponse {
     language: String,
@@ -201,11 +303,11 @@ async fn initialize(
             .await
             .map_err(|e| {
                 log::error!("Initialize script {} failed : {:?}", p.display(), e);
-                HttpResponse::InternalServerError()
+                initialize_error()
             })?;
         if !status.success() {
             log::error!("Initialize script {} failed", p.display());
-            return Ok(HttpResponse::InternalServerError().finish());
+            return Ok(initialize_error());
         }
     }
     Ok(HttpResponse::Ok().json(InitializeResponse {
@@ -268,19 +370,20 @@ async fn get_chair_detail(
     .await
     .map_err(|e| {
         log::error!("Failed to get the chair from id : {}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
 
     if let Some(chair) = chair {
         if chair.stock <= 0 {
             log::info!("requested id's chair is sold out : {}", id);
-            Ok(HttpResponse::NotFound().finish())
+            Ok(HttpResponse::NotFound()
+                .json(ErrorResponse::new("CHAIR_SOLD_OUT", "chair is sold out")))
         } else {
             Ok(HttpResponse::Ok().json(chair))
         }
     } else {
         log::info!("requested id's chair not found : {}", id);
-        Ok(HttpResponse::NotFound().finish())
+        Ok(HttpResponse::NotFound().json(ErrorResponse::new("CHAIR_NOT_FOUND", "chair not found")))
     }
 }
 
@@ -338,7 +441,11 @@ async fn post_chair(db: web::Data<Pool>, mut payload: Multipart) -> Result<HttpR
             for record in reader.deserialize() {
                 let chair: CSVChair = record.map_err(|e| {
                     log::error!("failed to read csv: {:?}", e);
-                    HttpResponse::InternalServerError()
+                    HttpResponse::InternalServerError().json(ErrorResponse::with_field(
+                        "CSV_READ_FAILED",
+                        "failed to read csv file",
+                        "chairs",
+                    ))
                 })?;
                 cs.push(chair.into());
             }
@@ -347,7 +454,11 @@ async fn post_chair(db: web::Data<Pool>, mut payload: Multipart) -> Result<HttpR
     }
     if chairs.is_none() {
         log::error!("failed to get from file: no chairs given");
-        return Ok(HttpResponse::BadRequest().finish());
+        return Ok(HttpResponse::BadRequest().json(ErrorResponse::with_field(
+            "MISSING_CSV",
+            "csv file is required",
+            "chairs",
+        )));
     }
     let chairs = chairs.unwrap();
 
@@ -377,12 +488,32 @@ async fn post_chair(db: web::Data<Pool>, mut payload: Multipart) -> Result<HttpR
     })
     .await.map_err(|e: BlockingDBError| {
         log::error!("failed to insert/commit chair: {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
     Ok(HttpResponse::Created().finish())
 }
 
 #[derive(Debug, Deserialize)]
+struct SearchPageParams {
+    #[serde(default)]
+    page: String,
+    #[serde(rename = "perPage", default)]
+    per_page: String,
+}
+
+impl SearchPageParams {
+    fn parse(&self) -> Result<(i64, i64), ErrorResponse> {
+        let page = self.page.parse().map_err(|_| {
+            ErrorResponse::with_field("INVALID_PAGE", "page must be an integer", "page")
+        })?;
+        let per_page = self.per_page.parse().map_err(|_| {
+            ErrorResponse::with_field("INVALID_PER_PAGE", "perPage must be an integer", "perPage")
+        })?;
+        Ok((page, per_page))
+    }
+}
+
+#[derive(Debug, Clone, Deserialize)]
 struct SearchChairsParams {
     #[serde(rename = "priceRangeId", default)]
     price_range_id: String,
@@ -398,9 +529,25 @@ struct SearchChairsParams {
     color: String,
     #[serde(default)]
     features: String,
-    page: i64,
-    #[serde(rename = "perPage")]
-    per_page: i64,
+    #[serde(rename = "featureMode", default)]
+    feature_mode: String,
+}
+
+impl SearchChairsParams {
+    fn without(&self, key: &str) -> Self {
+        let mut params = self.clone();
+        match key {
+            "priceRangeId" => params.price_range_id.clear(),
+            "heightRangeId" => params.height_range_id.clear(),
+            "widthRangeId" => params.width_range_id.clear(),
+            "depthRangeId" => params.depth_range_id.clear(),
+            "kind" => params.kind.clear(),
+            "color" => params.color.clear(),
+            "features" => params.features.clear(),
+            _ => {}
+        }
+        params
+    }
 }
 
 #[derive(Debug, Serialize)]
@@ -409,12 +556,11 @@ struct ChairSearchResponse {
     chairs: Vec<Chair>,
 }
 
-async fn search_chairs(
-    chair_search_condition: web::Data<Arc<ChairSearchCondition>>,
-    db: web::Data<Pool>,
-    query_params: web::Query<SearchChairsParams>,
-) -> Result<HttpResponse, AWError> {
-    let mut conditions = Vec::new();
+fn build_chair_search_condition(
+    chair_search_condition: &ChairSearchCondition,
+    query_params: &SearchChairsParams,
+) -> Result<SearchCondition, ErrorResponse> {
+    let mut conditions: Vec<String> = Vec::new();
     let mut params: Vec<mysql::Value> = Vec::new();
 
     if !query_params.price_range_id.is_empty() {
@@ -422,19 +568,22 @@ async fn search_chairs(
             get_range(&chair_search_condition.price, &query_params.price_range_id)
         {
             if chair_price.min != -1 {
-                conditions.push("price >= ?");
+                conditions.push("price >= ?".to_owned());
                 params.push(chair_price.min.into());
             }
             if chair_price.max != -1 {
-                conditions.push("price < ?");
+                conditions.push("price < ?".to_owned());
                 params.push(chair_price.max.into());
             }
         } else {
-            log::info!(
-                "priceRangeID invalid, {} : Unexpected Range ID",
-                query_params.price_range_id
-            );
-            return Ok(HttpResponse::BadRequest().finish());
+            return Err(ErrorResponse::with_field(
+                "INVALID_RANGE_ID",
+                format!(
+                    "priceRangeID invalid, {} : Unexpected Range ID",
+                    query_params.price_range_id
+                ),
+                "priceRangeId",
+            ));
         }
     }
 
@@ -444,19 +593,22 @@ async fn search_chairs(
             &query_params.height_range_id,
         ) {
             if chair_height.min != -1 {
-                conditions.push("height >= ?");
+                conditions.push("height >= ?".to_owned());
                 params.push(chair_height.min.into());
             }
             if chair_height.max != -1 {
-                conditions.push("height < ?");
+                conditions.push("height < ?".to_owned());
                 params.push(chair_height.max.into());
             }
         } else {
-            log::info!(
-                "heightRangeId invalid, {} : Unexpected Range ID",
-                query_params.height_range_id
-            );
-            return Ok(HttpResponse::BadRequest().finish());
+            return Err(ErrorResponse::with_field(
+                "INVALID_RANGE_ID",
+                format!(
+                    "heightRangeId invalid, {} : Unexpected Range ID",
+                    query_params.height_range_id
+                ),
+                "heightRangeId",
+            ));
         }
     }
 
@@ -465,19 +617,22 @@ async fn search_chairs(
             get_range(&chair_search_condition.width, &query_params.width_range_id)
         {
             if chair_width.min != -1 {
-                conditions.push("width >= ?");
+                conditions.push("width >= ?".to_owned());
                 params.push(chair_width.min.into());
             }
             if chair_width.max != -1 {
-                conditions.push("width < ?");
+                conditions.push("width < ?".to_owned());
                 params.push(chair_width.max.into());
             }
         } else {
-            log::info!(
-                "widthRangeId invalid, {} : Unexpected Range ID",
-                query_params.width_range_id
-            );
-            return Ok(HttpResponse::BadRequest().finish());
+            return Err(ErrorResponse::with_field(
+                "INVALID_RANGE_ID",
+                format!(
+                    "widthRangeId invalid, {} : Unexpected Range ID",
+                    query_params.width_range_id
+                ),
+                "widthRangeId",
+            ));
         }
     }
 
@@ -486,48 +641,95 @@ async fn search_chairs(
             get_range(&chair_search_condition.depth, &query_params.depth_range_id)
         {
             if chair_depth.min != -1 {
-                conditions.push("depth >= ?");
+                conditions.push("depth >= ?".to_owned());
                 params.push(chair_depth.min.into());
             }
             if chair_depth.max != -1 {
-                conditions.push("depth < ?");
+                conditions.push("depth < ?".to_owned());
                 params.push(chair_depth.max.into());
             }
         } else {
-            log::info!(
-                "depthRangeId invalid, {} : Unexpected Range ID",
-                query_params.depth_range_id
-            );
-            return Ok(HttpResponse::BadRequest().finish());
+            return Err(ErrorResponse::with_field(
+                "INVALID_RANGE_ID",
+                format!(
+                    "depthRangeId invalid, {} : Unexpected Range ID",
+                    query_params.depth_range_id
+                ),
+                "depthRangeId",
+            ));
         }
     }
 
     if !query_params.kind.is_empty() {
-        conditions.push("kind = ?");
-        params.push(query_params.kind.clone().into());
+        let kinds: Vec<&str> = query_params.kind.split(',').collect();
+        conditions.push(format!("kind in ({})", vec!["?"; kinds.len()].join(",")));
+        for k in kinds {
+            params.push(k.into());
+        }
     }
 
     if !query_params.color.is_empty() {
-        conditions.push("color = ?");
-        params.push(query_params.color.clone().into());
+        let colors: Vec<&str> = query_params.color.split(',').collect();
+        conditions.push(format!("color in ({})", vec!["?"; colors.len()].join(",")));
+        for c in colors {
+            params.push(c.into());
+        }
     }
 
-    if !query_params.features.is_empty() {
-        for f in query_params.features.split(',') {
-            conditions.push("features like concat('%', ?, '%')");
-            params.push(f.into());
+    match query_params.feature_mode.as_str() {
+        "" | "all" | "any" => {}
+        _ => {
+            return Err(ErrorResponse::with_field(
+                "INVALID_FEATURE_MODE",
+                format!("featureMode invalid, {}", query_params.feature_mode),
+                "featureMode",
+            ));
         }
     }
 
+    if !query_params.features.is_empty() {
+        let features: Vec<&str> = query_params.features.split(',').collect();
+        let (feature_condition, feature_params) =
+            build_feature_condition(&features, &query_params.feature_mode);
+        conditions.push(feature_condition);
+        params.extend(feature_params);
+    }
+
+    Ok((conditions, params))
+}
+
+async fn search_chairs(
+    chair_search_condition: web::Data<Arc<ChairSearchCondition>>,
+    db: web::Data<Pool>,
+    query_params: web::Query<SearchChairsParams>,
+    page_params: web::Query<SearchPageParams>,
+) -> Result<HttpResponse, AWError> {
+    let (mut conditions, mut params) =
+        match build_chair_search_condition(&chair_search_condition, &query_params) {
+            Ok(condition) => condition,
+            Err(e) => {
+                log::info!("{}", e.message);
+                return Ok(HttpResponse::BadRequest().json(e));
+            }
+        };
+
     if conditions.is_empty() {
         log::info!("Search condition not found");
-        return Ok(HttpResponse::BadRequest().finish());
+        return Ok(HttpResponse::BadRequest().json(ErrorResponse::new(
+            "MISSING_SEARCH_CONDITION",
+            "at least one search condition is required",
+        )));
     }
 
-    conditions.push("stock > 0");
+    conditions.push("stock > 0".to_owned());
 
-    let per_page = query_params.per_page;
-    let page = query_params.page;
+    let (page, per_page) = match page_params.parse() {
+        Ok(page) => page,
+        Err(e) => {
+            log::info!("{}", e.message);
+            return Ok(HttpResponse::BadRequest().json(e));
+        }
+    };
 
     let search_condition = conditions.join(" and ");
     let res = web::block(move || {
@@ -552,7 +754,7 @@ async fn search_chairs(
     .await
     .map_err(|e: BlockingDBError| {
         log::error!("searchChairs DB execution error : {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
     Ok(HttpResponse::Ok().json(res))
 }
@@ -567,6 +769,162 @@ fn get_range<'a>(cond: &'a RangeCondition, range_id: &str) -> Option<&'a Range>
     })
 }
 
+fn build_feature_condition(features: &[&str], feature_mode: &str) -> (String, Vec<mysql::Value>) {
+    let joiner = if feature_mode == "any" {
+        " or "
+    } else {
+        " and "
+    };
+    let matches = vec!["find_in_set(?, features) > 0"; features.len()];
+    (
+        format!("({})", matches.join(joiner)),
+        features.iter().map(|&f| f.into()).collect(),
+    )
+}
+
+type SearchCondition = (Vec<String>, Vec<mysql::Value>);
+
+#[derive(Debug, Serialize)]
+struct RangeFacet {
+    id: i64,
+    count: i64,
+}
+
+#[derive(Debug, Serialize)]
+struct ListFacet {
+    name: String,
+    count: i64,
+}
+
+fn count_facets(
+    conn: &mut mysql::Conn,
+    table: &str,
+    condition: &SearchCondition,
+    buckets: &[String],
+    mut bucket_params: Vec<mysql::Value>,
+) -> Result<Vec<i64>, mysql::Error> {
+    if buckets.is_empty() {
+        return Ok(Vec::new());
+    }
+
+    let (conditions, params) = condition;
+    let columns: Vec<String> = buckets
+        .iter()
+        .enumerate()
+        .map(|(i, bucket)| format!("count(case when {} then 1 end) as c{}", bucket, i))
+        .collect();
+    let where_clause = if conditions.is_empty() {
+        String::new()
+    } else {
+        format!(" where {}", conditions.join(" and "))
+    };
+    bucket_params.extend(params.iter().cloned());
+    let row: Option<mysql::Row> = conn.exec_first(
+        format!(
+            "select {} from {}{}",
+            columns.join(", "),
+            table,
+            where_clause
+        ),
+        &bucket_params,
+    )?;
+    Ok((0..buckets.len())
+        .map(|i| row.as_ref().and_then(|r| r.get(i)).unwrap_or(0))
+        .collect())
+}
+
+fn count_range_facets(
+    conn: &mut mysql::Conn,
+    table: &str,
+    condition: &SearchCondition,
+    column: &str,
+    range_condition: &RangeCondition,
+) -> Result<Vec<RangeFacet>, mysql::Error> {
+    let mut buckets = Vec::new();
+    let mut bucket_params: Vec<mysql::Value> = Vec::new();
+    for range in &range_condition.ranges {
+        let mut bucket = Vec::new();
+        if range.min != -1 {
+            bucket.push(format!("{} >= ?", column));
+            bucket_params.push(range.min.into());
+        }
+        if range.max != -1 {
+            bucket.push(format!("{} < ?", column));
+            bucket_params.push(range.max.into());
+        }
+        if bucket.is_empty() {
+            buckets.push("true".to_owned());
+        } else {
+            buckets.push(bucket.join(" and "));
+        }
+    }
+    let counts = count_facets(conn, table, condition, &buckets, bucket_params)?;
+    Ok(range_condition
+        .ranges
+        .iter()
+        .zip(counts)
+        .map(|(range, count)| RangeFacet {
+            id: range.id,
+            count,
+        })
+        .collect())
+}
+
+fn count_list_facets<F: Fn(&str) -> (String, Vec<mysql::Value>)>(
+    conn: &mut mysql::Conn,
+    table: &str,
+    condition: &SearchCondition,
+    list: &[String],
+    bucket: F,
+) -> Result<Vec<ListFacet>, mysql::Error> {
+    let mut buckets = Vec::new();
+    let mut bucket_params = Vec::new();
+    for name in list {
+        let (b, params) = bucket(name);
+        buckets.push(b);
+        bucket_params.extend(params);
+    }
+    let counts = count_facets(conn, table, condition, &buckets, bucket_params)?;
+    Ok(list
+        .iter()
+        .zip(counts)
+        .map(|(name, count)| ListFacet {
+            name: name.clone(),
+            count,
+        })
+        .collect())
+}
+
+fn column_equal_bucket(column: &'static str) -> impl Fn(&str) -> (String, Vec<mysql::Value>) {
+    move |name: &str| (format!("{} = ?", column), vec![name.into()])
+}
+
+// 現在の条件に feature を1つ追加したときの件数を数えるための条件
+// any のときは OR の中に追加する必要があるため、返り値の key の条件を外して features の条件を作り直す
+fn feature_facet_bucket(
+    features: &str,
+    feature_mode: &str,
+) -> (
+    &'static str,
+    Box<dyn Fn(&str) -> (String, Vec<mysql::Value>)>,
+) {
+    if feature_mode != "any" || features.is_empty() {
+        return (
+            "",
+            Box::new(|name: &str| build_feature_condition(&[name], "all")),
+        );
+    }
+    let current: Vec<String> = features.split(',').map(str::to_owned).collect();
+    (
+        "features",
+        Box::new(move |name: &str| {
+            let mut features: Vec<&str> = current.iter().map(String::as_str).collect();
+            features.push(name);
+            build_feature_condition(&features, "any")
+        }),
+    )
+}
+
 #[derive(Debug, Serialize)]
 struct ChairListResponse {
     chairs: Vec<Chair>,
@@ -583,7 +941,7 @@ async fn get_low_priced_chair(db: web::Data<Pool>) -> Result<HttpResponse, AWErr
     .await
     .map_err(|e| {
         log::error!("get_low_priced_chair DB execution error : {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
 
     Ok(HttpResponse::Ok().json(ChairListResponse { chairs }))
@@ -595,16 +953,115 @@ async fn get_chair_search_condition(
     Ok(HttpResponse::Ok().json(chair_search_condition.as_ref().as_ref()))
 }
 
+#[derive(Debug, Serialize)]
+struct ChairSearchFacets {
+    width: Vec<RangeFacet>,
+    height: Vec<RangeFacet>,
+    depth: Vec<RangeFacet>,
+    price: Vec<RangeFacet>,
+    color: Vec<ListFacet>,
+    feature: Vec<ListFacet>,
+    kind: Vec<ListFacet>,
+}
+
+async fn get_chair_search_facets(
+    chair_search_condition: web::Data<Arc<ChairSearchCondition>>,
+    db: web::Data<Pool>,
+    query_params: web::Query<SearchChairsParams>,
+) -> Result<HttpResponse, AWError> {
+    if let Err(e) = build_chair_search_condition(&chair_search_condition, &query_params) {
+        log::info!("{}", e.message);
+        return Ok(HttpResponse::BadRequest().json(e));
+    }
+
+    let query_params = query_params.into_inner();
+    let res = web::block(move || {
+        let without = |key: &str| -> SearchCondition {
+            let (mut conditions, params) =
+                build_chair_search_condition(&chair_search_condition, &query_params.without(key))
+                    .unwrap_or_default();
+            conditions.push("stock > 0".to_owned());
+            (conditions, params)
+        };
+        let (feature_key, feature_bucket) =
+            feature_facet_bucket(&query_params.features, &query_params.feature_mode);
+
+        let mut conn = db.get().expect("Failed to checkout database connection");
+        Ok(ChairSearchFacets {
+            width: count_range_facets(
+                &mut conn,
+                "chair",
+                &without("widthRangeId"),
+                "width",
+                &chair_search_condition.width,
+            )?,
+            height: count_range_facets(
+                &mut conn,
+                "chair",
+                &without("heightRangeId"),
+                "height",
+                &chair_search_condition.height,
+            )?,
+            depth: count_range_facets(
+                &mut conn,
+                "chair",
+                &without("depthRangeId"),
+                "depth",
+                &chair_search_condition.depth,
+            )?,
+            price: count_range_facets(
+                &mut conn,
+                "chair",
+                &without("priceRangeId"),
+                "price",
+                &chair_search_condition.price,
+            )?,
+            color: count_list_facets(
+                &mut conn,
+                "chair",
+                &without("color"),
+                &chair_search_condition.color.list,
+                column_equal_bucket("color"),
+            )?,
+            feature: count_list_facets(
+                &mut conn,
+                "chair",
+                &without(feature_key),
+                &chair_search_condition.feature.list,
+                feature_bucket,
+            )?,
+            kind: count_list_facets(
+                &mut conn,
+                "chair",
+                &without("kind"),
+                &chair_search_condition.kind.list,
+                column_equal_bucket("kind"),
+            )?,
+        })
+    })
+    .await
+    .map_err(|e: BlockingDBError| {
+        log::error!("get_chair_search_facets DB execution error : {:?}", e);
+        database_error()
+    })?;
+    Ok(HttpResponse::Ok().json(res))
+}
+
 #[derive(Debug, Deserialize)]
 struct BuyChairRequest {
+    #[serde(default)]
     email: String,
 }
 
 async fn buy_chair(
     db: web::Data<Pool>,
     path: web::Path<(i64,)>,
-    _params: web::Json<BuyChairRequest>,
+    params: web::Json<BuyChairRequest>,
 ) -> Result<HttpResponse, AWError> {
+    if params.email.is_empty() {
+        log::info!("post buy chair failed : email not found in request body");
+        return Ok(missing_email());
+    }
     let id = path.0;
 
     let found: bool = web::block(move || {
@@ -625,13 +1082,16 @@ async fn buy_chair(
     .await
     .map_err(|e: BlockingDBError| {
         log::error!("buy_chair DB execution error : {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
 
     if found {
         Ok(HttpResponse::Ok().finish())
     } else {
-        Ok(HttpResponse::NotFound().finish())
+        Ok(HttpResponse::NotFound().json(ErrorResponse::new(
+            "CHAIR_NOT_FOUND",
+            "chair not found or sold out",
+        )))
     }
 }
 
@@ -689,13 +1149,14 @@ async fn get_estate_detail(
     .await
     .map_err(|e| {
         log::error!("Database Execution error : {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
 
     if let Some(estate) = estate {
         Ok(HttpResponse::Ok().json(estate))
     } else {
-        Ok(HttpResponse::NotFound().finish())
+        Ok(HttpResponse::NotFound()
+            .json(ErrorResponse::new("ESTATE_NOT_FOUND", "estate not found")))
     }
 }
 
@@ -751,7 +1212,11 @@ async fn post_estate(db: web::Data<Pool>, mut payload: Multipart) -> Result<Http
             for record in reader.deserialize() {
                 let estate: CSVEstate = record.map_err(|e| {
                     log::error!("failed to read csv: {:?}", e);
-                    HttpResponse::InternalServerError()
+                    HttpResponse::InternalServerError().json(ErrorResponse::with_field(
+                        "CSV_READ_FAILED",
+                        "failed to read csv file",
+                        "estates",
+                    ))
                 })?;
                 es.push(estate.into());
             }
@@ -760,7 +1225,11 @@ async fn post_estate(db: web::Data<Pool>, mut payload: Multipart) -> Result<Http
     }
     if estates.is_none() {
         log::error!("failed to get from file: no estates given");
-        return Ok(HttpResponse::BadRequest().finish());
+        return Ok(HttpResponse::BadRequest().json(ErrorResponse::with_field(
+            "MISSING_CSV",
+            "csv file is required",
+            "estates",
+        )));
     }
     let estates = estates.unwrap();
 
@@ -775,13 +1244,13 @@ async fn post_estate(db: web::Data<Pool>, mut payload: Multipart) -> Result<Http
     }).await.map_err(
         |e: BlockingDBError| {
             log::error!("failed to insert/commit estate: {:?}", e);
-            HttpResponse::InternalServerError()
+            database_error()
         },
     )?;
     Ok(HttpResponse::Created().finish())
 }
 
-#[derive(Debug, Deserialize)]
+#[derive(Debug, Clone, Deserialize)]
 struct SearchEstatesParams {
     #[serde(rename = "doorHeightRangeId", default)]
     door_height_range_id: String,
@@ -791,9 +1260,22 @@ struct SearchEstatesParams {
     rent_range_id: String,
     #[serde(default)]
     features: String,
-    page: i64,
-    #[serde(rename = "perPage")]
-    per_page: i64,
+    #[serde(rename = "featureMode", default)]
+    feature_mode: String,
+}
+
+impl SearchEstatesParams {
+    fn without(&self, key: &str) -> Self {
+        let mut params = self.clone();
+        match key {
+            "doorHeightRangeId" => params.door_height_range_id.clear(),
+            "doorWidthRangeId" => params.door_width_range_id.clear(),
+            "rentRangeId" => params.rent_range_id.clear(),
+            "features" => params.features.clear(),
+            _ => {}
+        }
+        params
+    }
 }
 
 #[derive(Debug, Serialize)]
@@ -802,12 +1284,11 @@ struct EstateSearchResponse {
     estates: Vec<Estate>,
 }
 
-async fn search_estates(
-    estate_search_condition: web::Data<Arc<EstateSearchCondition>>,
-    db: web::Data<Pool>,
-    query_params: web::Query<SearchEstatesParams>,
-) -> Result<HttpResponse, AWError> {
-    let mut conditions = Vec::new();
+fn build_estate_search_condition(
+    estate_search_condition: &EstateSearchCondition,
+    query_params: &SearchEstatesParams,
+) -> Result<SearchCondition, ErrorResponse> {
+    let mut conditions: Vec<String> = Vec::new();
     let mut params: Vec<mysql::Value> = Vec::new();
 
     if !query_params.door_height_range_id.is_empty() {
@@ -816,19 +1297,22 @@ async fn search_estates(
             &query_params.door_height_range_id,
         ) {
             if door_height.min != -1 {
-                conditions.push("door_height >= ?");
+                conditions.push("door_height >= ?".to_owned());
                 params.push(door_height.min.into());
             }
             if door_height.max != -1 {
-                conditions.push("door_height < ?");
+                conditions.push("door_height < ?".to_owned());
                 params.push(door_height.max.into());
             }
         } else {
-            log::info!(
-                "doorHeightRangeID invalid, {} : Unexpected Range ID",
-                query_params.door_height_range_id
-            );
-            return Ok(HttpResponse::BadRequest().finish());
+            return Err(ErrorResponse::with_field(
+                "INVALID_RANGE_ID",
+                format!(
+                    "doorHeightRangeID invalid, {} : Unexpected Range ID",
+                    query_params.door_height_range_id
+                ),
+                "doorHeightRangeId",
+            ));
         }
     }
 
@@ -838,19 +1322,22 @@ async fn search_estates(
             &query_params.door_width_range_id,
         ) {
             if door_width.min != -1 {
-                conditions.push("door_width >= ?");
+                conditions.push("door_width >= ?".to_owned());
                 params.push(door_width.min.into());
             }
             if door_width.max != -1 {
-                conditions.push("door_width < ?");
+                conditions.push("door_width < ?".to_owned());
                 params.push(door_width.max.into());
             }
         } else {
-            log::info!(
-                "doorWidthRangeID invalid, {} : Unexpected Range ID",
-                query_params.door_width_range_id
-            );
-            return Ok(HttpResponse::BadRequest().finish());
+            return Err(ErrorResponse::with_field(
+                "INVALID_RANGE_ID",
+                format!(
+                    "doorWidthRangeID invalid, {} : Unexpected Range ID",
+                    query_params.door_width_range_id
+                ),
+                "doorWidthRangeId",
+            ));
         }
     }
 
@@ -859,36 +1346,77 @@ async fn search_estates(
             get_range(&estate_search_condition.rent, &query_params.rent_range_id)
         {
             if estate_rent.min != -1 {
-                conditions.push("rent >= ?");
+                conditions.push("rent >= ?".to_owned());
                 params.push(estate_rent.min.into());
             }
             if estate_rent.max != -1 {
-                conditions.push("rent < ?");
+                conditions.push("rent < ?".to_owned());
                 params.push(estate_rent.max.into());
             }
         } else {
-            log::info!(
-                "rentRangeID invalid, {} : Unexpected Range ID",
-                query_params.rent_range_id
-            );
-            return Ok(HttpResponse::BadRequest().finish());
+            return Err(ErrorResponse::with_field(
+                "INVALID_RANGE_ID",
+                format!(
+                    "rentRangeID invalid, {} : Unexpected Range ID",
+                    query_params.rent_range_id
+                ),
+                "rentRangeId",
+            ));
         }
     }
 
-    if !query_params.features.is_empty() {
-        for f in query_params.features.split(',') {
-            conditions.push("features like concat('%', ?, '%')");
-            params.push(f.into());
+    match query_params.feature_mode.as_str() {
+        "" | "all" | "any" => {}
+        _ => {
+            return Err(ErrorResponse::with_field(
+                "INVALID_FEATURE_MODE",
+                format!("featureMode invalid, {}", query_params.feature_mode),
+                "featureMode",
+            ));
         }
     }
 
+    if !query_params.features.is_empty() {
+        let features: Vec<&str> = query_params.features.split(',').collect();
+        let (feature_condition, feature_params) =
+            build_feature_condition(&features, &query_params.feature_mode);
+        conditions.push(feature_condition);
+        params.extend(feature_params);
+    }
+
+    Ok((conditions, params))
+}
+
+async fn search_estates(
+    estate_search_condition: web::Data<Arc<EstateSearchCondition>>,
+    db: web::Data<Pool>,
+    query_params: web::Query<SearchEstatesParams>,
+    page_params: web::Query<SearchPageParams>,
+) -> Result<HttpResponse, AWError> {
+    let (mut conditions, mut params) =
+        match build_estate_search_condition(&estate_search_condition, &query_params) {
+            Ok(condition) => condition,
+            Err(e) => {
+                log::info!("{}", e.message);
+                return Ok(HttpResponse::BadRequest().json(e));
+            }
+        };
+
     if conditions.is_empty() {
         log::info!("search_estates search condition not found");
-        return Ok(HttpResponse::BadRequest().finish());
+        return Ok(HttpResponse::BadRequest().json(ErrorResponse::new(
+            "MISSING_SEARCH_CONDITION",
+            "at least one search condition is required",
+        )));
     }
 
-    let per_page = query_params.per_page;
-    let page = query_params.page;
+    let (page, per_page) = match page_params.parse() {
+        Ok(page) => page,
+        Err(e) => {
+            log::info!("{}", e.message);
+            return Ok(HttpResponse::BadRequest().json(e));
+        }
+    };
 
     let search_condition = conditions.join(" and ");
     let res = web::block(move || {
@@ -913,7 +1441,7 @@ async fn search_estates(
     .await
     .map_err(|e: BlockingDBError| {
         log::error!("search_estates DB execution error : {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
     Ok(HttpResponse::Ok().json(res))
 }
@@ -934,7 +1462,7 @@ async fn get_low_priced_estate(db: web::Data<Pool>) -> Result<HttpResponse, AWEr
     .await
     .map_err(|e| {
         log::error!("get_low_priced_estate DB execution error : {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
 
     Ok(HttpResponse::Ok().json(EstateListResponse { estates }))
@@ -946,6 +1474,75 @@ async fn get_estate_search_condition(
     Ok(HttpResponse::Ok().json(estate_search_condition.as_ref().as_ref()))
 }
 
+#[derive(Debug, Serialize)]
+struct EstateSearchFacets {
+    #[serde(rename = "doorWidth")]
+    door_width: Vec<RangeFacet>,
+    #[serde(rename = "doorHeight")]
+    door_height: Vec<RangeFacet>,
+    rent: Vec<RangeFacet>,
+    feature: Vec<ListFacet>,
+}
+
+async fn get_estate_search_facets(
+    estate_search_condition: web::Data<Arc<EstateSearchCondition>>,
+    db: web::Data<Pool>,
+    query_params: web::Query<SearchEstatesParams>,
+) -> Result<HttpResponse, AWError> {
+    if let Err(e) = build_estate_search_condition(&estate_search_condition, &query_params) {
+        log::info!("{}", e.message);
+        return Ok(HttpResponse::BadRequest().json(e));
+    }
+
+    let query_params = query_params.into_inner();
+    let res = web::block(move || {
+        let without = |key: &str| -> SearchCondition {
+            build_estate_search_condition(&estate_search_condition, &query_params.without(key))
+                .unwrap_or_default()
+        };
+        let (feature_key, feature_bucket) =
+            feature_facet_bucket(&query_params.features, &query_params.feature_mode);
+
+        let mut conn = db.get().expect("Failed to checkout database connection");
+        Ok(EstateSearchFacets {
+            door_width: count_range_facets(
+                &mut conn,
+                "estate",
+                &without("doorWidthRangeId"),
+                "door_width",
+                &estate_search_condition.door_width,
+            )?,
+            door_height: count_range_facets(
+                &mut conn,
+                "estate",
+                &without("doorHeightRangeId"),
+                "door_height",
+                &estate_search_condition.door_height,
+            )?,
+            rent: count_range_facets(
+                &mut conn,
+                "estate",
+                &without("rentRangeId"),
+                "rent",
+                &estate_search_condition.rent,
+            )?,
+            feature: count_list_facets(
+                &mut conn,
+                "estate",
+                &without(feature_key),
+                &estate_search_condition.feature.list,
+                feature_bucket,
+            )?,
+        })
+    })
+    .await
+    .map_err(|e: BlockingDBError| {
+        log::error!("get_estate_search_facets DB execution error : {:?}", e);
+        database_error()
+    })?;
+    Ok(HttpResponse::Ok().json(res))
+}
+
 async fn search_recommended_estate_with_chair(
     db: web::Data<Pool>,
     path: web::Path<(i64,)>,
@@ -983,19 +1580,108 @@ async fn search_recommended_estate_with_chair(
     .await
     .map_err(|e: BlockingDBError| {
         log::error!("Database execution error : {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
 
     if let Some(estates) = estates {
         Ok(HttpResponse::Ok().json(EstateListResponse { estates }))
     } else {
         log::info!("Requested chair id \"{}\" not found", id);
-        Ok(HttpResponse::BadRequest().finish())
+        Ok(HttpResponse::BadRequest().json(ErrorResponse::with_field(
+            "CHAIR_NOT_FOUND",
+            "chair not found",
+            "id",
+        )))
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct SearchRecommendedChairParams {
+    #[serde(rename = "maxPrice", default)]
+    max_price: String,
+}
+
+async fn search_recommended_chair_with_estate(
+    db: web::Data<Pool>,
+    path: web::Path<(i64,)>,
+    query_params: web::Query<SearchRecommendedChairParams>,
+) -> Result<HttpResponse, AWError> {
+    let id = path.0;
+
+    let max_price: Option<i64> = if query_params.max_price.is_empty() {
+        None
+    } else if let Some(max_price) = query_params
+        .max_price
+        .parse::<i64>()
+        .ok()
+        .filter(|p| *p >= 0)
+    {
+        Some(max_price)
+    } else {
+        log::info!(
+            "Invalid format maxPrice parameter : {}",
+            query_params.max_price
+        );
+        return Ok(HttpResponse::BadRequest().json(ErrorResponse::with_field(
+            "INVALID_MAX_PRICE",
+            "maxPrice must be a non-negative integer",
+            "maxPrice",
+        )));
+    };
+
+    let chairs = web::block(move || {
+        let mut conn = db.get().expect("Failed to checkout database connection");
+        let estate: Option<Estate> = conn.exec_first("select * from estate where id = ?", (id,))?;
+        if let Some(estate) = estate {
+            let w = estate.door_width;
+            let h = estate.door_height;
+            let mut query = "select * from chair where stock > 0 and ((width <= ? and height <= ?) or (width <= ? and depth <= ?) or (height <= ? and width <= ?) or (height <= ? and depth <= ?) or (depth <= ? and width <= ?) or (depth <= ? and height <= ?))".to_owned();
+            let mut params: Vec<mysql::Value> = vec![
+                w.into(),
+                h.into(),
+                w.into(),
+                h.into(),
+                w.into(),
+                h.into(),
+                w.into(),
+                h.into(),
+                w.into(),
+                h.into(),
+                w.into(),
+                h.into(),
+            ];
+            if let Some(max_price) = max_price {
+                query.push_str(" and price <= ?");
+                params.push(max_price.into());
+            }
+            query.push_str(" order by popularity desc, id asc limit ?");
+            params.push(LIMIT.into());
+            Ok(Some(conn.exec(query, params)?))
+        } else {
+            Ok(None)
+        }
+    })
+    .await
+    .map_err(|e: BlockingDBError| {
+        log::error!("Database execution error : {:?}", e);
+        database_error()
+    })?;
+
+    if let Some(chairs) = chairs {
+        Ok(HttpResponse::Ok().json(ChairListResponse { chairs }))
+    } else {
+        log::info!("Requested estate id \"{}\" not found", id);
+        Ok(HttpResponse::BadRequest().json(ErrorResponse::with_field(
+            "ESTATE_NOT_FOUND",
+            "estate not found",
+            "id",
+        )))
     }
 }
 
 #[derive(Debug, Deserialize)]
 struct Coordinates {
+    #[serde(default)]
     coordinates: Vec<Coordinate>,
 }
 
@@ -1054,7 +1740,11 @@ async fn search_estate_nazotte(
     coordinates: web::Json<Coordinates>,
 ) -> Result<HttpResponse, AWError> {
     if coordinates.coordinates.is_empty() {
-        return Ok(HttpResponse::BadRequest().finish());
+        return Ok(HttpResponse::BadRequest().json(ErrorResponse::with_field(
+            "MISSING_COORDINATES",
+            "coordinates are required",
+            "coordinates",
+        )));
     }
     let bounding_box = coordinates.get_bounding_box();
 
@@ -1079,7 +1769,7 @@ async fn search_estate_nazotte(
     .await
     .map_err(|e: BlockingDBError| {
         log::error!("Database execution error : {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
 
     estates.truncate(NAZOTTE_LIMIT);
@@ -1091,14 +1781,19 @@ async fn search_estate_nazotte(
 
 #[derive(Debug, Deserialize)]
 struct PostEstateRequestDocumentParams {
+    #[serde(default)]
     email: String,
 }
 
 async fn post_estate_request_document(
     db: web::Data<Pool>,
     path: web::Path<(i64,)>,
-    _params: web::Json<PostEstateRequestDocumentParams>,
+    params: web::Json<PostEstateRequestDocumentParams>,
 ) -> Result<HttpResponse, AWError> {
+    if params.email.is_empty() {
+        log::info!("post request document failed : email not found in request body");
+        return Ok(missing_email());
+    }
     let id = path.0;
 
     let estate: Option<Estate> = web::block(move || {
@@ -1108,12 +1803,13 @@ async fn post_estate_request_document(
     .await
     .map_err(|e| {
         log::error!("post_estate_request_document: DB execution error : {:?}", e);
-        HttpResponse::InternalServerError()
+        database_error()
     })?;
 
     if estate.is_some() {
         Ok(HttpResponse::Ok().finish())
     } else {
-        Ok(HttpResponse::NotFound().finish())
+        Ok(HttpResponse::NotFound()
+            .json(ErrorResponse::new("ESTATE_NOT_FOUND", "estate not found")))
     }
 }
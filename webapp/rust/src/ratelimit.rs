@@ -0,0 +1,168 @@
+use actix_web::dev::ServiceRequest;
+use serde::Deserialize;
+use std::collections::HashMap;
+use std::fs::File;
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+
+const RATE_LIMIT_KEY_IP: &str = "ip";
+const RATE_LIMIT_KEY_USER_AGENT: &str = "user_agent";
+
+// これ以上アクセスのないバケットは破棄する
+const BUCKET_IDLE_TIMEOUT: Duration = Duration::from_secs(10 * 60);
+
+// トークンバケットの設定。rate が 0 以下なら制限しない
+#[derive(Debug, Default, Clone, Copy, Deserialize)]
+pub struct RateLimitBudget {
+    #[serde(default)]
+    rate: f64,
+    #[serde(default)]
+    burst: i64,
+}
+
+// Go 実装と同じ形式の設定。ルートは "POST /api/estate/nazotte" の形式で指定する
+#[derive(Debug, Deserialize)]
+pub struct RateLimitConfig {
+    #[serde(default = "default_key")]
+    key: String,
+    #[serde(default)]
+    default: RateLimitBudget,
+    #[serde(default)]
+    routes: HashMap<String, RateLimitBudget>,
+}
+
+fn default_key() -> String {
+    RATE_LIMIT_KEY_IP.to_owned()
+}
+
+pub fn load_rate_limit_config(path: &str) -> std::io::Result<RateLimitConfig> {
+    let config: RateLimitConfig = serde_json::from_reader(File::open(path)?)?;
+
+    let invalid = |message: String| std::io::Error::new(std::io::ErrorKind::InvalidData, message);
+    if config.key != RATE_LIMIT_KEY_IP && config.key != RATE_LIMIT_KEY_USER_AGENT {
+        return Err(invalid(format!("invalid rate limit key: {}", config.key)));
+    }
+    for budget in std::iter::once(&config.default).chain(config.routes.values()) {
+        if budget.rate > 0.0 && budget.burst < 1 {
+            return Err(invalid(
+                "burst must be greater than 0 when rate is set".to_owned(),
+            ));
+        }
+    }
+
+    Ok(config)
+}
+
+struct TokenBucket {
+    tokens: f64,
+    update_at: Instant,
+}
+
+struct Buckets {
+    buckets: HashMap<String, TokenBucket>,
+    swept_at: Instant,
+}
+
+pub struct RateLimiter {
+    config: RateLimitConfig,
+    buckets: Mutex<Buckets>,
+}
+
+impl RateLimiter {
+    pub fn new(config: RateLimitConfig) -> Self {
+        Self {
+            config,
+            buckets: Mutex::new(Buckets {
+                buckets: HashMap::new(),
+                swept_at: Instant::now(),
+            }),
+        }
+    }
+
+    fn budget(&self, route: &str) -> RateLimitBudget {
+        *self
+            .config
+            .routes
+            .get(route)
+            .unwrap_or(&self.config.default)
+    }
+
+    // トークンを1つ消費する。消費できなかった場合は次にトークンが補充されるまでの時間を返す
+    fn take(&self, key: String, budget: RateLimitBudget, now: Instant) -> Result<(), Duration> {
+        let mut guard = self.buckets.lock().unwrap();
+        let state = &mut *guard;
+        if now.duration_since(state.swept_at) > BUCKET_IDLE_TIMEOUT {
+            state
+                .buckets
+                .retain(|_, b| now.duration_since(b.update_at) <= BUCKET_IDLE_TIMEOUT);
+            state.swept_at = now;
+        }
+
+        let burst = budget.burst as f64;
+        let b = state.buckets.entry(key).or_insert(TokenBucket {
+            tokens: burst,
+            update_at: now,
+        });
+        let elapsed = now.duration_since(b.update_at).as_secs_f64();
+        b.tokens = burst.min(b.tokens + elapsed * budget.rate);
+        b.update_at = now;
+
+        if b.tokens >= 1.0 {
+            b.tokens -= 1.0;
+            return Ok(());
+        }
+
+        Err(Duration::from_secs_f64((1.0 - b.tokens) / budget.rate))
+    }
+
+    // 制限するリクエストなら Retry-After の秒数を返す
+    pub fn check(&self, req: &ServiceRequest) -> Option<u64> {
+        let route = format!("{} {}", req.method(), route_path(req.path()));
+        let budget = self.budget(&route);
+        if budget.rate <= 0.0 {
+            return None;
+        }
+
+        let key = format!("{}\x00{}", route, self.client_of(req));
+        self.take(key, budget, Instant::now())
+            .err()
+            .map(|wait| wait.as_secs_f64().ceil() as u64)
+    }
+
+    // echo の RealIP と同じ順でクライアントの IP を決める
+    fn client_of(&self, req: &ServiceRequest) -> String {
+        let header = |name: &str| {
+            req.headers()
+                .get(name)
+                .and_then(|v| v.to_str().ok())
+                .map(|v| v.to_owned())
+        };
+        if self.config.key == RATE_LIMIT_KEY_USER_AGENT {
+            return header("User-Agent").unwrap_or_default();
+        }
+        if let Some(forwarded_for) = header("X-Forwarded-For").filter(|v| !v.is_empty()) {
+            return forwarded_for
+                .split(", ")
+                .next()
+                .unwrap_or_default()
+                .to_owned();
+        }
+        header("X-Real-IP")
+            .or_else(|| req.peer_addr().map(|addr| addr.ip().to_string()))
+            .unwrap_or_default()
+    }
+}
+
+// Go 実装のルートに合わせて、数字のパスパラメータを :id に置き換える
+fn route_path(path: &str) -> String {
+    path.split('/')
+        .map(|segment| {
+            if !segment.is_empty() && segment.bytes().all(|c| c.is_ascii_digit()) {
+                ":id"
+            } else {
+                segment
+            }
+        })
+        .collect::<Vec<_>>()
+        .join("/")
+}